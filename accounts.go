@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// accountAudit is one user, service account or STS key. MinIO does not
+// record when accounts were created, Updated is the last change of a user.
+type accountAudit struct {
+	Type       string
+	AccessKey  string
+	Name       string     `json:",omitempty"`
+	Parent     string     `json:",omitempty"`
+	Status     string     `json:",omitempty"`
+	Policies   []string   `json:",omitempty"`
+	Groups     []string   `json:",omitempty"`
+	Updated    time.Time  `json:",omitempty"`
+	Expiration *time.Time `json:",omitempty"`
+	Findings   []string   `json:",omitempty"`
+}
+
+// iamPolicies returns every canned policy by name. Policies that do not
+// parse are left out, 'policy lint' reports them.
+func iamPolicies(ctx context.Context) (map[string]policyDocument, error) {
+	raw, err := mclient.ListCannedPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]policyDocument, len(raw))
+	for name, b := range raw {
+		if p, err := parsePolicy(b); err == nil {
+			docs[name] = p
+		}
+	}
+	return docs, nil
+}
+
+func splitPolicies(names string) (out []string) {
+	for _, n := range strings.Split(names, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			out = append(out, n)
+		}
+	}
+	return
+}
+
+// policyFindings flags the policies that grant admin or full S3 access.
+func policyFindings(docs []policyDocument) (findings []string) {
+	admin, all := false, false
+	for _, d := range docs {
+		admin = admin || d.grantsAdmin()
+		all = all || d.grantsAllBuckets()
+	}
+	if admin {
+		findings = append(findings, "admin-equivalent")
+	} else if all {
+		findings = append(findings, "full access to every bucket")
+	}
+	return
+}
+
+// auditAccounts lists the users of the cluster and the service accounts and
+// STS keys that belong to them or to the root user.
+func auditAccounts() (accounts []accountAudit, err error) {
+	ctx := context.Background()
+	err = makeClient()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := iamPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing policies: %w", err)
+	}
+	users, err := mclient.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+
+	groupPolicies := make(map[string][]string)
+	effective := make(map[string][]string)
+	for _, name := range stringKeysSorted(users) {
+		u := users[name]
+		a := accountAudit{
+			Type:      "user",
+			AccessKey: name,
+			Status:    string(u.Status),
+			Policies:  splitPolicies(u.PolicyName),
+			Groups:    u.MemberOf,
+			Updated:   u.UpdatedAt,
+		}
+		all := slices.Clone(a.Policies)
+		for _, g := range u.MemberOf {
+			if _, ok := groupPolicies[g]; !ok {
+				desc, gerr := mclient.GetGroupDescription(ctx, g)
+				if gerr != nil {
+					fmt.Fprintln(statusOut(), "Unable to read group", g+":", gerr)
+				}
+				if desc != nil {
+					groupPolicies[g] = splitPolicies(desc.Policy)
+				}
+			}
+			all = append(all, groupPolicies[g]...)
+		}
+		effective[name] = all
+		a.Findings = policyFindings(docsOf(policies, all))
+		accounts = append(accounts, a)
+	}
+
+	owners := append(stringKeysSorted(users), miniokey)
+	keys, err := mclient.ListAccessKeysBulk(ctx, nil, madmin.ListAccessKeysOpts{ListType: madmin.AccessKeyListAll, All: true})
+	if err != nil {
+		// Servers before the bulk API only list service accounts per user.
+		fmt.Fprintln(statusOut(), "Listing access keys in bulk failed, listing them per user:", err)
+		keys = make(map[string]madmin.ListAccessKeysResp)
+		for _, owner := range owners {
+			resp, lerr := mclient.ListServiceAccounts(ctx, owner)
+			if lerr != nil {
+				fmt.Fprintln(statusOut(), "Unable to list the service accounts of", owner+":", lerr)
+				continue
+			}
+			keys[owner] = madmin.ListAccessKeysResp{ServiceAccounts: resp.Accounts}
+		}
+	}
+
+	for _, owner := range stringKeysSorted(keys) {
+		resp := keys[owner]
+		for _, typ := range []struct {
+			name     string
+			accounts []madmin.ServiceAccountInfo
+		}{{"service-account", resp.ServiceAccounts}, {"sts", resp.STSKeys}} {
+			for _, sa := range typ.accounts {
+				accounts = append(accounts, auditAccessKey(ctx, typ.name, owner, sa, policies, effective))
+			}
+		}
+	}
+	return accounts, nil
+}
+
+func docsOf(policies map[string]policyDocument, names []string) (docs []policyDocument) {
+	for _, n := range names {
+		if d, ok := policies[n]; ok {
+			docs = append(docs, d)
+		}
+	}
+	return
+}
+
+// auditAccessKey describes a service account or STS key. Keys with an
+// implied policy have the policies of their parent, the root user's keys
+// have every permission.
+func auditAccessKey(ctx context.Context, typ, owner string, sa madmin.ServiceAccountInfo, policies map[string]policyDocument, effective map[string][]string) accountAudit {
+	parent := sa.ParentUser
+	if parent == "" {
+		parent = owner
+	}
+	a := accountAudit{
+		Type:       typ,
+		AccessKey:  sa.AccessKey,
+		Name:       sa.Name,
+		Parent:     parent,
+		Status:     sa.AccountStatus,
+		Expiration: sa.Expiration,
+	}
+	if a.Expiration != nil && a.Expiration.IsZero() {
+		a.Expiration = nil
+	}
+
+	implied := sa.ImpliedPolicy
+	var inline []policyDocument
+	info, err := mclient.InfoServiceAccount(ctx, sa.AccessKey)
+	if err != nil {
+		fmt.Fprintln(statusOut(), "Unable to read", sa.AccessKey+":", err)
+	} else {
+		implied = info.ImpliedPolicy
+		if !implied && info.Policy != "" {
+			if p, perr := parsePolicy([]byte(info.Policy)); perr == nil {
+				inline = append(inline, p)
+			}
+		}
+	}
+
+	switch {
+	case implied && parent == miniokey:
+		a.Policies = []string{"root"}
+		a.Findings = append(a.Findings, "admin-equivalent")
+	case implied:
+		a.Policies = effective[parent]
+		if len(a.Policies) == 0 {
+			a.Policies = []string{"inherited from " + parent}
+		}
+		a.Findings = policyFindings(docsOf(policies, effective[parent]))
+	default:
+		a.Policies = []string{"inline"}
+		a.Findings = policyFindings(inline)
+	}
+	if typ == "service-account" && a.Expiration == nil {
+		a.Findings = append(a.Findings, "never expires")
+	}
+	return a
+}
+
+func accountsAudit() {
+	accounts, err := auditAccounts()
+	if err != nil {
+		panic(err)
+	}
+	for _, a := range accounts {
+		if slices.Contains(a.Findings, "admin-equivalent") {
+			exitCode = 1
+		}
+	}
+	if jsonOutput {
+		jsonOut(accounts)
+		return
+	}
+	if len(accounts) == 0 {
+		fmt.Println("No users or access keys besides the root user")
+		return
+	}
+
+	width := len("ACCESS KEY")
+	for _, a := range accounts {
+		width = max(width, len(a.AccessKey))
+	}
+	fmt.Printf("%-15s  %-*s  %-16s  %-8s  %-30s  %-20s  %s\n", "TYPE", width, "ACCESS KEY", "PARENT", "STATUS", "POLICIES", "EXPIRES", "FINDINGS")
+	for _, a := range accounts {
+		expires := "never"
+		if a.Type == "user" {
+			expires = "-"
+		} else if a.Expiration != nil {
+			expires = a.Expiration.Format(time.RFC3339)
+		}
+		policies := strings.Join(a.Policies, ",")
+		if len(a.Groups) > 0 {
+			policies += " (groups " + strings.Join(a.Groups, ",") + ")"
+		}
+		line := fmt.Sprintf("%-15s  %-*s  %-16s  %-8s  %-30s  %-20s  %s", a.Type, width, a.AccessKey, a.Parent, a.Status, policies, expires, strings.Join(a.Findings, ", "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Roles of the serve API, each one includes the ones before it.
+const (
+	roleNone     = ""
+	roleRead     = "read"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var roleLevel = map[string]int{roleNone: 0, roleRead: 1, roleOperator: 2, roleAdmin: 3}
+
+// apiToken is a static bearer token from -tokenFile.
+type apiToken struct {
+	Name  string
+	Role  string
+	Token string
+}
+
+// loadTokens reads a token file with one "role token [name]" entry per line,
+// for example "operator 3f1c... oncall". Empty lines and lines starting with
+// '#' are skipped.
+func loadTokens(path string) (tokens []apiToken, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected 'role token [name]'", path, line)
+		}
+		if _, ok := roleLevel[fields[0]]; !ok || fields[0] == roleNone {
+			return nil, fmt.Errorf("%s:%d: unknown role %q, expected read, operator or admin", path, line, fields[0])
+		}
+		t := apiToken{Role: fields[0], Token: fields[1], Name: fmt.Sprintf("token-%d", line)}
+		if len(fields) == 3 {
+			t.Name = fields[2]
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, sc.Err()
+}
+
+// oidcVerifier checks ID or access tokens signed by an OpenID Connect
+// provider and maps a claim of the token to a role.
+type oidcVerifier struct {
+	Issuer    string
+	Audience  string
+	RoleClaim string
+	RoleMap   map[string]string
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+// parseRoleMap parses "group=role,group=role".
+func parseRoleMap(s string) (m map[string]string, err error) {
+	m = make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if _, known := roleLevel[v]; !ok || !known || v == roleNone {
+			return nil, fmt.Errorf("invalid role mapping %q, expected claim=read|operator|admin", kv)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func b64int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// fetchKeys loads the signing keys of the provider from its discovery
+// document.
+func (o *oidcVerifier) fetchKeys() (err error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	body, err := httpGet(strings.TrimSuffix(o.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, &discovery)
+	if err != nil {
+		return err
+	}
+	if discovery.Issuer != o.Issuer {
+		return fmt.Errorf("discovery document is for issuer %q, not %q", discovery.Issuer, o.Issuer)
+	}
+	body, err = httpGet(discovery.JWKSURI)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	err = json.Unmarshal(body, &set)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := b64int(k.N)
+			if err != nil {
+				return err
+			}
+			e, err := b64int(k.E)
+			if err != nil {
+				return err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := b64int(k.X)
+			if err != nil {
+				return err
+			}
+			y, err := b64int(k.Y)
+			if err != nil {
+				return err
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	o.keys = keys
+	o.fetched = time.Now()
+	return nil
+}
+
+// key returns the signing key kid, keys are fetched again at most once a
+// minute when a token uses a key that is not known yet.
+func (o *oidcVerifier) key(kid string) (interface{}, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(o.fetched) > time.Minute {
+		err := o.fetchKeys()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load signing keys: %w", err)
+		}
+		if k, ok := o.keys[kid]; ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verify returns the subject and role of a valid token.
+func (o *oidcVerifier) verify(raw string) (name string, role string, err error) {
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return o.key(kid)
+	})
+	if err != nil {
+		return "", roleNone, err
+	}
+	// The parser only checks exp when the token has one.
+	if _, ok := claims["exp"]; !ok {
+		return "", roleNone, fmt.Errorf("token has no expiry")
+	}
+	if !claims.VerifyIssuer(o.Issuer, true) {
+		return "", roleNone, fmt.Errorf("token is not issued by %s", o.Issuer)
+	}
+	if !claims.VerifyAudience(o.Audience, true) {
+		return "", roleNone, fmt.Errorf("token is not meant for %s", o.Audience)
+	}
+
+	name, _ = claims["preferred_username"].(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+
+	var values []string
+	switch v := claims[o.RoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	role = roleNone
+	for _, v := range values {
+		if r := o.RoleMap[v]; roleLevel[r] > roleLevel[role] {
+			role = r
+		}
+	}
+	if role == roleNone {
+		return name, roleNone, fmt.Errorf("%s has no role, none of %v is mapped by -oidcRoles", name, values)
+	}
+	return name, role, nil
+}
+
+// apiAuth authenticates serve requests with static tokens, OIDC or both.
+// Without either every request is allowed.
+type apiAuth struct {
+	tokens []apiToken
+	oidc   *oidcVerifier
+}
+
+func newAPIAuth() (a *apiAuth, err error) {
+	a = new(apiAuth)
+	if apiTokenFile != "" {
+		a.tokens, err = loadTokens(apiTokenFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if oidcIssuer != "" {
+		if oidcAudience == "" {
+			return nil, fmt.Errorf("-oidcAudience is required with -oidcIssuer, tokens the issuer made for other clients would be accepted otherwise")
+		}
+		roles, err := parseRoleMap(oidcRoles)
+		if err != nil {
+			return nil, err
+		}
+		a.oidc = &oidcVerifier{Issuer: oidcIssuer, Audience: oidcAudience, RoleClaim: oidcRoleClaim, RoleMap: roles}
+		err = a.oidc.fetchKeys()
+		if err != nil {
+			return nil, fmt.Errorf("oidc: %w", err)
+		}
+	}
+	return a, nil
+}
+
+func (a *apiAuth) enabled() bool {
+	return len(a.tokens) > 0 || a.oidc != nil
+}
+
+// loopbackOnly reports whether listen only accepts connections from the
+// local host. An empty host listens on every interface.
+func loopbackOnly(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authenticate returns who sent r and their role.
+func (a *apiAuth) authenticate(r *http.Request) (name string, role string, err error) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		return "", roleNone, fmt.Errorf("missing bearer token")
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(raw), []byte(t.Token)) == 1 {
+			return t.Name, t.Role, nil
+		}
+	}
+	if a.oidc != nil && strings.Count(raw, ".") == 2 {
+		return a.oidc.verify(raw)
+	}
+	return "", roleNone, fmt.Errorf("invalid token")
+}
+
+// require wraps h so GET requests need readRole and every other method
+// writeRole. Changes are logged with the name of the caller.
+func (a *apiAuth) require(readRole, writeRole string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		need := writeRole
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = readRole
+		}
+		if !a.enabled() {
+			h(w, r)
+			return
+		}
+
+		name, role, err := a.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if roleLevel[role] < roleLevel[need] {
+			writeError(w, http.StatusForbidden, fmt.Errorf("%s has role %s, %s %s needs %s", name, role, r.Method, r.URL.Path, need))
+			return
+		}
+		if need != readRole {
+			fmt.Printf("%s %s by %s (%s)\n", r.Method, r.URL.RequestURI(), name, role)
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/madmin-go/v3"
+)
+
+// batchJob is a server side batch job with its last reported progress.
+// Bytes are only counted by replicate jobs.
+type batchJob struct {
+	ID            string
+	Type          string
+	User          string `json:",omitempty"`
+	Started       time.Time
+	Updated       time.Time `json:",omitempty"`
+	State         string
+	Objects       int64
+	ObjectsFailed int64
+	Bytes         int64 `json:",omitempty"`
+	BytesFailed   int64 `json:",omitempty"`
+	Retries       int
+	// LastObject is the object the job worked on last, bucket/key.
+	LastObject string `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+func (b *batchJob) running() bool { return b.State == "running" }
+
+func batchJobState(ctx context.Context, r madmin.BatchJobResult) batchJob {
+	b := batchJob{ID: r.ID, Type: string(r.Type), User: r.User, Started: r.Started, State: "running"}
+	st, err := mclient.BatchJobStatus(ctx, r.ID)
+	if err != nil {
+		b.State, b.Error = "unknown", err.Error()
+		return b
+	}
+	m := st.LastMetric
+	b.Updated, b.Retries = m.LastUpdate, m.RetryAttempts
+	switch {
+	case m.Failed:
+		b.State = "failed"
+	case m.Complete:
+		b.State = "complete"
+	}
+	var bucket, object string
+	switch {
+	case m.Replicate != nil:
+		i := m.Replicate
+		bucket, object, b.Objects, b.ObjectsFailed, b.Bytes, b.BytesFailed = i.Bucket, i.Object, i.Objects, i.ObjectsFailed, i.BytesTransferred, i.BytesFailed
+	case m.KeyRotate != nil:
+		i := m.KeyRotate
+		bucket, object, b.Objects, b.ObjectsFailed = i.Bucket, i.Object, i.Objects, i.ObjectsFailed
+	case m.Expired != nil:
+		i := m.Expired
+		bucket, object, b.Objects, b.ObjectsFailed = i.Bucket, i.Object, i.Objects, i.ObjectsFailed
+	}
+	if bucket != "" {
+		b.LastObject = bucket + "/" + object
+	}
+	return b
+}
+
+// batchJobs returns the batch jobs the cluster knows, or the ones in ids.
+func batchJobs(ids []string) (jobs []batchJob, err error) {
+	ctx := context.Background()
+	list, err := mclient.ListBatchJobs(ctx, &madmin.ListBatchJobsFilter{ByJobType: batchType})
+	if err != nil {
+		return nil, fmt.Errorf("listing batch jobs: %w", err)
+	}
+	for _, r := range list.Jobs {
+		if len(ids) == 0 || slices.Contains(ids, r.ID) {
+			jobs = append(jobs, batchJobState(ctx, r))
+		}
+	}
+	return jobs, nil
+}
+
+func batchTable(jobs []batchJob) string {
+	var b strings.Builder
+	width := len("ID")
+	for _, j := range jobs {
+		width = max(width, len(j.ID))
+	}
+	fmt.Fprintf(&b, "%-*s  %-9s  %-8s  %-10s  %-10s  %-10s  %-10s  %s\n", width, "ID", "TYPE", "STATE", "ELAPSED", "OBJECTS", "FAILED", "BYTES", "LAST OBJECT")
+	for _, j := range jobs {
+		end := time.Now()
+		if !j.running() && !j.Updated.IsZero() {
+			end = j.Updated
+		}
+		bytes := "-"
+		if j.Type == string(madmin.BatchJobReplicate) {
+			bytes = humanize.IBytes(uint64(j.Bytes))
+		}
+		last := j.LastObject
+		if j.Error != "" {
+			last = j.Error
+		}
+		line := fmt.Sprintf("%-*s  %-9s  %-8s  %-10s  %-10d  %-10d  %-10s  %s", width, j.ID, j.Type, j.State, end.Sub(j.Started).Round(time.Second), j.Objects, j.ObjectsFailed, bytes, last)
+		fmt.Fprintln(&b, strings.TrimRight(line, " "))
+	}
+	return b.String()
+}
+
+// jobsBatch lists the batch jobs, with -watch it redraws them every -watch
+// until none of them is running.
+func jobsBatch() {
+	if batchType != "" && !slices.Contains(madmin.SupportedJobTypes, madmin.BatchJobType(batchType)) {
+		panic(fmt.Sprintf("-type must be one of %v", madmin.SupportedJobTypes))
+	}
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	tty := isTerminal(os.Stdout)
+	lines := 0
+	for {
+		jobs, err := batchJobs(cmdArgs)
+		if err != nil {
+			panic(err)
+		}
+		exitCode = 0
+		for _, j := range jobs {
+			if j.State == "failed" || j.ObjectsFailed > 0 {
+				exitCode = 1
+			}
+		}
+		if jsonOutput {
+			jsonOut(jobs)
+			return
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No batch jobs")
+			return
+		}
+
+		out := batchTable(jobs)
+		if tty && lines > 0 {
+			fmt.Printf("\033[%dA\033[J", lines)
+		}
+		fmt.Print(out)
+		lines = strings.Count(out, "\n")
+
+		running := slices.ContainsFunc(jobs, func(j batchJob) bool { return j.running() })
+		if batchWatch <= 0 || !running {
+			return
+		}
+		if !tty {
+			fmt.Println()
+			lines = 0
+		}
+		time.Sleep(batchWatch)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// bmcHost is the baseboard management controller of a host, from -bmcFile.
+type bmcHost struct {
+	Host    string
+	Address string
+	Type    string
+}
+
+var bmcHosts struct {
+	once  sync.Once
+	hosts map[string]bmcHost
+	err   error
+}
+
+// loadBMCFile reads a BMC file with one "host address [redfish|ipmi]" entry
+// per line, for example "node01 10.0.1.101 ipmi". Empty lines and lines
+// starting with '#' are skipped.
+func loadBMCFile(path string) (hosts map[string]bmcHost, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hosts = make(map[string]bmcHost)
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected 'host address [redfish|ipmi]'", path, line)
+		}
+		b := bmcHost{Host: fields[0], Address: fields[1], Type: "redfish"}
+		if len(fields) == 3 {
+			b.Type = fields[2]
+		}
+		if b.Type != "redfish" && b.Type != "ipmi" {
+			return nil, fmt.Errorf("%s:%d: unknown BMC type %q, expected redfish or ipmi", path, line, b.Type)
+		}
+		hosts[b.Host] = b
+	}
+	return hosts, sc.Err()
+}
+
+// bmcFor returns the BMC of host, if -bmcFile has one.
+func bmcFor(host string) (b bmcHost, ok bool) {
+	if bmcFile == "" {
+		return b, false
+	}
+	bmcHosts.once.Do(func() {
+		bmcHosts.hosts, bmcHosts.err = loadBMCFile(bmcFile)
+	})
+	if bmcHosts.err != nil {
+		panic(bmcHosts.err)
+	}
+	b, ok = bmcHosts.hosts[host]
+	return
+}
+
+// bmcPass reads the password from -bmcPasswordFile or $BMC_PASSWORD, never
+// from the command line where every user on the machine could see it.
+func bmcPass() string {
+	if bmcPasswordFile == "" {
+		return os.Getenv("BMC_PASSWORD")
+	}
+	b, err := os.ReadFile(bmcPasswordFile)
+	if err != nil {
+		panic(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// redfish sends a Redfish request to the BMC and decodes the JSON answer
+// into out, when out is not nil.
+func (b bmcHost) redfish(method string, path string, body interface{}, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, "https://"+b.Address+path, rd)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(bmcUser, bmcPass())
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Transport: DefaultTransport(true), Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("redfish %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// redfishMembers returns the member links of a Redfish collection.
+func (b bmcHost) redfishMembers(path string) (links []string, err error) {
+	var coll struct {
+		Members []struct {
+			ID string `json:"@odata.id"`
+		}
+	}
+	err = b.redfish(http.MethodGet, path, nil, &coll)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range coll.Members {
+		links = append(links, m.ID)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("redfish %s has no members", path)
+	}
+	return links, nil
+}
+
+// powerCycle resets the host through its BMC, without asking the operating
+// system.
+func (b bmcHost) powerCycle() error {
+	if b.Type == "ipmi" {
+		// -E reads the password from the environment instead of the
+		// command line, where every user on the machine could see it.
+		cmd := exec.Command("ipmitool", "-I", "lanplus", "-H", b.Address, "-U", bmcUser, "-E", "chassis", "power", "cycle")
+		cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+bmcPass())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ipmitool: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	systems, err := b.redfishMembers("/redfish/v1/Systems")
+	if err != nil {
+		return err
+	}
+	return b.redfish(http.MethodPost, systems[0]+"/Actions/ComputerSystem.Reset", map[string]string{"ResetType": "ForceRestart"}, nil)
+}
+
+// powerState asks the BMC whether the host is powered on.
+func (b bmcHost) powerState() (on bool, err error) {
+	if b.Type == "ipmi" {
+		cmd := exec.Command("ipmitool", "-I", "lanplus", "-H", b.Address, "-U", bmcUser, "-E", "chassis", "power", "status")
+		cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+bmcPass())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("ipmitool: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return strings.HasSuffix(strings.TrimSpace(string(out)), " on"), nil
+	}
+
+	systems, err := b.redfishMembers("/redfish/v1/Systems")
+	if err != nil {
+		return false, err
+	}
+	var system struct{ PowerState string }
+	err = b.redfish(http.MethodGet, systems[0], nil, &system)
+	return system.PowerState == "On", err
+}
+
+// unreachable reports whether err means the host did not answer at all, as
+// opposed to refusing ssh or the login failing.
+func unreachable(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
+
+// pingable reports whether host answers ICMP echo requests.
+func pingable(host string) bool {
+	return exec.Command("ping", "-c", "3", "-W", "2", host).Run() == nil
+}
+
+// powerCycleHost is the fallback for hosts ssh can not reboot. It reports
+// whether the host was power cycled. Only hosts that timed out, do not
+// answer ping and that their BMC reports as powered on are reset.
+func powerCycleHost(host string, why error) bool {
+	if !powerCycleFallback || minioOnly || reloadOnly {
+		return false
+	}
+	if !unreachable(why) {
+		fmt.Println("Not power cycling", host+", it is reachable:", why)
+		return false
+	}
+	b, ok := bmcFor(host)
+	if !ok {
+		fmt.Println("No BMC for", host, "in -bmcFile, unable to power cycle it")
+		return false
+	}
+	if pingable(host) {
+		fmt.Println("Not power cycling", host+", it still answers ping")
+		return false
+	}
+	on, err := b.powerState()
+	if err != nil {
+		fmt.Println("Not power cycling", host+", unable to read its power state:", err)
+		recordHostFailure(host, fmt.Errorf("bmc power state: %w", err))
+		return false
+	}
+	if !on {
+		fmt.Println("Not power cycling", host+", its BMC reports it powered off")
+		recordHostFailure(host, errors.New("powered off according to its BMC"))
+		return false
+	}
+	if dryRun {
+		fmt.Printf("Would power cycle %s through its BMC %s (%s): %v\n", host, b.Address, b.Type, why)
+		return true
+	}
+	fmt.Printf("Power cycling %s through its BMC %s (%s): %v\n", host, b.Address, b.Type, why)
+	err = b.powerCycle()
+	if err != nil {
+		fmt.Println("Power cycle of", host, "failed:", err)
+		recordHostFailure(host, fmt.Errorf("power cycle: %w", err))
+		return false
+	}
+	sshForget(host)
+	return true
+}
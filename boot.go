@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bootState is when a host booted and when its minio unit last started.
+type bootState struct {
+	BootID       string
+	Booted       time.Time
+	MinioStarted time.Time
+}
+
+// bootStateScript prints the boot id, the boot time and the time since boot
+// at which the minio unit became active in microseconds, 0 if it never did.
+const bootStateScript = `cat /proc/sys/kernel/random/boot_id; awk '/^btime/{print $2}' /proc/stat; systemctl show minio -p ActiveEnterTimestampMonotonic --value 2>/dev/null || echo 0`
+
+func hostBootState(host string) (st bootState, err error) {
+	out, err := runSSH(host, bootStateScript)
+	if err != nil {
+		return st, err
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) < 2 {
+		return st, fmt.Errorf("unexpected boot state output %q", strings.TrimSpace(string(out)))
+	}
+	st.BootID = lines[0]
+	btime, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return st, fmt.Errorf("invalid boot time %q", lines[1])
+	}
+	st.Booted = time.Unix(btime, 0)
+	if len(lines) > 2 {
+		mono, err := strconv.ParseInt(lines[2], 10, 64)
+		if err == nil && mono > 0 {
+			st.MinioStarted = st.Booted.Add(time.Duration(mono) * time.Microsecond)
+		}
+	}
+	return st, nil
+}
+
+// parseSince parses -since, either a time in RFC3339 or a duration before
+// now like 3h.
+func parseSince(s string) (t time.Time, err error) {
+	if s == "" {
+		return t, nil
+	}
+	if d, derr := time.ParseDuration(s); derr == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid -since %q, expected a duration like 3h or an RFC3339 time", s)
+	}
+	return t, nil
+}
+
+// rebootedSince reports whether host already rebooted, or restarted minio
+// with -minioOnly, after since.
+func rebootedSince(host string, since time.Time) (done bool, reason string, err error) {
+	st, err := hostBootState(host)
+	if err != nil {
+		return false, "", err
+	}
+	if minioOnly {
+		if st.MinioStarted.After(since) {
+			return true, "minio restarted at " + st.MinioStarted.Format(time.RFC3339), nil
+		}
+		return false, "", nil
+	}
+	if st.Booted.After(since) {
+		return true, "booted at " + st.Booted.Format(time.RFC3339), nil
+	}
+	return false, "", nil
+}
+
+// bootBefore holds the boot state of every host taken right before it was
+// rebooted, to verify afterwards that the reboot happened.
+var bootBefore = struct {
+	sync.Mutex
+	states map[string]bootState
+}{states: make(map[string]bootState)}
+
+// recordBootState remembers the boot state of host before it is rebooted.
+// Hosts it can not be read for are not verified.
+func recordBootState(host string) {
+	st, err := hostBootState(host)
+	if err != nil {
+		fmt.Println("Unable to read the boot state of", host+", the reboot will not be verified:", err)
+		return
+	}
+	bootBefore.Lock()
+	bootBefore.states[host] = st
+	bootBefore.Unlock()
+}
+
+// forgetBootState drops host from verification, for reboots that failed.
+func forgetBootState(host string) {
+	bootBefore.Lock()
+	delete(bootBefore.states, host)
+	bootBefore.Unlock()
+}
+
+func bootStateBefore(host string) (st bootState, ok bool) {
+	bootBefore.Lock()
+	defer bootBefore.Unlock()
+	st, ok = bootBefore.states[host]
+	return
+}
+
+// verifyMinioRestart confirms that the minio unit on host started again
+// after its restart.
+func verifyMinioRestart(host string) error {
+	before, ok := bootStateBefore(host)
+	if !ok {
+		return nil
+	}
+	if before.MinioStarted.IsZero() {
+		fmt.Println("The minio unit on", host, "was not active before, its restart is not verified")
+		return nil
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		st, err := hostBootState(host)
+		if err == nil && st.MinioStarted.After(before.MinioStarted) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("unable to verify minio restart: %w", err)
+			}
+			return fmt.Errorf("minio did not restart, it is active since %s", st.MinioStarted.Format(time.RFC3339))
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// verifyReboots waits until every host that was rebooted came back with a
+// new boot id, or -verifyTimeout passed. Hosts that did not reboot are
+// recorded as failed.
+func verifyReboots(hosts []string) (ok bool) {
+	if dryRun || minioOnly || reloadOnly || !verifyReboot {
+		return true
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok = true
+	for _, host := range hosts {
+		before, known := bootStateBefore(host)
+		if !known {
+			continue
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			err := waitForNewBoot(host, before)
+			if errors.Is(err, errHostDown) && powerCycleHost(host, err) {
+				err = waitForNewBoot(host, before)
+			}
+			if err != nil {
+				fmt.Println("Reboot of", host, "not verified:", err)
+				recordHostFailure(host, err)
+				runStats.failures.Add(1)
+				mu.Lock()
+				ok = false
+				mu.Unlock()
+				return
+			}
+			fmt.Println("Verified reboot:", host)
+		}(host)
+	}
+	wg.Wait()
+	return ok
+}
+
+// errHostDown is returned for rebooted hosts that did not come back.
+var errHostDown = errors.New("host did not come back")
+
+func waitForNewBoot(host string, before bootState) error {
+	deadline := time.Now().Add(verifyTimeout)
+	for {
+		st, err := hostBootState(host)
+		if err == nil && st.BootID != before.BootID {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("%w within %s: %w", errHostDown, verifyTimeout, err)
+			}
+			return fmt.Errorf("boot id did not change, the host did not reboot")
+		}
+		if err != nil {
+			sshForget(host)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// reloadMinio reloads minio on host through the ExecReload of its unit and
+// confirms the process survived it. minio exits on SIGHUP, a unit without
+// ExecReload is refused rather than signalled.
+func reloadMinio(host string) error {
+	unit := func() (canReload, pid string, err error) {
+		out, err := runSSH(host, "systemctl show minio -p CanReload -p MainPID")
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		for _, line := range strings.Fields(string(out)) {
+			k, v, _ := strings.Cut(line, "=")
+			switch k {
+			case "CanReload":
+				canReload = v
+			case "MainPID":
+				pid = v
+			}
+		}
+		return
+	}
+	canReload, before, err := unit()
+	if err != nil {
+		return err
+	}
+	if canReload != "yes" {
+		return errors.New("minio.service has no ExecReload, so minio cannot be reloaded in place, add an ExecReload to the unit or run without -reload to restart minio instead")
+	}
+	if before == "" || before == "0" {
+		return errors.New("minio is not running")
+	}
+	out, err := runSSH(host, "sudo systemctl reload minio")
+	if err != nil {
+		return fmt.Errorf("systemctl reload minio: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	_, after, err := unit()
+	if err != nil {
+		return err
+	}
+	if after != before {
+		return fmt.Errorf("minio did not survive the reload, its main PID went from %s to %s", before, after)
+	}
+	return nil
+}
+
+// minioJournalErrors returns the fatal messages minio logged since t.
+func minioJournalErrors(host string, t time.Time) string {
+	out, _ := runSSH(host, fmt.Sprintf("journalctl -u minio --since @%d --no-pager -o cat 2>/dev/null | grep -iE 'fatal|panic' | tail -n 5", t.Unix()))
+	return strings.TrimSpace(string(out))
+}
+
+// waitUnitActive polls the minio unit on host after a restart until it is
+// active, failed or -unitTimeout passed.
+func waitUnitActive(host string, restarted time.Time) error {
+	if unitTimeout <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(unitTimeout)
+	state := ""
+	for {
+		out, _ := runSSH(host, "systemctl is-active minio")
+		state = strings.TrimSpace(string(out))
+		if state == "active" {
+			if checkJournal {
+				if msgs := minioJournalErrors(host, restarted); msgs != "" {
+					return fmt.Errorf("minio is active but logged fatal errors: %s", strings.ReplaceAll(msgs, "\n", " | "))
+				}
+			}
+			return nil
+		}
+		if state == "failed" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	err := fmt.Errorf("minio unit is %q after the restart", state)
+	if state != "failed" {
+		err = fmt.Errorf("minio unit is still %q %s after the restart", state, unitTimeout)
+	}
+	if checkJournal {
+		if msgs := minioJournalErrors(host, restarted); msgs != "" {
+			err = fmt.Errorf("%w: %s", err, strings.ReplaceAll(msgs, "\n", " | "))
+		}
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bundleFile is one file of a support bundle.
+type bundleFile struct {
+	Name string
+	Data []byte
+}
+
+// bundleManifest describes a support bundle, it is the first file in the
+// archive so a support engineer knows what they are looking at.
+type bundleManifest struct {
+	Tool     string
+	Created  time.Time
+	Endpoint string
+	Redacted bool
+	Files    []string
+	Errors   []string `json:",omitempty"`
+}
+
+// bundleHealth is the health endpoint result for one server.
+type bundleHealth struct {
+	Host    string
+	Healthy bool
+	Reason  string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// redactor replaces host names and IP addresses with stable placeholders, the
+// same host gets the same placeholder in every file of the bundle.
+type redactor struct {
+	names    []string
+	replaced map[string]string
+	ips      map[string]string
+}
+
+func newRedactor(hosts []string) *redactor {
+	r := &redactor{replaced: make(map[string]string), ips: make(map[string]string)}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		if h == "" || r.replaced[h] != "" || net.ParseIP(h) != nil {
+			continue
+		}
+		r.replaced[h] = fmt.Sprintf("host-%02d", len(r.replaced)+1)
+		r.names = append(r.names, h)
+	}
+	// Longest first so node1 does not eat into node10.
+	sort.Slice(r.names, func(i, j int) bool { return len(r.names[i]) > len(r.names[j]) })
+	return r
+}
+
+func (r *redactor) redact(data []byte) []byte {
+	s := string(data)
+	for _, n := range r.names {
+		s = strings.ReplaceAll(s, n, r.replaced[n])
+	}
+	s = ipv4Pattern.ReplaceAllStringFunc(s, func(ip string) string {
+		if net.ParseIP(ip) == nil {
+			return ip
+		}
+		if _, ok := r.ips[ip]; !ok {
+			r.ips[ip] = fmt.Sprintf("ip-%02d", len(r.ips)+1)
+		}
+		return r.ips[ip]
+	})
+	return []byte(s)
+}
+
+// collectLogs reads up to lines recent console log entries of every server.
+// The log API streams, so reading stops after lines entries or a timeout.
+func collectLogs(lines int) (data []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var buf bytes.Buffer
+	n := 0
+	for l := range mclient.GetLogs(ctx, "", lines, "ALL") {
+		if l.Err != nil {
+			return buf.Bytes(), l.Err
+		}
+		b, err := json.Marshal(l)
+		if err != nil {
+			return buf.Bytes(), err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+		n++
+		if n >= lines {
+			break
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBundle(path string, dir string, files []bundleFile) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name:    dir + "/" + file.Name,
+			Mode:    0o644,
+			Size:    int64(len(file.Data)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(file.Data)
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err == nil {
+		err = gz.Close()
+	}
+	return err
+}
+
+func bundle() {
+	created := time.Now().UTC()
+	dir := "cluster-bundle-" + created.Format("20060102-150405")
+	out := bundleOut
+	if out == "" {
+		out = dir + ".tar.gz"
+	}
+
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+
+	manifest := bundleManifest{Tool: version, Created: created, Endpoint: endpoint, Redacted: bundleRedact}
+	var files []bundleFile
+	add := func(name string, v interface{}, err error) {
+		if err != nil {
+			manifest.Errors = append(manifest.Errors, name+": "+err.Error())
+			fmt.Println("Unable to collect", name+":", err)
+			if v == nil {
+				return
+			}
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			var merr error
+			b, merr = json.MarshalIndent(v, "", "  ")
+			if merr != nil {
+				manifest.Errors = append(manifest.Errors, name+": "+merr.Error())
+				return
+			}
+		}
+		files = append(files, bundleFile{Name: name, Data: b})
+		fmt.Println("Collected", name)
+	}
+
+	hosts := []string{endpoint}
+
+	pools, _, err := getInfra()
+	if err == nil {
+		add("info.json", pools, nil)
+		add("sets.json", setSummaries(pools), nil)
+		for _, p := range pools {
+			for host := range p.Servers {
+				hosts = append(hosts, host)
+			}
+		}
+		add("disks.json", allDisks(pools, false), nil)
+	} else {
+		add("info.json", nil, err)
+	}
+
+	serverInfo, err := clusterServerInfo()
+	if err == nil {
+		for _, s := range serverInfo.Servers {
+			h, _, serr := net.SplitHostPort(s.Endpoint)
+			if serr != nil {
+				h = s.Endpoint
+			}
+			hosts = append(hosts, h)
+		}
+		add("serverinfo.json", serverInfo, nil)
+	} else {
+		add("serverinfo.json", nil, err)
+	}
+
+	add("doctor.json", runDoctorChecks(loadDoctorData()), nil)
+
+	if pools != nil {
+		healthHosts := make(map[string]bool)
+		for _, p := range pools {
+			for host := range p.Servers {
+				healthHosts[host] = true
+			}
+		}
+		names := stringKeysSorted(healthHosts)
+		var health []bundleHealth
+		for i, r := range pollHealth(names) {
+			h := bundleHealth{Host: names[i], Healthy: r.ok, Reason: r.reason}
+			if r.err != nil {
+				h.Error = r.err.Error()
+			}
+			health = append(health, h)
+		}
+		add("health.json", health, nil)
+	}
+
+	if bundleLogLines > 0 {
+		logs, err := collectLogs(bundleLogLines)
+		if len(logs) == 0 && err != nil {
+			add("logs.jsonl", nil, err)
+		} else {
+			add("logs.jsonl", logs, err)
+		}
+	}
+
+	if bundleHostChecks && (pools != nil || hostfile != "") {
+		add("hostcheck.json", runHostChecks(hostCheckTargets(), hostChecks), nil)
+	}
+
+	if bundleRedact {
+		r := newRedactor(hosts)
+		for i := range files {
+			files[i].Data = r.redact(files[i].Data)
+		}
+		for i := range manifest.Errors {
+			manifest.Errors[i] = string(r.redact([]byte(manifest.Errors[i])))
+		}
+		manifest.Endpoint = string(r.redact([]byte(manifest.Endpoint)))
+	}
+
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.Name)
+	}
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	files = append([]bundleFile{{Name: "manifest.json", Data: m}}, files...)
+
+	err = writeBundle(out, dir, files)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Wrote", out)
+	if len(manifest.Errors) > 0 {
+		fmt.Printf("%d items could not be collected, see manifest.json\n", len(manifest.Errors))
+	}
+}
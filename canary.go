@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Client returns an S3 client that talks to host directly instead of going
+// through -endpoint, so requests are served by that host.
+func s3Client(host string) (*minio.Client, error) {
+	return minio.New(host+":"+port, &minio.Options{
+		Creds:     credentials.NewStaticV4(miniokey, miniosecret, ""),
+		Secure:    secure,
+		Transport: DefaultTransport(secure),
+	})
+}
+
+// canaryProbe writes, reads back and deletes a small object in -canaryBucket
+// through host.
+func canaryProbe(host string) (err error) {
+	client, err := s3Client(host)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	payload := make([]byte, 1024)
+	_, _ = rand.Read(payload)
+	object := fmt.Sprintf(".cluster-tool-canary/%s-%d", host, time.Now().UnixNano())
+
+	_, err = client.PutObject(ctx, canaryBucket, object, bytes.NewReader(payload), int64(len(payload)), minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("canary PUT: %w", err)
+	}
+	// Always try to clean up, even if the read fails.
+	defer func() {
+		rerr := client.RemoveObject(context.Background(), canaryBucket, object, minio.RemoveObjectOptions{})
+		if rerr != nil && err == nil {
+			err = fmt.Errorf("canary DELETE: %w", rerr)
+		}
+	}()
+
+	obj, err := client.GetObject(ctx, canaryBucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("canary GET: %w", err)
+	}
+	defer obj.Close()
+	got, err := io.ReadAll(obj)
+	if err != nil {
+		return fmt.Errorf("canary GET: %w", err)
+	}
+	if !bytes.Equal(got, payload) {
+		return fmt.Errorf("canary GET: read back %d bytes that do not match what was written", len(got))
+	}
+	return nil
+}
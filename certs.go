@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certPair is the public.crt and private.key MinIO serves TLS with.
+type certPair struct {
+	Source string
+	Cert   []byte
+	Key    []byte
+	Leaf   *x509.Certificate
+}
+
+// loadCertPair reads the pair for host from dir/host/ and falls back to the
+// pair in dir itself, which is shared by every host.
+func loadCertPair(dir, host string) (p certPair, err error) {
+	p.Source = filepath.Join(dir, host)
+	if _, err = os.Stat(filepath.Join(p.Source, "public.crt")); err != nil {
+		p.Source = dir
+	}
+	p.Cert, err = os.ReadFile(filepath.Join(p.Source, "public.crt"))
+	if err != nil {
+		return p, err
+	}
+	p.Key, err = os.ReadFile(filepath.Join(p.Source, "private.key"))
+	return p, err
+}
+
+// validateCertPair checks that the key belongs to the certificate, that it
+// covers host, that it is valid now and for longer than -days and, with
+// -caFile, that it chains to the CA.
+func validateCertPair(host string, p *certPair) (r []checkResult) {
+	pair, err := tls.X509KeyPair(p.Cert, p.Key)
+	if err != nil {
+		return []checkResult{newResult("keypair", checkFail, fmt.Sprintf("%s: %v", p.Source, err), "public.crt and private.key have to be PEM files of the same key")}
+	}
+	p.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return []checkResult{newResult("keypair", checkFail, fmt.Sprintf("%s: %v", p.Source, err), "")}
+	}
+	r = append(r, newResult("keypair", checkPass, "key matches the certificate from "+p.Source, ""))
+
+	if err := p.Leaf.VerifyHostname(host); err != nil {
+		names := append(append([]string{}, p.Leaf.DNSNames...), ipStrings(p.Leaf.IPAddresses)...)
+		if len(names) == 0 {
+			names = []string{"no SANs, CN " + p.Leaf.Subject.CommonName}
+		}
+		r = append(r, newResult("san", checkFail, fmt.Sprintf("certificate does not cover %s, it is for %s", host, strings.Join(names, ",")),
+			"Put the certificate for this host in a directory named after it"))
+	} else {
+		r = append(r, newResult("san", checkPass, "certificate covers "+host, ""))
+	}
+
+	now := time.Now()
+	left := p.Leaf.NotAfter.Sub(now)
+	switch {
+	case now.Before(p.Leaf.NotBefore):
+		r = append(r, newResult("expiry", checkFail, "certificate is not valid before "+p.Leaf.NotBefore.Format(time.RFC3339), ""))
+	case left <= 0:
+		r = append(r, newResult("expiry", checkFail, "certificate expired "+p.Leaf.NotAfter.Format(time.RFC3339), ""))
+	case left < time.Duration(certExpiryDays)*24*time.Hour:
+		r = append(r, newResult("expiry", checkWarn, fmt.Sprintf("certificate expires %s, in %d days", p.Leaf.NotAfter.Format(time.RFC3339), int(left.Hours()/24)), ""))
+	default:
+		r = append(r, newResult("expiry", checkPass, "certificate valid until "+p.Leaf.NotAfter.Format(time.RFC3339), ""))
+	}
+
+	if certCAFile == "" {
+		return
+	}
+	ca, err := os.ReadFile(certCAFile)
+	if err != nil {
+		return append(r, newResult("chain", checkFail, err.Error(), ""))
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return append(r, newResult("chain", checkFail, certCAFile+" has no PEM certificates", ""))
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range pair.Certificate[1:] {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err = p.Leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err != nil {
+		return append(r, newResult("chain", checkFail, err.Error(), "Append the intermediate certificates to public.crt"))
+	}
+	return append(r, newResult("chain", checkPass, "chains to "+certCAFile, ""))
+}
+
+// certChange installs a new certificate pair in the certs directory of the
+// minio unit right before the host restarts. The pair it replaces is kept
+// next to it as public.crt.old and private.key.old for a rollback.
+type certChange struct {
+	Pairs map[string]certPair
+}
+
+func (certChange) Name() string { return "certificates" }
+
+// certsDirScript sets $user to the user of the minio unit and $dir to
+// -certsDir or the certs directory MinIO defaults to in its home.
+func certsDirScript() string {
+	s := "user=$(systemctl show -p User --value minio); user=${user:-root}; "
+	if certsDir != "" {
+		return s + "dir=" + shellQuote(certsDir) + "; "
+	}
+	return s + `dir="$(getent passwd "$user" | cut -d: -f6)/.minio/certs"; `
+}
+
+func (c certChange) Install(host string) (err error) {
+	p := c.Pairs[host]
+	if dryRun {
+		fmt.Printf("Would install %s/public.crt and private.key to %s\n", p.Source, host)
+		return nil
+	}
+	dir, err := stagingDir(host)
+	if err != nil {
+		return err
+	}
+	defer removeStaging(host, dir)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"public.crt", p.Cert}, {"private.key", p.Key}} {
+		err = scpUpload(host, dir, f.name, f.data, 0o600)
+		if err != nil {
+			return fmt.Errorf("copying %s: %w", f.name, err)
+		}
+	}
+
+	// Both files are staged next to the old ones first and each is renamed
+	// over the old one so minio never reads half a file. When the key can
+	// not be swapped the certificate is put back, minio would not start
+	// with a certificate that does not match its key.
+	var script strings.Builder
+	script.WriteString(certsDirScript())
+	script.WriteString(`sudo install -d -o "$user" -g "$user" "$dir" && `)
+	for _, f := range []struct{ name, mode string }{{"public.crt", "0644"}, {"private.key", "0600"}} {
+		fmt.Fprintf(&script, `sudo install -m %s -o "$user" -g "$user" %s "$dir/.%s.new" && `,
+			f.mode, shellQuote(dir+"/"+f.name), f.name)
+	}
+	for _, f := range []string{"public.crt", "private.key"} {
+		fmt.Fprintf(&script, `{ if sudo test -e "$dir/%s"; then sudo ln -f "$dir/%s" "$dir/%s.old"; else sudo rm -f "$dir/%s.old"; fi; } && `, f, f, f, f)
+	}
+	script.WriteString(`sudo mv -f "$dir/.public.crt.new" "$dir/public.crt" && `)
+	script.WriteString(`{ sudo mv -f "$dir/.private.key.new" "$dir/private.key" || { if sudo test -e "$dir/public.crt.old"; then sudo mv -f "$dir/public.crt.old" "$dir/public.crt"; else sudo rm -f "$dir/public.crt"; fi; false; }; } && `)
+	script.WriteString(`echo "$dir"; rc=$?; sudo rm -f "$dir/.public.crt.new" "$dir/.private.key.new"; exit $rc`)
+	output, err := runSSH(host, script.String())
+	if err != nil {
+		return fmt.Errorf("installing: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	fmt.Printf("Installed %s/public.crt and private.key to %s:%s\n", p.Source, host, strings.TrimSpace(string(output)))
+	return nil
+}
+
+// Verify waits for the restarted minio to serve the new certificate.
+func (c certChange) Verify(host string) error {
+	want := c.Pairs[host].Leaf
+	addr := net.JoinHostPort(host, port)
+	conf := &tls.Config{InsecureSkipVerify: true}
+	if net.ParseIP(host) == nil {
+		conf.ServerName = host
+	}
+	wait := unitTimeout
+	if wait <= 0 {
+		wait = 30 * time.Second
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, conf)
+		if err == nil {
+			certs := conn.ConnectionState().PeerCertificates
+			conn.Close()
+			if len(certs) > 0 && bytes.Equal(certs[0].Raw, want.Raw) {
+				return nil
+			}
+			err = errors.New("minio still serves the old certificate")
+			if len(certs) > 0 {
+				err = fmt.Errorf("minio serves certificate %s valid until %s, not the new one", certs[0].Subject.CommonName, certs[0].NotAfter.Format(time.RFC3339))
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (certChange) Rollback(host string) error {
+	var script strings.Builder
+	script.WriteString(certsDirScript())
+	for _, f := range []string{"public.crt", "private.key"} {
+		fmt.Fprintf(&script, `if sudo test -e "$dir/%s.old"; then sudo mv -f "$dir/%s.old" "$dir/%s"; else sudo rm -f "$dir/%s"; fi && `, f, f, f, f)
+	}
+	script.WriteString("true")
+	output, err := runSSH(host, script.String())
+	if err != nil {
+		return fmt.Errorf("restoring the previous certificates: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	fmt.Println("Restored the previous certificates on", host)
+	return nil
+}
+
+// rolloutHosts returns every host of the round files in -folder.
+func rolloutHosts() (hosts []string, err error) {
+	rounds, err := roundFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, rf := range rounds {
+		more, err := readHostfile(rf)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, more...)
+	}
+	return
+}
+
+func certsRotate() {
+	if certsSource == "" {
+		panic("-certs is required, a directory with public.crt and private.key or a directory per host with them")
+	}
+	if !minioOnly || reloadOnly {
+		panic("certs rotate restarts minio, it cannot be combined with -minioOnly=false or -reload")
+	}
+	if !secure {
+		panic("-secure is required, the new certificate is verified over TLS after each restart")
+	}
+	hosts, err := rolloutHosts()
+	if err != nil {
+		panic(err)
+	}
+	if len(hosts) == 0 {
+		fmt.Println("No round files found in", folder)
+		return
+	}
+
+	// Nothing is installed unless the certificates of every host are valid.
+	change := certChange{Pairs: make(map[string]certPair)}
+	reports := make([]hostReport, 0, len(hosts))
+	failed := false
+	for _, host := range hosts {
+		p, err := loadCertPair(certsSource, host)
+		r := hostReport{Host: host}
+		if err != nil {
+			r.Results = []checkResult{newResult("keypair", checkFail, err.Error(), "")}
+		} else {
+			r.Results = validateCertPair(host, &p)
+		}
+		for _, c := range r.Results {
+			failed = failed || c.Status == checkFail
+		}
+		change.Pairs[host] = p
+		reports = append(reports, r)
+	}
+	printHostReports(reports)
+	if failed {
+		panic("certificates failed validation, nothing was installed")
+	}
+	if upgradeCheckOnly {
+		return
+	}
+
+	hostChanges = append(hostChanges, change)
+	rollout()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// hostChange is installed on a host right before its minio restarts, like a
+// new binary or certificate. When minio does not come back with it the host
+// is rolled back and restarted again.
+type hostChange interface {
+	Name() string
+	Install(host string) error
+	// Verify confirms the restarted minio runs with the change.
+	Verify(host string) error
+	Rollback(host string) error
+}
+
+// hostChanges are installed by rebootServer, they are set by the command
+// before it starts the rollout.
+var hostChanges []hostChange
+
+// installChanges installs every change on host. When one fails the ones
+// before it are rolled back, minio has not restarted yet.
+func installChanges(host string) error {
+	for i, c := range hostChanges {
+		err := c.Install(host)
+		if err != nil {
+			rollbackChanges(host, hostChanges[:i])
+			return fmt.Errorf("%s: %w", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+func verifyChanges(host string) error {
+	for _, c := range hostChanges {
+		err := c.Verify(host)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+// rollbackChanges rolls back changes on host in reverse order.
+func rollbackChanges(host string, changes []hostChange) (ok bool) {
+	ok = true
+	for i := len(changes) - 1; i >= 0; i-- {
+		err := changes[i].Rollback(host)
+		if err != nil {
+			fmt.Printf("Unable to roll back %s on %s: %v\n", changes[i].Name(), host, err)
+			ok = false
+		}
+	}
+	return
+}
+
+// rollbackHost restores what minio ran with before on a host it failed to
+// start on with the changes and restarts it again. The host stays failed,
+// the rollback only brings its drives back.
+func rollbackHost(host string, cause error) {
+	if len(hostChanges) == 0 || dryRun {
+		return
+	}
+	var names []string
+	for _, c := range hostChanges {
+		names = append(names, c.Name())
+	}
+	fmt.Printf("Rolling back %s on %s: %v\n", strings.Join(names, ", "), host, cause)
+	if !rollbackChanges(host, hostChanges) {
+		return
+	}
+	restarted := time.Now()
+	output, err := runSSH(host, "sudo systemctl restart minio")
+	if err != nil {
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	} else {
+		err = waitUnitActive(host, restarted)
+	}
+	if err != nil {
+		fmt.Printf("minio did not come back on %s after the rollback: %v\n", host, err)
+		return
+	}
+	fmt.Println("Rolled back:", host)
+}
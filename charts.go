@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	bolt "go.etcd.io/bbolt"
+)
+
+// reportChart is an inline SVG chart of report -charts. Charts without data
+// carry a note on how to get some instead.
+type reportChart struct {
+	Title string
+	SVG   template.HTML
+	Note  string
+}
+
+type chartSeries struct {
+	Name   string
+	Values []float64
+}
+
+const (
+	chartWidth  = 760
+	chartHeight = 260
+	chartLeft   = 70
+	chartBottom = 40
+	chartTop    = 15
+	chartRight  = 130
+)
+
+var chartColors = []string{"#4a90d9", "#d9534f", "#5cb85c", "#f0ad4e", "#9b59b6", "#1abc9c", "#34495e", "#e67e22"}
+
+// chartFrame draws the axes with the maximum value and the first, middle
+// and last label.
+func chartFrame(b *strings.Builder, labels []string, top float64, format func(float64) string) {
+	x0, y0 := chartLeft, chartHeight-chartBottom
+	x1 := chartWidth - chartRight
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, x0, y0, x1, y0)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, x0, chartTop, x0, y0)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, x0-5, chartTop+4, template.HTMLEscapeString(format(top)))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, x0-5, y0, template.HTMLEscapeString(format(0)))
+	if len(labels) == 0 {
+		return
+	}
+	for n, i := range []int{0, len(labels) / 2, len(labels) - 1} {
+		if n > 0 && i == 0 || n == 2 && i == len(labels)/2 {
+			continue
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, chartX(i, len(labels)), y0+16, template.HTMLEscapeString(labels[i]))
+	}
+}
+
+// chartX is the center of the i-th of n slots on the x axis.
+func chartX(i int, n int) float64 {
+	slot := float64(chartWidth-chartRight-chartLeft) / float64(n)
+	return chartLeft + slot*(float64(i)+0.5)
+}
+
+func chartY(v float64, top float64) float64 {
+	if top <= 0 {
+		return chartHeight - chartBottom
+	}
+	return chartHeight - chartBottom - v/top*float64(chartHeight-chartBottom-chartTop)
+}
+
+// chartMax is the largest value, NaN marks a missing point and is skipped.
+func chartMax(values ...[]float64) (top float64) {
+	for _, vs := range values {
+		for _, v := range vs {
+			if math.IsNaN(v) {
+				continue
+			}
+			top = math.Max(top, v)
+		}
+	}
+	return
+}
+
+// svgBars renders one bar per label.
+func svgBars(labels []string, values []float64, format func(float64) string) template.HTML {
+	b := new(strings.Builder)
+	top := chartMax(values)
+	chartFrame(b, labels, top, format)
+	w := float64(chartWidth-chartRight-chartLeft) / float64(max(len(values), 1)) * 0.8
+	for i, v := range values {
+		y := chartY(v, top)
+		fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+			chartX(i, len(values))-w/2, y, w, float64(chartHeight-chartBottom)-y, chartColors[0],
+			template.HTMLEscapeString(labels[i]), template.HTMLEscapeString(format(v)))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// svgLines renders one line per series with a legend on the right. NaN
+// values are gaps.
+func svgLines(labels []string, series []chartSeries, format func(float64) string) template.HTML {
+	b := new(strings.Builder)
+	all := make([][]float64, 0, len(series))
+	for _, s := range series {
+		all = append(all, s.Values)
+	}
+	top := chartMax(all...)
+	chartFrame(b, labels, top, format)
+	for si, s := range series {
+		color := chartColors[si%len(chartColors)]
+		var points []string
+		for i, v := range s.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", chartX(i, len(labels)), chartY(v, top)))
+		}
+		fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+		fmt.Fprintf(b, `<text x="%d" y="%d" fill="%s">%s</text>`, chartWidth-chartRight+10, chartTop+4+si*14, color, template.HTMLEscapeString(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// chartDays returns the day labels of the chart window, oldest first.
+func chartDays(since time.Time) (days []time.Time) {
+	for d := trendBucket(since, "day"); !d.After(time.Now().UTC()); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return
+}
+
+func dayLabels(days []time.Time) (labels []string) {
+	for _, d := range days {
+		labels = append(labels, d.Format("01-02"))
+	}
+	return
+}
+
+func countFormat(v float64) string { return fmt.Sprintf("%.0f", v) }
+
+// failureChart counts drives that left the ok state per day in -driveDB.
+func failureChart(since time.Time) (c reportChart) {
+	c.Title = "Drive failures per day"
+	if driveDB == "" {
+		c.Note = "Set -driveDB to chart drive failures"
+		return
+	}
+	db, err := openDriveDB(true)
+	if err != nil {
+		c.Note = err.Error()
+		return
+	}
+	defer db.Close()
+
+	days := chartDays(since)
+	counts := make(map[time.Time]float64)
+	err = db.View(func(tx *bolt.Tx) error {
+		events := tx.Bucket(bucketEvents)
+		if events == nil {
+			return nil
+		}
+		return events.ForEachBucket(func(id []byte) error {
+			return events.Bucket(id).ForEach(func(_, v []byte) error {
+				var ev driveEvent
+				if err := json.Unmarshal(v, &ev); err != nil {
+					return err
+				}
+				if ev.Event == eventState && strings.HasPrefix(ev.State, "ok -> ") && !ev.Time.Before(since) {
+					counts[trendBucket(ev.Time, "day")]++
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		c.Note = err.Error()
+		return
+	}
+	values := make([]float64, len(days))
+	for i, d := range days {
+		values[i] = counts[d]
+	}
+	c.SVG = svgBars(dayLabels(days), values, countFormat)
+	return
+}
+
+// usageChart draws the used space of every pool per day from -snapshotDir.
+func usageChart(since time.Time) (c reportChart) {
+	c.Title = "Used space per pool"
+	if snapshotDir == "" {
+		c.Note = "Set -snapshotDir to chart usage growth"
+		return
+	}
+	files, err := snapshotFiles(snapshotDir, since)
+	if err != nil {
+		c.Note = err.Error()
+		return
+	}
+	if len(files) == 0 {
+		c.Note = "No snapshots in " + snapshotDir + " for this period"
+		return
+	}
+	t := buildTrend(files, "used", "day", "pool")
+	days := chartDays(since)
+	var series []chartSeries
+	for _, g := range t.Groups {
+		s := chartSeries{Name: "pool " + g, Values: make([]float64, len(days))}
+		for i, d := range days {
+			s.Values[i] = math.NaN()
+			if v, ok := t.Values[d][g]; ok {
+				s.Values[i] = float64(v)
+			}
+		}
+		series = append(series, s)
+	}
+	c.SVG = svgLines(dayLabels(days), series, func(v float64) string { return humanize.IBytes(uint64(v)) })
+	return
+}
+
+// healChart draws how long every heal job in -jobsDir ran, from its first
+// set starting to its last set finishing.
+func healChart(since time.Time) (c reportChart) {
+	c.Title = "Heal durations"
+	jobs, err := listJobs()
+	if err != nil {
+		c.Note = err.Error()
+		return
+	}
+	var labels []string
+	var values []float64
+	for _, j := range jobs {
+		if j.Type != "heal" || j.Created.Before(since) {
+			continue
+		}
+		var first, last time.Time
+		for _, s := range j.Steps {
+			if s.Finished == nil {
+				continue
+			}
+			if first.IsZero() || s.Started.Before(first) {
+				first = s.Started
+			}
+			if s.Finished.After(last) {
+				last = *s.Finished
+			}
+		}
+		if first.IsZero() {
+			continue
+		}
+		labels = append(labels, j.Created.Format("01-02 15:04"))
+		values = append(values, last.Sub(first).Minutes())
+	}
+	if len(values) == 0 {
+		c.Note = "No finished heal jobs in " + jobsDir + " for this period"
+		return
+	}
+	c.SVG = svgBars(labels, values, func(v float64) string { return time.Duration(v * float64(time.Minute)).Round(time.Second).String() })
+	return
+}
+
+// buildCharts renders the charts of the last -chartDays days.
+func buildCharts() []reportChart {
+	since := time.Now().UTC().AddDate(0, 0, -chartDaysBack)
+	return []reportChart{failureChart(since), usageChart(since), healChart(since)}
+}
@@ -0,0 +1,1148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// command describes a subcommand. Flags registers the command specific
+// flags, the global flags are added to every command.
+type command struct {
+	Name     string
+	Short    string
+	Args     string
+	Examples []string
+	Flags    func(fs *flag.FlagSet)
+	Run      func()
+	// Output is a value of the type the command prints as JSON, -schema
+	// describes it. Nil for commands without JSON output.
+	Output any
+}
+
+// cmdArgs holds the positional arguments left after flag parsing.
+var cmdArgs []string
+
+// flagsGiven are the flags set on the command line.
+var flagsGiven map[string]bool
+
+// flagNames returns the names of the flags register adds to fs.
+func flagNames(fs *flag.FlagSet, register func(*flag.FlagSet)) (names []string) {
+	known := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) { known[f.Name] = true })
+	register(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !known[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+	return
+}
+
+// credentialFlags take a secret as their value, redactArgs hides it.
+var credentialFlags = map[string]bool{
+	"key":         true,
+	"secret":      true,
+	"newKey":      true,
+	"newSecret":   true,
+	"consulToken": true,
+	"bmcPassword": true,
+}
+
+// redactArgs returns args with the values of credential flags masked, for
+// everything that stores or prints the command line.
+func redactArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !strings.HasPrefix(a, "-") || !credentialFlags[name] {
+			out = append(out, a)
+			continue
+		}
+		if hasValue {
+			out = append(out, a[:len(a)-len(value)]+"***")
+			continue
+		}
+		out = append(out, a)
+		if i+1 < len(args) {
+			out = append(out, "***")
+			i++
+		}
+	}
+	return out
+}
+
+var commands = []*command{
+	{
+		Name:   "info",
+		Short:  "Create a json output of core storage system information",
+		Run:    info,
+		Output: map[string]*Pool{},
+	},
+	{
+		Name:  "sets",
+		Short: "Shows which servers/disks are in which sets (can show broken sets too)",
+		Examples: []string{
+			"cluster-tool sets -endpoint 10.0.0.1 -port 9000 -badSetsOnly",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			fs.BoolVar(&badSetsOnly, "badSetsOnly", false, "Show only bad sets")
+		},
+		Run:    sets,
+		Output: map[string]map[int]*setSummary{},
+	},
+	{
+		Name:  "sets usage",
+		Short: "Shows the used space of every erasure set and flags sets above -setWarn and -setFail (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool sets usage -endpoint 10.0.0.1 -port 9000 -setWarn 75 -setFail 85",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			setSpaceFlags(fs)
+		},
+		Run:    setsUsage,
+		Output: []setUsage{},
+	},
+	{
+		Name:  "disks",
+		Short: "Shows a list of disks per server (can show broken disks too)",
+		Examples: []string{
+			"cluster-tool disks -endpoint 10.0.0.1 -port 9000 -badDisksOnly -wide",
+			"cluster-tool disks -endpoint 10.0.0.1 -port 9000 -wide -physical -sshKey ~/.ssh/id_ed25519",
+			"cluster-tool disks -endpoint 10.0.0.1 -port 9000 -latency -latencyFactor 4",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&badDisksOnly, "badDisksOnly", false, "Show only bad disks")
+			fs.BoolVar(&wideOutput, "wide", false, "Show capacity, usage, inodes and heal/scan state per disk")
+			fs.BoolVar(&physicalIDs, "physical", false, "Also show the block device, serial, WWN and enclosure slot of each disk, read over ssh with lsblk, smartctl and sg_ses")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts read concurrently with -physical")
+			fs.BoolVar(&showLatency, "latency", false, "Show per-drive latency and flag drives that are slow compared to their set")
+			fs.Float64Var(&latencyFactor, "latencyFactor", 3, "Flag drives whose latency is at least this multiple of their set's median")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json (with -latency)")
+			sshFlags(fs)
+		},
+		Run:    disks,
+		Output: []*driveLatency{},
+	},
+	{
+		Name:  "hostfile",
+		Short: "Generates hostfiles in -folder. Hosts that can not be rebooted will be placed in a file called 'failure'",
+		Examples: []string{
+			"cluster-tool hostfile -endpoint 10.0.0.1 -port 9000 -folder ./rounds",
+			"cluster-tool hostfile -endpoint 10.0.0.1 -port 9000 -stdout | cluster-tool health -hostfile - -port 9000",
+			"cluster-tool hostfile -endpoint 10.0.0.1 -port 9000 -topology ./racks.txt",
+			"cluster-tool hostfile -endpoint 10.0.0.1 -port 9000 -format json > rounds.json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&folder, "folder", "./cluster-hostfiles", "Hostfiles will be placed in this folder")
+			fs.BoolVar(&toStdout, "stdout", false, "Print rounds to stdout, separated by '# round N' lines, instead of writing files")
+			fs.StringVar(&hostfileFormat, "format", "text", "Output format: text writes round files, json prints one document with rounds, sets and unhealthy hosts")
+			fs.IntVar(&maxPerRound, "maxPerRound", 0, "Never place more than this many hosts in one round, 0 means no limit")
+			fs.StringVar(&topologyFile, "topology", "", "File of 'host domain' lines, hosts sharing a rack or zone are never placed in the same round")
+			hostFilterFlags(fs)
+		},
+		Run:    makeHostfile,
+		Output: hostfileDocument{},
+	},
+	{
+		Name:  "reboot",
+		Short: "Reboots servers defined in -hostfile",
+		Examples: []string{
+			"cluster-tool reboot -hostfile ./cluster-hostfiles/round-0 -port 9000 -dryRun=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "The list of hosts to be rebooted ('-' reads from stdin)")
+			rebootFlags(fs)
+			hostFilterFlags(fs)
+			checkpointFlags(fs)
+			healthFlags(fs)
+		},
+		Run: rebootHostfile,
+	},
+	{
+		Name:  "health",
+		Short: "Monitors the health endpoint of hosts defined in -hostfile",
+		Examples: []string{
+			"cluster-tool health -hostfile ./cluster-hostfiles/round-0 -port 9000 -checkDrives",
+			"cluster-tool health -hostfile ./cluster-hostfiles/round-0 -port 9000 -healthPath /minio/health/ready -maintenance=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "The list of hosts to be monitored for health ('-' reads from stdin)")
+			healthFlags(fs)
+		},
+		Run: healthCheck,
+	},
+	{
+		Name:  "rollout",
+		Short: "Reboots every round in -folder, waiting for hosts to become healthy between rounds",
+		Examples: []string{
+			"cluster-tool rollout -folder ./cluster-hostfiles -dryRun=false -window 22:00-06:00 -timezone Europe/Berlin",
+			"cluster-tool rollout -folder ./cluster-hostfiles -dryRun=false -canary 1 -soak 30m",
+			"cluster-tool rollout -folder ./cluster-hostfiles -dryRun=false -stageBy pool -pauseBetweenStages",
+		},
+		Flags: rolloutFlags,
+		Run:   rollout,
+	},
+	{
+		Name:  "heal",
+		Short: "Triggers erasure set healing on all sets on -endpoint (-abort stops them)",
+		Examples: []string{
+			"cluster-tool heal -endpoint 10.0.0.1 -port 9000 -allServers -priority risk -gentle",
+			"cluster-tool heal -endpoint 10.0.0.1 -port 9000 -abort",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&dryRun, "dryRun", true, "Only perform a dry run")
+			fs.BoolVar(&healAbort, "abort", false, "Force-stop heal sequences previously started by this tool")
+			fs.BoolVar(&healAllServers, "allServers", false, "Heal every set in every pool instead of only the sets on -endpoint")
+			fs.IntVar(&healWorkers, "healWorkers", 4, "Maximum number of sets healed concurrently")
+			fs.StringVar(&healPriority, "priority", "risk", "Order in which sets are healed: risk, usage or id")
+			fs.StringVar(&healMaxIO, "healMaxIO", "", "Set the server heal max_io while healing, restored afterwards")
+			fs.StringVar(&healMaxSleep, "healMaxSleep", "", "Set the server heal max_sleep while healing, restored afterwards")
+			fs.BoolVar(&healGentle, "gentle", false, "Heal slowly to protect production latency (max_io=10 max_sleep=1s)")
+			fs.BoolVar(&healAggressive, "aggressive", false, "Heal as fast as possible (max_io=1000 max_sleep=1ms)")
+			fs.StringVar(&healTokenFile, "healTokens", "./heal-tokens.json", "File used to record the client tokens of running heal sequences")
+			jobFlags(fs)
+			checkpointFlags(fs)
+			lockFlags(fs)
+		},
+		Run: heal,
+	},
+	{
+		Name:  "doctor",
+		Short: "Runs cluster sanity checks and prints a pass/warn/fail report (exits 1 on failures)",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			setSpaceFlags(fs)
+		},
+		Run:    doctor,
+		Output: []checkResult{},
+	},
+	{
+		Name:  "smoke",
+		Short: "Runs an S3 smoke test against -endpoint and reports pass/fail with latencies (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool smoke -endpoint 10.0.0.1 -port 9000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&smokeBucket, "bucket", "", "Bucket to create and delete, defaults to cluster-tool-smoke-<unix time>")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    smoke,
+		Output: []smokeStep{},
+	},
+	{
+		Name:  "host check",
+		Short: "Checks uptime, kernel, pending reboots, memory, data mounts, fstab, kernel tuning and with -bmcFile the hardware of hosts (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool host check -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool host check -endpoint 10.0.0.1 -port 9000 -hostfile ./cluster-hostfiles/round-0 -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Only check these hosts ('-' reads from stdin), defaults to every server")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts checked concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			bmcFlags(fs)
+			sshFlags(fs)
+		},
+		Run:    hostCheckCmd,
+		Output: []hostReport{},
+	},
+	{
+		Name:  "drive fscheck",
+		Short: "Runs read-only filesystem and kernel log checks for drives that are not ok and guesses the cause",
+		Examples: []string{
+			"cluster-tool drive fscheck -endpoint 10.0.0.1 -port 9000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Only check drives on these hosts ('-' reads from stdin)")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts checked concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    driveFscheck,
+		Output: []driveDiagnosis{},
+	},
+	{
+		Name:  "drive remount",
+		Short: "Mounts drives MinIO reports offline whose device is present but not mounted, then waits for MinIO to use them",
+		Examples: []string{
+			"cluster-tool drive remount -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool drive remount -endpoint 10.0.0.1 -port 9000 -hostfile ./hosts -yes",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Only remount drives on these hosts")
+			fs.BoolVar(&remountYes, "yes", false, "Do not ask before mounting each drive")
+			fs.DurationVar(&remountWait, "wait", 2*time.Minute, "How long to wait for MinIO to report remounted drives as ok")
+			lockFlags(fs)
+			sshFlags(fs)
+		},
+		Run: driveRemount,
+	},
+	{
+		Name:  "drive locate",
+		Short: "Blinks the bay LED of drives that are not ok with ledctl or sas3ircu and prints their enclosure and slot",
+		Args:  "[host:/path ...]",
+		Examples: []string{
+			"cluster-tool drive locate -endpoint 10.0.0.1 -port 9000 -on",
+			"cluster-tool drive locate -endpoint 10.0.0.1 -port 9000 -off node07:/mnt/drive12",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&locateOn, "on", false, "Switch the locate LED on")
+			fs.BoolVar(&locateOff, "off", false, "Switch the locate LED off")
+			fs.StringVar(&hostfile, "hostfile", "", "Only locate drives on these hosts ('-' reads from stdin)")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts handled concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    driveLocate,
+		Output: []driveLocation{},
+	},
+	{
+		Name:  "drive history",
+		Short: "Shows when a drive went offline, healed or was replaced, from -driveDB, or the drives that changed most without an argument",
+		Args:  "[uuid|endpoint|host:/path]",
+		Examples: []string{
+			"cluster-tool drive history -driveDB /var/lib/cluster-tool/drives.db",
+			"cluster-tool drive history -driveDB /var/lib/cluster-tool/drives.db node07:/mnt/drive12",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    driveHistory,
+		Output: jsonOneOf{[]driveHistoryEntry{}, driveHistoryEntry{}},
+	},
+	{
+		Name:  "runbook",
+		Short: "Writes a step-by-step Markdown runbook to replace the drives that are not ok, per host with serials, slots and commands",
+		Examples: []string{
+			"cluster-tool runbook -endpoint 10.0.0.1 -port 9000 -out drive-swap.md",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&runbookOut, "out", "", "File to write the runbook to, defaults to stdout")
+			fs.StringVar(&hostfile, "hostfile", "", "Only include drives on these hosts ('-' reads from stdin)")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts read concurrently")
+			sshFlags(fs)
+		},
+		Run: runbook,
+	},
+	{
+		Name:  "clock",
+		Short: "Measures clock skew between servers over ssh or the HTTP Date header (exits 1 above -maxSkew)",
+		Examples: []string{
+			"cluster-tool clock -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool clock -hostfile ./hosts -method http -port 9000 -maxSkew 2s",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Hosts to compare ('-' reads from stdin), defaults to every server")
+			fs.StringVar(&clockMethod, "method", "ssh", "How clocks are read: ssh (date +%s%N) or http (Date header)")
+			fs.DurationVar(&maxClockSkew, "maxSkew", time.Second, "Fail when any two servers are further apart than this")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    clockCmd,
+		Output: clockReport{},
+	},
+	{
+		Name:  "nettest",
+		Short: "Connects from every server to every other server on the MinIO port and prints the matrix (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool nettest -endpoint 10.0.0.1 -port 9000 -rtt",
+			"cluster-tool nettest -endpoint 10.0.0.1 -port 9000 -mtu",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to test ('-' reads from stdin), defaults to every server. -port is used as the MinIO port")
+			fs.BoolVar(&showRTT, "rtt", false, "Show connect times instead of ok/fail marks")
+			fs.BoolVar(&testMTU, "mtu", false, "Also compare interface MTUs and send full-size pings with the don't-fragment flag between servers")
+			fs.DurationVar(&netTimeout, "timeout", 3*time.Second, "Connect timeout for each probe")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of servers probing concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    nettest,
+		Output: jsonVersions{1: [][]netProbe{}, 2: netReport{}},
+	},
+	{
+		Name:  "ports",
+		Short: "Checks that the S3, console and SSH ports of every server are reachable and explains failures (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool ports -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool ports -hostfile ./hosts -port 9000 -consolePort 9001 -sshPort 2222 -nodes",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to check ('-' reads from stdin), defaults to every server. -port is used as the S3 port")
+			fs.StringVar(&consolePort, "consolePort", "9001", "MinIO console port")
+			fs.BoolVar(&checkNodes, "nodes", false, "Also connect from every server to the S3 and console ports of the others over SSH")
+			fs.DurationVar(&netTimeout, "timeout", 3*time.Second, "Connect timeout per port")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of concurrent checks")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    portsAudit,
+		Output: portsReport{},
+	},
+	{
+		Name:  "validate-endpoints",
+		Short: "Checks DNS forward and reverse resolution, TCP reachability, the TLS handshake, certificate SANs and expiry of every server endpoint (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool validate-endpoints -endpoint minio1.example.net -port 9000 -secure -days 30",
+			"cluster-tool validate-endpoints -hostfile ./hosts -port 9000 -secure -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to check ('-' reads from stdin), defaults to every server. -port is used as the S3 port")
+			fs.IntVar(&certExpiryDays, "days", 30, "Warn about certificates expiring within this many days")
+			fs.StringVar(&certCAFile, "caFile", "", "Verify the certificates against the CAs in this PEM file instead of the system roots")
+			fs.DurationVar(&netTimeout, "timeout", 3*time.Second, "Connect and handshake timeout per endpoint")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of endpoints checked concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    validateEndpoints,
+		Output: []hostReport{},
+	},
+	{
+		Name:  "notify check",
+		Short: "Lists the event notification targets every server loaded and checks that each server can reach them (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool notify check -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool notify check -hostfile ./hosts -port 9000 -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to check ('-' reads from stdin), defaults to every server. -port is used as the S3 port")
+			fs.DurationVar(&netTimeout, "timeout", 30*time.Second, "Timeout per server, servers connect to every target before answering")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of servers checked concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    notifyCheck,
+		Output: []hostReport{},
+	},
+	{
+		Name:  "accounts audit",
+		Short: "Lists users, service accounts and STS keys with their policies and expiry, flagging admin-equivalent and never expiring keys (exits 1 on admin-equivalent accounts)",
+		Examples: []string{
+			"cluster-tool accounts audit -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool accounts audit -endpoint 10.0.0.1 -port 9000 -json -where 'findings=~admin'",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    accountsAudit,
+		Output: []accountAudit{},
+	},
+	{
+		Name:  "policy lint",
+		Short: "Flags IAM policies that allow s3:* on every bucket, wildcard actions without conditions, policies attached to nothing and duplicates (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool policy lint -endpoint 10.0.0.1 -port 9000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    policyLint,
+		Output: []policyReport{},
+	},
+	{
+		Name:  "quota report",
+		Short: "Lists buckets with a quota, their usage and object counts and flags the ones near or over their quota (exits 1 on flagged buckets)",
+		Examples: []string{
+			"cluster-tool quota report -endpoint 10.0.0.1 -port 9000 -within 10",
+			"cluster-tool quota report -endpoint 10.0.0.1 -port 9000 -all -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.Float64Var(&quotaWithin, "within", 10, "Flag buckets whose usage is within this many percent of their quota")
+			fs.BoolVar(&quotaAll, "all", false, "List buckets without a quota as well")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    quotaReportCmd,
+		Output: quotaReport{},
+	},
+	{
+		Name:  "objectlock audit",
+		Short: "Lists buckets with object lock, their default retention and the object versions under legal hold or retention, flagging long governance retention",
+		Examples: []string{
+			"cluster-tool objectlock audit -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool objectlock audit -endpoint 10.0.0.1 -port 9000 -scan=false -longRetention 3650",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&lockScan, "scan", true, "Count the object versions under legal hold and retention, this lists every version of the buckets")
+			fs.IntVar(&lockLongRetention, "longRetention", 365, "Flag governance mode default retention of at least this many days")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    objectLockAudit,
+		Output: []objectLockBucket{},
+	},
+	{
+		Name:  "lifecycle audit",
+		Short: "Summarizes the lifecycle rules of every bucket, flagging versioned buckets that never expire noncurrent versions",
+		Examples: []string{
+			"cluster-tool lifecycle audit -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool lifecycle audit -endpoint 10.0.0.1 -port 9000 -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    lifecycleAudit,
+		Output: []lifecycleBucket{},
+	},
+	{
+		Name:  "tiers",
+		Short: "Lists the remote tiers, verifies the cluster can write to each and reports the data tiered and still pending transition per tier (exits 1 on unreachable tiers)",
+		Examples: []string{
+			"cluster-tool tiers -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool tiers -endpoint 10.0.0.1 -port 9000 -scan=false -json",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&tiersScan, "scan", true, "Count the versions due for transition that are not transitioned yet, this lists every version of the buckets transitioning to a tier")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    tiers,
+		Output: []tierReport{},
+	},
+	{
+		Name:  "bundle",
+		Short: "Collects storage info, sets, drives, health, doctor and host check results and recent logs into a tar.gz for support cases",
+		Examples: []string{
+			"cluster-tool bundle -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool bundle -endpoint 10.0.0.1 -port 9000 -redact -out case-1234.tar.gz",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&bundleOut, "out", "", "Archive to write, defaults to cluster-bundle-<timestamp>.tar.gz")
+			fs.BoolVar(&bundleRedact, "redact", false, "Replace host names and IP addresses with placeholders")
+			fs.IntVar(&bundleLogLines, "logLines", 1000, "Number of recent console log entries to include, 0 skips logs")
+			fs.BoolVar(&bundleHostChecks, "hostChecks", true, "Include host check results, this logs in to every server over SSH")
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to run host checks on ('-' reads from stdin), defaults to every server")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of servers checked concurrently")
+			healthFlags(fs)
+			sshFlags(fs)
+		},
+		Run: bundle,
+	},
+	{
+		Name:  "inspect",
+		Short: "Downloads the xl.meta and erasure coded parts of an object from every drive into an encrypted file for support, printing the decryption key separately",
+		Args:  "<bucket/object>",
+		Examples: []string{
+			"cluster-tool inspect -endpoint 10.0.0.1 -port 9000 photos/2024/img.jpg",
+			"cluster-tool inspect -endpoint 10.0.0.1 -port 9000 -metaOnly -out case-1234.enc 'photos/2024/*/xl.meta'",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&inspectOut, "out", "", "File to write, defaults to inspect-data.<key id>.enc")
+			fs.BoolVar(&inspectMetaOnly, "metaOnly", false, "Only collect xl.meta, not the parts")
+		},
+		Run: inspect,
+	},
+	{
+		Name:  "report",
+		Short: "Renders pools, sets with their parity margin, drive states, capacity and doctor results into a self-contained HTML page",
+		Examples: []string{
+			"cluster-tool report -endpoint 10.0.0.1 -port 9000 -html cluster.html",
+			"cluster-tool report -endpoint 10.0.0.1 -port 9000 -html monthly.html -charts -driveDB /var/lib/cluster-tool/drives.db -snapshotDir /var/lib/cluster-tool/snapshots",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&reportHTML, "html", "", "HTML file to write, - writes to stdout")
+			fs.BoolVar(&reportCharts, "charts", false, "Add SVG charts of drive failures from -driveDB, pool usage from -snapshotDir and heal durations from -jobsDir")
+			fs.IntVar(&chartDaysBack, "chartDays", 30, "Number of days the charts cover")
+			fs.StringVar(&snapshotDir, "snapshotDir", "", "Directory the snapshot schedule task of serve writes to")
+			fs.StringVar(&jobsDir, "jobsDir", "./cluster-jobs", "Directory heal jobs are recorded in")
+		},
+		Run: report,
+	},
+	{
+		Name:  "trend",
+		Short: "Shows bad disks, used or free space, or usage growth per pool or set over time from the snapshots in -snapshotDir",
+		Args:  "<baddisks|used|free|growth>",
+		Examples: []string{
+			"cluster-tool trend -snapshotDir /var/lib/cluster-tool/snapshots baddisks",
+			"cluster-tool trend -snapshotDir /var/lib/cluster-tool/snapshots -per set -by week -csv growth",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&snapshotDir, "snapshotDir", "", "Directory the snapshot schedule task of serve writes to")
+			fs.DurationVar(&trendLast, "last", 30*24*time.Hour, "How far back to read snapshots")
+			fs.StringVar(&trendBy, "by", "day", "One row per hour, day or week")
+			fs.StringVar(&trendPer, "per", "pool", "One column per pool or set")
+			fs.BoolVar(&trendCSV, "csv", false, "Print CSV with raw numbers instead of a table")
+		},
+		Run: trend,
+	},
+	{
+		Name:  "forecast",
+		Short: "Projects from the snapshots in -snapshotDir when each pool or set reaches 80%, 90% and full",
+		Examples: []string{
+			"cluster-tool forecast -snapshotDir /var/lib/cluster-tool/snapshots",
+			"cluster-tool forecast -snapshotDir /var/lib/cluster-tool/snapshots -per set -model seasonal -thresholds 70,85,full",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&snapshotDir, "snapshotDir", "", "Directory the snapshot schedule task of serve writes to")
+			fs.DurationVar(&trendLast, "last", 90*24*time.Hour, "How much history the models are fitted to")
+			fs.StringVar(&trendPer, "per", "pool", "Forecast per pool or set")
+			fs.StringVar(&forecastModel, "model", "linear", "linear fits a line to the history, seasonal repeats the last -season with the average growth per season")
+			fs.DurationVar(&forecastSeason, "season", 7*24*time.Hour, "Length of the usage cycle of the seasonal model")
+			fs.StringVar(&forecastThresholds, "thresholds", "80,90,full", "Comma separated usage percentages to forecast")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    forecast,
+		Output: []forecastResult{},
+	},
+	{
+		Name:  "exporter",
+		Short: "Serves bad drives per set, parity margins, drive states and the heal backlog as Prometheus metrics",
+		Examples: []string{
+			"cluster-tool exporter -endpoint 10.0.0.1 -port 9000 -listen :9102 -refresh 1m",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&exporterListen, "listen", ":9102", "Address to serve /metrics on")
+			fs.DurationVar(&exporterRefresh, "refresh", time.Minute, "How often cluster data is reloaded, scrapes are served from the last load")
+			setSpaceFlags(fs)
+		},
+		Run: exporter,
+	},
+	{
+		Name:  "export grafana",
+		Short: "Prints a Grafana dashboard for the metrics served by 'exporter', ready to import",
+		Examples: []string{
+			"cluster-tool export grafana > minio-cluster-tool.json",
+		},
+		Run: exportGrafana,
+	},
+	{
+		Name:  "serve",
+		Short: "Serves info, sets, disks, hostfile plans, heal and reboot rounds as a JSON REST API and a web UI from a periodically refreshed cluster model",
+		Examples: []string{
+			"cluster-tool serve -endpoint 10.0.0.1 -port 9000 -listen 127.0.0.1:9180 -refresh 1m",
+			"curl localhost:9180/v1/sets",
+			"curl -X POST 'localhost:9180/v1/heal?pool=1&set=2'",
+			"cluster-tool serve -endpoint 10.0.0.1 -port 9000 -dryRun=false -lb haproxy -lbAddress /run/haproxy.sock -lbBackend minio",
+			"cluster-tool serve -endpoint 10.0.0.1 -port 9000 -listen :9180 -tokenFile /etc/cluster-tool/tokens",
+			"cluster-tool serve -endpoint 10.0.0.1 -port 9000 -schedule /etc/cluster-tool/schedule -snapshotDir /var/lib/cluster-tool/snapshots",
+			"cluster-tool serve -endpoint 10.0.0.1 -port 9000 -oidcIssuer https://sso.example.com/realms/ops -oidcAudience cluster-tool -oidcRoles minio-admins=admin,staff=read",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&serveListen, "listen", "127.0.0.1:9180", "Address to serve the API on, any address but loopback needs -tokenFile or -oidcIssuer")
+			fs.DurationVar(&serveRefresh, "refresh", time.Minute, "How often the cluster model is reloaded")
+			fs.StringVar(&apiTokenFile, "tokenFile", "", "File with one 'role token [name]' line per API token, roles are read, operator (heal) and admin (reboot)")
+			fs.StringVar(&oidcIssuer, "oidcIssuer", "", "Also accept tokens from this OpenID Connect issuer")
+			fs.StringVar(&oidcAudience, "oidcAudience", "", "Audience OIDC tokens must be issued for, usually the client ID, required with -oidcIssuer")
+			fs.StringVar(&oidcRoleClaim, "oidcRoleClaim", "groups", "OIDC claim that is mapped to a role")
+			fs.StringVar(&oidcRoles, "oidcRoles", "", "Claim values mapped to roles, e.g. minio-admins=admin,storage-oncall=operator,staff=read")
+			fs.StringVar(&scheduleFile, "schedule", "", "File with one '<cron> <task> [args]' line per recurring task, tasks are doctor, heal <pool> <set> [deep] and snapshot")
+			fs.StringVar(&scheduleLog, "scheduleLog", "", "Append the result of every scheduled run to this file as a JSON line")
+			fs.StringVar(&snapshotDir, "snapshotDir", "", "Directory the snapshot task writes storage info snapshots to")
+			rebootFlags(fs)
+			healthFlags(fs)
+		},
+		Run: serve,
+	},
+	{
+		Name:  "lock status",
+		Short: "Shows who holds the operation lock in -lockBucket",
+		Examples: []string{
+			"cluster-tool lock status -endpoint 10.0.0.1 -port 9000 -lockBucket ops",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&lockBucket, "lockBucket", "", "Bucket the operation lock is kept in")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    lockStatus,
+		Output: lockInfo{},
+	},
+	{
+		Name:  "history",
+		Short: "Lists the operations recorded in -historyBucket, oldest first",
+		Examples: []string{
+			"cluster-tool history -endpoint 10.0.0.1 -port 9000 -historyBucket ops -last 50",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			historyFlags(fs)
+			fs.IntVar(&historyLast, "last", 20, "Only list this many of the most recent operations, 0 lists all")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    historyList,
+		Output: []historyEntry{},
+	},
+	{
+		Name:  "history show",
+		Short: "Shows the summary of one recorded operation",
+		Args:  "<id>",
+		Examples: []string{
+			"cluster-tool history show 20240101-220000-rollout-3fa9c2 -historyBucket ops",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			historyFlags(fs)
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    historyShow,
+		Output: historyEntry{},
+	},
+	{
+		Name:  "jobs list",
+		Short: "Lists the rollout and heal jobs recorded in -jobsDir",
+		Examples: []string{
+			"cluster-tool jobs list -jobsDir ./cluster-jobs",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&jobsDir, "jobsDir", "./cluster-jobs", "Directory job state is stored in")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    jobsList,
+		Output: []*job{},
+	},
+	{
+		Name:  "jobs status",
+		Short: "Shows the state and step by step progress of a job",
+		Args:  "<id>",
+		Examples: []string{
+			"cluster-tool jobs status rollout-20240101-220000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&jobsDir, "jobsDir", "./cluster-jobs", "Directory job state is stored in")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    jobsStatus,
+		Output: &job{},
+	},
+	{
+		Name:  "jobs cancel",
+		Short: "Asks a running job to stop after its current step",
+		Args:  "<id>",
+		Examples: []string{
+			"cluster-tool jobs cancel rollout-20240101-220000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&jobsDir, "jobsDir", "./cluster-jobs", "Directory job state is stored in")
+		},
+		Run: jobsCancel,
+	},
+	{
+		Name:  "jobs batch",
+		Short: "Lists the server side batch jobs (replicate, keyrotate, expire) with their progress and failures, -watch follows them until they finish (exits 1 on failures)",
+		Args:  "[id ...]",
+		Examples: []string{
+			"cluster-tool jobs batch -endpoint 10.0.0.1 -port 9000",
+			"cluster-tool jobs batch -endpoint 10.0.0.1 -port 9000 -type replicate -watch 10s",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&batchType, "type", "", "Only list jobs of this type: replicate, keyrotate or expire")
+			fs.DurationVar(&batchWatch, "watch", 0, "Refresh the list this often until no job is running, 0 lists them once")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    jobsBatch,
+		Output: []batchJob{},
+	},
+	{
+		Name:  "versions",
+		Short: "Lists the MinIO version, commit and uptime of every server and flags mismatches (exits 1 on skew)",
+		Examples: []string{
+			"cluster-tool versions -endpoint 10.0.0.1 -port 9000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+		},
+		Run:    versions,
+		Output: []serverVersion{},
+	},
+	{
+		Name:  "version",
+		Short: "Prints build information (-checkCompat compares it against the cluster)",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			fs.BoolVar(&checkCompat, "checkCompat", false, "Warn when servers on -endpoint run a newer MinIO than this build supports")
+		},
+		Run:    versionCmd,
+		Output: buildVersion{},
+	},
+	{
+		Name:  "self-update",
+		Short: "Replaces this binary with the latest verified release",
+		Examples: []string{
+			"cluster-tool self-update -checkOnly",
+			"cluster-tool self-update -publicKey '<minisign public key>'",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&updateRepo, "repo", "zveinn/minio-cluster-tool", "GitHub repository releases are fetched from")
+			fs.StringVar(&updatePublicKey, "publicKey", "", "Minisign public key used to verify the release checksums")
+			fs.BoolVar(&updateCheckOnly, "checkOnly", false, "Only report whether a newer release exists")
+			fs.BoolVar(&updateForce, "force", false, "Reinstall even if the latest release is already installed")
+			fs.BoolVar(&updateInsecure, "insecure", false, "Install the release without -publicKey, only its checksum is verified")
+		},
+		Run: selfUpdate,
+	},
+	{
+		Name:  "upgrade",
+		Short: "Upgrades every server to a MinIO release once its SHA256 and minisign signature are verified",
+		Examples: []string{
+			"cluster-tool upgrade -endpoint 10.0.0.1 -port 9000 -checkOnly",
+			"cluster-tool upgrade -endpoint 10.0.0.1 -port 9000 -release RELEASE.2024-01-01T00-00-00Z -dryRun=false -historyBucket ops",
+			"cluster-tool upgrade -binary ./minio.RELEASE.2024-01-01T00-00-00Z -folder ./cluster-hostfiles -port 9000 -dryRun=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&upgradeRelease, "release", "", "Release to install, e.g. RELEASE.2024-01-01T00-00-00Z, defaults to the latest")
+			fs.StringVar(&upgradeURL, "releaseURL", minioReleaseURL, "Release download site or a mirror of it, the servers download from it as well")
+			fs.StringVar(&upgradeArch, "arch", "linux-amd64", "Platform of the servers")
+			fs.StringVar(&upgradePublicKey, "publicKey", minioPublicKey, "Minisign public key the release binary has to be signed with")
+			fs.BoolVar(&upgradeCheckOnly, "checkOnly", false, "Only download and verify the release")
+			fs.StringVar(&upgradeBinary, "binary", "", "Install this local MinIO binary over ssh instead, restarting the hosts round by round like rollout, the rollout flags only apply with it. Its .sha256sum and .minisig from the release site have to be next to it")
+			fs.StringVar(&upgradeBinaryPath, "binaryPath", "/usr/local/bin/minio", "Path of the minio binary on the hosts, replaced with -binary")
+			upgradeRolloutFlags = flagNames(fs, rolloutFlags)
+		},
+		Run: upgrade,
+	},
+	{
+		Name:  "certs rotate",
+		Short: "Installs new TLS certificates on every host once they are validated, restarting minio round by round and rolling back hosts it fails to start on",
+		Examples: []string{
+			"cluster-tool certs rotate -certs ./certs -caFile ./ca.crt -port 9000 -secure -checkOnly",
+			"cluster-tool certs rotate -certs ./certs -folder ./cluster-hostfiles -port 9000 -secure -dryRun=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&certsSource, "certs", "", "Directory with public.crt and private.key, a subdirectory named after a host overrides them for that host")
+			fs.StringVar(&certsDir, "certsDir", "", "Certs directory of minio on the hosts, defaults to .minio/certs in the home of the unit's user")
+			fs.StringVar(&certCAFile, "caFile", "", "Require the certificates to chain to the CAs in this PEM file")
+			fs.IntVar(&certExpiryDays, "days", 30, "Warn about certificates expiring within this many days")
+			fs.BoolVar(&upgradeCheckOnly, "checkOnly", false, "Only validate the certificates")
+			rolloutFlags(fs)
+		},
+		Run:    certsRotate,
+		Output: []hostReport{},
+	},
+	{
+		Name:  "rotate-credentials",
+		Short: "Replaces the root credentials in the env file of every server, restarts them together and verifies admin access with the new ones, rolling back otherwise",
+		Examples: []string{
+			"CLUSTER_TOOL_NEW_SECRET=... cluster-tool rotate-credentials -endpoint 10.0.0.1 -port 9000",
+			"CLUSTER_TOOL_NEW_SECRET=... cluster-tool rotate-credentials -endpoint 10.0.0.1 -port 9000 -newKey admin2 -profile ~/.cluster-tool.env -dryRun=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&dryRun, "dryRun", true, "Only check the current credentials and print what would change")
+			fs.StringVar(&credentialsNewKey, "newKey", "", "New root user, defaults to the current -key")
+			fs.StringVar(&credentialsNewSecret, "newSecret", "", "New root password, $CLUSTER_TOOL_NEW_SECRET keeps it out of process listings and the history")
+			fs.StringVar(&provisionEnvFile, "envFile", "/etc/default/minio", "Path of the env file on the servers")
+			fs.StringVar(&credentialsProfile, "profile", "", "Env file with $CLUSTER_TOOL_KEY and $CLUSTER_TOOL_SECRET to update once the servers run with the new credentials")
+			fs.StringVar(&hostfile, "hostfile", "", "Servers to rotate ('-' reads from stdin), defaults to every server. -port is used as the S3 port")
+			fs.DurationVar(&unitTimeout, "unitTimeout", 2*time.Minute, "How long to wait for the minio unit to become active after the restart")
+			fs.BoolVar(&checkJournal, "checkJournal", true, "Fail if minio logged fatal errors after the restart")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of servers changed concurrently")
+			lockFlags(fs)
+			sshFlags(fs)
+		},
+		Run: rotateCredentials,
+	},
+	{
+		Name:  "provision",
+		Short: "Prepares new hosts for a pool over ssh: minio user, labeled XFS data drives in fstab, binary, env file and unit, then validates them",
+		Examples: []string{
+			"cluster-tool provision -drives '/dev/sd[b-e]' -volumes 'https://node{5...8}.example.net:9000/mnt/drive{1...4}' -binary ./minio.RELEASE.2024-01-01T00-00-00Z node5 node6 node7 node8",
+			"cluster-tool provision -hostfile ./expansion -drives '/dev/disk/by-id/nvme-*' -volumes '...' -dryRun=false",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&dryRun, "dryRun", true, "Only print what would change on the hosts")
+			fs.StringVar(&hostfile, "hostfile", "", "Hosts to provision ('-' reads from stdin), in addition to the ones given as arguments")
+			fs.StringVar(&provisionDrives, "drives", "", "Comma separated data drive devices or globs on the hosts, e.g. /dev/sd[b-m]")
+			fs.StringVar(&provisionMountPrefix, "mountPrefix", "/mnt/drive", "Drives are mounted on this prefix followed by their number, starting at 1")
+			fs.StringVar(&provisionLabelPrefix, "labelPrefix", "DRIVE", "Drives are labeled with this prefix followed by their number, fstab mounts them by label")
+			fs.BoolVar(&provisionWipe, "wipe", false, "Format drives that already have a filesystem or partition table")
+			fs.StringVar(&provisionUser, "user", "minio-user", "User minio runs as, it owns the drives")
+			fs.StringVar(&provisionVolumes, "volumes", "", "MINIO_VOLUMES of the env file, every pool of the cluster including the new one")
+			fs.StringVar(&provisionOpts, "opts", "--console-address :9001", "MINIO_OPTS of the env file")
+			fs.StringVar(&provisionEnvFile, "envFile", "/etc/default/minio", "Path of the env file on the hosts, -key and -secret are written to it as the root credentials")
+			fs.StringVar(&provisionEnvTemplate, "envTemplate", "", "Go template file for the env file, defaults to MINIO_VOLUMES, MINIO_OPTS and the root credentials")
+			fs.StringVar(&provisionUnitTemplate, "unitTemplate", "", "Go template file for "+minioUnitPath+", defaults to the unit MinIO ships")
+			fs.StringVar(&upgradeBinary, "binary", "", "MinIO binary to install, its .sha256sum and .minisig from the release site have to be next to it")
+			fs.StringVar(&upgradeBinaryPath, "binaryPath", "/usr/local/bin/minio", "Path of the minio binary on the hosts")
+			fs.StringVar(&upgradePublicKey, "publicKey", minioPublicKey, "Minisign public key the binary has to be signed with")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts validated concurrently")
+			sshFlags(fs)
+		},
+		Run: provision,
+	},
+	{
+		Name:  "expansion check",
+		Short: "Checks the hosts of a new pool before the expansion restart: ssh, consistent DNS from every server, empty XFS drives and the MinIO release (exits 1 on failures)",
+		Examples: []string{
+			"cluster-tool expansion check -endpoint 10.0.0.1 -port 9000 -pool 'https://node{5...8}.example.net:9000/mnt/drive{1...4}'",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&expansionPool, "pool", "", "The new pool as it will be added to MINIO_VOLUMES")
+			fs.StringVar(&upgradeBinaryPath, "binaryPath", "/usr/local/bin/minio", "Path of the minio binary on the new hosts")
+			fs.IntVar(&hostWorkers, "workers", 16, "Number of hosts checked concurrently")
+			fs.BoolVar(&jsonOutput, "json", false, "Print output in json")
+			sshFlags(fs)
+		},
+		Run:    expansionCheck,
+		Output: []hostReport{},
+	},
+	{
+		Name:  "operator",
+		Short: "Runs in a Kubernetes cluster and reconciles ClusterMaintenance resources: rolling restarts, heals and upgrades declared as YAML",
+		Examples: []string{
+			"cluster-tool operator manifests -image ghcr.io/zveinn/minio-cluster-tool:latest -namespace minio -endpoint minio.minio.svc -port 9000 | kubectl apply -f -",
+			"cluster-tool operator -kubeAPI http://127.0.0.1:8001 -namespace minio -endpoint 10.0.0.1 -port 9000",
+		},
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&operatorNamespace, "namespace", "", "Namespace whose ClusterMaintenance resources are reconciled, defaults to the namespace of the pod")
+			fs.StringVar(&operatorKubeAPI, "kubeAPI", "", "Kubernetes API URL without authentication, e.g. from 'kubectl proxy', defaults to the in-cluster service account")
+			fs.DurationVar(&operatorResync, "resync", 30*time.Second, "How often resources are listed and the status of the running one is updated")
+			fs.StringVar(&operatorWorkDir, "workDir", "./cluster-operator", "Directory the rounds, jobs and checkpoints of every resource are kept in")
+			sshFlags(fs)
+		},
+		Run: operator,
+	},
+	{
+		Name:  "operator manifests",
+		Short: "Prints the ClusterMaintenance CRD, RBAC and a Deployment running the operator",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&operatorNamespace, "namespace", "default", "Namespace the operator runs in")
+			fs.StringVar(&operatorImage, "image", "ghcr.io/zveinn/minio-cluster-tool:latest", "Container image of cluster-tool")
+			fs.StringVar(&operatorSecret, "credentialsSecret", "cluster-tool-credentials", "Secret with the accessKey and secretKey of the MinIO admin user")
+			fs.StringVar(&operatorSSHSecret, "sshSecret", "cluster-tool-ssh", "kubernetes.io/ssh-auth secret with the ssh-privatekey the hosts accept")
+		},
+		Run: operatorManifestsCmd,
+	},
+}
+
+// globalFlags are accepted by every command.
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&endpoint, "endpoint", "127.0.0.1", "server endpoint")
+	fs.StringVar(&port, "port", "", "minio API port, it is no longer the ssh port, see -sshPort")
+	fs.StringVar(&endpoints, "endpoints", "", "Comma separated servers, host or host:port, asked for server and storage info at the same time as -endpoint, the first answer is used")
+	fs.StringVar(&miniokey, "key", "minioadmin", "minio user/key, $CLUSTER_TOOL_KEY replaces the default")
+	fs.StringVar(&miniosecret, "secret", "minioadmin", "minio password/secret, $CLUSTER_TOOL_SECRET replaces the default")
+	fs.BoolVar(&secure, "secure", false, "Toggle SSL on/off")
+	fs.IntVar(&safetyMargin, "safetyMargin", 1, "Parity drives every set must keep available while a host is rebooted")
+	fs.BoolVar(&strictParity, "strictParity", false, "Count all drives a host has in a set as going offline, instead of one")
+	fs.Var(&rebootBadStates, "rebootBadStates", "Comma separated drive states that count against the parity of a set when deciding whether a host can reboot, on top of every drive that is not ok. 'healing' matches healing drives, e.g. 'healing'")
+	fs.Var(&badStates, "badStates", "Comma separated drive states that -badDisksOnly, -badSetsOnly, doctor, report, trend and the exporter treat as bad, same syntax as -rebootBadStates")
+	fs.StringVar(&otelEndpoint, "otelEndpoint", "", "Export OpenTelemetry spans to this OTLP/HTTP endpoint, e.g. localhost:4318")
+	fs.StringVar(&pushgateway, "pushgateway", "", "Push run summary metrics to this Prometheus Pushgateway, e.g. localhost:9091")
+	fs.StringVar(&pushJob, "pushJob", "minio_cluster_tool", "Job name used when pushing metrics")
+	fs.BoolVar(&printSchema, "schema", false, "Print the JSON Schema of the command's JSON output and exit")
+	fs.IntVar(&outputSchemaVersion, "schemaVersion", 1, "Version of the JSON output, 1 prints the bare data, 2 wraps it in a {schemaVersion, command, data} envelope")
+	fs.StringVar(&queryFields, "fields", "", "Print only these comma separated fields of the JSON output, which is flattened into one record per drive, host or row, e.g. pool,server,state")
+	fs.StringVar(&queryWhere, "where", "", "Print only the JSON output records matching the expression, e.g. 'state!=ok && pool==2'. Operators are == != < <= > >= =~ !~ && || ! and parentheses")
+	fs.StringVar(&outputFormat, "output", "", "Output format of commands with JSON output: json, go-template=TEMPLATE or go-template-file=PATH. Templates run on the data documented by -schema and can use json, join, upper, lower and bytes")
+	fs.StringVar(&driveDB, "driveDB", os.Getenv("CLUSTER_TOOL_DRIVE_DB"), "Record drive state changes in this database whenever storage info is loaded (default $CLUSTER_TOOL_DRIVE_DB)")
+}
+
+// rebootFlags are shared by the commands that reboot hosts.
+func rebootFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&dryRun, "dryRun", true, "Only perform a dry run")
+	fs.BoolVar(&minioOnly, "minioOnly", true, "Only restart minio, not the server itself")
+	fs.BoolVar(&reloadOnly, "reload", false, "Reload minio through the ExecReload of its unit for config only changes instead of restarting it, hosts are not drained and rounds are not health gated")
+	fs.BoolVar(&waitHealBacklog, "waitHealBacklog", false, "Wait for the background heal backlog to drain before rebooting")
+	fs.IntVar(&healBacklogMax, "healBacklogMax", 0, "Maximum number of drives still healing when `-waitHealBacklog` is set")
+	fs.BoolVar(&healBetweenRounds, "healBetweenRounds", false, "Once rebooted hosts are healthy, heal the sets they belong to and wait for it before continuing")
+	fs.IntVar(&healWorkers, "healWorkers", 4, "With -healBetweenRounds the maximum number of sets healed concurrently")
+	fs.StringVar(&healTokenFile, "healTokens", "./heal-tokens.json", "File used to record the client tokens of running heal sequences, heal -abort stops them")
+	fs.DurationVar(&rebootStagger, "stagger", 0, "Wait this long between two hosts of a round, e.g. 30s")
+	fs.BoolVar(&forceReboot, "force", false, "Reboot even if the pre-flight safety checks fail")
+	fs.StringVar(&rebootSince, "since", "", "Skip hosts that already rebooted, or restarted minio with -minioOnly, after this RFC3339 time or this long ago, e.g. 3h. Resumed rollouts default to the start of the job")
+	fs.BoolVar(&verifyReboot, "verifyReboot", true, "Confirm the boot id of rebooted hosts changed, or the minio unit started again with -minioOnly")
+	fs.DurationVar(&verifyTimeout, "verifyTimeout", 15*time.Minute, "How long to wait for a rebooted host to come back with a new boot id")
+	fs.DurationVar(&unitTimeout, "unitTimeout", 2*time.Minute, "With -minioOnly wait this long for the minio unit to be active again after the restart, 0 does not wait")
+	fs.BoolVar(&checkJournal, "checkJournal", false, "With -minioOnly also look for fatal errors minio logged to the journal since the restart")
+	fs.BoolVar(&forceAll, "forceAll", false, "Reboot every host, even the ones that already rebooted since -since or the start of the resumed job")
+	fs.StringVar(&lbType, "lb", "", "Drain hosts from a load balancer while they reboot: haproxy, nginx or webhook")
+	fs.StringVar(&lbAddress, "lbAddress", "", "HAProxy runtime API socket or host:port, NGINX Plus API URL or webhook URL")
+	fs.StringVar(&lbBackend, "lbBackend", "", "HAProxy backend or NGINX upstream containing the hosts")
+	fs.DurationVar(&drainWait, "drainWait", 10*time.Second, "Time to wait after draining a host before stopping minio")
+	fs.StringVar(&consulService, "consulService", "", "Take this Consul service ID out of service on each host while it reboots")
+	fs.StringVar(&consulPort, "consulPort", "8500", "Port of the Consul agent HTTP API on each host")
+	fs.StringVar(&consulToken, "consulToken", "", "Consul ACL token")
+	fs.StringVar(&consulMode, "consulMode", "maintenance", "How the service is taken out: maintenance or deregister")
+	fs.StringVar(&consulSaveDir, "consulSaveDir", "./consul-services", "With -consulMode deregister keep the service definitions here until the hosts are registered again")
+	fs.BoolVar(&kubeDrain, "kubeDrain", false, "Cordon and drain the Kubernetes node of each host before rebooting and uncordon it after")
+	fs.StringVar(&kubeContext, "kubeContext", "", "kubectl context to use, defaults to the current context")
+	fs.StringVar(&kubeNamespace, "kubeNamespace", "", "Namespace of the MinIO pods, hosts are resolved to the node of their pod. Without it hosts are node names")
+	fs.DurationVar(&kubeDrainTimeout, "kubeDrainTimeout", 10*time.Minute, "Give up draining a node after this long, for example when a PodDisruptionBudget blocks eviction")
+	fs.BoolVar(&powerCycleFallback, "powerCycle", false, "Power cycle hosts through their BMC when ssh fails or they do not come back after a reboot, needs -bmcFile")
+	bmcFlags(fs)
+	lockFlags(fs)
+	sshFlags(fs)
+}
+
+// rolloutFlags are shared by the commands that restart hosts round by round.
+func rolloutFlags(fs *flag.FlagSet) {
+	fs.StringVar(&folder, "folder", "./cluster-hostfiles", "Folder containing the round files created by `hostfile`")
+	rebootFlags(fs)
+	fs.StringVar(&window, "window", "", "Only start rounds inside this daily window, e.g. 22:00-06:00")
+	fs.DurationVar(&roundDelay, "roundDelay", 0, "Pause this long after a round before starting the next one, e.g. 10m")
+	fs.IntVar(&canaryHosts, "canary", 0, "Reboot this many hosts of the first round on their own first, verify them, wait -soak and run the smoke test before the other rounds")
+	fs.DurationVar(&canarySoak, "soak", 15*time.Minute, "How long the -canary hosts run before they are verified again")
+	fs.BoolVar(&verifyQuorum, "verifyQuorum", true, "After each round verify that every set has write quorum and no more offline drives than before, abort otherwise")
+	fs.DurationVar(&degradeInterval, "degradeInterval", 30*time.Second, "While a round runs check this often whether drives outside the round went bad, 0 disables the check")
+	fs.StringVar(&onDegrade, "onDegrade", "abort", "What to do when drives outside the round go bad: abort stops after the round, pause waits until they recover")
+	fs.StringVar(&alertWebhook, "alertWebhook", "", "POST {\"event\",\"command\",\"problems\"} JSON to this URL when the cluster degrades or recovers")
+	fs.StringVar(&timezone, "timezone", "Local", "Timezone used to evaluate `-window`, e.g. Europe/Berlin")
+	fs.StringVar(&stageBy, "stageBy", "", "Finish and verify the rounds of one pool before the next pool starts: pool")
+	fs.BoolVar(&pauseStages, "pauseBetweenStages", false, "Ask for approval before every -stageBy stage after the first, declining stops the job until it is resumed")
+	healthFlags(fs)
+	jobFlags(fs)
+	hostFilterFlags(fs)
+	checkpointFlags(fs)
+}
+
+// bmcFlags are shared by the commands that talk to the BMCs of hosts.
+func bmcFlags(fs *flag.FlagSet) {
+	fs.StringVar(&bmcFile, "bmcFile", "", "File with one 'host address [redfish|ipmi]' line per host")
+	fs.StringVar(&bmcUser, "bmcUser", "admin", "BMC user")
+	fs.StringVar(&bmcPasswordFile, "bmcPasswordFile", "", "File with the BMC password, defaults to $BMC_PASSWORD")
+}
+
+// lockFlags are shared by the commands that change the cluster.
+func lockFlags(fs *flag.FlagSet) {
+	fs.StringVar(&lockBucket, "lockBucket", "", "Take an operation lock in this bucket so only one operator changes the cluster at a time")
+	fs.DurationVar(&lockTTL, "lockTTL", 5*time.Minute, "The lock is renewed while the tool runs and expires this long after it died")
+	fs.BoolVar(&stealLock, "steal", false, "Take the operation lock even if someone else holds it, for emergencies only")
+	historyFlags(fs)
+}
+
+// historyFlags are shared by the commands that record or read operation
+// summaries.
+func historyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&historyBucket, "historyBucket", "", "Bucket operation summaries are recorded in, see 'history'")
+}
+
+// jobFlags are shared by the commands that run as jobs.
+func jobFlags(fs *flag.FlagSet) {
+	fs.StringVar(&jobsDir, "jobsDir", "./cluster-jobs", "Directory job state is stored in, empty disables job tracking")
+	fs.StringVar(&resumeJobID, "resume", "", "Resume this interrupted job, skipping the steps it already finished")
+}
+
+// sshFlags are shared by the commands that run commands on hosts.
+func sshFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sshUser, "sshUser", "root", "User to ssh in as")
+	fs.StringVar(&sshPort, "sshPort", "22", "ssh port of the hosts, hosts without ssh on it are tried on -port as before -sshPort existed")
+	fs.StringVar(&sshKey, "sshKey", "", "Private key file, defaults to the ssh agent and the keys in ~/.ssh")
+	fs.DurationVar(&sshCommandTimeout, "sshCommandTimeout", 5*time.Minute, "Kill a remote command and mark the host failed if it runs longer than this, 0 waits forever")
+	fs.IntVar(&sshRetries, "sshRetries", 3, "Number of times a failed ssh connection is retried, with exponential backoff")
+}
+
+// healthFlags are shared by the commands that wait for hosts to be healthy.
+func healthFlags(fs *flag.FlagSet) {
+	fs.IntVar(&healthWorkers, "healthWorkers", 16, "Number of hosts polled for health concurrently")
+	fs.DurationVar(&healthTimeout, "healthTimeout", 10*time.Second, "Timeout for a single host health request")
+	fs.StringVar(&healthPath, "healthPath", "/minio/health/cluster", "Health endpoint to poll, e.g. /minio/health/live or /minio/health/ready")
+	fs.BoolVar(&healthMaintenance, "maintenance", true, "Add maintenance=true to the health request, the cluster endpoint then also checks that the host can be taken down")
+	fs.StringVar(&canaryBucket, "canaryBucket", "", "Also PUT, GET and DELETE a small object in this bucket through each host before it counts as healthy")
+	fs.BoolVar(&checkDrives, "checkDrives", false, "Also require every drive of a host to be ok in storage info before it counts as healthy")
+	fs.DurationVar(&healthInterval, "interval", 30*time.Second, "Time between health polls of the hosts that are not healthy yet")
+	fs.DurationVar(&healthMaxWait, "maxWait", 0, "Give up on hosts that are not healthy after this long and report them as timed out, 0 waits forever")
+}
+
+// findCommand matches args against the command table. Commands made of
+// several words, like "drive history", take precedence over shorter ones.
+func findCommand(args []string) (cmd *command, rest []string) {
+	for _, c := range commands {
+		words := strings.Fields(c.Name)
+		if len(words) > len(args) {
+			continue
+		}
+		match := true
+		for i, w := range words {
+			if args[i] != w {
+				match = false
+				break
+			}
+		}
+		if match && (cmd == nil || len(words) > len(strings.Fields(cmd.Name))) {
+			cmd = c
+			rest = args[len(words):]
+		}
+	}
+	return
+}
+
+func printCommands() {
+	fmt.Println("")
+	fmt.Println(" Usage: cluster-tool <command> [flags]")
+	fmt.Println("")
+	fmt.Println(" Available commands")
+	fmt.Println(" -----------------------------")
+	for _, c := range commands {
+		fmt.Printf(" %-18s %s\n", c.Name, c.Short)
+	}
+	fmt.Println(" -----------------------------")
+	fmt.Println(" Run 'cluster-tool <command> --help' for the flags of a command")
+	fmt.Println("")
+}
+
+func printFlags(register func(fs *flag.FlagSet)) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	register(fs)
+	fs.SetOutput(os.Stderr)
+	fs.PrintDefaults()
+}
+
+func commandUsage(c *command) func() {
+	return func() {
+		out := os.Stderr
+		usage := "cluster-tool " + c.Name + " [flags]"
+		if c.Args != "" {
+			usage += " " + c.Args
+		}
+		fmt.Fprintf(out, "\n%s\n\nUsage:\n  %s\n", c.Short, usage)
+		if len(c.Examples) > 0 {
+			fmt.Fprintf(out, "\nExamples:\n")
+			for _, e := range c.Examples {
+				fmt.Fprintf(out, "  %s\n", e)
+			}
+		}
+		if c.Flags != nil {
+			fmt.Fprintf(out, "\nFlags:\n")
+			printFlags(c.Flags)
+		}
+		fmt.Fprintf(out, "\nGlobal flags:\n")
+		printFlags(globalFlags)
+		fmt.Fprintln(out)
+	}
+}
+
+// parseArgs selects the command from os.Args and parses its flags.
+func parseArgs() (cmd *command) {
+	if len(os.Args) < 2 {
+		fmt.Println("invalid number of arguments.. try --help")
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "help", "-h", "-help", "--help":
+		if len(os.Args) > 2 {
+			if c, _ := findCommand(os.Args[2:]); c != nil {
+				commandUsage(c)()
+				os.Exit(0)
+			}
+		}
+		printCommands()
+		os.Exit(0)
+	}
+
+	cmd, rest := findCommand(os.Args[1:])
+	if cmd == nil {
+		fmt.Println("unknown command:", os.Args[1])
+		printCommands()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet(cmd.Name, flag.ExitOnError)
+	fs.Usage = commandUsage(cmd)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	globalFlags(fs)
+	_ = fs.Parse(rest)
+	cmdArgs = fs.Args()
+
+	// Credentials from the environment stay out of process listings and the
+	// arguments recorded in job files.
+	flagsGiven = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { flagsGiven[f.Name] = true })
+	if v := os.Getenv("CLUSTER_TOOL_KEY"); v != "" && !flagsGiven["key"] {
+		miniokey = v
+	}
+	if v := os.Getenv("CLUSTER_TOOL_SECRET"); v != "" && !flagsGiven["secret"] {
+		miniosecret = v
+	}
+	return
+}
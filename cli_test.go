@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+// TestCommandFlags registers the flags of every command the way parseArgs
+// does, a flag registered twice panics.
+func TestCommandFlags(t *testing.T) {
+	for _, c := range commands {
+		t.Run(c.Name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatal(r)
+				}
+			}()
+			fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			if c.Flags != nil {
+				c.Flags(fs)
+			}
+			globalFlags(fs)
+		})
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{
+			name: "separate values",
+			in:   []string{"rollout", "-key", "admin", "-secret", "s3cr3t", "-dryRun=false"},
+			want: []string{"rollout", "-key", "***", "-secret", "***", "-dryRun=false"},
+		},
+		{
+			name: "inline values and double dashes",
+			in:   []string{"rotate-credentials", "--newSecret=s3cr3t", "-consulToken=t"},
+			want: []string{"rotate-credentials", "--newSecret=***", "-consulToken=***"},
+		},
+		{
+			name: "other flags are kept",
+			in:   []string{"serve", "-sshKey", "/etc/key", "-tokenFile", "tokens", "-secure"},
+			want: []string{"serve", "-sshKey", "/etc/key", "-tokenFile", "tokens", "-secure"},
+		},
+		{
+			name: "flag without a value",
+			in:   []string{"heal", "-secret"},
+			want: []string{"heal", "-secret"},
+		},
+		{
+			name: "positional arguments",
+			in:   []string{"jobs", "status", "secret"},
+			want: []string{"jobs", "status", "secret"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactArgs(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockOffset is how far the clock of Host is ahead of the local clock.
+type clockOffset struct {
+	Host   string
+	Offset time.Duration
+	RTT    time.Duration
+	Error  string `json:",omitempty"`
+}
+
+// clockReport is the -json output of clock.
+type clockReport struct {
+	Hosts   []clockOffset
+	MaxSkew time.Duration
+}
+
+// sshClockOffset reads the host clock with date +%s%N and assumes it was
+// sampled halfway through the round trip.
+func sshClockOffset(host string) (offset time.Duration, rtt time.Duration, err error) {
+	// Connect first so the handshake is not part of the round trip.
+	_, err = sshClient(host)
+	if err != nil {
+		return 0, 0, err
+	}
+	before := time.Now()
+	out, err := runSSH(host, "date +%s%N")
+	rtt = time.Since(before)
+	if err != nil {
+		return 0, rtt, err
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, rtt, fmt.Errorf("unexpected date output %q", strings.TrimSpace(string(out)))
+	}
+	mid := before.Add(rtt / 2)
+	return time.Unix(0, ns).Sub(mid), rtt, nil
+}
+
+// clockTargets returns the hosts from -hostfile, or every server of the
+// cluster.
+func clockTargets() (hosts []string) {
+	if hostfile != "" {
+		hosts, err := readHostfile(hostfile)
+		if err != nil {
+			panic(err)
+		}
+		return hosts
+	}
+
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	info, err := clusterServerInfo()
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range info.Servers {
+		h := s.Endpoint
+		if clockMethod == "ssh" {
+			h = strings.Split(s.Endpoint, ":")[0]
+		}
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return
+}
+
+func measureClocks(hosts []string) (offsets []clockOffset) {
+	offsets = make([]clockOffset, len(hosts))
+	wg := new(sync.WaitGroup)
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h string) {
+			defer wg.Done()
+			o := clockOffset{Host: h}
+			var err error
+			if clockMethod == "ssh" {
+				o.Offset, o.RTT, err = sshClockOffset(h)
+			} else {
+				hostport := h
+				if !strings.Contains(h, ":") {
+					hostport = h + ":" + port
+				}
+				before := time.Now()
+				o.Offset, err = serverClockOffset(hostport)
+				o.RTT = time.Since(before)
+			}
+			if err != nil {
+				o.Error = err.Error()
+			}
+			offsets[i] = o
+		}(i, h)
+	}
+	wg.Wait()
+	return
+}
+
+func clockCmd() {
+	if clockMethod != "ssh" && clockMethod != "http" {
+		panic("invalid -method " + clockMethod + ", expected ssh or http")
+	}
+	offsets := measureClocks(clockTargets())
+
+	var minO, maxO *clockOffset
+	for i := range offsets {
+		o := &offsets[i]
+		if o.Error != "" {
+			exitCode = 1
+			continue
+		}
+		if minO == nil || o.Offset < minO.Offset {
+			minO = o
+		}
+		if maxO == nil || o.Offset > maxO.Offset {
+			maxO = o
+		}
+	}
+	var skew time.Duration
+	if minO != nil {
+		skew = maxO.Offset - minO.Offset
+	}
+	if skew > maxClockSkew {
+		exitCode = 1
+	}
+
+	if jsonOutput {
+		jsonOut(clockReport{offsets, skew})
+		return
+	}
+
+	for _, o := range offsets {
+		if o.Error != "" {
+			fmt.Printf("%-30s error %s\n", o.Host, o.Error)
+			continue
+		}
+		fmt.Printf("%-30s offset %12s rtt %s\n", o.Host, o.Offset.Round(time.Microsecond), o.RTT.Round(time.Microsecond))
+	}
+	if minO == nil {
+		return
+	}
+	status := "OK"
+	if skew > maxClockSkew {
+		status = "FAIL"
+	}
+	fmt.Printf("%s max skew %s between %s and %s (threshold %s)\n", status, skew.Round(time.Microsecond), minO.Host, maxO.Host, maxClockSkew)
+	if clockMethod == "http" {
+		fmt.Println("The HTTP Date header only has second precision, use -method ssh for exact numbers")
+	}
+}
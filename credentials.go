@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// setEnvValues sets the variables in values in an env file, replacing their
+// lines or appending them. Every other line is kept as it is.
+func setEnvValues(data []byte, values map[string]string) []byte {
+	set := make(map[string]bool)
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		name, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+		export, isExport := strings.CutPrefix(name, "export ")
+		if isExport {
+			name = strings.TrimSpace(export)
+		}
+		if v, found := values[name]; ok && found {
+			if isExport {
+				out.WriteString("export ")
+			}
+			fmt.Fprintf(&out, "%s=%s\n", name, v)
+			set[name] = true
+			continue
+		}
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n")
+		}
+	}
+	for _, name := range stringKeysSorted(values) {
+		if !set[name] {
+			fmt.Fprintf(&out, "%s=%s\n", name, values[name])
+		}
+	}
+	return out.Bytes()
+}
+
+// adminAs returns an admin client for one server with the given credentials.
+func adminAs(addr, key, secret string) (*madmin.AdminClient, error) {
+	return madmin.NewWithOptions(addr, &madmin.Options{
+		Creds:     credentials.NewStaticV4(key, secret, ""),
+		Secure:    secure,
+		Transport: DefaultTransport(secure),
+	})
+}
+
+// checkAdminAccess asks every server for the server info with the
+// credentials until all of them answer or wait passed.
+func checkAdminAccess(nodes []netNode, key, secret string, wait time.Duration) (failed map[string]error) {
+	deadline := time.Now().Add(wait)
+	for {
+		failed = make(map[string]error)
+		for _, n := range nodes {
+			client, err := adminAs(n.Addr, key, secret)
+			if err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				_, err = client.ServerInfo(ctx)
+				cancel()
+			}
+			if err != nil {
+				failed[n.Addr] = err
+			}
+		}
+		if len(failed) == 0 || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// onNodes runs fn for every node with -workers at a time and returns the
+// errors by ssh host.
+func onNodes(nodes []netNode, fn func(n netNode) error) (failed map[string]error) {
+	failed = make(map[string]error)
+	lock := new(sync.Mutex)
+	sem := make(chan struct{}, max(hostWorkers, 1))
+	wg := new(sync.WaitGroup)
+	for _, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n netNode) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(n); err != nil {
+				lock.Lock()
+				failed[n.SSH] = err
+				lock.Unlock()
+			}
+		}(n)
+	}
+	wg.Wait()
+	return
+}
+
+func printFailed(what string, failed map[string]error) {
+	fmt.Printf("%s failed on %d servers:\n", what, len(failed))
+	for _, h := range stringKeysSorted(failed) {
+		fmt.Printf("  %s: %v\n", h, failed[h])
+	}
+}
+
+// writeCredentials replaces the root credentials in the env file of host.
+// The file it replaces is kept as .old until the rotation is verified.
+func writeCredentials(host, key, secret string) error {
+	f := shellQuote(provisionEnvFile)
+	old, err := runSSH(host, "sudo cat "+f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w: %s", provisionEnvFile, err, strings.TrimSpace(string(old)))
+	}
+	data := setEnvValues(old, map[string]string{"MINIO_ROOT_USER": key, "MINIO_ROOT_PASSWORD": secret})
+	dir, err := stagingDir(host)
+	if err != nil {
+		return err
+	}
+	defer removeStaging(host, dir)
+	err = scpUpload(host, dir, "env", data, 0o600)
+	if err != nil {
+		return fmt.Errorf("copying the env file: %w", err)
+	}
+	// The copies keep the owner and mode of the env file, it is renamed
+	// over the old one so systemd never reads half a file.
+	cmd := fmt.Sprintf(`f=%s; sudo cp -p "$f" "$f.old" && sudo cp -p "$f" "$f.new" && sudo tee "$f.new" < %s > /dev/null && sudo mv -f "$f.new" "$f"`, f, shellQuote(dir+"/env"))
+	output, err := runSSH(host, cmd)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w: %s", provisionEnvFile, err, strings.TrimSpace(string(output)))
+	}
+	written, err := runSSH(host, "sudo cat "+f)
+	if err != nil || !bytes.Equal(written, data) {
+		return fmt.Errorf("%s does not have the new credentials after writing it", provisionEnvFile)
+	}
+	fmt.Println("Wrote the new credentials to", host+":"+provisionEnvFile)
+	return nil
+}
+
+// restoreCredentials puts the env file with the old credentials back.
+func restoreCredentials(host string) error {
+	f := shellQuote(provisionEnvFile)
+	output, err := runSSH(host, fmt.Sprintf(`f=%s; sudo test -e "$f.old" && sudo mv -f "$f.old" "$f"`, f))
+	if err != nil {
+		return fmt.Errorf("restoring %s: %w: %s", provisionEnvFile+".old", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// restartAll restarts minio on every node at once and waits for the units.
+func restartAll(nodes []netNode) (failed map[string]error) {
+	return onNodes(nodes, func(n netNode) error {
+		restarted := time.Now()
+		output, err := runSSH(n.SSH, "sudo systemctl restart minio")
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+		}
+		touchHost(n.SSH)
+		return waitUnitActive(n.SSH, restarted)
+	})
+}
+
+// writeProfile sets the credentials in the env file -profile, which is
+// meant to be sourced before running the tool.
+func writeProfile(path, key, secret string) error {
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	data := setEnvValues(old, map[string]string{"CLUSTER_TOOL_KEY": key, "CLUSTER_TOOL_SECRET": secret})
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rotateCredentials replaces the root credentials of the cluster. The
+// servers of a deployment authenticate with each other using the root
+// credentials, so every env file is written first and all servers restart
+// together. Restarting them round by round would leave two halves of the
+// cluster that cannot talk to each other. When the servers do not all come
+// back with the new credentials the old env files are put back and the
+// servers restart again.
+func rotateCredentials() {
+	newKey, newSecret := credentialsNewKey, credentialsNewSecret
+	if v := os.Getenv("CLUSTER_TOOL_NEW_SECRET"); v != "" && newSecret == "" {
+		newSecret = v
+	}
+	if newKey == "" {
+		newKey = miniokey
+	}
+	switch {
+	case newSecret == "":
+		panic("-newSecret or $CLUSTER_TOOL_NEW_SECRET is required")
+	case len(newKey) < 3:
+		panic("the new key has to be at least 3 characters")
+	case len(newSecret) < 8:
+		panic("the new secret has to be at least 8 characters")
+	case strings.ContainsAny(newKey+newSecret, " \t\r\n'\"\\$`#"):
+		panic("the new key and secret cannot contain whitespace, quotes, backslashes, $, ` or #")
+	case newKey == miniokey && newSecret == miniosecret:
+		panic("the new credentials are the current ones")
+	}
+
+	nodes := netNodes()
+	if len(nodes) == 0 {
+		fmt.Println("No servers found")
+		return
+	}
+	fmt.Printf("Checking admin access with the current credentials on %d servers\n", len(nodes))
+	if failed := checkAdminAccess(nodes, miniokey, miniosecret, 0); len(failed) > 0 {
+		printFailed("Admin access", failed)
+		panic("the current credentials do not work on every server, fix that first")
+	}
+	// A server left with the old credentials cannot talk to the others.
+	if hostfile != "" {
+		client, err := adminAs(nodes[0].Addr, miniokey, miniosecret)
+		if err != nil {
+			panic(err)
+		}
+		info, err := client.ServerInfo(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		if len(info.Servers) != len(nodes) {
+			panic(fmt.Sprintf("-hostfile lists %d servers but the cluster has %d, every server needs the new credentials", len(nodes), len(info.Servers)))
+		}
+	}
+
+	if dryRun {
+		for _, n := range nodes {
+			fmt.Printf("Would write the new credentials to %s:%s\n", n.SSH, provisionEnvFile)
+		}
+		fmt.Printf("Would restart minio on %d servers at once and check admin access with the new credentials\n", len(nodes))
+		if credentialsProfile != "" {
+			fmt.Println("Would write the new credentials to", credentialsProfile)
+		}
+		return
+	}
+
+	l := acquireLock(lockOperation())
+	defer l.release()
+
+	written := make(map[string]bool)
+	lock := new(sync.Mutex)
+	failed := onNodes(nodes, func(n netNode) error {
+		err := writeCredentials(n.SSH, newKey, newSecret)
+		if err == nil {
+			lock.Lock()
+			written[n.SSH] = true
+			lock.Unlock()
+		}
+		return err
+	})
+	restore := func() {
+		var back []netNode
+		for _, n := range nodes {
+			if written[n.SSH] {
+				back = append(back, n)
+			}
+		}
+		if f := onNodes(back, func(n netNode) error { return restoreCredentials(n.SSH) }); len(f) > 0 {
+			printFailed("Restoring the env file", f)
+		}
+	}
+	if len(failed) > 0 {
+		printFailed("Writing the env file", failed)
+		restore()
+		panic("the new credentials could not be written to every server, nothing was restarted")
+	}
+
+	fmt.Printf("Restarting minio on %d servers\n", len(nodes))
+	wait := max(unitTimeout, time.Minute)
+	failed = restartAll(nodes)
+	if len(failed) > 0 {
+		printFailed("Restart", failed)
+	} else {
+		fmt.Println("Checking admin access with the new credentials")
+		failed = checkAdminAccess(nodes, newKey, newSecret, wait)
+		if len(failed) > 0 {
+			printFailed("Admin access", failed)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Println("Rolling back to the old credentials")
+		restore()
+		if f := restartAll(nodes); len(f) > 0 {
+			printFailed("Restart", f)
+		} else if f := checkAdminAccess(nodes, miniokey, miniosecret, wait); len(f) > 0 {
+			printFailed("Admin access with the old credentials", f)
+		} else {
+			fmt.Println("The servers run with the old credentials again")
+		}
+		panic("minio did not come back with the new credentials on every server")
+	}
+	if f := checkAdminAccess(nodes[:1], miniokey, miniosecret, 0); len(f) == 0 {
+		fmt.Println("WARNING: the old credentials are still accepted by", nodes[0].Addr)
+	}
+
+	// Everything after this point talks to the cluster with the new
+	// credentials, including the lock and the history entry.
+	miniokey, miniosecret = newKey, newSecret
+	if err := l.reconnect(); err != nil {
+		fmt.Println("Unable to renew the operation lock with the new credentials:", err)
+	}
+	if f := onNodes(nodes, func(n netNode) error {
+		_, err := runSSH(n.SSH, fmt.Sprintf(`sudo rm -f %s`, shellQuote(provisionEnvFile+".old")))
+		return err
+	}); len(f) > 0 {
+		printFailed("Removing the old env file", f)
+	}
+	hosts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		hosts = append(hosts, n.SSH)
+	}
+	sort.Strings(hosts)
+	fmt.Printf("Rotated the root credentials of %d servers: %s\n", len(hosts), strings.Join(hosts, ", "))
+
+	if credentialsProfile == "" {
+		fmt.Println("Use the new credentials with -key and -secret or $CLUSTER_TOOL_KEY and $CLUSTER_TOOL_SECRET from now on")
+		return
+	}
+	err := writeProfile(credentialsProfile, newKey, newSecret)
+	if err != nil {
+		panic(fmt.Errorf("the cluster runs with the new credentials but %s could not be updated: %w", credentialsProfile, err))
+	}
+	fmt.Println("Wrote the new credentials to", credentialsProfile)
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestSetEnvValues(t *testing.T) {
+	values := map[string]string{"MINIO_ROOT_USER": "admin2", "MINIO_ROOT_PASSWORD": "secret2"}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "replaces lines",
+			in:   "MINIO_VOLUMES=/mnt/disk{1...4}\nMINIO_ROOT_USER=admin\nMINIO_ROOT_PASSWORD=secret\n",
+			want: "MINIO_VOLUMES=/mnt/disk{1...4}\nMINIO_ROOT_USER=admin2\nMINIO_ROOT_PASSWORD=secret2\n",
+		},
+		{
+			name: "keeps export",
+			in:   "export MINIO_ROOT_USER=admin\nexport  MINIO_ROOT_PASSWORD=\"secret\"\n",
+			want: "export MINIO_ROOT_USER=admin2\nexport MINIO_ROOT_PASSWORD=secret2\n",
+		},
+		{
+			name: "leaves comments and blank lines",
+			in:   "# MINIO_ROOT_USER=old\n\nMINIO_ROOT_USER=admin\n#MINIO_ROOT_PASSWORD=old\nMINIO_ROOT_PASSWORD=secret\n",
+			want: "# MINIO_ROOT_USER=old\n\nMINIO_ROOT_USER=admin2\n#MINIO_ROOT_PASSWORD=old\nMINIO_ROOT_PASSWORD=secret2\n",
+		},
+		{
+			name: "no trailing newline",
+			in:   "MINIO_ROOT_USER=admin\nMINIO_OPTS=\"--address :9000\"",
+			want: "MINIO_ROOT_USER=admin2\nMINIO_OPTS=\"--address :9000\"\nMINIO_ROOT_PASSWORD=secret2\n",
+		},
+		{
+			name: "appends missing keys sorted",
+			in:   "MINIO_VOLUMES=/mnt/data\n",
+			want: "MINIO_VOLUMES=/mnt/data\nMINIO_ROOT_PASSWORD=secret2\nMINIO_ROOT_USER=admin2\n",
+		},
+		{
+			name: "empty file",
+			in:   "",
+			want: "MINIO_ROOT_PASSWORD=secret2\nMINIO_ROOT_USER=admin2\n",
+		},
+		{
+			name: "similar names are kept",
+			in:   "MINIO_ROOT_USER_FILE=/run/secrets/user\nMINIO_ROOT_USER=admin\nMINIO_ROOT_PASSWORD=secret\n",
+			want: "MINIO_ROOT_USER_FILE=/run/secrets/user\nMINIO_ROOT_USER=admin2\nMINIO_ROOT_PASSWORD=secret2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(setEnvValues([]byte(tt.in), values))
+			if got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// degradeMonitor watches the drives of the cluster while a round reboots.
+// Drives on the hosts of the round are expected to go away, any other drive
+// that turns bad is a degradation the round does not explain: an unrelated
+// drive or host died and the next reboot may take a set below quorum.
+type degradeMonitor struct {
+	round    map[string]bool
+	baseline map[string]bool
+
+	mu       sync.Mutex
+	problems []string
+	reported map[string]bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// activeMonitor is the monitor of the round in progress, rebootRound asks
+// it before every host.
+var activeMonitor *degradeMonitor
+
+// startDegradeMonitor records the bad drives before the round and polls
+// storage info every -degradeInterval until stop. It returns nil when
+// monitoring is disabled or the round is a dry run.
+func startDegradeMonitor(hosts []string) *degradeMonitor {
+	if degradeInterval <= 0 || dryRun {
+		return nil
+	}
+	pools, _, err := getInfra()
+	if err != nil {
+		fmt.Println("Unable to monitor the cluster during the round:", err)
+		return nil
+	}
+	m := &degradeMonitor{
+		round:    make(map[string]bool),
+		reported: make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+	for _, h := range hosts {
+		m.round[h] = true
+	}
+	m.baseline = degradeDrives(pools)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t := time.NewTicker(degradeInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-t.C:
+				m.poll()
+			}
+		}
+	}()
+	activeMonitor = m
+	return m
+}
+
+// stop ends polling, the problems found so far are kept.
+func (m *degradeMonitor) stop() {
+	if m == nil {
+		return
+	}
+	activeMonitor = nil
+	close(m.done)
+	m.wg.Wait()
+}
+
+// degradeDrives returns the bad drives of pools as host:path.
+func degradeDrives(pools map[string]*Pool) (drives map[string]bool) {
+	drives = make(map[string]bool)
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if rebootBad(d.State, d.Healing) {
+						drives[host+":"+d.Path] = true
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (m *degradeMonitor) poll() {
+	pools, _, err := getInfra()
+	if err != nil {
+		// A round takes hosts down, the endpoint may be one of them.
+		fmt.Println("Unable to monitor the cluster:", err)
+		return
+	}
+	problems := m.degradation(pools)
+
+	m.mu.Lock()
+	m.problems = problems
+	var fresh []string
+	for _, p := range problems {
+		if !m.reported[p] {
+			m.reported[p] = true
+			fresh = append(fresh, p)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(fresh) > 0 {
+		fmt.Println("DEGRADED: the cluster got worse than the round explains:")
+		for _, p := range fresh {
+			fmt.Println("  " + p)
+		}
+		sendAlert("degraded", fresh)
+	}
+}
+
+// degradation lists the drives that turned bad since the round started and
+// are not on one of its hosts, with how many drives of their set are down.
+func (m *degradeMonitor) degradation(pools map[string]*Pool) (problems []string) {
+	type setDown struct {
+		down, drives, parity int
+	}
+	sets := make(map[string]*setDown)
+	type freshDrive struct {
+		set, drive, state string
+	}
+	var fresh []freshDrive
+	for pid, p := range pools {
+		for host, s := range p.Servers {
+			for _, set := range s.Sets {
+				key := fmt.Sprintf("pool %s set %d", pid, set.ID)
+				sd := sets[key]
+				if sd == nil {
+					sd = &setDown{parity: set.SCParity}
+					sets[key] = sd
+				}
+				for _, d := range set.Disks {
+					sd.drives++
+					bad := rebootBad(d.State, d.Healing)
+					if bad || m.round[host] {
+						sd.down++
+					}
+					if bad && !m.round[host] && !m.baseline[host+":"+d.Path] {
+						fresh = append(fresh, freshDrive{key, host + ":" + d.Path, d.State})
+					}
+				}
+			}
+		}
+	}
+	for _, f := range fresh {
+		sd := sets[f.set]
+		problems = append(problems, fmt.Sprintf("%s: %s is %s, %d of %d drives are down with parity %d",
+			f.set, f.drive, f.state, sd.down, sd.drives, sd.parity))
+	}
+	sort.Strings(problems)
+	return
+}
+
+func (m *degradeMonitor) current() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.problems
+}
+
+// hold reports whether the rollout has to abort because the cluster
+// degraded. With -onDegrade pause it instead waits, polling storage info,
+// until the drives recovered.
+func (m *degradeMonitor) hold() (abort bool) {
+	if m == nil || len(m.current()) == 0 {
+		return false
+	}
+	if onDegrade != "pause" {
+		return true
+	}
+	fmt.Println("Pausing rollout until the cluster recovers")
+	for len(m.current()) > 0 {
+		time.Sleep(degradeInterval)
+		if activeMonitor != m {
+			// Nobody polls after stop.
+			m.poll()
+		}
+	}
+	fmt.Println("Cluster recovered, resuming rollout")
+	sendAlert("recovered", nil)
+	return false
+}
+
+// sendAlert POSTs {"event":...,"problems":[...]} to -alertWebhook.
+func sendAlert(event string, problems []string) {
+	if alertWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]any{
+		"event":    event,
+		"command":  jsonCommand,
+		"problems": problems,
+	})
+	if err != nil {
+		panic(err)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(alertWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Unable to send alert:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		fmt.Println("Unable to send alert: POST", alertWebhook+":", resp.Status)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type checkResult struct {
+	Check   string
+	Status  string
+	Message string
+	Hint    string `json:",omitempty"`
+}
+
+// doctorData is the cluster state shared by all doctor checks. Every field is
+// loaded once, errors are reported by the checks that need the data.
+type doctorData struct {
+	pools    map[string]*Pool
+	poolsErr error
+	info     madmin.InfoMessage
+	infoErr  error
+	heal     madmin.BgHealState
+	healErr  error
+}
+
+type doctorCheck struct {
+	Name string
+	Run  func(d *doctorData) []checkResult
+}
+
+var doctorChecks = []doctorCheck{
+	{"topology", checkTopology},
+	{"parity", checkParity},
+	{"versions", checkVersionSkew},
+	{"tls", checkTLS},
+	{"clock", checkClockSkew},
+	{"heal", checkHealBacklog},
+	{"capacity", checkCapacity},
+	{"setspace", checkSetSpace},
+	{"drives", checkOfflineDrives},
+	{"rootdisk", checkRootDisks},
+}
+
+func newResult(check, status, message, hint string) checkResult {
+	return checkResult{Check: check, Status: status, Message: message, Hint: hint}
+}
+
+func checkTopology(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("topology", checkFail, d.poolsErr.Error(), "Verify -endpoint, -port and credentials")}
+	}
+	for _, pid := range stringKeysSorted(d.pools) {
+		p := d.pools[pid]
+		drivesPerServer := make(map[int][]string)
+		setSizes := make(map[int]int)
+		for host, s := range p.Servers {
+			n := 0
+			for _, set := range s.Sets {
+				n += len(set.Disks)
+				setSizes[set.ID] += len(set.Disks)
+			}
+			drivesPerServer[n] = append(drivesPerServer[n], host)
+		}
+
+		sizes := make(map[int]bool)
+		for _, n := range setSizes {
+			sizes[n] = true
+		}
+
+		if len(drivesPerServer) > 1 || len(sizes) > 1 {
+			counts := []string{}
+			for n, hosts := range drivesPerServer {
+				sort.Strings(hosts)
+				counts = append(counts, fmt.Sprintf("%d drives: %s", n, strings.Join(hosts, ",")))
+			}
+			sort.Strings(counts)
+			r = append(r, newResult("topology", checkWarn,
+				fmt.Sprintf("pool %s is not symmetric (%s)", pid, strings.Join(counts, "; ")),
+				"Servers without all of their drives usually have unmounted or missing drives"))
+		} else {
+			r = append(r, newResult("topology", checkPass,
+				fmt.Sprintf("pool %s: %d servers, %d sets", pid, len(p.Servers), len(setSizes)), ""))
+		}
+	}
+	return
+}
+
+func checkParity(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("parity", checkFail, d.poolsErr.Error(), "")}
+	}
+	worst := checkPass
+	var msgs []string
+	seen := make(map[string]bool)
+	for _, pid := range stringKeysSorted(d.pools) {
+		for _, s := range d.pools[pid].Servers {
+			for _, set := range s.Sets {
+				key := fmt.Sprintf("%s/%d", pid, set.ID)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				margin := set.SCParity - set.BadDisks
+				switch {
+				case margin <= 0:
+					worst = checkFail
+					msgs = append(msgs, fmt.Sprintf("set %s has no parity left (%d bad drives)", key, set.BadDisks))
+				case !set.CanReboot:
+					if worst != checkFail {
+						worst = checkWarn
+					}
+					msgs = append(msgs, fmt.Sprintf("set %s has %d bad drives with parity %d", key, set.BadDisks, set.SCParity))
+				case set.RRAtRisk:
+					if worst != checkFail {
+						worst = checkWarn
+					}
+					msgs = append(msgs, fmt.Sprintf("set %s has %d bad drives, reduced redundancy objects (parity %d) lose quorum if a server goes down", key, set.BadDisks, set.RRSCParity))
+				}
+			}
+		}
+	}
+	if worst == checkPass {
+		return []checkResult{newResult("parity", checkPass, fmt.Sprintf("all %d sets have spare parity", len(seen)), "")}
+	}
+	sort.Strings(msgs)
+	return []checkResult{newResult("parity", worst, strings.Join(msgs, "; "),
+		"Replace or heal the bad drives before rebooting any server in these sets")}
+}
+
+func checkVersionSkew(d *doctorData) (r []checkResult) {
+	if d.infoErr != nil {
+		return []checkResult{newResult("versions", checkFail, d.infoErr.Error(), "")}
+	}
+	servers, majority := serverVersions(d.info)
+	if majority == "" {
+		return []checkResult{newResult("versions", checkWarn, "no servers reported a version", "")}
+	}
+	if msg := versionSkewMessage(servers, majority); msg != "" {
+		return []checkResult{newResult("versions", checkFail, msg,
+			"Finish the upgrade so every server runs the same release, see 'versions'")}
+	}
+	return []checkResult{newResult("versions", checkPass, "all servers run "+majority, "")}
+}
+
+func checkTLS(d *doctorData) (r []checkResult) {
+	if !secure {
+		return []checkResult{newResult("tls", checkPass, "skipped, -secure is not set", "")}
+	}
+	if d.infoErr != nil {
+		return []checkResult{newResult("tls", checkFail, d.infoErr.Error(), "")}
+	}
+	for _, s := range d.info.Servers {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", s.Endpoint, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			r = append(r, newResult("tls", checkFail, s.Endpoint+": "+err.Error(), "Check that the server is up and serving TLS"))
+			continue
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) == 0 {
+			r = append(r, newResult("tls", checkFail, s.Endpoint+": no certificate presented", ""))
+			continue
+		}
+		left := time.Until(certs[0].NotAfter)
+		switch {
+		case left <= 0:
+			r = append(r, newResult("tls", checkFail, fmt.Sprintf("%s: certificate expired %s", s.Endpoint, certs[0].NotAfter.Format(time.RFC3339)), "Rotate the certificate"))
+		case left < 30*24*time.Hour:
+			r = append(r, newResult("tls", checkWarn, fmt.Sprintf("%s: certificate expires %s", s.Endpoint, certs[0].NotAfter.Format(time.RFC3339)), "Rotate the certificate before it expires"))
+		default:
+			r = append(r, newResult("tls", checkPass, fmt.Sprintf("%s: certificate valid until %s", s.Endpoint, certs[0].NotAfter.Format(time.RFC3339)), ""))
+		}
+	}
+	return
+}
+
+// serverClockOffset compares the Date header of a server response with the
+// local clock. The header only has second precision.
+func serverClockOffset(hostport string) (offset time.Duration, err error) {
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	client := &http.Client{Transport: DefaultTransport(secure), Timeout: 5 * time.Second}
+	before := time.Now()
+	resp, err := client.Get(scheme + hostport + "/minio/health/live")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	mid := before.Add(time.Since(before) / 2)
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("no usable Date header: %w", err)
+	}
+	return date.Sub(mid.Truncate(time.Second)), nil
+}
+
+func checkClockSkew(d *doctorData) (r []checkResult) {
+	if d.infoErr != nil {
+		return []checkResult{newResult("clock", checkFail, d.infoErr.Error(), "")}
+	}
+	var min, max time.Duration
+	var msgs []string
+	first := true
+	for _, s := range d.info.Servers {
+		off, err := serverClockOffset(s.Endpoint)
+		if err != nil {
+			msgs = append(msgs, s.Endpoint+": "+err.Error())
+			continue
+		}
+		if first || off < min {
+			min = off
+		}
+		if first || off > max {
+			max = off
+		}
+		first = false
+	}
+	skew := max - min
+	status := checkPass
+	hint := ""
+	if skew > 5*time.Second {
+		status = checkFail
+		hint = "Make sure NTP/chrony is running and synchronised on every server, see 'clock' for exact offsets"
+	} else if skew > 2*time.Second || len(msgs) > 0 {
+		status = checkWarn
+	}
+	msgs = append([]string{fmt.Sprintf("max skew between servers %s", skew)}, msgs...)
+	return []checkResult{newResult("clock", status, strings.Join(msgs, "; "), hint)}
+}
+
+func checkHealBacklog(d *doctorData) (r []checkResult) {
+	if d.healErr != nil {
+		return []checkResult{newResult("heal", checkFail, d.healErr.Error(), "")}
+	}
+	if len(d.heal.HealDisks) > 0 {
+		return []checkResult{newResult("heal", checkWarn,
+			fmt.Sprintf("%d drives are healing", len(d.heal.HealDisks)),
+			"Wait for healing to finish before maintenance")}
+	}
+	return []checkResult{newResult("heal", checkPass, "no drives are healing", "")}
+}
+
+func checkCapacity(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("capacity", checkFail, d.poolsErr.Error(), "")}
+	}
+	for _, pid := range stringKeysSorted(d.pools) {
+		var used, total uint64
+		for _, s := range d.pools[pid].Servers {
+			for _, set := range s.Sets {
+				for _, disk := range set.Disks {
+					used += disk.UsedSpace
+					total += disk.TotalSpace
+				}
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		pct := float64(used) / float64(total) * 100
+		msg := fmt.Sprintf("pool %s is %.1f%% used", pid, pct)
+		switch {
+		case pct >= 90:
+			r = append(r, newResult("capacity", checkFail, msg, "Expand the cluster or free up space"))
+		case pct >= 80:
+			r = append(r, newResult("capacity", checkWarn, msg, "Plan a pool expansion"))
+		default:
+			r = append(r, newResult("capacity", checkPass, msg, ""))
+		}
+	}
+	return
+}
+
+func checkOfflineDrives(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("drives", checkFail, d.poolsErr.Error(), "")}
+	}
+	var bad []string
+	total := 0
+	for _, p := range d.pools {
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, disk := range set.Disks {
+					total++
+					if disk.isBad() {
+						bad = append(bad, disk.Server+" ("+disk.State+")")
+					}
+				}
+			}
+		}
+	}
+	if len(bad) == 0 {
+		return []checkResult{newResult("drives", checkPass, fmt.Sprintf("all %d drives are ok", total), "")}
+	}
+	sort.Strings(bad)
+	return []checkResult{newResult("drives", checkWarn,
+		fmt.Sprintf("%d/%d drives are not ok: %s", len(bad), total, strings.Join(bad, ", ")),
+		"Run 'disks -badDisksOnly' for details")}
+}
+
+func loadDoctorData() (d *doctorData) {
+	d = new(doctorData)
+	d.pools, _, d.poolsErr = getInfra()
+	d.info, d.infoErr = clusterServerInfo()
+	d.heal, d.healErr = mclient.BackgroundHealStatus(context.Background())
+	return
+}
+
+func runDoctorChecks(d *doctorData) (results []checkResult) {
+	for _, c := range doctorChecks {
+		results = append(results, c.Run(d)...)
+	}
+	return
+}
+
+func doctor() {
+	results := runDoctorChecks(loadDoctorData())
+
+	failed := false
+	for _, r := range results {
+		if r.Status == checkFail {
+			failed = true
+		}
+	}
+	if failed {
+		exitCode = 1
+	}
+
+	if jsonOutput {
+		jsonOut(results)
+		return
+	}
+
+	for _, r := range results {
+		fmt.Printf("%-5s %-10s %s\n", strings.ToUpper(r.Status), r.Check, r.Message)
+		if r.Hint != "" && r.Status != checkPass {
+			fmt.Printf("%-5s %-10s -> %s\n", "", "", r.Hint)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// badDrive is a drive MinIO reports in a state other than ok.
+type badDrive struct {
+	Host  string
+	Path  string
+	State string
+	Pool  int
+	Set   int
+}
+
+// badDrives returns the drives that are not ok, optionally limited to the
+// hosts in -hostfile.
+func badDrives() (drives []badDrive) {
+	pools, _, err := getInfra()
+	if err != nil {
+		panic(err)
+	}
+	var only map[string]bool
+	if hostfile != "" {
+		hosts, err := readHostfile(hostfile)
+		if err != nil {
+			panic(err)
+		}
+		only = make(map[string]bool)
+		for _, h := range hosts {
+			only[h] = true
+		}
+	}
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			if only != nil && !only[host] {
+				continue
+			}
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if d.State != "ok" {
+						drives = append(drives, badDrive{Host: host, Path: d.Path, State: d.State, Pool: d.Pool, Set: d.Set})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(drives, func(i, j int) bool {
+		if drives[i].Host != drives[j].Host {
+			return drives[i].Host < drives[j].Host
+		}
+		return drives[i].Path < drives[j].Path
+	})
+	return
+}
+
+// forEachHost calls fn for the drives of every host, -workers hosts at a
+// time. Drives of one host share a hostData so command output is reused.
+func forEachHost(drives []badDrive, fn func(h *hostData, d badDrive)) {
+	byHost := make(map[string][]badDrive)
+	for _, d := range drives {
+		byHost[d.Host] = append(byHost[d.Host], d)
+	}
+	workers := hostWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+	for host, list := range byHost {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h *hostData, list []badDrive) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, d := range list {
+				fn(h, d)
+			}
+		}(&hostData{Host: host}, list)
+	}
+	wg.Wait()
+}
+
+// driveDiagnosis is the result of drive fscheck for one drive.
+type driveDiagnosis struct {
+	Host     string
+	Path     string
+	State    string
+	Device   string `json:",omitempty"`
+	FSType   string `json:",omitempty"`
+	Verdict  string
+	Evidence []string `json:",omitempty"`
+}
+
+const (
+	verdictCorruption = "filesystem corruption"
+	verdictDeadDevice = "dead device"
+	verdictCabling    = "cabling or controller"
+	verdictUnmounted  = "not mounted"
+	verdictUnknown    = "unknown"
+)
+
+// Kernel messages are mapped to the verdict they point at. Order matters,
+// the first verdict with a match wins.
+var dmesgPatterns = []struct {
+	verdict string
+	re      *regexp.Regexp
+}{
+	{verdictDeadDevice, regexp.MustCompile(`(?i)critical medium error|medium error|unrecovered read error|rejecting I/O to offline device|device offline|offlining`)},
+	{verdictCorruption, regexp.MustCompile(`(?i)XFS.*(corruption|internal error|metadata I/O error|shutting down filesystem)|EXT4-fs error|structure needs cleaning`)},
+	{verdictCabling, regexp.MustCompile(`(?i)hard resetting link|SATA link down|COMRESET failed|link is slow|interface CRC error|UDMA_CRC|ICRC ABRT`)},
+}
+
+// partitionRe splits a partition name into its disk and partition number,
+// sda1 -> sda and nvme0n1p2 -> nvme0n1.
+var partitionRe = regexp.MustCompile(`^((?:nvme\d+n\d+|mmcblk\d+|loop\d+)p|(?:sd|vd|xvd|hd)[a-z]+)\d+$`)
+
+// parentDisk returns the disk a partition is on, or name itself.
+func parentDisk(name string) string {
+	m := partitionRe.FindStringSubmatch(name)
+	if m == nil {
+		return name
+	}
+	return strings.TrimSuffix(m[1], "p")
+}
+
+// dmesgLines returns the kernel log lines mentioning device or the disk it is
+// a partition of, the kernel reports I/O errors against the whole disk.
+func dmesgLines(h *hostData, device string) (lines []string, err error) {
+	out, err := h.run("sudo dmesg 2>/dev/null || dmesg")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(device, "/dev/")
+	if name == "" {
+		return nil, nil
+	}
+	names := regexp.QuoteMeta(name)
+	if disk := parentDisk(name); disk != name {
+		names += "|" + regexp.QuoteMeta(disk)
+	}
+	// Word boundaries keep sda from matching sdaa.
+	re := regexp.MustCompile(`\b(?:` + names + `)\b`)
+	for _, line := range strings.Split(out, "\n") {
+		if re.MatchString(line) {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return
+}
+
+// fsHealth runs read-only filesystem queries. corrupt is set when they report
+// damage, evidence also holds informational output like fragmentation.
+func fsHealth(h *hostData, device string, fstype string, mountPoint string) (evidence []string, corrupt bool) {
+	switch fstype {
+	case "xfs":
+		out, err := h.run("sudo xfs_spaceman -c health " + shellQuote(mountPoint) + " 2>&1")
+		if err == nil {
+			for _, line := range strings.Split(out, "\n") {
+				if strings.Contains(strings.ToLower(line), "unhealthy") || strings.Contains(strings.ToLower(line), "corrupt") {
+					evidence = append(evidence, "xfs_spaceman: "+strings.TrimSpace(line))
+					corrupt = true
+				}
+			}
+		}
+		out, err = h.run("sudo xfs_db -r -c frag " + shellQuote(device) + " 2>&1")
+		if err == nil && out != "" {
+			evidence = append(evidence, "xfs_db: "+lastLine(out))
+		}
+	case "ext4", "ext3", "ext2":
+		out, err := h.run("sudo dumpe2fs -h " + shellQuote(device) + " 2>/dev/null")
+		if err == nil {
+			for _, line := range strings.Split(out, "\n") {
+				k, v, ok := strings.Cut(line, ":")
+				if !ok {
+					continue
+				}
+				v = strings.TrimSpace(v)
+				switch strings.TrimSpace(k) {
+				case "Filesystem state":
+					if v != "clean" {
+						evidence = append(evidence, "dumpe2fs: state "+v)
+						corrupt = true
+					}
+				case "FS Error count":
+					evidence = append(evidence, "dumpe2fs: error count "+v)
+					corrupt = corrupt || v != "0"
+				}
+			}
+		}
+	}
+	return
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func diagnoseDrive(h *hostData, d badDrive) (diag driveDiagnosis) {
+	diag = driveDiagnosis{Host: d.Host, Path: d.Path, State: d.State, Verdict: verdictUnknown}
+
+	mounts, err := hostMounts(h)
+	if err != nil {
+		diag.Evidence = append(diag.Evidence, "ssh: "+err.Error())
+		return
+	}
+	mp := mountPointOf(d.Path, mounts)
+	if mp == "" || mp == "/" {
+		diag.Verdict = verdictUnmounted
+		diag.Evidence = append(diag.Evidence, d.Path+" is not on a mounted drive")
+		return
+	}
+	diag.Device = mounts[mp].Device
+	diag.FSType = mounts[mp].FSType
+
+	if strings.HasPrefix(diag.Device, "/dev/") {
+		out, err := h.run("test -b " + shellQuote(diag.Device) + " && echo present || echo missing")
+		if err == nil && out == "missing" {
+			diag.Verdict = verdictDeadDevice
+			diag.Evidence = append(diag.Evidence, diag.Device+" no longer exists")
+		}
+	}
+
+	lines, err := dmesgLines(h, diag.Device)
+	if err != nil {
+		diag.Evidence = append(diag.Evidence, "dmesg: "+err.Error())
+	}
+	matched := ""
+	for _, p := range dmesgPatterns {
+		for _, line := range lines {
+			if p.re.MatchString(line) {
+				if matched == "" {
+					matched = p.verdict
+				}
+				if len(diag.Evidence) < 10 {
+					diag.Evidence = append(diag.Evidence, "dmesg: "+line)
+				}
+			}
+		}
+	}
+
+	fsEvidence, corrupt := fsHealth(h, diag.Device, diag.FSType, mp)
+	diag.Evidence = append(diag.Evidence, fsEvidence...)
+
+	switch {
+	case diag.Verdict != verdictUnknown:
+	case matched != "":
+		diag.Verdict = matched
+	case corrupt:
+		diag.Verdict = verdictCorruption
+	}
+	return
+}
+
+func driveFscheck() {
+	drives := badDrives()
+	if len(drives) == 0 {
+		fmt.Println("All drives are ok")
+		return
+	}
+
+	results := make([]driveDiagnosis, 0, len(drives))
+	lock := new(sync.Mutex)
+	forEachHost(drives, func(h *hostData, d badDrive) {
+		diag := diagnoseDrive(h, d)
+		lock.Lock()
+		results = append(results, diag)
+		lock.Unlock()
+	})
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Host != results[j].Host {
+			return results[i].Host < results[j].Host
+		}
+		return results[i].Path < results[j].Path
+	})
+
+	if jsonOutput {
+		jsonOut(results)
+		return
+	}
+	for _, r := range results {
+		fmt.Printf("%s:%s state(%s) device(%s) fs(%s)\n", r.Host, r.Path, r.State, r.Device, r.FSType)
+		fmt.Println("  verdict:", r.Verdict)
+		for _, e := range r.Evidence {
+			fmt.Println("   ", e)
+		}
+	}
+}
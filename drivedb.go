@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The drive database records every change of drive state it observes, so
+// drives that flap between two invocations can be told apart from drives
+// that are down for good. Drives are keyed by their UUID, offline drives
+// often report none and are found through their endpoint instead.
+var (
+	bucketDrives    = []byte("drives")
+	bucketEndpoints = []byte("endpoints")
+	bucketEvents    = []byte("events")
+)
+
+// driveRecord is the last observed state of a drive.
+type driveRecord struct {
+	UUID     string
+	Endpoint string
+	Pool     int
+	Set      int
+	State    string
+	Healing  bool
+	Seen     time.Time
+}
+
+// driveEvent is one change of a drive.
+type driveEvent struct {
+	Time     time.Time
+	Event    string
+	State    string
+	Endpoint string
+}
+
+const (
+	eventFirstSeen = "first seen"
+	eventState     = "state changed"
+	eventHealing   = "healing started"
+	eventHealed    = "healed"
+	eventReplaced  = "replaced"
+	eventReplaces  = "replacement"
+	eventMoved     = "moved"
+)
+
+var driveDBWarn sync.Once
+
+func openDriveDB(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(driveDB, 0o600, &bolt.Options{Timeout: 2 * time.Second, ReadOnly: readOnly})
+}
+
+// recordDriveStates stores the drive states of a storage info in -driveDB.
+// Recording is best effort, a locked or broken database must not fail the
+// command that loaded storage info.
+func recordDriveStates(disks []madmin.Disk) {
+	if driveDB == "" {
+		return
+	}
+	db, err := openDriveDB(false)
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			return recordDrives(tx, disks, time.Now().UTC())
+		})
+		db.Close()
+	}
+	if err != nil {
+		driveDBWarn.Do(func() {
+			fmt.Fprintln(os.Stderr, "Drive states not recorded in", driveDB+":", err)
+		})
+	}
+}
+
+func recordDrives(tx *bolt.Tx, disks []madmin.Disk, now time.Time) error {
+	drives, err := tx.CreateBucketIfNotExists(bucketDrives)
+	if err != nil {
+		return err
+	}
+	endpoints, err := tx.CreateBucketIfNotExists(bucketEndpoints)
+	if err != nil {
+		return err
+	}
+	events, err := tx.CreateBucketIfNotExists(bucketEvents)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range disks {
+		previous := string(endpoints.Get([]byte(d.Endpoint)))
+		id := d.UUID
+		if id == "" {
+			id = previous
+		}
+		if id == "" {
+			// A drive that was never seen online has nothing to
+			// identify it by.
+			continue
+		}
+		err = endpoints.Put([]byte(d.Endpoint), []byte(id))
+		if err != nil {
+			return err
+		}
+
+		rec := driveRecord{UUID: id, Endpoint: d.Endpoint, Pool: d.PoolIndex + 1, Set: d.SetIndex + 1, State: d.State, Healing: d.Healing, Seen: now}
+		old, known, err := getDriveRecord(drives, id)
+		if err != nil {
+			return err
+		}
+		if known {
+			err = driveChanges(events, old, rec)
+		} else {
+			err = addDriveEvent(events, id, driveEvent{Time: now, Event: eventFirstSeen, State: d.State, Endpoint: d.Endpoint})
+			if err == nil && d.Healing {
+				err = addDriveEvent(events, id, driveEvent{Time: now, Event: eventHealing, State: d.State, Endpoint: d.Endpoint})
+			}
+		}
+		if err != nil {
+			return err
+		}
+		err = putDriveRecord(drives, rec)
+		if err != nil {
+			return err
+		}
+
+		if previous == "" || previous == id {
+			continue
+		}
+		// Another drive took the endpoint, the old one was swapped out.
+		err = addDriveEvent(events, id, driveEvent{Time: now, Event: eventReplaces, State: "replaces " + previous, Endpoint: d.Endpoint})
+		if err != nil {
+			return err
+		}
+		err = addDriveEvent(events, previous, driveEvent{Time: now, Event: eventReplaced, State: "replaced by " + id, Endpoint: d.Endpoint})
+		if err != nil {
+			return err
+		}
+		replaced, known, err := getDriveRecord(drives, previous)
+		if err != nil || !known {
+			return err
+		}
+		replaced.State = "replaced"
+		replaced.Healing = false
+		err = putDriveRecord(drives, replaced)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getDriveRecord(drives *bolt.Bucket, id string) (rec driveRecord, ok bool, err error) {
+	raw := drives.Get([]byte(id))
+	if raw == nil {
+		return rec, false, nil
+	}
+	err = json.Unmarshal(raw, &rec)
+	return rec, err == nil, err
+}
+
+func putDriveRecord(drives *bolt.Bucket, rec driveRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return drives.Put([]byte(rec.UUID), raw)
+}
+
+// driveChanges records the events between two observations of a drive.
+func driveChanges(events *bolt.Bucket, old driveRecord, rec driveRecord) (err error) {
+	add := func(event string, state string) {
+		if err == nil {
+			err = addDriveEvent(events, rec.UUID, driveEvent{Time: rec.Seen, Event: event, State: state, Endpoint: rec.Endpoint})
+		}
+	}
+	if old.Endpoint != rec.Endpoint {
+		add(eventMoved, "from "+old.Endpoint)
+	}
+	if old.State != rec.State {
+		add(eventState, old.State+" -> "+rec.State)
+	}
+	switch {
+	case !old.Healing && rec.Healing:
+		add(eventHealing, rec.State)
+	case old.Healing && !rec.Healing:
+		add(eventHealed, rec.State)
+	}
+	return
+}
+
+// addDriveEvent appends e to the events of the drive, keyed by time so a
+// cursor walks them in order.
+func addDriveEvent(events *bolt.Bucket, id string, e driveEvent) error {
+	b, err := events.CreateBucketIfNotExists([]byte(id))
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(e.Time.UnixNano()))
+	// Several events of one observation share a time.
+	for b.Get(key) != nil {
+		binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, raw)
+}
+
+// driveHistoryEntry is a drive with its events, as printed by drive history.
+type driveHistoryEntry struct {
+	driveRecord
+	Changes int
+	Events  []driveEvent `json:",omitempty"`
+}
+
+func readDriveHistory(tx *bolt.Tx, id string) (e driveHistoryEntry, err error) {
+	drives := tx.Bucket(bucketDrives)
+	if drives == nil {
+		return e, fmt.Errorf("%s has no drives recorded yet", driveDB)
+	}
+	var ok bool
+	e.driveRecord, ok, err = getDriveRecord(drives, id)
+	if err != nil {
+		return e, err
+	}
+	if !ok {
+		return e, fmt.Errorf("drive %s is not in %s", id, driveDB)
+	}
+	b := tx.Bucket(bucketEvents).Bucket([]byte(id))
+	if b == nil {
+		return e, nil
+	}
+	err = b.ForEach(func(_, v []byte) error {
+		var ev driveEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return err
+		}
+		if ev.Event != eventFirstSeen {
+			e.Changes++
+		}
+		e.Events = append(e.Events, ev)
+		return nil
+	})
+	return e, err
+}
+
+// resolveDrive finds the UUID of a drive given as UUID, endpoint or
+// host:/path.
+func resolveDrive(tx *bolt.Tx, arg string) string {
+	if drives := tx.Bucket(bucketDrives); drives != nil && drives.Get([]byte(arg)) != nil {
+		return arg
+	}
+	endpoints := tx.Bucket(bucketEndpoints)
+	if endpoints == nil {
+		return arg
+	}
+	if id := endpoints.Get([]byte(arg)); id != nil {
+		return string(id)
+	}
+	host, path, ok := strings.Cut(arg, ":")
+	if !ok {
+		return arg
+	}
+	id := arg
+	_ = endpoints.ForEach(func(k, v []byte) error {
+		u, err := url.Parse(string(k))
+		if err == nil && u.Hostname() == host && u.Path == path {
+			id = string(v)
+		}
+		return nil
+	})
+	return id
+}
+
+func driveHistory() {
+	if driveDB == "" {
+		panic("drive history needs -driveDB or CLUSTER_TOOL_DRIVE_DB")
+	}
+	if len(cmdArgs) > 1 {
+		panic("expected at most one drive UUID, endpoint or host:/path")
+	}
+	db, err := openDriveDB(true)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	var entries []driveHistoryEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		if len(cmdArgs) == 1 {
+			e, err := readDriveHistory(tx, resolveDrive(tx, cmdArgs[0]))
+			entries = append(entries, e)
+			return err
+		}
+		drives := tx.Bucket(bucketDrives)
+		if drives == nil {
+			return nil
+		}
+		return drives.ForEach(func(k, _ []byte) error {
+			e, err := readDriveHistory(tx, string(k))
+			if err != nil {
+				return err
+			}
+			if e.Changes > 0 {
+				e.Events = nil
+				entries = append(entries, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if len(cmdArgs) == 0 {
+		// The drives that changed most often come first, those are the
+		// flapping ones.
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Changes != entries[j].Changes {
+				return entries[i].Changes > entries[j].Changes
+			}
+			return entries[i].Endpoint < entries[j].Endpoint
+		})
+		if jsonOutput {
+			jsonOut(entries)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("No drive changed its state since it was first recorded")
+			return
+		}
+		fmt.Printf("%-38s %-8s %-10s %-20s %s\n", "UUID", "CHANGES", "STATE", "LAST SEEN", "ENDPOINT")
+		for _, e := range entries {
+			fmt.Printf("%-38s %-8d %-10s %-20s %s\n", e.UUID, e.Changes, e.State, e.Seen.Format(time.RFC3339), e.Endpoint)
+		}
+		return
+	}
+
+	e := entries[0]
+	if jsonOutput {
+		jsonOut(e)
+		return
+	}
+	fmt.Printf("Drive %s, pool %d set %d, %s\n", e.UUID, e.Pool, e.Set, e.Endpoint)
+	fmt.Printf("Last seen %s %s, %d changes\n", e.Seen.Format(time.RFC3339), e.State, e.Changes)
+	fmt.Println()
+	fmt.Printf("%-20s %-16s %s\n", "TIME", "EVENT", "STATE")
+	for _, ev := range e.Events {
+		state := ev.State
+		if ev.Endpoint != e.Endpoint {
+			state += " at " + ev.Endpoint
+		}
+		fmt.Printf("%-20s %-16s %s\n", ev.Time.Format(time.RFC3339), ev.Event, state)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkDNS resolves host forward and reverse. Servers find each other by
+// name, a name that resolves differently than its address maps back is a
+// common reason for nodes that cannot join.
+func checkDNS(host string) []checkResult {
+	if ip := net.ParseIP(host); ip != nil {
+		names, err := net.LookupAddr(host)
+		if err != nil || len(names) == 0 {
+			return []checkResult{newResult("dns", checkWarn, host+" is an address without a reverse entry", "")}
+		}
+		return []checkResult{newResult("dns", checkPass, host+" is an address, reverse "+strings.Join(names, ","), "")}
+	}
+
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return []checkResult{newResult("dns", checkFail, "does not resolve: "+dialReason(err), "Add the name to DNS or /etc/hosts")}
+	}
+	var mismatched []string
+	for _, a := range addrs {
+		names, err := net.LookupAddr(a)
+		if err != nil || len(names) == 0 {
+			mismatched = append(mismatched, a+" has no reverse entry")
+			continue
+		}
+		found := false
+		for _, n := range names {
+			found = found || strings.EqualFold(strings.TrimSuffix(n, "."), host)
+		}
+		if !found {
+			mismatched = append(mismatched, fmt.Sprintf("%s maps back to %s", a, strings.Join(names, ",")))
+		}
+	}
+	if len(mismatched) > 0 {
+		return []checkResult{newResult("dns", checkWarn, fmt.Sprintf("resolves to %s but %s", strings.Join(addrs, ","), strings.Join(mismatched, "; ")),
+			"Make the PTR records match the names the servers use")}
+	}
+	return []checkResult{newResult("dns", checkPass, fmt.Sprintf("resolves to %s and back", strings.Join(addrs, ",")), "")}
+}
+
+// checkEndpointTLS does a TLS handshake with addr and checks that the
+// certificate chains to the system roots or -caFile, covers host and that no
+// certificate of the chain expires within -days.
+func checkEndpointTLS(host, addr string) []checkResult {
+	if !secure {
+		return []checkResult{newResult("tls", checkWarn, "skipped, -secure is not set", "Pass -secure if the servers serve TLS")}
+	}
+	conf := &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12}
+	if net.ParseIP(host) == nil {
+		conf.ServerName = host
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: netTimeout}, "tcp", addr, conf)
+	if err != nil {
+		return []checkResult{newResult("tls", checkFail, "handshake failed: "+err.Error(), "Check that the server serves TLS on this port")}
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return []checkResult{newResult("tls", checkFail, "no certificate presented", "")}
+	}
+	r := []checkResult{newResult("tls", checkPass, "handshake ok, "+tls.VersionName(state.Version), "")}
+
+	leaf := certs[0]
+	r = append(r, checkEndpointChain(certs))
+	if err := leaf.VerifyHostname(host); err != nil {
+		names := append(append([]string{}, leaf.DNSNames...), ipStrings(leaf.IPAddresses)...)
+		r = append(r, newResult("san", checkFail, fmt.Sprintf("certificate does not cover %s, it is for %s", host, strings.Join(names, ",")),
+			"Reissue the certificate with the name clients and servers use as a SAN"))
+	} else {
+		r = append(r, newResult("san", checkPass, "certificate covers "+host, ""))
+	}
+
+	// The first certificate of the chain to expire breaks the chain.
+	first := leaf
+	for _, c := range certs[1:] {
+		if c.NotAfter.Before(first.NotAfter) {
+			first = c
+		}
+	}
+	what := "certificate"
+	if first != leaf {
+		what = "chain certificate " + first.Subject.CommonName
+	}
+	left := time.Until(first.NotAfter)
+	switch {
+	case left <= 0:
+		r = append(r, newResult("expiry", checkFail, fmt.Sprintf("%s expired %s", what, first.NotAfter.Format(time.RFC3339)), "Rotate the certificate"))
+	case left < time.Duration(certExpiryDays)*24*time.Hour:
+		r = append(r, newResult("expiry", checkWarn, fmt.Sprintf("%s expires %s, in %d days", what, first.NotAfter.Format(time.RFC3339), int(left.Hours()/24)), "Rotate the certificate before it expires"))
+	default:
+		r = append(r, newResult("expiry", checkPass, fmt.Sprintf("%s valid until %s", what, first.NotAfter.Format(time.RFC3339)), ""))
+	}
+	return r
+}
+
+// checkEndpointChain verifies the presented chain against -caFile, or the
+// system roots without it. The handshake itself skips verification so the
+// other checks still run on an untrusted certificate.
+func checkEndpointChain(certs []*x509.Certificate) checkResult {
+	opts := x509.VerifyOptions{Intermediates: x509.NewCertPool()}
+	trusted := "the system roots"
+	if certCAFile != "" {
+		ca, err := os.ReadFile(certCAFile)
+		if err != nil {
+			return newResult("chain", checkFail, err.Error(), "")
+		}
+		opts.Roots = x509.NewCertPool()
+		if !opts.Roots.AppendCertsFromPEM(ca) {
+			return newResult("chain", checkFail, certCAFile+" has no PEM certificates", "")
+		}
+		trusted = certCAFile
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return newResult("chain", checkFail, err.Error(), "Serve the intermediate certificates too, or pass the CA with -caFile")
+	}
+	return newResult("chain", checkPass, "chains to "+trusted, "")
+}
+
+func ipStrings(ips []net.IP) (s []string) {
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return
+}
+
+// validateEndpoint runs every check against one server endpoint.
+func validateEndpoint(n netNode) (r hostReport) {
+	r.Host = n.Addr
+	host, p, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		host, p = n.Addr, port
+	}
+	r.Results = checkDNS(host)
+
+	c := checkPort(host, p, "s3")
+	if !c.OK {
+		r.Results = append(r.Results, newResult("tcp", checkFail, c.Error, ""))
+		return
+	}
+	r.Results = append(r.Results, newResult("tcp", checkPass, fmt.Sprintf("connected in %s", c.Connect.Round(time.Millisecond/10)), ""))
+	r.Results = append(r.Results, checkEndpointTLS(host, net.JoinHostPort(host, p))...)
+	return
+}
+
+func validateEndpoints() {
+	if hostfile != "" && port == "" {
+		panic("-port is required with -hostfile")
+	}
+	nodes := netNodes()
+	if len(nodes) == 0 {
+		fmt.Println("No servers to check")
+		return
+	}
+	reports := make([]hostReport, len(nodes))
+	sem := make(chan struct{}, max(hostWorkers, 1))
+	wg := new(sync.WaitGroup)
+	for i, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n netNode) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			reports[i] = validateEndpoint(n)
+		}(i, n)
+	}
+	wg.Wait()
+	printHostReports(reports)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expandEllipses expands the {1...4} ranges of a MinIO volume argument the
+// way the server does, {01...16} keeps the leading zero and {a...d} counts
+// letters.
+func expandEllipses(arg string) (out []string, err error) {
+	start := strings.Index(arg, "{")
+	if start < 0 {
+		return []string{arg}, nil
+	}
+	end := strings.Index(arg[start:], "}")
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated { in %s", arg)
+	}
+	end += start
+	from, to, ok := strings.Cut(arg[start+1:end], "...")
+	if !ok {
+		return nil, fmt.Errorf("expected {a...b} in %s", arg)
+	}
+
+	var values []string
+	if a, errA := strconv.Atoi(from); errA == nil {
+		b, errB := strconv.Atoi(to)
+		if errB != nil || b < a {
+			return nil, fmt.Errorf("invalid range {%s...%s} in %s", from, to, arg)
+		}
+		width := 0
+		if len(from) > 1 && from[0] == '0' {
+			width = len(from)
+		}
+		for i := a; i <= b; i++ {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	} else if len(from) == 1 && len(to) == 1 && from <= to {
+		for c := from[0]; c <= to[0]; c++ {
+			values = append(values, string(c))
+		}
+	} else {
+		return nil, fmt.Errorf("invalid range {%s...%s} in %s", from, to, arg)
+	}
+
+	rest, err := expandEllipses(arg[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		for _, r := range rest {
+			out = append(out, arg[:start]+v+r)
+		}
+	}
+	return
+}
+
+// poolHosts returns the hosts of a pool argument like
+// https://node{5...8}.example.net:9000/mnt/drive{1...4} and the drive paths
+// each of them has to serve.
+func poolHosts(arg string) (hosts []string, drives map[string][]string, err error) {
+	endpoints, err := expandEllipses(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	drives = make(map[string][]string)
+	for _, e := range endpoints {
+		if !strings.Contains(e, "://") {
+			e = "http://" + e
+		}
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, nil, err
+		}
+		host := u.Hostname()
+		if u.Path == "" || u.Path == "/" {
+			return nil, nil, fmt.Errorf("%s has no drive path", e)
+		}
+		if _, ok := drives[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		drives[host] = append(drives[host], u.Path)
+	}
+	return
+}
+
+// releaseVersion turns the RELEASE.2024-01-01T00-00-00Z tag printed by
+// 'minio --version' into the version servers report.
+func releaseVersion(tag string) string {
+	t, err := time.Parse("2006-01-02T15-04-05Z", strings.TrimPrefix(tag, "RELEASE."))
+	if err != nil {
+		return tag
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// resolveFrom asks every existing server what the new hosts resolve to.
+// The result maps each new host to the addresses seen by each server.
+func resolveFrom(servers, hosts []string) (seen map[string]map[string]string) {
+	seen = make(map[string]map[string]string)
+	for _, h := range hosts {
+		seen[h] = make(map[string]string)
+	}
+	var script strings.Builder
+	for _, h := range hosts {
+		fmt.Fprintf(&script, "echo %s $(getent ahosts %s | awk '{print $1}' | sort -u | paste -sd, -); ", shellQuote(h), shellQuote(h))
+	}
+
+	lock := new(sync.Mutex)
+	sem := make(chan struct{}, max(hostWorkers, 1))
+	wg := new(sync.WaitGroup)
+	for _, server := range servers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(server string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			out, err := runSSH(server, script.String())
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				for _, h := range hosts {
+					seen[h][server] = "ssh failed: " + err.Error()
+				}
+				return
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 || seen[fields[0]] == nil {
+					continue
+				}
+				addrs := "unresolved"
+				if len(fields) > 1 {
+					addrs = fields[1]
+				}
+				seen[fields[0]][server] = addrs
+			}
+		}(server)
+	}
+	wg.Wait()
+	return
+}
+
+// checkResolution reports whether every existing server resolves host to
+// the same addresses and whether they belong to the host.
+func checkResolution(h *hostData, seen map[string]string) []checkResult {
+	if len(seen) == 0 {
+		return []checkResult{newResult("dns", checkWarn, "no existing servers to resolve from", "")}
+	}
+	byAddrs := make(map[string][]string)
+	for server, addrs := range seen {
+		byAddrs[addrs] = append(byAddrs[addrs], server)
+	}
+	if len(byAddrs) > 1 || byAddrs["unresolved"] != nil {
+		var parts []string
+		for _, addrs := range stringKeysSorted(byAddrs) {
+			servers := byAddrs[addrs]
+			sort.Strings(servers)
+			parts = append(parts, fmt.Sprintf("%s from %s", addrs, strings.Join(servers, ",")))
+		}
+		return []checkResult{newResult("dns", checkFail, "resolves inconsistently: "+strings.Join(parts, "; "),
+			"Every server has to resolve the new hosts to the same address, check /etc/hosts and DNS on them")}
+	}
+	var addrs string
+	for a := range byAddrs {
+		addrs = a
+	}
+
+	out, err := h.run("hostname -I")
+	if err != nil {
+		return hostFail("dns", err)
+	}
+	own := strings.Fields(out)
+	for _, a := range strings.Split(addrs, ",") {
+		for _, o := range own {
+			if a == o {
+				return []checkResult{newResult("dns", checkPass, fmt.Sprintf("resolves to %s from all %d servers", addrs, len(seen)), "")}
+			}
+		}
+	}
+	return []checkResult{newResult("dns", checkFail, fmt.Sprintf("resolves to %s, which is not an address of the host (%s)", addrs, strings.Join(own, " ")),
+		"The name points at a different machine")}
+}
+
+// checkExpansionDrives verifies that every drive of the new host is a
+// mounted, formatted and empty filesystem. Drives that held data for another
+// deployment make the expansion fail.
+func checkExpansionDrives(h *hostData) []checkResult {
+	var script strings.Builder
+	for _, d := range h.Drives {
+		q := shellQuote(d)
+		fmt.Fprintf(&script, "echo %s $(findmnt -no FSTYPE --target %s 2>/dev/null | head -1) $(mountpoint -q %s && echo mounted) $(sudo ls -A %s 2>/dev/null | wc -l); ", q, q, q, q)
+	}
+	out, err := h.run(script.String())
+	if err != nil {
+		return hostFail("drives", err)
+	}
+	var problems []string
+	ok := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		path, entries := fields[0], fields[len(fields)-1]
+		switch {
+		case len(fields) != 4 || fields[2] != "mounted":
+			problems = append(problems, path+" is not a mounted filesystem")
+		case fields[1] != "xfs":
+			problems = append(problems, fmt.Sprintf("%s is %s, not xfs", path, fields[1]))
+		case entries != "0":
+			problems = append(problems, fmt.Sprintf("%s is not empty (%s entries)", path, entries))
+		default:
+			ok++
+		}
+	}
+	if len(problems) > 0 {
+		return []checkResult{newResult("drives", checkFail, strings.Join(problems, "; "),
+			"New pools need empty XFS drives, see 'provision'")}
+	}
+	return []checkResult{newResult("drives", checkPass, fmt.Sprintf("all %d drives are empty XFS filesystems", ok), "")}
+}
+
+// checkNewVersion compares the MinIO binary on the new host with the
+// release most servers run, a pool has to start on the same release.
+func checkNewVersion(h *hostData, majority string) []checkResult {
+	out, err := h.run(shellQuote(upgradeBinaryPath) + " --version")
+	if err != nil {
+		return hostFail("version", err)
+	}
+	// minio version RELEASE.2024-01-01T00-00-00Z (commit-id=...)
+	fields := strings.Fields(strings.Split(out, "\n")[0])
+	if len(fields) < 3 {
+		return hostFail("version", fmt.Errorf("unexpected --version output %q", out))
+	}
+	release := fields[2]
+	if majority == "" {
+		return []checkResult{newResult("version", checkWarn, release+", the cluster version is unknown", "")}
+	}
+	want, _, _ := strings.Cut(majority, " ")
+	if releaseVersion(release) != want {
+		return []checkResult{newResult("version", checkFail, fmt.Sprintf("%s, the cluster runs %s", release, want),
+			"Install the release the cluster runs, e.g. with 'provision -binary'")}
+	}
+	return []checkResult{newResult("version", checkPass, release+" matches the cluster", "")}
+}
+
+func expansionCheck() {
+	if expansionPool == "" {
+		panic("-pool is required, e.g. https://node{5...8}.example.net:9000/mnt/drive{1...4}")
+	}
+	hosts, drives, err := poolHosts(expansionPool)
+	if err != nil {
+		panic(err)
+	}
+
+	pools, _, err := getInfra()
+	if err != nil {
+		panic(err)
+	}
+	existing := make(map[string]string)
+	for pid, p := range pools {
+		for host := range p.Servers {
+			existing[host] = pid
+		}
+	}
+	majority := ""
+	if err = makeClient(); err == nil {
+		info, ierr := clusterServerInfo()
+		if ierr == nil {
+			_, majority = serverVersions(info)
+		} else {
+			fmt.Fprintln(statusOut(), "Unable to read server versions:", ierr)
+		}
+	}
+
+	seen := resolveFrom(stringKeysSorted(existing), hosts)
+	checks := []hostCheck{
+		{"mounts", checkHostMounts},
+		{"drives", checkExpansionDrives},
+		{"dns", func(h *hostData) []checkResult { return checkResolution(h, seen[h.Host]) }},
+		{"version", func(h *hostData) []checkResult { return checkNewVersion(h, majority) }},
+	}
+
+	var targets []*hostData
+	var reports []hostReport
+	for _, host := range hosts {
+		if pid, ok := existing[host]; ok {
+			reports = append(reports, hostReport{Host: host, Results: []checkResult{
+				newResult("membership", checkFail, "already a server of pool "+pid, "The new pool must only list new hosts")}})
+			continue
+		}
+		targets = append(targets, &hostData{Host: host, Drives: drives[host]})
+	}
+	reports = append(reports, runHostChecks(targets, checks)...)
+	printHostReports(reports)
+}
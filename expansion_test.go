@@ -0,0 +1,127 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandEllipses(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no ellipses",
+			in:   "/mnt/data",
+			want: []string{"/mnt/data"},
+		},
+		{
+			name: "numbers",
+			in:   "/mnt/drive{1...3}",
+			want: []string{"/mnt/drive1", "/mnt/drive2", "/mnt/drive3"},
+		},
+		{
+			name: "keeps zero padding",
+			in:   "node{08...11}",
+			want: []string{"node08", "node09", "node10", "node11"},
+		},
+		{
+			name: "single value range",
+			in:   "node{5...5}",
+			want: []string{"node5"},
+		},
+		{
+			name: "letters",
+			in:   "/dev/sd{a...c}",
+			want: []string{"/dev/sda", "/dev/sdb", "/dev/sdc"},
+		},
+		{
+			name: "several ellipses",
+			in:   "http://node{1...2}.example.net:9000/mnt/drive{1...2}",
+			want: []string{
+				"http://node1.example.net:9000/mnt/drive1",
+				"http://node1.example.net:9000/mnt/drive2",
+				"http://node2.example.net:9000/mnt/drive1",
+				"http://node2.example.net:9000/mnt/drive2",
+			},
+		},
+		{name: "unterminated", in: "node{1...4", wantErr: true},
+		{name: "missing dots", in: "node{1..4}", wantErr: true},
+		{name: "descending", in: "node{4...1}", wantErr: true},
+		{name: "mixed number and letter", in: "node{1...d}", wantErr: true},
+		{name: "multi letter", in: "node{aa...cc}", wantErr: true},
+		{name: "malformed later ellipsis", in: "node{1...2}/mnt/drive{1...}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEllipses(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolHosts(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		wantHosts  []string
+		wantDrives map[string][]string
+		wantErr    bool
+	}{
+		{
+			name:      "hosts and drives",
+			in:        "https://node{09...10}.example.net:9000/mnt/drive{1...2}",
+			wantHosts: []string{"node09.example.net", "node10.example.net"},
+			wantDrives: map[string][]string{
+				"node09.example.net": {"/mnt/drive1", "/mnt/drive2"},
+				"node10.example.net": {"/mnt/drive1", "/mnt/drive2"},
+			},
+		},
+		{
+			name:       "no scheme",
+			in:         "node{a...b}:9000/data",
+			wantHosts:  []string{"nodea", "nodeb"},
+			wantDrives: map[string][]string{"nodea": {"/data"}, "nodeb": {"/data"}},
+		},
+		{name: "no drive path", in: "http://node{1...2}:9000", wantErr: true},
+		{name: "malformed range", in: "http://node{1...x}:9000/data", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, drives, err := poolHosts(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", hosts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(hosts, tt.wantHosts) {
+				t.Errorf("hosts %q, want %q", hosts, tt.wantHosts)
+			}
+			for host, want := range tt.wantDrives {
+				if !slices.Equal(drives[host], want) {
+					t.Errorf("drives of %s %q, want %q", host, drives[host], want)
+				}
+			}
+			if len(drives) != len(tt.wantDrives) {
+				t.Errorf("drives for %d hosts, want %d", len(drives), len(tt.wantDrives))
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metric names served by the exporter, the Grafana dashboard from
+// 'export grafana' queries exactly these.
+const (
+	metricSetBadDrives     = "minio_cluster_tool_set_bad_drives"
+	metricSetParity        = "minio_cluster_tool_set_parity"
+	metricSetParityMargin  = "minio_cluster_tool_set_parity_margin"
+	metricSetCanReboot     = "minio_cluster_tool_set_can_reboot"
+	metricSetUsedBytes     = "minio_cluster_tool_set_used_bytes"
+	metricSetTotalBytes    = "minio_cluster_tool_set_capacity_bytes"
+	metricSetSpaceAlert    = "minio_cluster_tool_set_space_alert"
+	metricDrives           = "minio_cluster_tool_drives"
+	metricHealBacklog      = "minio_cluster_tool_heal_backlog_drives"
+	metricRefreshSuccess   = "minio_cluster_tool_refresh_success"
+	metricRefreshTimestamp = "minio_cluster_tool_last_refresh_timestamp_seconds"
+)
+
+// exporterState holds the last rendered metrics, /metrics serves it without
+// querying the cluster so scrapes stay cheap.
+type exporterState struct {
+	mu      sync.Mutex
+	metrics []byte
+}
+
+func (e *exporterState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	body := e.metrics
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write(body)
+}
+
+// renderMetrics writes the cluster state in the Prometheus text format. Data
+// that could not be loaded is left out and reported through
+// minio_cluster_tool_refresh_success.
+func renderMetrics() []byte {
+	buf := new(bytes.Buffer)
+	header := func(name string, help string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	success := 1
+
+	pools, _, err := getInfra()
+	if err != nil {
+		fmt.Fprintln(statusOut(), "Unable to load storage info:", err)
+		success = 0
+	} else {
+		summaries := setSummaries(pools)
+		type setKey struct {
+			pool string
+			set  int
+		}
+		var keys []setKey
+		for _, pid := range stringKeysSorted(summaries) {
+			for id := range summaries[pid] {
+				keys = append(keys, setKey{pid, id})
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].pool != keys[j].pool {
+				return keys[i].pool < keys[j].pool
+			}
+			return keys[i].set < keys[j].set
+		})
+
+		bad := make(map[setKey]int)
+		for _, k := range keys {
+			for _, d := range summaries[k.pool][k.set].Disks {
+				if d.isBad() {
+					bad[k]++
+				}
+			}
+		}
+
+		header(metricSetBadDrives, "Drives of the erasure set that are not ok.")
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetBadDrives, k.pool, k.set, bad[k])
+		}
+		header(metricSetParity, "Standard storage class parity of the erasure set.")
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetParity, k.pool, k.set, summaries[k.pool][k.set].Parity)
+		}
+		header(metricSetParityMargin, "Drives the erasure set can still lose before objects become unreadable.")
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetParityMargin, k.pool, k.set, summaries[k.pool][k.set].Parity-bad[k])
+		}
+		header(metricSetCanReboot, "Whether a server of the erasure set can be taken down.")
+		for _, k := range keys {
+			v := 0
+			if summaries[k.pool][k.set].CanReboot {
+				v = 1
+			}
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetCanReboot, k.pool, k.set, v)
+		}
+
+		usages := setUsages(pools)
+		header(metricSetUsedBytes, "Used space of the erasure set.")
+		for _, u := range usages {
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetUsedBytes, u.Pool, u.Set, u.Used)
+		}
+		header(metricSetTotalBytes, "Capacity of the erasure set.")
+		for _, u := range usages {
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetTotalBytes, u.Pool, u.Set, u.Total)
+		}
+		header(metricSetSpaceAlert, "1 when the erasure set is above -setWarn, 2 when it is above -setFail.")
+		for _, u := range usages {
+			v := 0
+			switch u.Status {
+			case checkWarn:
+				v = 1
+			case checkFail:
+				v = 2
+			}
+			fmt.Fprintf(buf, "%s{pool=%q,set=\"%d\"} %d\n", metricSetSpaceAlert, u.Pool, u.Set, v)
+		}
+
+		header(metricDrives, "Drives by pool and state.")
+		for _, pid := range stringKeysSorted(pools) {
+			states := make(map[string]int)
+			for _, s := range pools[pid].Servers {
+				for _, set := range s.Sets {
+					for _, d := range set.Disks {
+						states[d.State]++
+					}
+				}
+			}
+			for _, state := range stringKeysSorted(states) {
+				fmt.Fprintf(buf, "%s{pool=%q,state=%q} %d\n", metricDrives, pid, state, states[state])
+			}
+		}
+	}
+
+	heal, err := mclient.BackgroundHealStatus(context.Background())
+	if err != nil {
+		fmt.Fprintln(statusOut(), "Unable to load heal status:", err)
+		success = 0
+	} else {
+		header(metricHealBacklog, "Drives that are currently healing.")
+		fmt.Fprintf(buf, "%s %d\n", metricHealBacklog, len(heal.HealDisks))
+	}
+
+	header(metricRefreshSuccess, "Whether the last refresh loaded all cluster data.")
+	fmt.Fprintf(buf, "%s %d\n", metricRefreshSuccess, success)
+	header(metricRefreshTimestamp, "Unix time of the last refresh.")
+	fmt.Fprintf(buf, "%s %d\n", metricRefreshTimestamp, time.Now().Unix())
+	return buf.Bytes()
+}
+
+func exporter() {
+	state := new(exporterState)
+	refresh := func() {
+		m := renderMetrics()
+		state.mu.Lock()
+		state.metrics = m
+		state.mu.Unlock()
+	}
+	refresh()
+	go func() {
+		for range time.Tick(exporterRefresh) {
+			refresh()
+		}
+	}()
+
+	http.Handle("/metrics", state)
+	fmt.Println("Serving metrics on", exporterListen+"/metrics", "refreshing every", exporterRefresh)
+	err := http.ListenAndServe(exporterListen, nil)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// fanOutGrace is how long answers from other servers are waited for once
+// one arrived that reports servers or drives as offline. A server that
+// cannot reach a peer reports it offline, the others are asked what they
+// see.
+var fanOutGrace = 2 * time.Second
+
+// queryNodes returns -endpoint followed by -endpoints.
+func queryNodes() []string {
+	nodes := []string{endpoint + ":" + port}
+	for _, e := range strings.Split(endpoints, ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(e); err != nil {
+			e = net.JoinHostPort(e, port)
+		}
+		if !slices.Contains(nodes, e) {
+			nodes = append(nodes, e)
+		}
+	}
+	return nodes
+}
+
+// peers are the online servers of the last server info, they are asked
+// when none of the query nodes answers, e.g. while -endpoint reboots.
+var peers struct {
+	sync.Mutex
+	addrs []string
+}
+
+func rememberPeers(info madmin.InfoMessage) {
+	var addrs []string
+	for _, s := range info.Servers {
+		if s.State == string(madmin.ItemOnline) {
+			addrs = append(addrs, s.Endpoint)
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	peers.Lock()
+	peers.addrs = addrs
+	peers.Unlock()
+}
+
+// nodeClients caches one admin client per server and key, so connections
+// are reused between queries.
+var nodeClients struct {
+	sync.Mutex
+	m map[string]*madmin.AdminClient
+}
+
+func nodeClient(addr string) (*madmin.AdminClient, error) {
+	nodeClients.Lock()
+	defer nodeClients.Unlock()
+	k := addr + "\x00" + miniokey + "\x00" + miniosecret
+	if c, ok := nodeClients.m[k]; ok {
+		return c, nil
+	}
+	c, err := adminAs(addr, miniokey, miniosecret)
+	if err != nil {
+		return nil, err
+	}
+	if nodeClients.m == nil {
+		nodeClients.m = make(map[string]*madmin.AdminClient)
+	}
+	nodeClients.m[k] = c
+	return c, nil
+}
+
+type nodeAnswer[T any] struct {
+	node string
+	v    T
+	err  error
+}
+
+// fanOut runs query on every node at once and returns the first answer
+// without an error. While complete is false for the answer so far, answers
+// arriving within fanOutGrace are merged into it.
+func fanOut[T any](nodes []string, query func(context.Context, *madmin.AdminClient) (T, error), complete func(T) bool, merge func(T, T) T) (v T, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	answers := make(chan nodeAnswer[T], len(nodes))
+	for _, n := range nodes {
+		go func(n string) {
+			a := nodeAnswer[T]{node: n}
+			var client *madmin.AdminClient
+			client, a.err = nodeClient(n)
+			if a.err == nil {
+				a.v, a.err = query(ctx, client)
+			}
+			answers <- a
+		}(n)
+	}
+
+	var errs []error
+	got := false
+	var grace <-chan time.Time
+	for range nodes {
+		var a nodeAnswer[T]
+		select {
+		case a = <-answers:
+		case <-grace:
+			return v, nil
+		}
+		if a.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.node, a.err))
+			continue
+		}
+		if got {
+			v = merge(v, a.v)
+		} else {
+			v, got = a.v, true
+		}
+		if complete(v) {
+			return v, nil
+		}
+		if grace == nil {
+			grace = time.After(fanOutGrace)
+		}
+	}
+	if got {
+		return v, nil
+	}
+	if len(nodes) == 1 {
+		// Keep the error of a single server as the server returned it.
+		return v, errors.Unwrap(errs[0])
+	}
+	return v, errors.Join(errs...)
+}
+
+// clusterQuery asks the query nodes, and the known peers when none of them
+// answers.
+func clusterQuery[T any](query func(context.Context, *madmin.AdminClient) (T, error), complete func(T) bool, merge func(T, T) T) (T, error) {
+	nodes := queryNodes()
+	v, err := fanOut(nodes, query, complete, merge)
+	if err == nil {
+		return v, nil
+	}
+	peers.Lock()
+	var fallback []string
+	for _, p := range peers.addrs {
+		if !slices.Contains(nodes, p) {
+			fallback = append(fallback, p)
+		}
+	}
+	peers.Unlock()
+	if len(fallback) == 0 {
+		return v, err
+	}
+	fmt.Fprintf(statusOut(), "No answer from %s, asking %d other servers: %v\n", strings.Join(nodes, ", "), len(fallback), err)
+	if fv, ferr := fanOut(fallback, query, complete, merge); ferr == nil {
+		return fv, nil
+	}
+	return v, err
+}
+
+// clusterServerInfo is ServerInfo from the first server that answers.
+// Servers one answer reports as not online are taken from another answer
+// that reaches them, with their drive metrics. It is for showing the
+// cluster, decisions about taking servers down use worstServerInfo.
+func clusterServerInfo(options ...func(*madmin.ServerInfoOpts)) (madmin.InfoMessage, error) {
+	return serverInfoMerged(mergeServerInfo, options...)
+}
+
+// worstServerInfo is ServerInfo from the first server that answers, a server
+// any answer reports as not online stays not online.
+func worstServerInfo(options ...func(*madmin.ServerInfoOpts)) (madmin.InfoMessage, error) {
+	return serverInfoMerged(mergeWorstServerInfo, options...)
+}
+
+func serverInfoMerged(merge func(into, other madmin.InfoMessage) madmin.InfoMessage, options ...func(*madmin.ServerInfoOpts)) (madmin.InfoMessage, error) {
+	info, err := clusterQuery(func(ctx context.Context, c *madmin.AdminClient) (madmin.InfoMessage, error) {
+		return c.ServerInfo(ctx, options...)
+	}, func(info madmin.InfoMessage) bool {
+		return !slices.ContainsFunc(info.Servers, func(s madmin.ServerProperties) bool { return s.State != string(madmin.ItemOnline) })
+	}, merge)
+	if err == nil {
+		rememberPeers(info)
+	}
+	return info, err
+}
+
+func mergeServerInfo(into, other madmin.InfoMessage) madmin.InfoMessage {
+	online := make(map[string]madmin.ServerProperties)
+	for _, s := range other.Servers {
+		if s.State == string(madmin.ItemOnline) {
+			online[s.Endpoint] = s
+		}
+	}
+	for i, s := range into.Servers {
+		if o, ok := online[s.Endpoint]; ok && s.State != string(madmin.ItemOnline) {
+			into.Servers[i] = o
+		}
+	}
+	return into
+}
+
+func mergeWorstServerInfo(into, other madmin.InfoMessage) madmin.InfoMessage {
+	down := make(map[string]madmin.ServerProperties)
+	for _, s := range other.Servers {
+		if s.State != string(madmin.ItemOnline) {
+			down[s.Endpoint] = s
+		}
+	}
+	for i, s := range into.Servers {
+		if o, ok := down[s.Endpoint]; ok && s.State == string(madmin.ItemOnline) {
+			into.Servers[i] = o
+		}
+	}
+	return into
+}
+
+// clusterStorageInfo is StorageInfo from the first server that answers. It
+// decides which hosts may go down, so a drive any answer reports as not ok
+// is taken from that answer.
+func clusterStorageInfo() (madmin.StorageInfo, error) {
+	return clusterQuery(func(ctx context.Context, c *madmin.AdminClient) (madmin.StorageInfo, error) {
+		return c.StorageInfo(ctx)
+	}, func(info madmin.StorageInfo) bool {
+		return !slices.ContainsFunc(info.Disks, func(d madmin.Disk) bool { return d.State != madmin.DriveStateOk })
+	}, mergeStorageInfo)
+}
+
+func mergeStorageInfo(into, other madmin.StorageInfo) madmin.StorageInfo {
+	bad := make(map[string]int)
+	for i, d := range other.Disks {
+		if d.State != madmin.DriveStateOk {
+			bad[d.Endpoint] = i
+		}
+	}
+	for i, d := range into.Disks {
+		if j, found := bad[d.Endpoint]; found && d.State == madmin.DriveStateOk {
+			into.Disks[i] = other.Disks[j]
+		}
+	}
+	return into
+}
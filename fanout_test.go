@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// nodeQuery answers a fanOut query with the function of the node the client
+// was made for.
+func nodeQuery[T any](t *testing.T, answers map[string]func(context.Context) (T, error)) func(context.Context, *madmin.AdminClient) (T, error) {
+	t.Helper()
+	byClient := make(map[*madmin.AdminClient]func(context.Context) (T, error))
+	for node, f := range answers {
+		c, err := nodeClient(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byClient[c] = f
+	}
+	return func(ctx context.Context, c *madmin.AdminClient) (T, error) {
+		return byClient[c](ctx)
+	}
+}
+
+func answer(v []string, delay time.Duration, err error) func(context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		select {
+		case <-time.After(delay):
+			return v, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	defer func(g time.Duration) { fanOutGrace = g }(fanOutGrace)
+	fanOutGrace = 200 * time.Millisecond
+
+	complete := func(v []string) bool { return len(v) >= 2 }
+	merge := func(into, other []string) []string { return append(into, other...) }
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name    string
+		answers map[string]func(context.Context) ([]string, error)
+		want    []string
+		err     bool
+	}{
+		{
+			name: "a hung node does not block a complete answer",
+			answers: map[string]func(context.Context) ([]string, error){
+				"fanout-a:9000": answer([]string{"a"}, time.Hour, nil),
+				"fanout-b:9000": answer([]string{"b1", "b2"}, 0, nil),
+			},
+			want: []string{"b1", "b2"},
+		},
+		{
+			name: "incomplete answers within the grace are merged",
+			answers: map[string]func(context.Context) ([]string, error){
+				"fanout-c:9000": answer([]string{"c"}, 0, nil),
+				"fanout-d:9000": answer([]string{"d"}, 50*time.Millisecond, nil),
+			},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "answers after the grace are not waited for",
+			answers: map[string]func(context.Context) ([]string, error){
+				"fanout-e:9000": answer([]string{"e"}, 0, nil),
+				"fanout-f:9000": answer([]string{"f"}, time.Hour, nil),
+			},
+			want: []string{"e"},
+		},
+		{
+			name: "errors are skipped",
+			answers: map[string]func(context.Context) ([]string, error){
+				"fanout-g:9000": answer(nil, 0, errDown),
+				"fanout-h:9000": answer([]string{"h"}, 10*time.Millisecond, nil),
+			},
+			want: []string{"h"},
+		},
+		{
+			name: "every node failing is an error",
+			answers: map[string]func(context.Context) ([]string, error){
+				"fanout-i:9000": answer(nil, 0, errDown),
+				"fanout-j:9000": answer(nil, 0, errDown),
+			},
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodes []string
+			for n := range tt.answers {
+				nodes = append(nodes, n)
+			}
+			slices.Sort(nodes)
+			start := time.Now()
+			v, err := fanOut(nodes, nodeQuery(t, tt.answers), complete, merge)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(v)
+			if !slices.Equal(v, tt.want) {
+				t.Errorf("got %v, want %v", v, tt.want)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("took %s", d)
+			}
+		})
+	}
+}
+
+func TestFanOutSingleNodeError(t *testing.T) {
+	errDown := errors.New("down")
+	answers := map[string]func(context.Context) ([]string, error){
+		"fanout-k:9000": answer(nil, 0, errDown),
+	}
+	_, err := fanOut([]string{"fanout-k:9000"}, nodeQuery(t, answers), func([]string) bool { return true }, nil)
+	if err != errDown {
+		t.Errorf("got %v, want the error of the node", err)
+	}
+}
+
+func servers(states ...string) (info madmin.InfoMessage) {
+	for i, st := range states {
+		info.Servers = append(info.Servers, madmin.ServerProperties{Endpoint: string(rune('a'+i)) + ":9000", State: st, Version: st})
+	}
+	return
+}
+
+func serverStates(info madmin.InfoMessage) (states []string) {
+	for _, s := range info.Servers {
+		states = append(states, s.State)
+	}
+	return
+}
+
+func TestMergeServerInfo(t *testing.T) {
+	const on, off = string(madmin.ItemOnline), string(madmin.ItemOffline)
+	tests := []struct {
+		into, other []string
+		merged      []string
+		worst       []string
+	}{
+		{into: []string{on, off, on}, other: []string{on, on, on}, merged: []string{on, on, on}, worst: []string{on, off, on}},
+		{into: []string{on, on, on}, other: []string{off, on, off}, merged: []string{on, on, on}, worst: []string{off, on, off}},
+		{into: []string{off, on}, other: []string{on}, merged: []string{on, on}, worst: []string{off, on}},
+	}
+	for _, tt := range tests {
+		merged := mergeServerInfo(servers(tt.into...), servers(tt.other...))
+		if got := serverStates(merged); !slices.Equal(got, tt.merged) {
+			t.Errorf("mergeServerInfo(%v, %v) = %v, want %v", tt.into, tt.other, got, tt.merged)
+		}
+		// The properties come from the answer the state was taken from.
+		for _, s := range merged.Servers {
+			if s.Version != s.State {
+				t.Errorf("mergeServerInfo took the state of %s without its properties", s.Endpoint)
+			}
+		}
+		if got := serverStates(mergeWorstServerInfo(servers(tt.into...), servers(tt.other...))); !slices.Equal(got, tt.worst) {
+			t.Errorf("mergeWorstServerInfo(%v, %v) = %v, want %v", tt.into, tt.other, got, tt.worst)
+		}
+	}
+}
+
+func TestMergeStorageInfo(t *testing.T) {
+	const ok, off, faulty = madmin.DriveStateOk, madmin.DriveStateOffline, madmin.DriveStateFaulty
+	drives := func(states ...string) (info madmin.StorageInfo) {
+		for i, st := range states {
+			info.Disks = append(info.Disks, madmin.Disk{Endpoint: "http://a:9000/d" + string(rune('0'+i)), State: st})
+		}
+		return
+	}
+	tests := []struct {
+		into, other, want []string
+	}{
+		{into: []string{ok, ok, ok}, other: []string{ok, off, ok}, want: []string{ok, off, ok}},
+		{into: []string{ok, off, ok}, other: []string{ok, ok, ok}, want: []string{ok, off, ok}},
+		{into: []string{off, ok}, other: []string{faulty, faulty}, want: []string{off, faulty}},
+		{into: []string{ok, ok}, other: []string{off}, want: []string{off, ok}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range mergeStorageInfo(drives(tt.into...), drives(tt.other...)).Disks {
+			got = append(got, d.State)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("mergeStorageInfo(%v, %v) = %v, want %v", tt.into, tt.other, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// forecastHorizon is how far ahead forecast looks for a threshold, the
+// "> 5 years" of the output.
+const forecastHorizon = 5 * 365 * 24 * time.Hour
+
+type usagePoint struct {
+	Time  time.Time
+	Used  float64
+	Total float64
+}
+
+// forecastResult is when a pool or set reaches each threshold. Thresholds
+// it does not reach within the horizon are missing from Reached.
+type forecastResult struct {
+	Group      string
+	Model      string
+	Used       uint64
+	Total      uint64
+	PerDay     int64
+	Reached    map[string]time.Time `json:",omitempty"`
+	Thresholds map[string]string
+}
+
+// usageSeries reads used and total space per pool or set from the
+// snapshots.
+func usageSeries(files []snapshotFile, per string) map[string][]usagePoint {
+	used := func(d *Disk) int64 { return int64(d.UsedSpace) }
+	total := func(d *Disk) int64 { return int64(d.TotalSpace) }
+	series := make(map[string][]usagePoint)
+	for _, f := range files {
+		pools, err := readSnapshot(f.Path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping", f.Path+":", err)
+			continue
+		}
+		totals := snapshotValues(pools, total, per)
+		for g, u := range snapshotValues(pools, used, per) {
+			series[g] = append(series[g], usagePoint{Time: f.Time, Used: float64(u), Total: float64(totals[g])})
+		}
+	}
+	return series
+}
+
+// linearRate fits used space over time with least squares and returns the
+// growth per hour.
+func linearRate(points []usagePoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	t0 := points[0].Time
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		x := p.Time.Sub(t0).Hours()
+		sx += x
+		sy += p.Used
+		sxx += x * x
+		sxy += x * p.Used
+	}
+	n := float64(len(points))
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+// hourly resamples points to one value per hour, carrying the last value
+// into hours without a snapshot.
+func hourly(points []usagePoint) (values []float64, start time.Time) {
+	start = points[0].Time.Truncate(time.Hour)
+	end := points[len(points)-1].Time.Truncate(time.Hour)
+	values = make([]float64, int(end.Sub(start).Hours())+1)
+	i := 0
+	last := points[0].Used
+	for h := range values {
+		at := start.Add(time.Duration(h) * time.Hour)
+		for i < len(points) && !points[i].Time.Truncate(time.Hour).After(at) {
+			last = points[i].Used
+			i++
+		}
+		values[h] = last
+	}
+	return
+}
+
+// seasonalProjection repeats the last season of usage shifted up by the
+// average growth per season, so weekly patterns like backups on the weekend
+// are not mistaken for trend. It needs at least two seasons of history.
+func seasonalProjection(points []usagePoint, season time.Duration) (project func(h int) float64, perHour float64, ok bool) {
+	values, _ := hourly(points)
+	m := int(season.Hours())
+	if m < 1 || len(values) < 2*m {
+		return nil, 0, false
+	}
+	var drift float64
+	for t := m; t < len(values); t++ {
+		drift += values[t] - values[t-m]
+	}
+	drift /= float64(len(values) - m)
+	last := len(values) - 1
+	project = func(h int) float64 {
+		k := (h + m - 1) / m
+		return values[last+h-k*m] + float64(k)*drift
+	}
+	return project, drift / float64(m), true
+}
+
+// parseThresholds parses -thresholds, percentages of the capacity.
+func parseThresholds(s string) (pcts []float64, err error) {
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(f), "%"))
+		if f == "full" {
+			f = "100"
+		}
+		p, err := strconv.ParseFloat(f, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid threshold %q, expected a percentage between 0 and 100", f)
+		}
+		pcts = append(pcts, p)
+	}
+	sort.Float64s(pcts)
+	return
+}
+
+func thresholdName(p float64) string {
+	if p == 100 {
+		return "full"
+	}
+	return strconv.FormatFloat(p, 'f', -1, 64) + "%"
+}
+
+// forecastGroup projects one pool or set with the selected model.
+func forecastGroup(group string, points []usagePoint, pcts []float64) (r forecastResult) {
+	now := points[len(points)-1]
+	r = forecastResult{Group: group, Model: forecastModel, Used: uint64(now.Used), Total: uint64(now.Total), Reached: make(map[string]time.Time), Thresholds: make(map[string]string)}
+
+	rate := linearRate(points)
+	project := func(h int) float64 { return now.Used + rate*float64(h) }
+	if forecastModel == "seasonal" {
+		p, perHour, ok := seasonalProjection(points, forecastSeason)
+		if ok {
+			project, rate = p, perHour
+		} else {
+			r.Model = "linear"
+		}
+	}
+	r.PerDay = int64(rate * 24)
+
+	for _, pct := range pcts {
+		name := thresholdName(pct)
+		limit := now.Total * pct / 100
+		switch {
+		case now.Used >= limit:
+			r.Thresholds[name] = "reached"
+			continue
+		case rate <= 0 && r.Model == "linear":
+			r.Thresholds[name] = "not growing"
+			continue
+		}
+		r.Thresholds[name] = "> 5 years"
+		if r.Model == "linear" {
+			hours := (limit - now.Used) / rate
+			if hours <= forecastHorizon.Hours() {
+				at := now.Time.Add(time.Duration(hours * float64(time.Hour)))
+				r.Reached[name] = at
+				r.Thresholds[name] = at.Format("2006-01-02")
+			}
+			continue
+		}
+		for h := 1; h <= int(forecastHorizon.Hours()); h++ {
+			if project(h) >= limit {
+				at := now.Time.Add(time.Duration(h) * time.Hour)
+				r.Reached[name] = at
+				r.Thresholds[name] = at.Format("2006-01-02")
+				break
+			}
+		}
+	}
+	return
+}
+
+func forecast() {
+	if snapshotDir == "" {
+		panic("forecast needs -snapshotDir, the directory the snapshot schedule task writes to")
+	}
+	if trendPer != "pool" && trendPer != "set" {
+		panic("invalid -per " + trendPer + ", expected pool or set")
+	}
+	if forecastModel != "linear" && forecastModel != "seasonal" {
+		panic("invalid -model " + forecastModel + ", expected linear or seasonal")
+	}
+	pcts, err := parseThresholds(forecastThresholds)
+	if err != nil {
+		panic(err)
+	}
+
+	files, err := snapshotFiles(snapshotDir, time.Now().Add(-trendLast))
+	if err != nil {
+		panic(err)
+	}
+	if len(files) < 2 {
+		fmt.Println("forecast needs at least two snapshots in", snapshotDir, "within the last", trendLast)
+		return
+	}
+
+	series := usageSeries(files, trendPer)
+	groups := stringKeysSorted(series)
+	sort.Slice(groups, func(i, j int) bool { return naturalLess(groups[i], groups[j]) })
+	results := make([]forecastResult, 0, len(groups))
+	for _, g := range groups {
+		results = append(results, forecastGroup(g, series[g], pcts))
+	}
+
+	if jsonOutput {
+		jsonOut(results)
+		return
+	}
+	fmt.Printf("%-10s %-10s %-10s %-6s %-12s %-9s", strings.ToUpper(trendPer), "USED", "CAPACITY", "USED%", "GROWTH/DAY", "MODEL")
+	for _, p := range pcts {
+		fmt.Printf(" %-12s", strings.ToUpper(thresholdName(p)))
+	}
+	fmt.Println()
+	for _, r := range results {
+		pct := 0.0
+		if r.Total > 0 {
+			pct = float64(r.Used) / float64(r.Total) * 100
+		}
+		growth := humanize.IBytes(uint64(max(r.PerDay, -r.PerDay)))
+		if r.PerDay < 0 {
+			growth = "-" + growth
+		}
+		fmt.Printf("%-10s %-10s %-10s %-6s %-12s %-9s", r.Group, humanize.IBytes(r.Used), humanize.IBytes(r.Total), humanize.FormatFloat("#.#", pct)+"%", growth, r.Model)
+		for _, p := range pcts {
+			fmt.Printf(" %-12s", r.Thresholds[thresholdName(p)])
+		}
+		fmt.Println()
+	}
+}
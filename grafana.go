@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+type grafanaPanel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	Datasource  map[string]string      `json:"datasource"`
+	GridPos     map[string]int         `json:"gridPos"`
+	Targets     []grafanaTarget        `json:"targets"`
+	FieldConfig map[string]interface{} `json:"fieldConfig,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+}
+
+// thresholds colors a panel red below red and yellow below yellow, or the
+// other way round when higherIsWorse is set.
+func thresholds(higherIsWorse bool, yellow, red int) map[string]interface{} {
+	steps := []map[string]interface{}{
+		{"color": "red", "value": nil},
+		{"color": "yellow", "value": red},
+		{"color": "green", "value": yellow},
+	}
+	if higherIsWorse {
+		steps = []map[string]interface{}{
+			{"color": "green", "value": nil},
+			{"color": "yellow", "value": yellow},
+			{"color": "red", "value": red},
+		}
+	}
+	return map[string]interface{}{
+		"defaults": map[string]interface{}{
+			"thresholds": map[string]interface{}{"mode": "absolute", "steps": steps},
+		},
+	}
+}
+
+// grafanaDashboard builds a dashboard for the metrics served by 'exporter'.
+// The data source is an import input so Grafana asks for it on import.
+func grafanaDashboard() map[string]interface{} {
+	ds := map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+	var panels []grafanaPanel
+	add := func(typ, title, desc string, w, h int, fc map[string]interface{}, targets ...grafanaTarget) {
+		x, y := 0, 0
+		if n := len(panels); n > 0 {
+			last := panels[n-1].GridPos
+			x, y = last["x"]+last["w"], last["y"]
+			if x+w > 24 {
+				x, y = 0, last["y"]+last["h"]
+			}
+		}
+		panels = append(panels, grafanaPanel{
+			ID:          len(panels) + 1,
+			Type:        typ,
+			Title:       title,
+			Description: desc,
+			Datasource:  ds,
+			GridPos:     map[string]int{"x": x, "y": y, "w": w, "h": h},
+			Targets:     targets,
+			FieldConfig: fc,
+		})
+	}
+
+	add("stat", "Lowest parity margin", "Drives the weakest erasure set can still lose", 6, 5,
+		thresholds(false, 2, 1),
+		grafanaTarget{Expr: "min(" + metricSetParityMargin + ")", RefID: "A"})
+	add("stat", "Heal backlog", "Drives that are currently healing", 6, 5,
+		thresholds(true, 1, 10),
+		grafanaTarget{Expr: metricHealBacklog, RefID: "A"})
+	add("stat", "Sets that can not reboot", "Erasure sets without the parity to take a server down", 6, 5,
+		thresholds(true, 1, 1),
+		grafanaTarget{Expr: "count(" + metricSetCanReboot + " == 0) or vector(0)", RefID: "A"})
+	add("stat", "Last refresh", "Seconds since the exporter last loaded cluster data", 6, 5,
+		thresholds(true, 300, 900),
+		grafanaTarget{Expr: "time() - " + metricRefreshTimestamp, RefID: "A"})
+	add("timeseries", "Bad drives per set", "", 12, 8, nil,
+		grafanaTarget{Expr: metricSetBadDrives + " > 0", LegendFormat: "pool {{pool}} set {{set}}", RefID: "A"})
+	add("timeseries", "Parity margin per set", "", 12, 8, thresholds(false, 2, 1),
+		grafanaTarget{Expr: metricSetParityMargin, LegendFormat: "pool {{pool}} set {{set}}", RefID: "A"})
+	add("timeseries", "Drives by state", "", 12, 8, nil,
+		grafanaTarget{Expr: "sum by (state) (" + metricDrives + ")", LegendFormat: "{{state}}", RefID: "A"})
+	add("timeseries", "Heal backlog", "", 12, 8, nil,
+		grafanaTarget{Expr: metricHealBacklog, LegendFormat: "healing drives", RefID: "A"})
+
+	return map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name":     "DS_PROMETHEUS",
+			"label":    "Prometheus",
+			"type":     "datasource",
+			"pluginId": "prometheus",
+		}},
+		"title":         "MinIO cluster tool",
+		"uid":           "minio-cluster-tool",
+		"tags":          []string{"minio"},
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"panels":        panels,
+	}
+}
+
+func exportGrafana() {
+	out, err := json.MarshalIndent(grafanaDashboard(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+}
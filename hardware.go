@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// redfishStatus is the Status object most Redfish resources carry.
+type redfishStatus struct {
+	State  string
+	Health string
+}
+
+// absent reports whether the resource is an empty slot.
+func (s redfishStatus) absent() bool {
+	return s.State == "Absent"
+}
+
+// healthStatus maps a Redfish health to a check status: Critical fails,
+// Warning warns.
+func (s redfishStatus) healthStatus() string {
+	switch s.Health {
+	case "", "OK":
+		return checkPass
+	case "Warning":
+		return checkWarn
+	}
+	return checkFail
+}
+
+type redfishPower struct {
+	PowerSupplies []struct {
+		Name   string
+		Status redfishStatus
+	}
+}
+
+type redfishThermal struct {
+	Fans []struct {
+		Name   string
+		Status redfishStatus
+	}
+	Temperatures []struct {
+		Name                   string
+		ReadingCelsius         float64
+		UpperThresholdCritical float64
+		Status                 redfishStatus
+	}
+}
+
+type redfishDrive struct {
+	Name             string
+	SerialNumber     string
+	FailurePredicted bool
+	Status           redfishStatus
+}
+
+// redfishHardware reads power supplies, fans, temperatures and drives from
+// the BMC. Only problems are returned, or a single pass result when there
+// are none.
+func redfishHardware(b bmcHost) (r []checkResult) {
+	chassis, err := b.redfishMembers("/redfish/v1/Chassis")
+	if err != nil {
+		return []checkResult{newResult("bmc", checkFail, err.Error(), "Check that the BMC is reachable and accepts -bmcUser and its password")}
+	}
+
+	psus, fans, temps, drives := 0, 0, 0, 0
+	bad := func(check, status, message, hint string) {
+		r = append(r, newResult(check, status, message, hint))
+	}
+	for _, c := range chassis {
+		var power redfishPower
+		err = b.redfish(http.MethodGet, c+"/Power", nil, &power)
+		if err != nil {
+			bad("psu", checkWarn, err.Error(), "")
+		}
+		for _, p := range power.PowerSupplies {
+			if p.Status.absent() {
+				continue
+			}
+			psus++
+			if (p.Status.Health != "" && p.Status.Health != "OK") || p.Status.State == "UnavailableOffline" {
+				bad("psu", checkFail, fmt.Sprintf("%s is %s/%s", p.Name, p.Status.State, p.Status.Health),
+					"Replace the power supply before rebooting, the host runs without redundancy")
+			}
+		}
+
+		var thermal redfishThermal
+		err = b.redfish(http.MethodGet, c+"/Thermal", nil, &thermal)
+		if err != nil {
+			bad("thermal", checkWarn, err.Error(), "")
+		}
+		for _, f := range thermal.Fans {
+			if f.Status.absent() {
+				continue
+			}
+			fans++
+			if st := f.Status.healthStatus(); st != checkPass {
+				bad("fans", st, fmt.Sprintf("%s is %s", f.Name, f.Status.Health), "Check the fan, hosts may not boot with failed fans")
+			}
+		}
+		for _, t := range thermal.Temperatures {
+			if t.Status.absent() {
+				continue
+			}
+			temps++
+			st := t.Status.healthStatus()
+			if st == checkPass && t.UpperThresholdCritical > 0 && t.ReadingCelsius >= t.UpperThresholdCritical {
+				st = checkFail
+			}
+			if st != checkPass {
+				bad("thermal", st, fmt.Sprintf("%s at %.0fC (critical %.0fC) is %s", t.Name, t.ReadingCelsius, t.UpperThresholdCritical, t.Status.Health), "")
+			}
+		}
+	}
+
+	systems, err := b.redfishMembers("/redfish/v1/Systems")
+	if err != nil {
+		bad("drives", checkWarn, err.Error(), "")
+	}
+	for _, s := range systems {
+		storage, err := b.redfishMembers(s + "/Storage")
+		if err != nil {
+			// Not every BMC exposes storage controllers.
+			continue
+		}
+		for _, st := range storage {
+			var ctrl struct {
+				Drives []struct {
+					ID string `json:"@odata.id"`
+				}
+			}
+			err = b.redfish(http.MethodGet, st, nil, &ctrl)
+			if err != nil {
+				bad("drives", checkWarn, err.Error(), "")
+				continue
+			}
+			for _, link := range ctrl.Drives {
+				var d redfishDrive
+				err = b.redfish(http.MethodGet, link.ID, nil, &d)
+				if err != nil {
+					bad("drives", checkWarn, err.Error(), "")
+					continue
+				}
+				drives++
+				switch {
+				case d.FailurePredicted:
+					bad("drives", checkWarn, fmt.Sprintf("%s (serial %s) is predicted to fail", d.Name, d.SerialNumber), "Replace the drive before it fails")
+				case d.Status.healthStatus() != checkPass:
+					bad("drives", d.Status.healthStatus(), fmt.Sprintf("%s (serial %s) is %s", d.Name, d.SerialNumber, d.Status.Health), "")
+				}
+			}
+		}
+	}
+
+	if len(r) == 0 {
+		r = append(r, newResult("hardware", checkPass, fmt.Sprintf("%d power supplies, %d fans, %d temperatures and %d drives ok", psus, fans, temps, drives), ""))
+	}
+	return
+}
+
+// checkHostHardware adds the BMC view of the host to the host checks, when
+// -bmcFile is given.
+func checkHostHardware(h *hostData) []checkResult {
+	if bmcFile == "" {
+		return nil
+	}
+	b, ok := bmcFor(h.Host)
+	if !ok {
+		return []checkResult{newResult("hardware", checkWarn, "no BMC in "+bmcFile, "")}
+	}
+	if b.Type != "redfish" {
+		return []checkResult{newResult("hardware", checkWarn, "hardware health needs a Redfish BMC, "+b.Address+" is "+b.Type, "")}
+	}
+	return redfishHardware(b)
+}
+
+// checkHardware is the pre-flight view of checkHostHardware, problems are
+// reported per host. A BMC that does not answer only blocks the reboot when
+// -powerCycle relies on it.
+func checkHardware(hosts []string) (r []checkResult) {
+	for _, host := range hosts {
+		for _, res := range checkHostHardware(&hostData{Host: host}) {
+			if res.Status == checkPass {
+				continue
+			}
+			if res.Check == "bmc" && !powerCycleFallback {
+				res.Status = checkWarn
+			}
+			res.Message = host + ": " + res.Message
+			r = append(r, res)
+		}
+	}
+	if len(r) == 0 && bmcFile != "" {
+		r = append(r, newResult("hardware", checkPass, "no hardware problems reported by the BMCs", ""))
+	}
+	return
+}
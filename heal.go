@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// healThrottle holds the heal subsystem settings that control how hard the
+// server heals. Empty values are left untouched.
+type healThrottle struct {
+	MaxIO    string
+	MaxSleep string
+}
+
+var healPresets = map[string]healThrottle{
+	"gentle":     {MaxIO: "10", MaxSleep: "1s"},
+	"aggressive": {MaxIO: "1000", MaxSleep: "1ms"},
+}
+
+// requestedHealThrottle returns the throttle settings selected by the
+// -gentle/-aggressive presets and the explicit -healMaxIO/-healMaxSleep
+// flags. Explicit flags win over presets.
+func requestedHealThrottle() (t healThrottle, ok bool) {
+	if healGentle && healAggressive {
+		panic("-gentle and -aggressive can not be combined")
+	}
+	if healGentle {
+		t = healPresets["gentle"]
+	}
+	if healAggressive {
+		t = healPresets["aggressive"]
+	}
+	if healMaxIO != "" {
+		t.MaxIO = healMaxIO
+	}
+	if healMaxSleep != "" {
+		t.MaxSleep = healMaxSleep
+	}
+	return t, t.MaxIO != "" || t.MaxSleep != ""
+}
+
+func (t healThrottle) kv() (kv string) {
+	kv = "heal"
+	if t.MaxIO != "" {
+		kv += " max_io=" + t.MaxIO
+	}
+	if t.MaxSleep != "" {
+		kv += " max_sleep=" + t.MaxSleep
+	}
+	return
+}
+
+// getHealThrottle reads the current heal settings from the server.
+func getHealThrottle() (t healThrottle, err error) {
+	raw, err := mclient.GetConfigKV(context.Background(), "heal")
+	if err != nil {
+		return
+	}
+	cfgs, err := madmin.ParseServerConfigOutput(string(raw))
+	if err != nil {
+		return
+	}
+	for _, c := range cfgs {
+		if c.SubSystem != "heal" {
+			continue
+		}
+		t.MaxIO, _ = c.Lookup("max_io")
+		t.MaxSleep, _ = c.Lookup("max_sleep")
+	}
+	return
+}
+
+func setHealThrottle(t healThrottle) (err error) {
+	_, err = mclient.SetConfigKV(context.Background(), t.kv())
+	return
+}
+
+// applyHealThrottle applies the requested heal settings and returns a
+// function that restores the previous ones. When no throttling was requested
+// the returned function does nothing.
+func applyHealThrottle() (restore func()) {
+	restore = func() {}
+	requested, ok := requestedHealThrottle()
+	if !ok {
+		return
+	}
+
+	previous, err := getHealThrottle()
+	if err != nil {
+		panic(err)
+	}
+	// Only restore what we changed.
+	if requested.MaxIO == "" {
+		previous.MaxIO = ""
+	}
+	if requested.MaxSleep == "" {
+		previous.MaxSleep = ""
+	}
+
+	err = setHealThrottle(requested)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Heal settings applied:", requested.kv())
+
+	return func() {
+		err := setHealThrottle(previous)
+		if err != nil {
+			fmt.Println("Unable to restore heal settings:", previous.kv(), err)
+			return
+		}
+		fmt.Println("Heal settings restored:", previous.kv())
+	}
+}
+
+// healRound heals every set with drives on hosts and returns once all of them
+// are done, so the next round does not start on a set that is still
+// degraded from the previous one.
+func healRound(hosts []string) {
+	pools, _, err := getInfra()
+	if err != nil {
+		fmt.Println("Unable to load sets to heal:", err)
+		runStats.failures.Add(1)
+		return
+	}
+
+	rebooted := make(map[string]bool)
+	for _, h := range hosts {
+		rebooted[h] = true
+	}
+	var targets []healTarget
+	seen := make(map[healTarget]bool)
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			if !rebooted[host] {
+				continue
+			}
+			for _, set := range s.Sets {
+				t := healTarget{Pool: set.Pool - 1, Set: set.ID - 1}
+				if !seen[t] {
+					seen[t] = true
+					targets = append(targets, t)
+				}
+			}
+		}
+	}
+
+	workers := healWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+	fmt.Println("Healing", len(targets), "sets affected by the round")
+	for _, t := range targets {
+		sem <- struct{}{}
+		if lockLost() {
+			fmt.Println("Not healing the remaining sets of the round,", errLockLost)
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(t healTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := healSet(t.Pool, t.Set); err != nil {
+				fmt.Printf("Unable to heal set %d/%d: %v\n", t.Pool, t.Set, err)
+				return
+			}
+			fmt.Printf("Healed set %d/%d\n", t.Pool, t.Set)
+		}(t)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// hostProgress is what waitHealthy knows about a host it is waiting for.
+type hostProgress struct {
+	Host     string
+	Status   string
+	Attempts int
+	Since    time.Time
+	Healthy  time.Time
+	LastErr  string
+}
+
+func (p *hostProgress) update(r healthResult) {
+	p.Attempts++
+	switch {
+	case r.err != nil:
+		p.Status = "failed"
+		p.LastErr = r.err.Error()
+	case !r.ok:
+		p.Status = "waiting"
+		p.LastErr = r.reason
+	default:
+		p.Status = "healthy"
+		p.Healthy = time.Now()
+	}
+}
+
+func (p *hostProgress) waited() time.Duration {
+	if !p.Healthy.IsZero() {
+		return p.Healthy.Sub(p.Since).Truncate(time.Second)
+	}
+	return time.Since(p.Since).Truncate(time.Second)
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// healthTable renders host progress. On a terminal the previous table is
+// overwritten, otherwise only hosts that are not healthy yet are printed so
+// logs stay readable.
+type healthTable struct {
+	tty   bool
+	lines int
+}
+
+func newHealthTable() *healthTable {
+	return &healthTable{tty: isTerminal(os.Stdout)}
+}
+
+func (t *healthTable) render(hosts []*hostProgress, summary string) {
+	width := len("HOST")
+	for _, p := range hosts {
+		if len(p.Host) > width {
+			width = len(p.Host)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s  %-8s  %8s  %8s  %s\n", width, "HOST", "STATUS", "ATTEMPTS", "WAITED", "LAST ERROR")
+	for _, p := range hosts {
+		if !t.tty && p.Status == "healthy" {
+			continue
+		}
+		lastErr := p.LastErr
+		if p.Status == "healthy" {
+			lastErr = ""
+		}
+		fmt.Fprintf(&b, "%-*s  %-8s  %8d  %8s  %s\n", width, p.Host, p.Status, p.Attempts, p.waited(), lastErr)
+	}
+	b.WriteString(summary + "\n")
+
+	out := b.String()
+	if t.tty && t.lines > 0 {
+		// Move up to the first line of the previous table and clear it.
+		fmt.Printf("\033[%dA\033[J", t.lines)
+	}
+	fmt.Print(out)
+	t.lines = strings.Count(out, "\n")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// historyPrefix is where operation summaries are kept inside -historyBucket,
+// object names sort by the time the operation started.
+const historyPrefix = ".cluster-tool/history/"
+
+// historyEntry is the summary of one completed operation.
+type historyEntry struct {
+	ID            string
+	Command       string
+	Args          []string
+	Operator      string
+	Host          string
+	DryRun        bool
+	Started       time.Time
+	Finished      time.Time
+	Duration      string
+	Outcome       string
+	Error         string   `json:",omitempty"`
+	Hosts         []string `json:",omitempty"`
+	HostsRebooted int64
+	ObjectsHealed int64
+	Failures      int64
+	// Binary and BinarySHA256 are the verified MinIO release an upgrade
+	// installed.
+	Binary       string `json:",omitempty"`
+	BinarySHA256 string `json:",omitempty"`
+}
+
+// touchedHosts are the hosts the current invocation worked on.
+var touchedHosts struct {
+	sync.Mutex
+	hosts map[string]bool
+}
+
+func touchHost(host string) {
+	touchedHosts.Lock()
+	defer touchedHosts.Unlock()
+	if touchedHosts.hosts == nil {
+		touchedHosts.hosts = make(map[string]bool)
+	}
+	touchedHosts.hosts[host] = true
+}
+
+func touchedHostList() (hosts []string) {
+	touchedHosts.Lock()
+	defer touchedHosts.Unlock()
+	for h := range touchedHosts.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return
+}
+
+// saveHistory stores e in -historyBucket. Failing to record history never
+// fails the operation itself.
+func saveHistory(e historyEntry) {
+	if historyBucket == "" {
+		return
+	}
+	e.Operator = lockHolder()
+	e.Host, _ = os.Hostname()
+	e.Duration = e.Finished.Sub(e.Started).Round(time.Second).String()
+	// Operations started in the same second, like API calls and scheduled
+	// runs, get their own entry.
+	e.ID = e.Started.UTC().Format("20060102-150405") + "-" + strings.ReplaceAll(e.Command, " ", "-") + "-" + randomHex(3)
+
+	client, err := s3Client(endpoint)
+	if err == nil {
+		var b []byte
+		b, err = json.MarshalIndent(e, "", "  ")
+		if err == nil {
+			_, err = client.PutObject(context.Background(), historyBucket, historyPrefix+e.ID+".json", bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{ContentType: "application/json"})
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to record operation history:", err)
+	}
+}
+
+// recordHistory stores the summary of the command that just finished.
+// Reading the history is not an operation itself.
+func recordHistory(command string, started time.Time, runErr error) {
+	if historyBucket == "" || strings.HasPrefix(command, "history") {
+		return
+	}
+	e := historyEntry{
+		Command:       command,
+		Args:          redactArgs(os.Args[1:]),
+		DryRun:        dryRun,
+		Started:       started,
+		Finished:      time.Now(),
+		Outcome:       "success",
+		Hosts:         touchedHostList(),
+		HostsRebooted: runStats.hostsRebooted.Load(),
+		ObjectsHealed: runStats.objectsHealed.Load(),
+		Failures:      runStats.failures.Load(),
+		Binary:        verifiedBinary.Name,
+		BinarySHA256:  verifiedBinary.SHA256,
+	}
+	switch {
+	case runErr != nil:
+		e.Outcome = "failed"
+		e.Error = runErr.Error()
+	case exitCode != 0 || e.Failures > 0:
+		e.Outcome = "failed"
+	}
+	saveHistory(e)
+}
+
+func historyClient() *minio.Client {
+	if historyBucket == "" {
+		panic("-historyBucket is required")
+	}
+	client, err := s3Client(endpoint)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func readHistory(client *minio.Client, id string) (e historyEntry, err error) {
+	obj, err := client.GetObject(context.Background(), historyBucket, historyPrefix+id+".json", minio.GetObjectOptions{})
+	if err != nil {
+		return e, err
+	}
+	defer obj.Close()
+	b, err := io.ReadAll(obj)
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(b, &e)
+	return
+}
+
+// historyList prints the last -last operations, oldest first.
+func historyList() {
+	client := historyClient()
+	var ids []string
+	for obj := range client.ListObjects(context.Background(), historyBucket, minio.ListObjectsOptions{Prefix: historyPrefix}) {
+		if obj.Err != nil {
+			panic(obj.Err)
+		}
+		ids = append(ids, strings.TrimSuffix(path.Base(obj.Key), ".json"))
+	}
+	sort.Strings(ids)
+	if historyLast > 0 && len(ids) > historyLast {
+		ids = ids[len(ids)-historyLast:]
+	}
+
+	entries := make([]historyEntry, 0, len(ids))
+	for _, id := range ids {
+		e, err := readHistory(client, id)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read", id+":", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if jsonOutput {
+		jsonOut(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No operations recorded in", historyBucket)
+		return
+	}
+	fmt.Printf("%-38s %-20s %-12s %-8s %-14s %s\n", "ID", "STARTED", "OPERATOR", "TOOK", "OUTCOME", "HOSTS")
+	for _, e := range entries {
+		outcome := e.Outcome
+		if e.DryRun {
+			outcome += " (dry)"
+		}
+		fmt.Printf("%-38s %-20s %-12s %-8s %-14s %d\n", e.ID, e.Started.Local().Format("2006-01-02 15:04:05"), e.Operator, e.Duration, outcome, len(e.Hosts))
+	}
+}
+
+// historyShow prints one recorded operation.
+func historyShow() {
+	if len(cmdArgs) != 1 {
+		panic("expected an operation ID, see 'history'")
+	}
+	e, err := readHistory(historyClient(), cmdArgs[0])
+	if err != nil {
+		panic(err)
+	}
+	if jsonOutput {
+		jsonOut(e)
+		return
+	}
+	fmt.Printf("%-10s %s\n", "ID", e.ID)
+	fmt.Printf("%-10s cluster-tool %s\n", "Command", strings.Join(e.Args, " "))
+	fmt.Printf("%-10s %s on %s\n", "Operator", e.Operator, e.Host)
+	fmt.Printf("%-10s %v\n", "Dry run", e.DryRun)
+	fmt.Printf("%-10s %s\n", "Started", e.Started.Local().Format(time.RFC3339))
+	fmt.Printf("%-10s %s\n", "Finished", e.Finished.Local().Format(time.RFC3339))
+	fmt.Printf("%-10s %s\n", "Took", e.Duration)
+	fmt.Printf("%-10s %s\n", "Outcome", e.Outcome)
+	if e.Error != "" {
+		fmt.Printf("%-10s %s\n", "Error", e.Error)
+	}
+	if e.Binary != "" {
+		fmt.Printf("%-10s %s sha256 %s\n", "Binary", e.Binary, e.BinarySHA256)
+	}
+	fmt.Printf("%-10s rebooted(%d) objectsHealed(%d) failures(%d)\n", "Counters", e.HostsRebooted, e.ObjectsHealed, e.Failures)
+	for _, h := range e.Hosts {
+		fmt.Println("  " + h)
+	}
+}
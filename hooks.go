@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maintenanceHook takes a host out of service before it is rebooted and puts
+// it back once it is healthy again.
+type maintenanceHook interface {
+	Name() string
+	Drain(host string) error
+	Enable(host string) error
+}
+
+// hookCache keeps hooks alive between Drain and Enable, kubeHook remembers
+// state about the hosts it drained.
+var hookCache []maintenanceHook
+
+// maintenanceHooks returns the hooks configured by flags, in the order they
+// should drain. Hosts are enabled again in reverse order.
+func maintenanceHooks() (hooks []maintenanceHook) {
+	if hookCache != nil {
+		return hookCache
+	}
+
+	switch lbType {
+	case "":
+	case "haproxy":
+		hooks = append(hooks, &haproxyHook{Address: lbAddress, Backend: lbBackend})
+	case "nginx":
+		hooks = append(hooks, &nginxHook{Address: lbAddress, Upstream: lbBackend})
+	case "webhook":
+		hooks = append(hooks, &webhookHook{URL: lbAddress})
+	default:
+		panic("invalid -lb " + lbType + ", expected haproxy, nginx or webhook")
+	}
+
+	if consulService != "" {
+		switch consulMode {
+		case "maintenance", "deregister":
+		default:
+			panic("invalid -consulMode " + consulMode + ", expected maintenance or deregister")
+		}
+		hooks = append(hooks, &consulHook{
+			Port:       consulPort,
+			Service:    consulService,
+			Token:      consulToken,
+			Deregister: consulMode == "deregister",
+			SaveDir:    consulSaveDir,
+		})
+	}
+
+	if kubeDrain {
+		hooks = append(hooks, &kubeHook{
+			Context:      kubeContext,
+			Namespace:    kubeNamespace,
+			DrainTimeout: kubeDrainTimeout,
+		})
+	}
+
+	hookCache = hooks
+	return
+}
+
+// drainHost runs every hook's Drain for host and waits -drainWait so
+// in-flight requests can finish. It returns the hooks that drained host, on
+// an error those are the ones to enable again.
+func drainHost(host string) (drained []maintenanceHook, err error) {
+	hooks := maintenanceHooks()
+	for _, h := range hooks {
+		err = h.Drain(host)
+		if err != nil {
+			return drained, fmt.Errorf("%s drain: %w", h.Name(), err)
+		}
+		drained = append(drained, h)
+		fmt.Println("Drained:", host, "from", h.Name())
+	}
+	if len(hooks) > 0 && drainWait > 0 {
+		time.Sleep(drainWait)
+	}
+	return
+}
+
+// enableHost puts host back into service on every hook.
+func enableHost(host string) error {
+	return enableHooks(host, maintenanceHooks())
+}
+
+// enableHooks puts host back into service on hooks in reverse order. A hook
+// that fails does not stop the ones before it.
+func enableHooks(host string, hooks []maintenanceHook) error {
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		err := hooks[i].Enable(host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s enable: %w", hooks[i].Name(), err))
+			continue
+		}
+		fmt.Println("Enabled:", host, "on", hooks[i].Name())
+	}
+	return errors.Join(errs...)
+}
+
+// enableHosts enables hosts after they became healthy and reports failures
+// without stopping, an operator has to enable them by hand.
+func enableHosts(hosts []string) {
+	for _, h := range hosts {
+		err := enableHost(h)
+		if err != nil {
+			runStats.failures.Add(1)
+			recordHostFailure(h, err)
+			fmt.Println("Unable to enable", h, err)
+		}
+	}
+}
+
+// haproxyHook uses the HAProxy runtime API. Address is either a unix socket
+// path or host:port, and servers in Backend must be named after the host.
+type haproxyHook struct {
+	Address string
+	Backend string
+}
+
+func (h *haproxyHook) Name() string { return "haproxy" }
+
+func (h *haproxyHook) command(cmd string) (err error) {
+	network := "tcp"
+	if strings.HasPrefix(h.Address, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, h.Address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	_, err = conn.Write([]byte(cmd + "\n"))
+	if err != nil {
+		return err
+	}
+	out, err := io.ReadAll(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	// HAProxy answers an empty line on success.
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
+
+func (h *haproxyHook) Drain(host string) error {
+	return h.command("set server " + h.Backend + "/" + host + " state drain")
+}
+
+func (h *haproxyHook) Enable(host string) error {
+	return h.command("set server " + h.Backend + "/" + host + " state ready")
+}
+
+// nginxHook uses the NGINX Plus upstream API. Address is the API base URL,
+// for example http://lb:8080/api/8.
+type nginxHook struct {
+	Address  string
+	Upstream string
+}
+
+func (n *nginxHook) Name() string { return "nginx" }
+
+func (n *nginxHook) serverID(host string) (id int, err error) {
+	u := strings.TrimSuffix(n.Address, "/") + "/http/upstreams/" + n.Upstream + "/servers"
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+
+	var servers []struct {
+		ID     int    `json:"id"`
+		Server string `json:"server"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&servers)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range servers {
+		h, _, _ := net.SplitHostPort(s.Server)
+		if h == host || s.Server == host {
+			return s.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not a server in upstream %s", host, n.Upstream)
+}
+
+func (n *nginxHook) patch(host string, drain bool) (err error) {
+	id, err := n.serverID(host)
+	if err != nil {
+		return err
+	}
+	body := []byte(`{"drain":false,"down":false}`)
+	if drain {
+		body = []byte(`{"drain":true}`)
+	}
+	u := fmt.Sprintf("%s/http/upstreams/%s/servers/%d", strings.TrimSuffix(n.Address, "/"), n.Upstream, id)
+	req, err := http.NewRequest(http.MethodPatch, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PATCH %s: %s", u, resp.Status)
+	}
+	return nil
+}
+
+func (n *nginxHook) Drain(host string) error  { return n.patch(host, true) }
+func (n *nginxHook) Enable(host string) error { return n.patch(host, false) }
+
+// webhookHook POSTs {"action":"drain|enable","host":"..."} to URL and
+// expects a 2xx response.
+type webhookHook struct {
+	URL string
+}
+
+func (w *webhookHook) Name() string { return "webhook" }
+
+func (w *webhookHook) post(action string, host string) error {
+	body, err := json.Marshal(map[string]string{"action": action, "host": host})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+func (w *webhookHook) Drain(host string) error  { return w.post("drain", host) }
+func (w *webhookHook) Enable(host string) error { return w.post("enable", host) }
+
+// consulHook takes the minio service out of Consul through the agent running
+// on the host itself, either by enabling service maintenance mode or by
+// deregistering it and registering the saved definition again. Saved
+// definitions are written to SaveDir so a later run can register them.
+type consulHook struct {
+	Port       string
+	Service    string
+	Token      string
+	Deregister bool
+	SaveDir    string
+}
+
+func (c *consulHook) Name() string { return "consul" }
+
+func (c *consulHook) request(method string, host string, path string, body []byte) (out []byte, err error) {
+	u := "http://" + net.JoinHostPort(host, c.Port) + path
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s %s", method, u, resp.Status, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// consulAgentService is a service as the agent returns it, it is not what
+// the register endpoint accepts.
+type consulAgentService struct {
+	ID                string
+	Service           string
+	Kind              string            `json:",omitempty"`
+	Tags              []string          `json:",omitempty"`
+	Meta              map[string]string `json:",omitempty"`
+	Port              int
+	Address           string
+	TaggedAddresses   json.RawMessage `json:",omitempty"`
+	Weights           json.RawMessage `json:",omitempty"`
+	EnableTagOverride bool
+	Proxy             json.RawMessage `json:",omitempty"`
+	Connect           json.RawMessage `json:",omitempty"`
+	Namespace         string          `json:",omitempty"`
+	Partition         string          `json:",omitempty"`
+}
+
+// consulAgentCheck is a check as /v1/agent/checks returns it.
+type consulAgentCheck struct {
+	CheckID    string
+	Name       string
+	Notes      string
+	ServiceID  string
+	Type       string
+	Definition struct {
+		HTTP                           string              `json:",omitempty"`
+		Header                         map[string][]string `json:",omitempty"`
+		Method                         string              `json:",omitempty"`
+		Body                           string              `json:",omitempty"`
+		TLSServerName                  string              `json:",omitempty"`
+		TLSSkipVerify                  bool                `json:",omitempty"`
+		TCP                            string              `json:",omitempty"`
+		UDP                            string              `json:",omitempty"`
+		GRPC                           string              `json:",omitempty"`
+		GRPCUseTLS                     bool                `json:",omitempty"`
+		H2PING                         string              `json:",omitempty"`
+		OSService                      string              `json:",omitempty"`
+		Interval                       json.RawMessage
+		Timeout                        json.RawMessage
+		DeregisterCriticalServiceAfter json.RawMessage
+	}
+}
+
+// consulCheck is a check in a service registration.
+type consulCheck struct {
+	CheckID                        string
+	Name                           string
+	Notes                          string              `json:",omitempty"`
+	HTTP                           string              `json:",omitempty"`
+	Header                         map[string][]string `json:",omitempty"`
+	Method                         string              `json:",omitempty"`
+	Body                           string              `json:",omitempty"`
+	TLSServerName                  string              `json:",omitempty"`
+	TLSSkipVerify                  bool                `json:",omitempty"`
+	TCP                            string              `json:",omitempty"`
+	UDP                            string              `json:",omitempty"`
+	GRPC                           string              `json:",omitempty"`
+	GRPCUseTLS                     bool                `json:",omitempty"`
+	H2PING                         string              `json:",omitempty"`
+	OSService                      string              `json:",omitempty"`
+	Interval                       string              `json:",omitempty"`
+	Timeout                        string              `json:",omitempty"`
+	DeregisterCriticalServiceAfter string              `json:",omitempty"`
+}
+
+// consulRegistration is what /v1/agent/service/register accepts.
+type consulRegistration struct {
+	ID                string
+	Name              string
+	Kind              string            `json:",omitempty"`
+	Tags              []string          `json:",omitempty"`
+	Meta              map[string]string `json:",omitempty"`
+	Port              int
+	Address           string
+	TaggedAddresses   json.RawMessage `json:",omitempty"`
+	Weights           json.RawMessage `json:",omitempty"`
+	EnableTagOverride bool
+	Proxy             json.RawMessage `json:",omitempty"`
+	Connect           json.RawMessage `json:",omitempty"`
+	Namespace         string          `json:",omitempty"`
+	Partition         string          `json:",omitempty"`
+	Checks            []consulCheck   `json:",omitempty"`
+}
+
+// consulDuration turns a check duration into the "10s" form registrations
+// take, older agents return nanoseconds instead of a string.
+func consulDuration(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+	var ns int64
+	if err := json.Unmarshal(raw, &ns); err != nil {
+		return "", fmt.Errorf("unexpected duration %s", raw)
+	}
+	if ns == 0 {
+		return "", nil
+	}
+	return time.Duration(ns).String(), nil
+}
+
+// consulCheckTypes are the check types whose definition the agent returns
+// in full, the others, like script and TTL checks, cannot be registered
+// again from it.
+var consulCheckTypes = map[string]bool{"http": true, "tcp": true, "udp": true, "grpc": true, "h2ping": true, "os_service": true}
+
+// registration reads the service and its checks from the agent on host and
+// turns them into a definition the agent can register again.
+func (c *consulHook) registration(host string) (reg consulRegistration, err error) {
+	out, err := c.request(http.MethodGet, host, "/v1/agent/service/"+url.PathEscape(c.Service), nil)
+	if err != nil {
+		return reg, err
+	}
+	var svc consulAgentService
+	if err = json.Unmarshal(out, &svc); err != nil {
+		return reg, fmt.Errorf("reading service %s: %w", c.Service, err)
+	}
+	reg = consulRegistration{
+		ID:                svc.ID,
+		Name:              svc.Service,
+		Kind:              svc.Kind,
+		Tags:              svc.Tags,
+		Meta:              svc.Meta,
+		Port:              svc.Port,
+		Address:           svc.Address,
+		TaggedAddresses:   svc.TaggedAddresses,
+		Weights:           svc.Weights,
+		EnableTagOverride: svc.EnableTagOverride,
+		Proxy:             svc.Proxy,
+		Connect:           svc.Connect,
+		Namespace:         svc.Namespace,
+		Partition:         svc.Partition,
+	}
+
+	out, err = c.request(http.MethodGet, host, "/v1/agent/checks", nil)
+	if err != nil {
+		return reg, err
+	}
+	checks := make(map[string]consulAgentCheck)
+	if err = json.Unmarshal(out, &checks); err != nil {
+		return reg, fmt.Errorf("reading checks: %w", err)
+	}
+	ids := make([]string, 0, len(checks))
+	for id, ch := range checks {
+		if ch.ServiceID == svc.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ch := checks[id]
+		if !consulCheckTypes[ch.Type] {
+			return reg, fmt.Errorf("check %s of service %s is a %q check which cannot be registered again, use -consulMode maintenance", ch.CheckID, c.Service, ch.Type)
+		}
+		d := ch.Definition
+		rc := consulCheck{
+			CheckID: ch.CheckID, Name: ch.Name, Notes: ch.Notes,
+			HTTP: d.HTTP, Header: d.Header, Method: d.Method, Body: d.Body,
+			TLSServerName: d.TLSServerName, TLSSkipVerify: d.TLSSkipVerify,
+			TCP: d.TCP, UDP: d.UDP, GRPC: d.GRPC, GRPCUseTLS: d.GRPCUseTLS,
+			H2PING: d.H2PING, OSService: d.OSService,
+		}
+		for _, f := range []struct {
+			raw json.RawMessage
+			dst *string
+		}{{d.Interval, &rc.Interval}, {d.Timeout, &rc.Timeout}, {d.DeregisterCriticalServiceAfter, &rc.DeregisterCriticalServiceAfter}} {
+			if *f.dst, err = consulDuration(f.raw); err != nil {
+				return reg, fmt.Errorf("check %s: %w", ch.CheckID, err)
+			}
+		}
+		reg.Checks = append(reg.Checks, rc)
+	}
+	return reg, nil
+}
+
+// savedPath is where the definition of the service on host is kept while it
+// is deregistered.
+func (c *consulHook) savedPath(host string) string {
+	return filepath.Join(c.SaveDir, host+"-"+c.Service+".json")
+}
+
+func (c *consulHook) Drain(host string) (err error) {
+	if !c.Deregister {
+		_, err = c.request(http.MethodPut, host, "/v1/agent/service/maintenance/"+url.PathEscape(c.Service)+"?enable=true&reason=minio-cluster-tool+reboot", nil)
+		return
+	}
+
+	reg, err := c.registration(host)
+	if err != nil {
+		return err
+	}
+	def, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The definition is on disk before the service is gone from Consul.
+	err = os.MkdirAll(c.SaveDir, 0o700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(c.savedPath(host), def, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = c.request(http.MethodPut, host, "/v1/agent/service/deregister/"+url.PathEscape(c.Service), nil)
+	return err
+}
+
+func (c *consulHook) Enable(host string) (err error) {
+	if !c.Deregister {
+		_, err = c.request(http.MethodPut, host, "/v1/agent/service/maintenance/"+url.PathEscape(c.Service)+"?enable=false", nil)
+		return
+	}
+
+	def, err := os.ReadFile(c.savedPath(host))
+	if err != nil {
+		return fmt.Errorf("no saved service definition for %s: %w", host, err)
+	}
+	_, err = c.request(http.MethodPut, host, "/v1/agent/service/register", def)
+	if err == nil {
+		_ = os.Remove(c.savedPath(host))
+	}
+	return
+}
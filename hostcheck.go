@@ -0,0 +1,466 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostData is what the host checks know about one host. Command output is
+// cached so several checks can share it over the same connection.
+type hostData struct {
+	Host string
+	// Drives are the drive paths MinIO reports for the host, nil when the
+	// cluster could not be queried.
+	Drives []string
+
+	mu  sync.Mutex
+	out map[string]hostOutput
+}
+
+type hostOutput struct {
+	out string
+	err error
+}
+
+// run returns the output of cmd on the host, running it at most once.
+func (h *hostData) run(cmd string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.out == nil {
+		h.out = make(map[string]hostOutput)
+	}
+	if o, ok := h.out[cmd]; ok {
+		return o.out, o.err
+	}
+	out, err := runSSH(h.Host, cmd)
+	o := hostOutput{out: strings.TrimSpace(string(out)), err: err}
+	if err != nil && o.out != "" {
+		o.err = fmt.Errorf("%w: %s", err, lastLine(o.out))
+	}
+	h.out[cmd] = o
+	return o.out, o.err
+}
+
+type hostCheck struct {
+	Name string
+	Run  func(h *hostData) []checkResult
+}
+
+var hostChecks = []hostCheck{
+	{"uptime", checkHostUptime},
+	{"kernel", checkHostKernel},
+	{"reboot", checkHostPendingReboot},
+	{"memory", checkHostMemory},
+	{"mounts", checkHostMounts},
+	{"rootdisk", checkHostRootDisk},
+	{"fstab", checkHostFstab},
+	{"limits", checkHostLimits},
+	{"hardware", checkHostHardware},
+}
+
+func hostFail(check string, err error) []checkResult {
+	return []checkResult{newResult(check, checkFail, err.Error(), "")}
+}
+
+func checkHostUptime(h *hostData) []checkResult {
+	out, err := h.run("cat /proc/uptime")
+	if err != nil {
+		return hostFail("uptime", err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return hostFail("uptime", fmt.Errorf("unexpected /proc/uptime: %q", out))
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return hostFail("uptime", err)
+	}
+	up := (time.Duration(secs) * time.Second).Truncate(time.Minute)
+	return []checkResult{newResult("uptime", checkPass, "up "+up.String(), "")}
+}
+
+func checkHostKernel(h *hostData) []checkResult {
+	out, err := h.run("uname -r")
+	if err != nil {
+		return hostFail("kernel", err)
+	}
+	return []checkResult{newResult("kernel", checkPass, out, "")}
+}
+
+// checkHostPendingReboot looks at the Debian/Ubuntu reboot-required marker
+// and at the kernel status reported by needrestart in batch mode.
+func checkHostPendingReboot(h *hostData) []checkResult {
+	var reasons []string
+
+	out, err := h.run("test -f /var/run/reboot-required && echo yes || echo no")
+	if err != nil {
+		return hostFail("reboot", err)
+	}
+	if out == "yes" {
+		reasons = append(reasons, "/var/run/reboot-required exists")
+	}
+
+	// needrestart may not be installed, missing output is not an error.
+	out, _ = h.run("needrestart -b 2>/dev/null || true")
+	services := 0
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "NEEDRESTART-KSTA":
+			// 1 means the running kernel is current.
+			if v != "" && v != "0" && v != "1" {
+				reasons = append(reasons, "kernel upgrade pending (needrestart)")
+			}
+		case "NEEDRESTART-SVC":
+			services++
+		}
+	}
+	if services > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d services need a restart (needrestart)", services))
+	}
+
+	if len(reasons) > 0 {
+		return []checkResult{newResult("reboot", checkWarn, strings.Join(reasons, "; "), "Reboot the host during the next maintenance round")}
+	}
+	return []checkResult{newResult("reboot", checkPass, "no reboot pending", "")}
+}
+
+func checkHostMemory(h *hostData) []checkResult {
+	out, err := h.run("cat /proc/meminfo")
+	if err != nil {
+		return hostFail("memory", err)
+	}
+	var total, available float64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		v, _ := strconv.ParseFloat(fields[1], 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = v
+		case "MemAvailable:":
+			available = v
+		}
+	}
+	if total == 0 {
+		return hostFail("memory", fmt.Errorf("no MemTotal in /proc/meminfo"))
+	}
+	pct := available / total * 100
+	msg := fmt.Sprintf("%.1f%% available", pct)
+
+	// Pressure stall information needs Linux 4.20 or newer.
+	pressure := -1.0
+	out, err = h.run("cat /proc/pressure/memory 2>/dev/null || true")
+	if err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			if !strings.HasPrefix(line, "some ") {
+				continue
+			}
+			for _, f := range strings.Fields(line) {
+				if v, ok := strings.CutPrefix(f, "avg10="); ok {
+					pressure, _ = strconv.ParseFloat(v, 64)
+				}
+			}
+		}
+	}
+	if pressure >= 0 {
+		msg += fmt.Sprintf(", pressure avg10 %.2f%%", pressure)
+	}
+
+	switch {
+	case pct < 5 || pressure >= 10:
+		return []checkResult{newResult("memory", checkFail, msg, "The host is close to running out of memory")}
+	case pct < 15 || pressure >= 1:
+		return []checkResult{newResult("memory", checkWarn, msg, "")}
+	}
+	return []checkResult{newResult("memory", checkPass, msg, "")}
+}
+
+type mountEntry struct {
+	Device string
+	FSType string
+}
+
+// hostMounts returns the mount points of the host. When several filesystems
+// are stacked on one mount point the one mounted last wins.
+func hostMounts(h *hostData) (mounts map[string]mountEntry, err error) {
+	out, err := h.run("cat /proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	return parseMounts(out), nil
+}
+
+// parseMounts reads the mount points of /proc/self/mounts.
+func parseMounts(out string) (mounts map[string]mountEntry) {
+	mounts = make(map[string]mountEntry)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 {
+			// Spaces in paths are escaped as \040.
+			mounts[strings.ReplaceAll(fields[1], `\040`, " ")] = mountEntry{Device: fields[0], FSType: fields[2]}
+		}
+	}
+	return
+}
+
+// mountPointOf returns the longest mount point containing path.
+func mountPointOf(path string, mounts map[string]mountEntry) (mp string) {
+	path = strings.TrimSuffix(path, "/")
+	for m := range mounts {
+		prefix := strings.TrimSuffix(m, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/") || m == "/") && len(m) > len(mp) {
+			mp = m
+		}
+	}
+	return
+}
+
+// checkHostMounts fails when a drive path MinIO uses is not a mount point,
+// MinIO would then write to the root filesystem after a reboot.
+func checkHostMounts(h *hostData) []checkResult {
+	if h.Drives == nil {
+		return []checkResult{newResult("mounts", checkWarn, "drive paths unknown, the cluster could not be queried", "")}
+	}
+	if len(h.Drives) == 0 {
+		return []checkResult{newResult("mounts", checkWarn, "MinIO reports no drives for this host", "")}
+	}
+	mounts, err := hostMounts(h)
+	if err != nil {
+		return hostFail("mounts", err)
+	}
+	var missing []string
+	for _, d := range h.Drives {
+		if mp := mountPointOf(d, mounts); mp == "" || mp == "/" {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) > 0 {
+		return []checkResult{newResult("mounts", checkFail, "not mounted: "+strings.Join(missing, ", "),
+			"Mount the drives before restarting MinIO")}
+	}
+	return []checkResult{newResult("mounts", checkPass, fmt.Sprintf("all %d data drives are mounted", len(h.Drives)), "")}
+}
+
+// hostCheckTargets returns the hosts to check and the drive paths MinIO
+// reports for each of them. Without -hostfile every server is checked.
+func hostCheckTargets() (hosts []*hostData) {
+	drives := make(map[string][]string)
+	pools, _, err := getInfra()
+	if err != nil {
+		if hostfile == "" {
+			panic(err)
+		}
+		fmt.Fprintln(statusOut(), "Unable to load drive paths:", err)
+		drives = nil
+	} else {
+		for _, p := range pools {
+			for host, s := range p.Servers {
+				for _, set := range s.Sets {
+					for _, d := range set.Disks {
+						drives[host] = append(drives[host], d.Path)
+					}
+				}
+			}
+		}
+	}
+
+	var names []string
+	if hostfile != "" {
+		names, err = readHostfile(hostfile)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		names = stringKeysSorted(drives)
+	}
+
+	for _, name := range names {
+		h := &hostData{Host: name}
+		if drives != nil {
+			h.Drives = drives[name]
+			if h.Drives == nil {
+				h.Drives = []string{}
+			}
+			sort.Strings(h.Drives)
+		}
+		hosts = append(hosts, h)
+	}
+	return
+}
+
+type hostReport struct {
+	Host    string
+	Results []checkResult
+}
+
+// runHostChecks runs checks on every host, -workers hosts at a time.
+func runHostChecks(hosts []*hostData, checks []hostCheck) (reports []hostReport) {
+	reports = make([]hostReport, len(hosts))
+	workers := hostWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+	for i, h := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, h *hostData) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			reports[i].Host = h.Host
+			// Connect once up front so an unreachable host reports one
+			// failure instead of one per check.
+			_, err := sshClient(h.Host)
+			if err != nil {
+				reports[i].Results = hostFail("ssh", err)
+				return
+			}
+			for _, c := range checks {
+				reports[i].Results = append(reports[i].Results, c.Run(h)...)
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	return
+}
+
+// printHostReports prints reports grouped by host and sets the exit code
+// when any check failed.
+func printHostReports(reports []hostReport) {
+	for _, r := range reports {
+		for _, res := range r.Results {
+			if res.Status == checkFail {
+				exitCode = 1
+			}
+		}
+	}
+
+	if jsonOutput {
+		jsonOut(reports)
+		return
+	}
+	for _, r := range reports {
+		fmt.Println(r.Host)
+		for _, res := range r.Results {
+			fmt.Printf("  %-5s %-10s %s\n", strings.ToUpper(res.Status), res.Check, res.Message)
+			if res.Hint != "" && res.Status != checkPass {
+				fmt.Printf("  %-5s %-10s -> %s\n", "", "", res.Hint)
+			}
+		}
+	}
+}
+
+func hostCheckCmd() {
+	printHostReports(runHostChecks(hostCheckTargets(), hostChecks))
+}
+
+// unstableDevice reports whether dev is a kernel device name that can change
+// between boots, like /dev/sdb or /dev/nvme1n1.
+func unstableDevice(dev string) bool {
+	for _, p := range []string{"/dev/sd", "/dev/hd", "/dev/vd", "/dev/xvd", "/dev/nvme"} {
+		if strings.HasPrefix(dev, p) {
+			return true
+		}
+	}
+	return false
+}
+
+type fstabEntry struct {
+	Device  string
+	FSType  string
+	Options string
+}
+
+// hostFstab returns the /etc/fstab entries of the host keyed by mount point
+// without a trailing slash.
+func hostFstab(h *hostData) (fstab map[string]fstabEntry, err error) {
+	out, err := h.run("cat /etc/fstab")
+	if err != nil {
+		return nil, err
+	}
+	fstab = make(map[string]fstabEntry)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		e := fstabEntry{Device: fields[0]}
+		if len(fields) > 2 {
+			e.FSType = fields[2]
+		}
+		if len(fields) > 3 {
+			e.Options = fields[3]
+		}
+		fstab[strings.ReplaceAll(strings.TrimSuffix(fields[1], "/"), `\040`, " ")] = e
+	}
+	return
+}
+
+// checkHostFstab verifies that every mount holding a MinIO drive has an
+// /etc/fstab entry that mounts it at boot using a stable device name.
+func checkHostFstab(h *hostData) []checkResult {
+	if len(h.Drives) == 0 {
+		return []checkResult{newResult("fstab", checkWarn, "no drive paths to compare", "")}
+	}
+	mounts, err := hostMounts(h)
+	if err != nil {
+		return hostFail("fstab", err)
+	}
+	fstab, err := hostFstab(h)
+	if err != nil {
+		return hostFail("fstab", err)
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, d := range h.Drives {
+		mp := mountPointOf(d, mounts)
+		if mp == "" || mp == "/" {
+			// Reported by the mounts check.
+			continue
+		}
+		if seen[mp] {
+			continue
+		}
+		seen[mp] = true
+
+		e, ok := fstab[strings.TrimSuffix(mp, "/")]
+		switch {
+		case !ok:
+			problems = append(problems, mp+" has no fstab entry")
+		case unstableDevice(e.Device):
+			problems = append(problems, fmt.Sprintf("%s uses unstable device name %s", mp, e.Device))
+		}
+		if ok {
+			for _, opt := range strings.Split(e.Options, ",") {
+				if opt == "noauto" {
+					problems = append(problems, mp+" is marked noauto")
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return []checkResult{newResult("fstab", checkFail, strings.Join(problems, "; "),
+			"Add fstab entries using UUID= or LABEL= so the drives are mounted after a reboot")}
+	}
+	return []checkResult{newResult("fstab", checkPass, fmt.Sprintf("all %d drive mounts have stable fstab entries", len(seen)), "")}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// hostfileDocument is the -format json output of the hostfile command.
+type hostfileDocument struct {
+	Rounds    []hostfileRound
+	Unhealthy []hostfileUnhealthy
+	// Excluded are the hosts left out by -includeHosts, -excludeHosts and
+	// -excludeFile.
+	Excluded []string `json:",omitempty"`
+}
+
+type hostfileRound struct {
+	Round int
+	Hosts []hostfileHost
+}
+
+type hostfileHost struct {
+	Host string
+	Pool int
+	Sets []hostfileSet
+}
+
+type hostfileSet struct {
+	ID       int
+	Parity   int
+	RRParity int
+	BadDisks int
+	Drives   int
+	RRAtRisk bool `json:",omitempty"`
+}
+
+type hostfileUnhealthy struct {
+	Host    string
+	Pool    int
+	Reasons []string
+}
+
+func hostfileSets(s *Server) (sets []hostfileSet) {
+	for _, set := range s.Sets {
+		sets = append(sets, hostfileSet{
+			ID:       set.ID,
+			Parity:   set.SCParity,
+			RRParity: set.RRSCParity,
+			BadDisks: set.BadDisks,
+			Drives:   len(set.Disks),
+			RRAtRisk: set.RRAtRisk,
+		})
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID < sets[j].ID })
+	return
+}
+
+func serverPool(s *Server) int {
+	for _, set := range s.Sets {
+		return set.Pool
+	}
+	return 0
+}
+
+// newHostfileDocument describes the computed rounds and every host that was
+// left out because one of its sets can not lose it.
+func newHostfileDocument(rounds [][]map[string]*Server, unhealthy map[string]*Server) (doc hostfileDocument) {
+	doc.Rounds = []hostfileRound{}
+	doc.Unhealthy = []hostfileUnhealthy{}
+
+	for ri, rv := range rounds {
+		round := hostfileRound{Round: ri}
+		for _, servers := range rv {
+			for _, host := range stringKeysSorted(servers) {
+				s := servers[host]
+				round.Hosts = append(round.Hosts, hostfileHost{
+					Host: s.Endpoint,
+					Pool: serverPool(s),
+					Sets: hostfileSets(s),
+				})
+			}
+		}
+		if len(round.Hosts) > 0 {
+			doc.Rounds = append(doc.Rounds, round)
+		}
+	}
+
+	for _, host := range stringKeysSorted(unhealthy) {
+		s := unhealthy[host]
+		u := hostfileUnhealthy{Host: s.Endpoint, Pool: serverPool(s)}
+		if s.Offline {
+			u.Reasons = append(u.Reasons, "server is offline according to ServerInfo")
+		}
+		for _, set := range hostfileSets(s) {
+			if s.Sets[set.ID].CanReboot {
+				continue
+			}
+			u.Reasons = append(u.Reasons, fmt.Sprintf("pool %d set %d has %d bad drives with parity %d and safety margin %d",
+				u.Pool, set.ID, set.BadDisks, set.Parity, safetyMargin))
+		}
+		doc.Unhealthy = append(doc.Unhealthy, u)
+	}
+	return
+}
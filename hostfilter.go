@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// hostPatterns is a comma separated list of host patterns given as a flag,
+// repeating the flag adds to the list. A pattern is a glob like node0[1-3]*
+// or, between slashes, a regular expression like /^node1[0-9]\./.
+type hostPatterns struct {
+	list []string
+	res  []*regexp.Regexp
+}
+
+// includeHosts and excludeHosts restrict the hosts placed in rounds by
+// hostfile and the hosts a hostfile reboots, excludeFile holds more
+// patterns to exclude, one per line.
+var (
+	includeHosts hostPatterns
+	excludeHosts hostPatterns
+	excludeFile  string
+)
+
+func (p *hostPatterns) String() string {
+	return strings.Join(p.list, ",")
+}
+
+func (p *hostPatterns) Set(v string) error {
+	for _, pattern := range strings.Split(v, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		err := p.add(pattern)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *hostPatterns) add(pattern string) error {
+	var re *regexp.Regexp
+	if len(pattern) > 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+		var err error
+		re, err = regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return err
+		}
+	} else if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	p.list = append(p.list, pattern)
+	p.res = append(p.res, re)
+	return nil
+}
+
+// match returns the first pattern matching host.
+func (p *hostPatterns) match(host string) (pattern string, ok bool) {
+	for i, pattern := range p.list {
+		if re := p.res[i]; re != nil {
+			if re.MatchString(host) {
+				return pattern, true
+			}
+			continue
+		}
+		if m, _ := path.Match(pattern, host); m {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func hostFilterFlags(fs *flag.FlagSet) {
+	fs.Var(&includeHosts, "includeHosts", "Only touch hosts matching these comma separated globs or /regexes/")
+	fs.Var(&excludeHosts, "excludeHosts", "Never touch hosts matching these comma separated globs or /regexes/, e.g. hosts under hardware maintenance")
+	fs.StringVar(&excludeFile, "excludeFile", "", "File of host globs or /regexes/ to exclude, one per line")
+}
+
+// excludeFileLoaded is set once the patterns of -excludeFile are part of
+// excludeHosts.
+var excludeFileLoaded bool
+
+func loadExcludeFile() {
+	if excludeFile == "" || excludeFileLoaded {
+		return
+	}
+	patterns, err := readHostfile(excludeFile)
+	if err != nil {
+		panic(err)
+	}
+	for _, pattern := range patterns {
+		// Allow a note on why the host is excluded after the pattern.
+		err = excludeHosts.add(strings.Fields(pattern)[0])
+		if err != nil {
+			panic(fmt.Sprintf("%s: %s", excludeFile, err))
+		}
+	}
+	excludeFileLoaded = true
+}
+
+// hostExcluded returns why host is filtered out by -includeHosts,
+// -excludeHosts or -excludeFile, or an empty string.
+func hostExcluded(host string) string {
+	loadExcludeFile()
+	if pattern, ok := excludeHosts.match(host); ok {
+		return "excluded by " + pattern
+	}
+	if len(includeHosts.list) > 0 {
+		if _, ok := includeHosts.match(host); !ok {
+			return "not matched by -includeHosts"
+		}
+	}
+	return ""
+}
+
+// filterHosts drops the filtered out hosts of a hostfile.
+func filterHosts(hosts []string) (kept []string) {
+	for _, h := range hosts {
+		if why := hostExcluded(h); why != "" {
+			fmt.Fprintln(statusOut(), "Skipping", h, why)
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return
+}
+
+// excludeServers removes the filtered out servers from pools before rounds
+// are planned. The drives of their sets still count, a set with a bad drive
+// on an excluded host can lose fewer of the others.
+func excludeServers(pools map[string]*Pool) (excluded map[string]string, removed int) {
+	excluded = make(map[string]string)
+	for _, p := range pools {
+		for host := range p.Servers {
+			if why := hostExcluded(host); why != "" {
+				excluded[host] = why
+				delete(p.Servers, host)
+				removed++
+			}
+		}
+	}
+	return
+}
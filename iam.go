@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// stringOrList is a policy element that is either a string or a list of
+// strings, like Action and Resource.
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*s = stringOrList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+func (s stringOrList) has(values ...string) bool {
+	for _, v := range s {
+		for _, w := range values {
+			if strings.EqualFold(v, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyStatement is one statement of an IAM policy document.
+type policyStatement struct {
+	Sid         string                     `json:",omitempty"`
+	Effect      string                     `json:",omitempty"`
+	Action      stringOrList               `json:",omitempty"`
+	NotAction   stringOrList               `json:",omitempty"`
+	Resource    stringOrList               `json:",omitempty"`
+	NotResource stringOrList               `json:",omitempty"`
+	Condition   map[string]json.RawMessage `json:",omitempty"`
+}
+
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+func parsePolicy(b []byte) (p policyDocument, err error) {
+	err = json.Unmarshal(b, &p)
+	return
+}
+
+func (s policyStatement) allows() bool {
+	return strings.EqualFold(s.Effect, "Allow")
+}
+
+// allResources is true when the statement applies to every bucket.
+func (s policyStatement) allResources() bool {
+	return len(s.NotResource) > 0 || s.Resource.has("*", "arn:aws:s3:::*", "arn:aws:s3:::*/*")
+}
+
+// grantsAdmin is true when the policy allows every admin action, which is
+// as good as having the root credentials. NotAction without admin actions
+// in it allows them as well.
+func (p policyDocument) grantsAdmin() bool {
+	for _, s := range p.Statement {
+		if !s.allows() {
+			continue
+		}
+		if s.Action.has("*", "admin:*") || (len(s.NotAction) > 0 && !s.NotAction.has("*", "admin:*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsAllBuckets is true when the policy allows every S3 action on every
+// bucket.
+func (p policyDocument) grantsAllBuckets() bool {
+	for _, s := range p.Statement {
+		if s.allows() && s.allResources() && (s.Action.has("*", "s3:*") || (len(s.NotAction) > 0 && !s.NotAction.has("*", "s3:*"))) {
+			return true
+		}
+	}
+	return false
+}
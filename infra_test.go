@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// benchStorageInfo is a cluster of 3 pools with 25 servers of 20 drives
+// each, 1500 drives in sets of 16.
+func benchStorageInfo() (info madmin.StorageInfo) {
+	const pools, servers, drives, setSize = 3, 25, 20, 16
+	info.Backend.StandardSCParity = 4
+	info.Backend.RRSCParity = 2
+	for p := 0; p < pools; p++ {
+		for s := 0; s < servers; s++ {
+			for d := 0; d < drives; d++ {
+				i := d*servers + s
+				state := madmin.DriveStateOk
+				if i%97 == 0 {
+					state = madmin.DriveStateOffline
+				}
+				info.Disks = append(info.Disks, madmin.Disk{
+					Endpoint:   fmt.Sprintf("https://pool%d-node%02d.example.net:9000/mnt/drive%d", p+1, s+1, d+1),
+					DrivePath:  fmt.Sprintf("/mnt/drive%d", d+1),
+					State:      state,
+					UUID:       fmt.Sprintf("%08d-0000-0000-0000-000000000000", p*servers*drives+i),
+					PoolIndex:  p,
+					SetIndex:   i / setSize,
+					DiskIndex:  i % setSize,
+					TotalSpace: 16 << 40,
+					UsedSpace:  8 << 40,
+				})
+			}
+		}
+	}
+	return
+}
+
+// buildInfraBefore is how getInfra built the pools before buildInfra, kept
+// to compare both against.
+func buildInfraBefore(info *madmin.StorageInfo, offline map[string]madmin.ServerProperties) (pools map[string]*Pool, totalServers int) {
+	setInfo := make(map[string]map[string]*Set)
+
+	pools = make(map[string]*Pool, 0)
+	for _, d := range info.Disks {
+		PI := strconv.Itoa(d.PoolIndex + 1)
+		SI := d.SetIndex + 1
+		if setInfo[PI] == nil {
+			setInfo[PI] = make(map[string]*Set, 0)
+		}
+
+		pool, ok := pools[PI]
+		if !ok {
+			pools[PI] = &Pool{
+				Servers: make(map[string]*Server, 0),
+			}
+			pool = pools[PI]
+		}
+
+		x, errx := url.Parse(d.Endpoint)
+		if errx != nil || x == nil {
+			panic(errx)
+		}
+
+		server, ok := pool.Servers[x.Hostname()]
+		if !ok {
+			pool.Servers[x.Hostname()] = &Server{
+				Sets:     make(map[int]*Set, 0),
+				Rebooted: false,
+				Endpoint: x.Hostname(),
+			}
+			server = pool.Servers[x.Hostname()]
+			totalServers++
+		}
+
+		set, ok := server.Sets[SI]
+		if !ok {
+			server.Sets[SI] = &Set{
+				Disks:      make(map[string]*Disk, 0),
+				SCParity:   poolParity(info.Backend.StandardSCParities, info.Backend.StandardSCParity, d.PoolIndex),
+				RRSCParity: poolParity(info.Backend.RRSCParities, info.Backend.RRSCParity, d.PoolIndex),
+				ID:         SI,
+				Pool:       d.PoolIndex + 1,
+				CanReboot:  false,
+			}
+			set = server.Sets[SI]
+		}
+
+		seti, ok := setInfo[PI][strconv.Itoa(SI)]
+		if !ok {
+			setInfo[PI][strconv.Itoa(SI)] = &Set{
+				SCParity:   poolParity(info.Backend.StandardSCParities, info.Backend.StandardSCParity, d.PoolIndex),
+				RRSCParity: poolParity(info.Backend.RRSCParities, info.Backend.RRSCParity, d.PoolIndex),
+				ID:         SI,
+				Pool:       d.PoolIndex + 1,
+				BadDisks:   0,
+				CanReboot:  true,
+			}
+			seti = setInfo[PI][strconv.Itoa(SI)]
+		}
+
+		if rebootBadStates.bad(d.State, d.Healing) {
+			seti.BadDisks++
+		}
+
+		if d.DrivePath == "" {
+			d.DrivePath = x.Path
+		}
+
+		set.Disks[d.Endpoint] = &Disk{
+			UUID:       d.UUID,
+			Index:      d.DiskIndex,
+			Pool:       d.PoolIndex + 1,
+			Server:     d.Endpoint,
+			Set:        SI,
+			Path:       d.DrivePath,
+			State:      d.State,
+			TotalSpace: d.TotalSpace,
+			UsedSpace:  d.UsedSpace,
+			FreeInodes: d.FreeInodes,
+			Healing:    d.Healing,
+			Scanning:   d.Scanning,
+			RootDisk:   d.RootDisk,
+		}
+		if d.HealInfo != nil {
+			set.Disks[d.Endpoint].LastHealUpdate = d.HealInfo.LastUpdate
+		}
+	}
+
+	totalServers += markOffline(pools, offline)
+
+	for i, v := range pools {
+		for _, vv := range v.Servers {
+			for iii, vvv := range vv.Sets {
+				seti, ok := setInfo[i][strconv.Itoa(iii)]
+				if ok {
+					vvv.BadDisks = seti.BadDisks
+					vvv.CanReboot = canReboot(vvv)
+					vvv.RRAtRisk = rrAtRisk(vvv)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func TestBuildInfra(t *testing.T) {
+	info := benchStorageInfo()
+	// Drives without a path take it from their endpoint.
+	for i := 0; i < len(info.Disks); i += 7 {
+		info.Disks[i].DrivePath = ""
+	}
+	pools, total := buildInfra(&info, nil)
+	wantPools, wantTotal := buildInfraBefore(&info, nil)
+	if total != wantTotal {
+		t.Errorf("%d servers, want %d", total, wantTotal)
+	}
+	if !reflect.DeepEqual(pools, wantPools) {
+		t.Error("pools differ from the pools built before")
+	}
+}
+
+func BenchmarkBuildInfra(b *testing.B) {
+	info := benchStorageInfo()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buildInfra(&info, nil)
+	}
+}
+
+func BenchmarkBuildInfraBefore(b *testing.B) {
+	info := benchStorageInfo()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buildInfraBefore(&info, nil)
+	}
+}
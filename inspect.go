@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// inspectPattern turns bucket/object into the volume and file pattern the
+// server matches on every drive. An object is its xl.meta and the parts of
+// its data directories, paths with a wildcard or ending in xl.meta are sent
+// as they are.
+func inspectPattern(arg string) (volume, file string) {
+	volume, file, _ = strings.Cut(strings.Trim(arg, "/"), "/")
+	if volume == "" || file == "" {
+		panic("expected a bucket/object path")
+	}
+	switch {
+	case strings.Contains(file, "*") || strings.HasSuffix(file, "/xl.meta"):
+	case inspectMetaOnly:
+		file += "/xl.meta"
+	default:
+		file += "/**"
+	}
+	return
+}
+
+// inspectKey formats a key the way mc does, the crc32 of the key followed by
+// the key, so the inspect decryptor of MinIO reads it.
+func inspectKey(key []byte) (id, hexKey string) {
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(key))
+	id = hex.EncodeToString(crc[:])
+	return id, id + hex.EncodeToString(key)
+}
+
+// inspect downloads the raw files of an object from every drive. Without a
+// public key the server encrypts the zip with a key of its own and returns
+// it first, the key is printed and never written next to the data.
+func inspect() {
+	if len(cmdArgs) != 1 {
+		panic("expected one bucket/object path")
+	}
+	volume, file := inspectPattern(cmdArgs[0])
+	if _, err := os.Stat(inspectOut); inspectOut != "" && err == nil {
+		panic(inspectOut + " exists")
+	}
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	key, r, err := mclient.Inspect(context.Background(), madmin.InspectOptions{Volume: volume, File: file})
+	if err != nil {
+		panic(fmt.Sprintf("inspecting %s/%s: %v", volume, file, err))
+	}
+	defer r.Close()
+	if len(key) == 0 {
+		panic("the server did not return a decryption key")
+	}
+	id, hexKey := inspectKey(key)
+
+	out := inspectOut
+	if out == "" {
+		out = "inspect-data." + id + ".enc"
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		panic(err)
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+		panic(fmt.Sprintf("downloading the inspect data: %v", err))
+	}
+
+	fmt.Fprintf(statusOut(), "Wrote %d encrypted bytes of %s/%s to %s\n", n, volume, file, out)
+	fmt.Fprintln(statusOut(), "The key below is only shown once, send it to support separately from the file.")
+	fmt.Fprintf(statusOut(), "Decrypt with 'inspect -key=<key> %s', installed by 'go install github.com/minio/minio/docs/debugging/inspect@latest'\n", out)
+	fmt.Println(hexKey)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// exitInterrupted is the exit code of a command stopped by SIGINT or
+// SIGTERM, so scripts can tell an interrupted rollout from a failed one.
+const exitInterrupted = 130
+
+// interrupted is set by the first SIGINT or SIGTERM. Reboots and heals
+// finish the host or set in flight and stop before the next one, interrupt
+// is closed at the same time to cut waits short.
+var (
+	interrupted atomic.Bool
+	interrupt   = make(chan struct{})
+)
+
+var checkpointFile string
+
+func checkpointFlags(fs *flag.FlagSet) {
+	fs.StringVar(&checkpointFile, "checkpoint", "./cluster-tool-checkpoint.json", "File the completed and remaining hosts and the running heal sequences are written to when interrupted, empty disables it")
+}
+
+// checkpoint records where an interrupted command stopped.
+type checkpoint struct {
+	Command     string
+	Args        []string
+	Job         string `json:",omitempty"`
+	Started     time.Time
+	Interrupted time.Time
+	// Completed and Remaining are hosts, or sets for heal.
+	Completed []string
+	Remaining []string
+	// Abandoned is the host that was rebooting when a second interrupt
+	// stopped the command without waiting for it.
+	Abandoned  string `json:",omitempty"`
+	HealTokens []*healToken
+	Resume     string
+}
+
+// progress tracks the hosts or sets of the running command for the
+// checkpoint.
+var progress struct {
+	mu        sync.Mutex
+	started   time.Time
+	completed []string
+	remaining []string
+	inFlight  string
+}
+
+// handleInterrupts makes the first SIGINT or SIGTERM stop the command after
+// the host in flight, a second one abandons that host: the checkpoint is
+// written, lock released and the process exits at once.
+func handleInterrupts(j *job, l *opLock) {
+	progress.mu.Lock()
+	progress.started = time.Now().UTC()
+	progress.mu.Unlock()
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		interrupted.Store(true)
+		close(interrupt)
+		fmt.Println()
+		fmt.Println("Received", s.String()+", stopping after the host in flight. Interrupt again to abandon it")
+		s = <-sig
+		fmt.Println()
+		fmt.Println("Received", s.String()+" again, abandoning the host in flight")
+		stopInterrupted(j, true)
+		l.release()
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// planProgress adds hosts or sets to the ones the command still has to do.
+func planProgress(items []string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.remaining = append(progress.remaining, items...)
+}
+
+func progressStarted(item string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.inFlight = item
+}
+
+func progressDone(item string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	if progress.inFlight == item {
+		progress.inFlight = ""
+	}
+	progress.completed = append(progress.completed, item)
+	for i, h := range progress.remaining {
+		if h == item {
+			progress.remaining = append(progress.remaining[:i], progress.remaining[i+1:]...)
+			break
+		}
+	}
+}
+
+// resumeCommand returns the command line that continues where the
+// interrupted command stopped. Jobs are resumed, reboots skip the hosts that
+// rebooted since the command started. Credential flags are left out, see
+// credentialsHint.
+func resumeCommand(j *job, started time.Time, rebooted bool) string {
+	// The flags start after the words of the command name.
+	n := len(strings.Fields(jsonCommand))
+	var flags []string
+	skip := false
+	for _, a := range os.Args[1+n:] {
+		if skip {
+			skip = false
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "-") && (name == "resume" || name == "since" || credentialFlags[name]) {
+			skip = !hasValue
+			continue
+		}
+		flags = append(flags, argQuote(a))
+	}
+	resume := append([]string{"cluster-tool"}, os.Args[1:1+n]...)
+	switch {
+	case j != nil:
+		resume = append(resume, "-resume", j.ID)
+	case rebooted:
+		resume = append(resume, "-since", started.Format(time.RFC3339))
+	}
+	return strings.Join(append(resume, flags...), " ")
+}
+
+// credentialEnv are the environment variables that can replace a credential
+// flag.
+var credentialEnv = map[string]string{
+	"key":       "CLUSTER_TOOL_KEY",
+	"secret":    "CLUSTER_TOOL_SECRET",
+	"newSecret": "CLUSTER_TOOL_NEW_SECRET",
+}
+
+// credentialsHint tells how to pass the credentials resumeCommand left out,
+// it is empty when none were given on the command line.
+func credentialsHint() string {
+	var given []string
+	for _, name := range stringKeysSorted(credentialFlags) {
+		if !flagsGiven[name] {
+			continue
+		}
+		if env, ok := credentialEnv[name]; ok {
+			given = append(given, "-"+name+" (or $"+env+")")
+		} else {
+			given = append(given, "-"+name)
+		}
+	}
+	if len(given) == 0 {
+		return ""
+	}
+	return "Pass " + strings.Join(given, ", ") + " again, they are not repeated here"
+}
+
+// argQuote quotes a for the shell when it needs it.
+func argQuote(a string) string {
+	if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=./:,@") == "" {
+		return a
+	}
+	return shellQuote(a)
+}
+
+// stopInterrupted writes the checkpoint, records the job as interrupted and
+// prints how to resume.
+func stopInterrupted(j *job, abandoned bool) {
+	progress.mu.Lock()
+	cp := checkpoint{
+		Command:     jsonCommand,
+		Args:        redactArgs(os.Args[1:]),
+		Started:     progress.started,
+		Interrupted: time.Now().UTC(),
+		Completed:   append([]string{}, progress.completed...),
+		Remaining:   append([]string{}, progress.remaining...),
+		HealTokens:  []*healToken{},
+	}
+	if abandoned {
+		cp.Abandoned = progress.inFlight
+	}
+	progress.mu.Unlock()
+
+	healMapLock.Lock()
+	for _, key := range stringKeysSorted(healTokens) {
+		cp.HealTokens = append(cp.HealTokens, healTokens[key])
+	}
+	healMapLock.Unlock()
+
+	if j != nil {
+		cp.Job = j.ID
+	}
+	cp.Resume = resumeCommand(j, cp.Started, len(cp.Completed) > 0 && jsonCommand != "heal")
+
+	if checkpointFile != "" {
+		b, err := json.MarshalIndent(cp, "", "  ")
+		if err == nil {
+			err = os.WriteFile(checkpointFile, b, 0o600)
+		}
+		if err != nil {
+			fmt.Println("Unable to write the checkpoint:", err)
+		} else {
+			fmt.Println("Checkpoint written to", checkpointFile)
+		}
+	}
+	if j != nil {
+		j.mu.Lock()
+		j.Checkpoint = &cp
+		j.mu.Unlock()
+		j.finish(jobInterrupted, errors.New("interrupted"))
+	}
+
+	fmt.Printf("Interrupted with %d done and %d remaining", len(cp.Completed), len(cp.Remaining))
+	if cp.Abandoned != "" {
+		fmt.Printf(", %s was abandoned while rebooting", cp.Abandoned)
+	}
+	fmt.Println()
+	if len(cp.HealTokens) > 0 {
+		fmt.Println(len(cp.HealTokens), "heal sequences keep running on the cluster, 'heal -abort' stops them")
+	}
+	fmt.Println("Resume with:", cp.Resume)
+	if hint := credentialsHint(); hint != "" {
+		fmt.Println(hint)
+	}
+	exitCode = exitInterrupted
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Job states. A job whose process died while it was running is reported as
+// interrupted and can be resumed.
+const (
+	jobRunning     = "running"
+	jobDone        = "done"
+	jobFailed      = "failed"
+	jobCanceled    = "canceled"
+	jobInterrupted = "interrupted"
+)
+
+// jobStep is one unit of progress of a job, a rollout round or a healed set.
+type jobStep struct {
+	Name     string
+	State    string
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+	Error    string     `json:",omitempty"`
+}
+
+// job is a long operation recorded in -jobsDir, so it can be inspected,
+// canceled and resumed from another process.
+type job struct {
+	ID              string
+	Type            string
+	Args            []string
+	State           string
+	Host            string
+	PID             int
+	DryRun          bool
+	Created         time.Time
+	Updated         time.Time
+	CancelRequested bool   `json:"-"`
+	Error           string `json:",omitempty"`
+	Steps           []*jobStep
+	// Checkpoint is where the job stopped when it was interrupted.
+	Checkpoint *checkpoint `json:",omitempty"`
+
+	mu sync.Mutex
+}
+
+func jobPath(id string) string {
+	return filepath.Join(jobsDir, id+".json")
+}
+
+// cancelPath is the marker 'jobs cancel' leaves for a running job. It holds
+// the pid of the process it cancels, the job file itself is only ever
+// written by the process running the job.
+func cancelPath(id string) string {
+	return filepath.Join(jobsDir, id+".cancel")
+}
+
+// cancelMarked reports whether the process pid of job id was asked to stop.
+func cancelMarked(id string, pid int) bool {
+	b, err := os.ReadFile(cancelPath(id))
+	return err == nil && strings.TrimSpace(string(b)) == strconv.Itoa(pid)
+}
+
+// newJob records a new job of typ for the current invocation. Without
+// -jobsDir nothing is recorded and nil is returned, every job method accepts
+// a nil receiver.
+func newJob(typ string) *job {
+	if jobsDir == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	j := &job{
+		ID:      typ + "-" + now.Format("20060102-150405") + "-" + randomHex(3),
+		Type:    typ,
+		Args:    redactArgs(os.Args[1:]),
+		State:   jobRunning,
+		Host:    host,
+		PID:     os.Getpid(),
+		DryRun:  dryRun,
+		Created: now,
+	}
+	j.save()
+	fmt.Println("Job:", j.ID)
+	return j
+}
+
+// startJob records a new job, or takes over the one given to -resume.
+func startJob(typ string) *job {
+	if resumeJobID != "" {
+		return resumeJob(resumeJobID, typ)
+	}
+	return newJob(typ)
+}
+
+func loadJob(id string) (j *job, err error) {
+	b, err := os.ReadFile(jobPath(id))
+	if err != nil {
+		return nil, err
+	}
+	j = new(job)
+	err = json.Unmarshal(b, j)
+	if err == nil {
+		j.CancelRequested = cancelMarked(id, j.PID)
+	}
+	return
+}
+
+// resumeJob takes over an interrupted or failed job, steps that are done are
+// skipped by the caller through stepDone.
+func resumeJob(id string, typ string) *job {
+	j, err := loadJob(id)
+	if err != nil {
+		panic(err)
+	}
+	if j.Type != typ {
+		panic(fmt.Sprintf("job %s is a %s job, not %s", id, j.Type, typ))
+	}
+	if j.alive() {
+		panic(fmt.Sprintf("job %s is still running as pid %d on %s", id, j.PID, j.Host))
+	}
+	if j.State == jobDone {
+		panic("job " + id + " is already done")
+	}
+	if j.DryRun != dryRun {
+		panic(fmt.Sprintf("job %s was started with -dryRun=%v", id, j.DryRun))
+	}
+	j.PID = os.Getpid()
+	j.Host, _ = os.Hostname()
+	j.State = jobRunning
+	j.CancelRequested = false
+	j.Error = ""
+	_ = os.Remove(cancelPath(j.ID))
+	j.save()
+	fmt.Println("Resuming job:", j.ID)
+	return j
+}
+
+// save writes the job to disk, through a rename so readers never see a half
+// written file.
+func (j *job) save() {
+	if j == nil {
+		return
+	}
+	j.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(jobsDir, 0o700)
+	}
+	if err == nil {
+		// The job holds the command line, it is only readable by its owner.
+		tmp := jobPath(j.ID) + ".tmp"
+		err = os.WriteFile(tmp, b, 0o600)
+		if err == nil {
+			err = os.Chmod(tmp, 0o600)
+		}
+		if err == nil {
+			err = os.Rename(tmp, jobPath(j.ID))
+		}
+	}
+	if err != nil {
+		fmt.Println("Unable to save job", j.ID+":", err)
+	}
+}
+
+// alive reports whether the process running the job still exists. Jobs of
+// other hosts are assumed to be alive.
+func (j *job) alive() bool {
+	if j.State != jobRunning {
+		return false
+	}
+	host, _ := os.Hostname()
+	if j.Host != host {
+		return true
+	}
+	err := syscall.Kill(j.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// displayState reports running jobs whose process is gone as interrupted.
+func (j *job) displayState() string {
+	if j.State == jobRunning && !j.alive() {
+		return jobInterrupted
+	}
+	return j.State
+}
+
+// stepDone reports whether a resumed job already finished the step.
+func (j *job) stepDone(name string) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.Steps {
+		if s.Name == name && s.State == jobDone {
+			return true
+		}
+	}
+	return false
+}
+
+// startStep records that the step started, replacing an earlier attempt.
+func (j *job) startStep(name string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	step := &jobStep{Name: name, State: jobRunning, Started: time.Now().UTC()}
+	for i, s := range j.Steps {
+		if s.Name == name {
+			j.Steps[i] = step
+			j.save()
+			return
+		}
+	}
+	j.Steps = append(j.Steps, step)
+	j.save()
+}
+
+func (j *job) finishStep(name string, err error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.Steps {
+		if s.Name != name {
+			continue
+		}
+		now := time.Now().UTC()
+		s.Finished = &now
+		s.State = jobDone
+		if err != nil {
+			s.State = jobFailed
+			s.Error = err.Error()
+			if s.Error == "" {
+				s.Error = "unknown error"
+			}
+		}
+	}
+	j.save()
+}
+
+// canceled reports whether 'jobs cancel' was run. Jobs are only canceled
+// between steps, a round that started is finished.
+func (j *job) canceled() bool {
+	if j == nil {
+		return false
+	}
+	return cancelMarked(j.ID, j.PID)
+}
+
+// finish records the outcome of the job.
+func (j *job) finish(state string, err error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.State = state
+	if err != nil {
+		j.Error = err.Error()
+	}
+	j.save()
+	_ = os.Remove(cancelPath(j.ID))
+	fmt.Println("Job", j.ID, state)
+}
+
+// finishFromPanic is deferred by job commands so a panic still leaves a
+// failed job behind.
+func (j *job) finishFromPanic() {
+	if j == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		j.finish(jobFailed, fmt.Errorf("%v", r))
+		panic(r)
+	}
+}
+
+func listJobs() (jobs []*job, err error) {
+	matches, err := filepath.Glob(filepath.Join(jobsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		j, err := loadJob(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read", m+":", err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Created.Before(jobs[b].Created) })
+	return
+}
+
+// failedSteps returns the number of steps that failed.
+func (j *job) failedSteps() (n int) {
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.Steps {
+		if s.State == jobFailed {
+			n++
+		}
+	}
+	return
+}
+
+func jobProgress(j *job) string {
+	done := 0
+	for _, s := range j.Steps {
+		if s.State == jobDone {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d/%d steps done", done, len(j.Steps))
+}
+
+func jobsList() {
+	jobs, err := listJobs()
+	if err != nil {
+		panic(err)
+	}
+	if jsonOutput {
+		jsonOut(jobs)
+		return
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs in", jobsDir)
+		return
+	}
+	fmt.Printf("%-32s %-8s %-12s %-20s %s\n", "ID", "TYPE", "STATE", "UPDATED", "PROGRESS")
+	for _, j := range jobs {
+		fmt.Printf("%-32s %-8s %-12s %-20s %s\n", j.ID, j.Type, j.displayState(), j.Updated.Format("2006-01-02 15:04:05"), jobProgress(j))
+	}
+}
+
+func jobArg() string {
+	if len(cmdArgs) != 1 {
+		panic("expected a job ID, see 'jobs list'")
+	}
+	return cmdArgs[0]
+}
+
+func jobsStatus() {
+	j, err := loadJob(jobArg())
+	if err != nil {
+		panic(err)
+	}
+	if jsonOutput {
+		jsonOut(j)
+		return
+	}
+	fmt.Printf("%-10s %s\n", "ID", j.ID)
+	fmt.Printf("%-10s %s\n", "Type", j.Type)
+	fmt.Printf("%-10s %s\n", "State", j.displayState())
+	fmt.Printf("%-10s cluster-tool %s\n", "Command", strings.Join(j.Args, " "))
+	fmt.Printf("%-10s %s pid %d\n", "Process", j.Host, j.PID)
+	fmt.Printf("%-10s %s\n", "Created", j.Created.Format(time.RFC3339))
+	fmt.Printf("%-10s %s\n", "Updated", j.Updated.Format(time.RFC3339))
+	if j.CancelRequested && j.State == jobRunning {
+		fmt.Printf("%-10s %s\n", "Cancel", "requested, stops after the current step")
+	}
+	if j.Error != "" {
+		fmt.Printf("%-10s %s\n", "Error", j.Error)
+	}
+	fmt.Println()
+	for _, s := range j.Steps {
+		took := "-"
+		if s.Finished != nil {
+			took = s.Finished.Sub(s.Started).Round(time.Second).String()
+		}
+		line := fmt.Sprintf("  %-20s %-8s %-20s %-8s %s", s.Name, s.State, s.Started.Format("2006-01-02 15:04:05"), took, s.Error)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	if j.displayState() == jobInterrupted || j.State == jobFailed {
+		fmt.Println()
+		fmt.Println("Resume with: cluster-tool", j.Type, "-resume", j.ID, "[the original flags]")
+	}
+}
+
+func jobsCancel() {
+	j, err := loadJob(jobArg())
+	if err != nil {
+		panic(err)
+	}
+	if j.State != jobRunning {
+		fmt.Println("Job", j.ID, "is", j.State)
+		return
+	}
+	if !j.alive() {
+		j.State = jobCanceled
+		j.save()
+		fmt.Println("Job", j.ID, "was interrupted, marked as canceled")
+		return
+	}
+	err = os.WriteFile(cancelPath(j.ID), []byte(strconv.Itoa(j.PID)), 0o600)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Cancel requested, job", j.ID, "stops after its current step")
+}
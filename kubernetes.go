@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// kubeHook cordons and drains the Kubernetes node under a host before it is
+// rebooted and uncordons it afterwards. It shells out to kubectl, so the
+// current context or -kubeContext must point at the cluster running MinIO.
+//
+// When Namespace is set, hosts are MinIO pod DNS names
+// (minio-0.minio-hl.ns.svc...) and the node is looked up from the pod,
+// otherwise the host is the node name.
+type kubeHook struct {
+	Context      string
+	Namespace    string
+	DrainTimeout time.Duration
+
+	nodes map[string]string
+}
+
+func (k *kubeHook) Name() string { return "kubernetes" }
+
+func (k *kubeHook) kubectl(args ...string) (out string, err error) {
+	if k.Context != "" {
+		args = append([]string{"--context", k.Context}, args...)
+	}
+	b, err := exec.Command("kubectl", args...).CombinedOutput()
+	out = strings.TrimSpace(string(b))
+	if err != nil {
+		return out, fmt.Errorf("kubectl %s: %w: %s", strings.Join(args, " "), err, out)
+	}
+	return out, nil
+}
+
+// node returns the node name for host. Lookups are cached because the pod is
+// evicted by the drain and may not be scheduled again until uncordon.
+func (k *kubeHook) node(host string) (node string, err error) {
+	if k.Namespace == "" {
+		return host, nil
+	}
+	if node, ok := k.nodes[host]; ok {
+		return node, nil
+	}
+	pod := strings.SplitN(host, ".", 2)[0]
+	node, err = k.kubectl("get", "pod", pod, "-n", k.Namespace, "-o", "jsonpath={.spec.nodeName}")
+	if err != nil {
+		return "", err
+	}
+	if node == "" {
+		return "", fmt.Errorf("pod %s/%s is not scheduled on a node", k.Namespace, pod)
+	}
+	if k.nodes == nil {
+		k.nodes = make(map[string]string)
+	}
+	k.nodes[host] = node
+	return node, nil
+}
+
+// Drain uses the eviction API through kubectl drain, so PodDisruptionBudgets
+// are honored and the drain fails after DrainTimeout if one blocks it.
+func (k *kubeHook) Drain(host string) (err error) {
+	node, err := k.node(host)
+	if err != nil {
+		return err
+	}
+	_, err = k.kubectl("cordon", node)
+	if err != nil {
+		return err
+	}
+	_, err = k.kubectl("drain", node,
+		"--ignore-daemonsets",
+		"--delete-emptydir-data",
+		"--timeout", k.DrainTimeout.String(),
+	)
+	if err != nil {
+		// Leave the node schedulable, nothing is going to be rebooted.
+		_, _ = k.kubectl("uncordon", node)
+		return err
+	}
+	return nil
+}
+
+func (k *kubeHook) Enable(host string) (err error) {
+	node, err := k.node(host)
+	if err != nil {
+		return err
+	}
+	_, err = k.kubectl("uncordon", node)
+	return
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+type driveLatency struct {
+	Pool        int
+	Set         int
+	Server      string
+	Path        string
+	Avg         time.Duration
+	Max         time.Duration
+	Utilization float64
+	Factor      float64
+	Slow        bool
+}
+
+// lastMinuteLatency returns the average and maximum latency of all drive
+// operations the server recorded over the last minute.
+func lastMinuteLatency(d madmin.Disk) (avg time.Duration, max time.Duration) {
+	if d.Metrics == nil {
+		return
+	}
+	var count, acc uint64
+	for _, v := range d.Metrics.LastMinute {
+		count += v.Count
+		acc += v.AccTime
+		if time.Duration(v.MaxTime) > max {
+			max = time.Duration(v.MaxTime)
+		}
+	}
+	if count > 0 {
+		avg = time.Duration(acc / count)
+	}
+	return
+}
+
+func medianDuration(v []time.Duration) time.Duration {
+	if len(v) == 0 {
+		return 0
+	}
+	s := append([]time.Duration(nil), v...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// driveLatencies collects per-drive latency from ServerInfo and marks drives
+// whose average latency is at least latencyFactor times their set's median.
+// MinIO only reports averages and maximums, not percentiles, so the average
+// over the last minute is used for the comparison.
+func driveLatencies() (drives []*driveLatency, err error) {
+	err = makeClient()
+	if err != nil {
+		return
+	}
+
+	info, err := clusterServerInfo(madmin.WithDriveMetrics(true))
+	if err != nil {
+		return
+	}
+
+	type setKey struct{ pool, set int }
+	bySet := make(map[setKey][]*driveLatency)
+	for _, srv := range info.Servers {
+		for _, d := range srv.Disks {
+			if d.PoolIndex < 0 || d.SetIndex < 0 {
+				continue
+			}
+			dl := &driveLatency{
+				Pool:        d.PoolIndex + 1,
+				Set:         d.SetIndex + 1,
+				Path:        d.DrivePath,
+				Utilization: d.Utilization,
+			}
+			x, errx := url.Parse(d.Endpoint)
+			if errx == nil {
+				dl.Server = x.Hostname()
+				if dl.Path == "" {
+					dl.Path = x.Path
+				}
+			}
+			dl.Avg, dl.Max = lastMinuteLatency(d)
+
+			k := setKey{dl.Pool, dl.Set}
+			bySet[k] = append(bySet[k], dl)
+			drives = append(drives, dl)
+		}
+	}
+
+	for _, set := range bySet {
+		avgs := make([]time.Duration, 0, len(set))
+		for _, dl := range set {
+			if dl.Avg > 0 {
+				avgs = append(avgs, dl.Avg)
+			}
+		}
+		median := medianDuration(avgs)
+		if median == 0 {
+			continue
+		}
+		for _, dl := range set {
+			dl.Factor = float64(dl.Avg) / float64(median)
+			dl.Slow = dl.Factor >= latencyFactor
+		}
+	}
+
+	sort.Slice(drives, func(i, j int) bool {
+		a, b := drives[i], drives[j]
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+		if a.Server != b.Server {
+			return a.Server < b.Server
+		}
+		return a.Path < b.Path
+	})
+	return
+}
+
+func diskLatency() {
+	drives, err := driveLatencies()
+	if err != nil {
+		panic(err)
+	}
+
+	if jsonOutput {
+		jsonOut(drives)
+		return
+	}
+
+	slow := 0
+	fmt.Printf("%-5s %-4s %-25s %-30s %-12s %-12s %-6s %-7s %s\n", "POOL", "SET", "SERVER", "PATH", "AVG", "MAX", "UTIL", "FACTOR", "")
+	for _, d := range drives {
+		if d.Slow {
+			slow++
+		} else if badDisksOnly {
+			continue
+		}
+		mark := ""
+		if d.Slow {
+			mark = "SLOW"
+		}
+		fmt.Printf("%-5d %-4d %-25s %-30s %-12s %-12s %-6.1f %-7.2f %s\n",
+			d.Pool, d.Set, d.Server, d.Path, d.Avg, d.Max, d.Utilization, d.Factor, mark)
+	}
+	fmt.Printf("\nSlow drives (%d) threshold(%.2fx set median)\n", slow, latencyFactor)
+}
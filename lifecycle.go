@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// lifecycleRule summarizes what one ILM rule does.
+type lifecycleRule struct {
+	ID      string
+	Enabled bool
+	Filter  string `json:",omitempty"`
+	Actions []string
+}
+
+// lifecycleBucket is the ILM setup of a bucket. Objects and Versions come
+// from the data scanner, many more versions than objects are what a missing
+// noncurrent expiry looks like.
+type lifecycleBucket struct {
+	Bucket     string
+	Versioning string `json:",omitempty"`
+	Objects    uint64
+	Versions   uint64
+	Rules      []lifecycleRule `json:",omitempty"`
+	Findings   []string        `json:",omitempty"`
+}
+
+func ruleFilter(r lifecycle.Rule) string {
+	f := r.RuleFilter
+	var parts []string
+	for _, p := range []string{r.Prefix, f.Prefix, f.And.Prefix} {
+		if p != "" {
+			parts = append(parts, "prefix "+p)
+		}
+	}
+	tags := append([]lifecycle.Tag{f.Tag}, f.And.Tags...)
+	for _, t := range tags {
+		if t.Key != "" {
+			parts = append(parts, "tag "+t.Key+"="+t.Value)
+		}
+	}
+	for _, n := range []int64{f.ObjectSizeGreaterThan, f.And.ObjectSizeGreaterThan} {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("size > %d", n))
+		}
+	}
+	for _, n := range []int64{f.ObjectSizeLessThan, f.And.ObjectSizeLessThan} {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("size < %d", n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func ruleActions(r lifecycle.Rule) (actions []string) {
+	e := r.Expiration
+	switch {
+	case e.Days > 0:
+		actions = append(actions, fmt.Sprintf("expire after %dd", e.Days))
+	case !e.Date.IsZero():
+		actions = append(actions, "expire on "+e.Date.Format("2006-01-02"))
+	}
+	if e.DeleteMarker {
+		actions = append(actions, "remove expired delete markers")
+	}
+	if e.DeleteAll {
+		actions = append(actions, "expire all versions")
+	}
+	t := r.Transition
+	switch {
+	case t.StorageClass != "" && !t.Date.IsZero():
+		actions = append(actions, fmt.Sprintf("transition to %s on %s", t.StorageClass, t.Date.Format("2006-01-02")))
+	case t.StorageClass != "":
+		actions = append(actions, fmt.Sprintf("transition to %s after %dd", t.StorageClass, t.Days))
+	}
+	if n := r.NoncurrentVersionExpiration; n.NoncurrentDays > 0 || n.NewerNoncurrentVersions > 0 {
+		s := fmt.Sprintf("expire noncurrent after %dd", n.NoncurrentDays)
+		if n.NewerNoncurrentVersions > 0 {
+			s += fmt.Sprintf(" keeping %d", n.NewerNoncurrentVersions)
+		}
+		actions = append(actions, s)
+	}
+	if n := r.NoncurrentVersionTransition; n.StorageClass != "" {
+		actions = append(actions, fmt.Sprintf("transition noncurrent to %s after %dd", n.StorageClass, n.NoncurrentDays))
+	}
+	if d := r.DelMarkerExpiration.Days; d > 0 {
+		actions = append(actions, fmt.Sprintf("expire delete markers after %dd", d))
+	}
+	if d := r.AllVersionsExpiration.Days; d > 0 {
+		actions = append(actions, fmt.Sprintf("expire all versions after %dd", d))
+	}
+	if d := r.AbortIncompleteMultipartUpload.DaysAfterInitiation; d > 0 {
+		actions = append(actions, fmt.Sprintf("abort incomplete uploads after %dd", d))
+	}
+	return
+}
+
+// lifecycleFindings flags versioned buckets whose noncurrent versions are
+// never expired, or only under some prefixes.
+func lifecycleFindings(b lifecycleBucket, rules []lifecycle.Rule) (findings []string) {
+	if b.Versioning != "Enabled" {
+		return nil
+	}
+	whole, partial := false, false
+	for _, r := range rules {
+		n := r.NoncurrentVersionExpiration
+		if r.Status != "Enabled" || (n.NoncurrentDays == 0 && n.NewerNoncurrentVersions == 0 && r.AllVersionsExpiration.Days == 0) {
+			continue
+		}
+		if ruleFilter(r) == "" {
+			whole = true
+		} else {
+			partial = true
+		}
+	}
+	switch {
+	case whole:
+	case partial:
+		findings = append(findings, "versioned, noncurrent versions only expire for some objects")
+	default:
+		findings = append(findings, "versioned without noncurrent version expiry, old versions are kept forever")
+	}
+	return
+}
+
+func auditLifecycle() (buckets []lifecycleBucket, err error) {
+	ctx := context.Background()
+	s3, err := s3Client(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s3.ListBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets: %w", err)
+	}
+	usage := make(map[string][2]uint64)
+	if err := makeClient(); err != nil {
+		fmt.Fprintln(statusOut(), "Unable to read data usage:", err)
+	} else if du, uerr := mclient.DataUsageInfo(ctx); uerr != nil {
+		fmt.Fprintln(statusOut(), "Unable to read data usage:", uerr)
+	} else {
+		for name, u := range du.BucketsUsage {
+			usage[name] = [2]uint64{u.ObjectsCount, u.VersionsCount}
+		}
+	}
+
+	for _, lb := range list {
+		b := lifecycleBucket{Bucket: lb.Name, Objects: usage[lb.Name][0], Versions: usage[lb.Name][1]}
+		v, verr := s3.GetBucketVersioning(ctx, lb.Name)
+		if verr != nil {
+			fmt.Fprintln(statusOut(), "Unable to read the versioning of", lb.Name+":", verr)
+		}
+		b.Versioning = v.Status
+
+		var rules []lifecycle.Rule
+		cfg, lerr := s3.GetBucketLifecycle(ctx, lb.Name)
+		switch {
+		case lerr == nil:
+			rules = cfg.Rules
+		case minio.ToErrorResponse(lerr).Code != "NoSuchLifecycleConfiguration":
+			fmt.Fprintln(statusOut(), "Unable to read the lifecycle of", lb.Name+":", lerr)
+		}
+		for _, r := range rules {
+			b.Rules = append(b.Rules, lifecycleRule{ID: r.ID, Enabled: r.Status == "Enabled", Filter: ruleFilter(r), Actions: ruleActions(r)})
+		}
+		b.Findings = lifecycleFindings(b, rules)
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+func lifecycleAudit() {
+	buckets, err := auditLifecycle()
+	if err != nil {
+		panic(err)
+	}
+	for _, b := range buckets {
+		if len(b.Findings) > 0 {
+			exitCode = 1
+		}
+	}
+	if jsonOutput {
+		jsonOut(buckets)
+		return
+	}
+	if len(buckets) == 0 {
+		fmt.Println("No buckets")
+		return
+	}
+	for _, b := range buckets {
+		versioning := b.Versioning
+		if versioning == "" {
+			versioning = "Unversioned"
+		}
+		fmt.Printf("%s (%s, %d objects, %d versions)\n", b.Bucket, versioning, b.Objects, b.Versions)
+		if len(b.Rules) == 0 {
+			fmt.Println("  no lifecycle rules")
+		}
+		for _, r := range b.Rules {
+			status := "enabled"
+			if !r.Enabled {
+				status = "disabled"
+			}
+			filter := r.Filter
+			if filter == "" {
+				filter = "all objects"
+			}
+			fmt.Printf("  %-20s %-8s %-20s %s\n", r.ID, status, filter, strings.Join(r.Actions, ", "))
+		}
+		for _, f := range b.Findings {
+			fmt.Println("  WARN", f)
+		}
+	}
+}
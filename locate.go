@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// driveLocation is where a drive sits in its chassis, as far as the host
+// can tell, and how its locate LED was switched.
+type driveLocation struct {
+	Host      string
+	Path      string
+	Disk      string `json:",omitempty"`
+	Serial    string `json:",omitempty"`
+	Enclosure string `json:",omitempty"`
+	Slot      string `json:",omitempty"`
+	Tool      string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+// locateDrives returns the drives to locate: the host:path arguments, or
+// every drive that is not ok.
+func locateDrives() (drives []badDrive) {
+	if len(cmdArgs) == 0 {
+		return badDrives()
+	}
+	for _, a := range cmdArgs {
+		host, path, ok := strings.Cut(a, ":")
+		if !ok || host == "" || !strings.HasPrefix(path, "/") {
+			panic("invalid drive " + a + ", expected host:/path")
+		}
+		drives = append(drives, badDrive{Host: host, Path: path})
+	}
+	return
+}
+
+// sas3ircuSlot finds the controller, enclosure and slot of the drive with
+// serial in the output of sas3ircu DISPLAY.
+func sas3ircuSlot(h *hostData, serial string) (ctrl string, enclosure string, slot string, err error) {
+	out, err := h.run("sudo sas3ircu LIST")
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			continue
+		}
+		display, err := h.run("sudo sas3ircu " + fields[0] + " DISPLAY")
+		if err != nil {
+			continue
+		}
+		// Every device is a block of "key : value" lines starting with
+		// the enclosure number.
+		enc, sl := "", ""
+		for _, dl := range strings.Split(display, "\n") {
+			k, v, ok := strings.Cut(dl, ":")
+			if !ok {
+				continue
+			}
+			v = strings.TrimSpace(v)
+			switch strings.TrimSpace(k) {
+			case "Enclosure #":
+				enc, sl = v, ""
+			case "Slot #":
+				sl = v
+			case "Serial No":
+				if serial != "" && strings.EqualFold(v, serial) && enc != "" && sl != "" {
+					return fields[0], enc, sl, nil
+				}
+			}
+		}
+	}
+	return "", "", "", fmt.Errorf("serial %q not found by sas3ircu", serial)
+}
+
+// locateDrive switches the locate LED of the bay holding d with ledctl, or
+// sas3ircu on LSI/Broadcom HBAs without ledmon.
+func locateDrive(h *hostData, d badDrive, on bool) (loc driveLocation) {
+	loc = driveLocation{Host: d.Host, Path: d.Path}
+	p, err := physicalInfo(h, d.Path)
+	if err != nil {
+		loc.Error = err.Error()
+		return
+	}
+	loc.Disk, loc.Serial, loc.Enclosure, loc.Slot = p.Disk, p.Serial, p.Enclosure, p.Slot
+
+	state, sas := "locate_off", "OFF"
+	if on {
+		state, sas = "locate", "ON"
+	}
+	if _, err := h.run("command -v ledctl"); err == nil {
+		if output, err := runSSH(h.Host, "sudo ledctl "+state+"="+shellQuote(loc.Disk)); err != nil {
+			loc.Error = fmt.Sprintf("ledctl: %v: %s", err, strings.TrimSpace(string(output)))
+			return
+		}
+		loc.Tool = "ledctl"
+		return
+	}
+	if _, err := h.run("command -v sas3ircu"); err != nil {
+		loc.Error = "neither ledctl nor sas3ircu is installed"
+		return
+	}
+	ctrl, enc, slot, err := sas3ircuSlot(h, loc.Serial)
+	if err != nil {
+		loc.Error = err.Error()
+		return
+	}
+	if loc.Slot == "" {
+		loc.Enclosure, loc.Slot = enc, slot
+	}
+	if output, err := runSSH(h.Host, "sudo sas3ircu "+ctrl+" LOCATE "+enc+":"+slot+" "+sas); err != nil {
+		loc.Error = fmt.Sprintf("sas3ircu: %v: %s", err, strings.TrimSpace(string(output)))
+		return
+	}
+	loc.Tool = "sas3ircu"
+	return
+}
+
+func driveLocate() {
+	if locateOn == locateOff {
+		panic("drive locate needs either -on or -off")
+	}
+	drives := locateDrives()
+	if len(drives) == 0 {
+		fmt.Println("All drives are ok, pass host:/path to locate a specific drive")
+		return
+	}
+
+	results := make([]driveLocation, 0, len(drives))
+	lock := new(sync.Mutex)
+	forEachHost(drives, func(h *hostData, d badDrive) {
+		loc := locateDrive(h, d, locateOn)
+		lock.Lock()
+		results = append(results, loc)
+		lock.Unlock()
+	})
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Host != results[j].Host {
+			return results[i].Host < results[j].Host
+		}
+		return results[i].Path < results[j].Path
+	})
+	for _, r := range results {
+		if r.Error != "" {
+			exitCode = 1
+		}
+	}
+
+	if jsonOutput {
+		jsonOut(results)
+		return
+	}
+	led := "off"
+	if locateOn {
+		led = "on"
+	}
+	for _, r := range results {
+		fmt.Printf("%s:%s disk(%s) serial(%s)\n", r.Host, r.Path, r.Disk, r.Serial)
+		if r.Slot != "" {
+			fmt.Printf("  enclosure %s slot %s\n", r.Enclosure, r.Slot)
+		} else {
+			fmt.Println("  enclosure slot unknown, match the serial on the drive label")
+		}
+		if r.Error != "" {
+			fmt.Println("  LED not switched:", r.Error)
+			continue
+		}
+		fmt.Printf("  LED %s via %s\n", led, r.Tool)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// lockObject is where the operation lock is kept inside -lockBucket.
+const lockObject = ".cluster-tool/lock.json"
+
+// lockInfo is the content of the lock object, it tells other operators who
+// is running what.
+type lockInfo struct {
+	Holder    string
+	Host      string
+	PID       int
+	Operation string
+	Acquired  time.Time
+	Expires   time.Time
+}
+
+func (l lockInfo) String() string {
+	return fmt.Sprintf("%s on %s (pid %d) running '%s' since %s", l.Holder, l.Host, l.PID, l.Operation, l.Acquired.Local().Format(time.RFC3339))
+}
+
+// activeLock is the lock this process holds, nil while it holds none.
+var activeLock atomic.Pointer[opLock]
+
+// lockLost tells if someone else took over the held lock. Reboots and heals
+// stop before the next host, round or set, the cluster is theirs now.
+func lockLost() bool {
+	l := activeLock.Load()
+	return l != nil && l.lost.Load()
+}
+
+// errLockLost stops a job whose lock was taken over.
+var errLockLost = errors.New("the operation lock was taken over")
+
+// opLock is a held operation lock. The holder keeps renewing it every third
+// of -lockTTL, the lock of a tool that died expires after -lockTTL.
+type opLock struct {
+	client *minio.Client
+	info   lockInfo
+
+	mu   sync.Mutex
+	etag string
+	done chan struct{}
+	// lost is set by renew once someone else took the lock over.
+	lost atomic.Bool
+}
+
+func lockHolder() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return name
+}
+
+func isPreconditionFailed(err error) bool {
+	return minio.ToErrorResponse(err).Code == "PreconditionFailed"
+}
+
+func readLock(client *minio.Client) (info lockInfo, etag string, err error) {
+	obj, err := client.GetObject(context.Background(), lockBucket, lockObject, minio.GetObjectOptions{})
+	if err != nil {
+		return info, "", err
+	}
+	defer obj.Close()
+	st, err := obj.Stat()
+	if err != nil {
+		return info, "", err
+	}
+	b, err := io.ReadAll(obj)
+	if err != nil {
+		return info, "", err
+	}
+	err = json.Unmarshal(b, &info)
+	return info, st.ETag, err
+}
+
+// writeLock writes info only if the lock object is still etag, or does not
+// exist when etag is empty, so two tools can never both take the lock.
+func writeLock(client *minio.Client, info lockInfo, etag string) (newETag string, err error) {
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	if etag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(etag)
+	}
+	up, err := client.PutObject(context.Background(), lockBucket, lockObject, bytes.NewReader(b), int64(len(b)), opts)
+	if err != nil {
+		return "", err
+	}
+	return up.ETag, nil
+}
+
+// tryLock takes the operation lock for operation. A lock held by someone
+// else is only taken over when it expired or -steal is set. Without
+// -lockBucket no lock is taken and nil is returned.
+func tryLock(operation string) (l *opLock, err error) {
+	if lockBucket == "" {
+		return nil, nil
+	}
+	client, err := s3Client(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ttl := lockTTL
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	l = &opLock{
+		client: client,
+		info: lockInfo{
+			Holder:    lockHolder(),
+			Host:      host,
+			PID:       os.Getpid(),
+			Operation: operation,
+			Acquired:  now,
+			Expires:   now.Add(ttl),
+		},
+		done: make(chan struct{}),
+	}
+
+	l.etag, err = writeLock(client, l.info, "")
+	if isPreconditionFailed(err) {
+		held, etag, rerr := readLock(client)
+		if rerr != nil {
+			return nil, fmt.Errorf("lock is held but unreadable: %w", rerr)
+		}
+		switch {
+		case stealLock:
+			fmt.Println("WARNING: stealing the operation lock from", held)
+		case now.After(held.Expires):
+			fmt.Println("Taking over the expired operation lock of", held)
+		default:
+			return nil, fmt.Errorf("cluster is locked by %s, use -steal if they are really gone", held)
+		}
+		l.etag, err = writeLock(client, l.info, etag)
+		if isPreconditionFailed(err) {
+			return nil, fmt.Errorf("someone else took the lock at the same time, try again")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to write lock to bucket %s: %w", lockBucket, err)
+	}
+
+	activeLock.Store(l)
+	go l.renew(ttl)
+	fmt.Println("Acquired operation lock in bucket", lockBucket)
+	return l, nil
+}
+
+// acquireLock is tryLock for commands, refusing to run without the lock.
+func acquireLock(operation string) *opLock {
+	l, err := tryLock(operation)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+func (l *opLock) renew(ttl time.Duration) {
+	t := time.NewTicker(ttl / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-t.C:
+		}
+		l.mu.Lock()
+		l.info.Expires = time.Now().UTC().Add(ttl)
+		etag, err := writeLock(l.client, l.info, l.etag)
+		if err == nil {
+			l.etag = etag
+		}
+		l.mu.Unlock()
+		if isPreconditionFailed(err) {
+			l.lost.Store(true)
+			held, _, _ := readLock(l.client)
+			fmt.Println("WARNING: the operation lock was taken over by", held, "stopping before the next host")
+			return
+		}
+		if err != nil {
+			fmt.Println("Unable to renew the operation lock:", err)
+		}
+	}
+}
+
+// reconnect renews the lock with a client using the current credentials,
+// after they were rotated.
+func (l *opLock) reconnect() error {
+	if l == nil {
+		return nil
+	}
+	client, err := s3Client(endpoint)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.client = client
+	return nil
+}
+
+// release removes the lock, unless someone took it over in the meantime.
+func (l *opLock) release() {
+	if l == nil {
+		return
+	}
+	close(l.done)
+	activeLock.CompareAndSwap(l, nil)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, etag, err := readLock(l.client)
+	if err != nil {
+		fmt.Println("Unable to release the operation lock:", err)
+		return
+	}
+	if etag != l.etag {
+		return
+	}
+	err = l.client.RemoveObject(context.Background(), lockBucket, lockObject, minio.RemoveObjectOptions{})
+	if err != nil {
+		fmt.Println("Unable to release the operation lock:", err)
+		return
+	}
+	fmt.Println("Released operation lock")
+}
+
+// lockStatus prints who holds the lock.
+func lockStatus() {
+	if lockBucket == "" {
+		panic("-lockBucket is required")
+	}
+	client, err := s3Client(endpoint)
+	if err != nil {
+		panic(err)
+	}
+	info, _, err := readLock(client)
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		fmt.Println("Not locked")
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	if jsonOutput {
+		jsonOut(info)
+		return
+	}
+	state := "held"
+	if time.Now().After(info.Expires) {
+		state = "expired"
+	}
+	fmt.Println("Locked by", info)
+	fmt.Println("Lock is", state+", expires", info.Expires.Local().Format(time.RFC3339))
+}
+
+// lockOperation describes the running command for the lock object, which
+// everyone sharing the lock can read.
+func lockOperation() string {
+	return strings.Join(redactArgs(os.Args[1:]), " ")
+}
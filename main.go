@@ -5,8 +5,9 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -14,12 +15,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/debug"
-	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/minio/madmin-go/v3"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"golang.org/x/crypto/ssh"
@@ -35,6 +37,8 @@ type Server struct {
 	Endpoint  string
 	Rebooted  bool
 	Processed bool
+	// Offline is set when ServerInfo reports the server as not online.
+	Offline bool
 }
 
 type Set struct {
@@ -44,28 +48,85 @@ type Set struct {
 	ID         int
 	Pool       int
 	CanReboot  bool
-	Disks      map[string]*Disk
+	// RRAtRisk is set when reduced redundancy objects in the set lose read
+	// quorum while the server owning it is down.
+	RRAtRisk bool
+	Disks    map[string]*Disk
 }
 
 type Disk struct {
-	UUID   string
-	Index  int
-	Pool   int
-	Server string
-	Set    int
-	Path   string
-	State  string
+	UUID       string
+	Index      int
+	Pool       int
+	Server     string
+	Set        int
+	Path       string
+	State      string
+	TotalSpace uint64
+	UsedSpace  uint64
+	FreeInodes uint64
+	Healing    bool
+	Scanning   bool
+	// RootDisk is set when MinIO finds the drive on the same disk as the
+	// root filesystem.
+	RootDisk bool `json:",omitempty"`
+	// LastHealUpdate is the last progress update of the drive's heal
+	// tracker, zero when the drive has not been healed.
+	LastHealUpdate time.Time
 }
 
 var (
 	endpoint    string
+	endpoints   string
 	miniokey    string
 	miniosecret string
 	secure      bool
 	jsonOutput  bool
 
+	otelEndpoint string
+	pushgateway  string
+	pushJob      string
+
+	checkCompat bool
+
+	updateRepo      string
+	updatePublicKey string
+	updateCheckOnly bool
+	updateForce     bool
+	updateInsecure  bool
+
+	upgradeRelease   string
+	upgradeURL       string
+	upgradeArch      string
+	upgradePublicKey string
+	upgradeCheckOnly bool
+
+	upgradeBinary     string
+	upgradeBinaryPath string
+	// upgradeRolloutFlags are the rollout flags of upgrade, they only apply
+	// to -binary.
+	upgradeRolloutFlags []string
+
+	provisionDrives       string
+	provisionMountPrefix  string
+	provisionLabelPrefix  string
+	provisionWipe         bool
+	provisionUser         string
+	provisionVolumes      string
+	provisionOpts         string
+	provisionEnvFile      string
+	provisionEnvTemplate  string
+	provisionUnitTemplate string
+
+	expansionPool string
+
 	badSetsOnly  bool
 	badDisksOnly bool
+	wideOutput   bool
+	physicalIDs  bool
+
+	showLatency   bool
+	latencyFactor float64
 
 	dryRun    bool
 	minioOnly bool
@@ -73,149 +134,252 @@ var (
 	folder   string
 	hostfile string
 	port     string
+	toStdout bool
+
+	topologyFile   string
+	hostfileFormat string
+	maxPerRound    int
+	safetyMargin   int
+	strictParity   bool
+
+	window       string
+	timezone     string
+	verifyQuorum bool
+
+	healthWorkers   int
+	healthTimeout   time.Duration
+	checkDrives     bool
+	healthInterval  time.Duration
+	healthMaxWait   time.Duration
+	rebootStagger   time.Duration
+	roundDelay      time.Duration
+	degradeInterval time.Duration
+	onDegrade       string
+	alertWebhook    string
+	canaryHosts     int
+	canarySoak      time.Duration
+	stageBy         string
+	pauseStages     bool
+
+	healthPath        string
+	healthMaintenance bool
+	canaryBucket      string
+
+	smokeBucket string
+
+	waitHealBacklog   bool
+	healBacklogMax    int
+	healBetweenRounds bool
+
+	healAbort      bool
+	healTokenFile  string
+	healAllServers bool
+	healWorkers    int
+	healPriority   string
+	healMaxIO      string
+	healMaxSleep   string
+	healGentle     bool
+	healAggressive bool
+
+	forceReboot bool
+
+	lbType    string
+	lbAddress string
+	lbBackend string
+	drainWait time.Duration
+
+	consulService string
+	consulPort    string
+	consulToken   string
+	consulMode    string
+	consulSaveDir string
+
+	kubeDrain        bool
+	kubeContext      string
+	kubeNamespace    string
+	kubeDrainTimeout time.Duration
+
+	sshUser    string
+	sshPort    string
+	sshKey     string
+	sshRetries int
+
+	sshCommandTimeout time.Duration
+
+	hostWorkers int
+	remountYes  bool
+	remountWait time.Duration
+	locateOn    bool
+	locateOff   bool
+	runbookOut  string
+
+	clockMethod  string
+	maxClockSkew time.Duration
+
+	showRTT        bool
+	netTimeout     time.Duration
+	certExpiryDays int
+	certsSource    string
+	certsDir       string
+	certCAFile     string
+	testMTU        bool
+	consolePort    string
+	checkNodes     bool
+
+	credentialsNewKey    string
+	credentialsNewSecret string
+	credentialsProfile   string
+
+	quotaWithin float64
+	quotaAll    bool
+
+	lockScan          bool
+	lockLongRetention int
+
+	tiersScan bool
+
+	batchType  string
+	batchWatch time.Duration
+
+	inspectOut      string
+	inspectMetaOnly bool
+
+	bundleOut           string
+	bundleRedact        bool
+	bundleLogLines      int
+	bundleHostChecks    bool
+	reportHTML          string
+	exporterListen      string
+	exporterRefresh     time.Duration
+	serveListen         string
+	serveRefresh        time.Duration
+	apiTokenFile        string
+	oidcIssuer          string
+	oidcAudience        string
+	oidcRoleClaim       string
+	oidcRoles           string
+	scheduleFile        string
+	scheduleLog         string
+	snapshotDir         string
+	jobsDir             string
+	resumeJobID         string
+	lockBucket          string
+	lockTTL             time.Duration
+	stealLock           bool
+	historyBucket       string
+	historyLast         int
+	rebootSince         string
+	forceAll            bool
+	skipSince           time.Time
+	verifyReboot        bool
+	verifyTimeout       time.Duration
+	unitTimeout         time.Duration
+	checkJournal        bool
+	reloadOnly          bool
+	bmcFile             string
+	bmcUser             string
+	bmcPasswordFile     string
+	powerCycleFallback  bool
+	driveDB             string
+	trendLast           time.Duration
+	trendBy             string
+	trendPer            string
+	trendCSV            bool
+	reportCharts        bool
+	chartDaysBack       int
+	forecastModel       string
+	forecastSeason      time.Duration
+	forecastThresholds  string
+	printSchema         bool
+	outputSchemaVersion int
+	queryFields         string
+	queryWhere          string
+	queryFilter         *queryExpr
+	outputFormat        string
 )
 
-var mclient *madmin.AdminClient
+var (
+	mclient     *madmin.AdminClient
+	mclientLock sync.Mutex
+	mclientFor  string
+)
 
-func jsonOut(b interface{}) {
-	outb, err := json.Marshal(b)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Println(string(outb))
-}
+// exitCode is returned by the process once the command has finished.
+var exitCode int
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("invalid number of arguments.. try --help")
-		os.Exit(1)
-	}
-
-	switch parseArgs() {
-	case "hostfile":
-		makeHostfile()
-	case "reboot":
-		rebootHostfile()
-	case "health":
-		healthCheck()
-	case "sets":
-		sets()
-	case "heal":
-		heal()
-	case "disks":
-		disks()
-	case "info":
-		info()
-	default:
-		flag.Usage()
-	}
-}
-
-func parseArgs() (command string) {
-	hasHelp := false
-	if slices.Contains(os.Args, "--help") {
-		hasHelp = true
-	}
-	command = os.Args[1]
-	os.Args = os.Args[1:]
-	switch command {
-
-	case "hostfile":
-		flag.StringVar(&folder, "folder", "./cluster-hostfiles", "Hostfiles will be placed in this folder")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-
-	case "reboot":
-		flag.StringVar(&hostfile, "hostfile", "", "The list of hosts to be rebooted")
-		flag.BoolVar(&dryRun, "dryRun", true, "Only perform a dry run")
-		flag.BoolVar(&minioOnly, "minioOnly", true, "Only restart minio, not the server itself")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-	case "health":
-		flag.StringVar(&hostfile, "hostfile", "", "The list of hosts to be monitored for health")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-	case "sets":
-		flag.BoolVar(&jsonOutput, "json", false, "Print output in json")
-		flag.BoolVar(&badSetsOnly, "badSetsOnly", false, "Show only bad sets")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-	case "disks":
-		flag.BoolVar(&badDisksOnly, "badDisksOnly", false, "Show only bad disks")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-	case "info":
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
-		}
-	case "heal":
-		flag.BoolVar(&dryRun, "dryRun", true, "Only perform a dry run")
-		if hasHelp {
-			flag.Parse()
-			flag.Usage()
-			os.Exit(1)
+	cmd := parseArgs()
+	if queryWhere != "" {
+		var err error
+		queryFilter, err = parseWhere(queryWhere)
+		if err != nil {
+			panic(err)
 		}
-	default:
 	}
-
-	flag.StringVar(&endpoint, "endpoint", "127.0.0.1", "server endpoint")
-	flag.StringVar(&port, "port", "", "ssh port")
-	flag.StringVar(&miniokey, "key", "minioadmin", "minio user/key")
-	flag.StringVar(&miniosecret, "secret", "minioadmin", "minio password/secret")
-	flag.BoolVar(&secure, "secure", false, "Toggle SSL on/off")
-	flag.Parse()
-	if hasHelp {
-		printCommands()
-		flag.Usage()
-		os.Exit(1)
+	if outputFormat != "" {
+		err := parseOutput(outputFormat)
+		if err != nil {
+			panic(err)
+		}
+		// Every command with JSON output renders it through jsonOut,
+		// hostfile only with -format json.
+		jsonOutput = true
+		hostfileFormat = "json"
 	}
-	return
+	if printSchema {
+		printOutputSchema(cmd)
+		os.Exit(0)
+	}
+	runCommand(cmd)
+	os.Exit(exitCode)
 }
 
-func printCommands() {
-	fmt.Println("")
-	fmt.Println(" Available commands")
-	fmt.Println(" -----------------------------")
-	fmt.Println(" info       Create a json output of core storage system information")
-	fmt.Println(" sets       Shows which servers/disks are in which sets (can show broken sets too)")
-	fmt.Println(" disks      Shows a list of disks per server (can show broken disks too)")
-	fmt.Println()
-	fmt.Println(" hostfile   Generates hostfiles in `-folder`. Hosts that can not be rebooted will be places in a file called 'failure'")
-	fmt.Println(" reboot     Reboots servers defined in `-hostfile`")
-	fmt.Println(" health     Monitors the health endpoint of hosts defined in `-hostfile`")
-	fmt.Println(" heal       Triggers erasure set healing on all sets on `-endpoint`")
-	fmt.Println(" -----------------------------")
-	fmt.Println("")
+func runCommand(cmd *command) {
+	start := time.Now()
+	jsonCommand = cmd.Name
+	startTracing(cmd.Name)
+	defer func() {
+		r := recover()
+		if r != nil {
+			stopTracing(fmt.Errorf("%v", r))
+			pushMetrics(cmd.Name, time.Since(start), fmt.Errorf("%v", r))
+			recordHistory(cmd.Name, start, fmt.Errorf("%v", r))
+			panic(r)
+		}
+		stopTracing(nil)
+		pushMetrics(cmd.Name, time.Since(start), nil)
+		recordHistory(cmd.Name, start, nil)
+	}()
+
+	cmd.Run()
 }
 
+// makeClient sets mclient for -endpoint and the current credentials. The
+// client is only replaced when they changed, serve and the heals it starts
+// keep sharing the one made at startup.
 func makeClient() (err error) {
 	ep := endpoint + ":" + port
-	mclient, err = madmin.NewWithOptions(ep, &madmin.Options{
+	key := ep + "\x00" + miniokey + "\x00" + miniosecret
+	mclientLock.Lock()
+	defer mclientLock.Unlock()
+	if mclient != nil && mclientFor == key {
+		return nil
+	}
+	client, err := madmin.NewWithOptions(ep, &madmin.Options{
 		Creds:     credentials.NewStaticV4(miniokey, miniosecret, ""),
 		Secure:    secure,
 		Transport: DefaultTransport(secure),
 	})
-	return
+	if err != nil {
+		return err
+	}
+	mclient, mclientFor = client, key
+	return nil
 }
 
 func info() {
+	// info only prints JSON, status lines go to stderr.
+	jsonOutput = true
 	pools, _, err := getInfra()
 	if err != nil {
 		panic(err)
@@ -223,14 +387,31 @@ func info() {
 	jsonOut(pools)
 }
 
-func healSet(poolIndex int, setIndex int) {
+func healSet(poolIndex int, setIndex int) error {
+	return healSetMode(poolIndex, setIndex, madmin.HealNormalScan)
+}
+
+// healSetMode heals one set with the given scan mode and returns once
+// nothing is left to heal.
+func healSetMode(poolIndex int, setIndex int, scanMode madmin.HealScanMode) (err error) {
+	sp := startSpan("healSet", map[string]string{
+		"pool": strconv.Itoa(poolIndex),
+		"set":  strconv.Itoa(setIndex),
+	})
 	defer func() {
 		r := recover()
 		if r != nil {
 			log.Println(r, string(debug.Stack()))
+			err = fmt.Errorf("%v", r)
+		}
+		sp.end(err)
+		if err != nil {
+			runStats.failures.Add(1)
 		}
 		healMapLock.Lock()
-		healMap[fmt.Sprintf("%d/%d", poolIndex, poolIndex)] = 0
+		healMap[fmt.Sprintf("%d/%d", poolIndex, setIndex)] = 0
+		delete(healTokens, fmt.Sprintf("%d/%d", poolIndex, setIndex))
+		saveHealTokens()
 		healMapLock.Unlock()
 	}()
 
@@ -245,7 +426,7 @@ func healSet(poolIndex int, setIndex int) {
 			UpdateParity: false,
 			NoLock:       false,
 			Recursive:    true,
-			ScanMode:     1,
+			ScanMode:     scanMode,
 			Pool:         &poolIndex,
 			Set:          &setIndex,
 		},
@@ -258,6 +439,16 @@ func healSet(poolIndex int, setIndex int) {
 		return
 	}
 
+	healMapLock.Lock()
+	healTokens[fmt.Sprintf("%d/%d", poolIndex, setIndex)] = &healToken{
+		ClientToken: success.ClientToken,
+		Pool:        poolIndex,
+		Set:         setIndex,
+		StartTime:   success.StartTime,
+	}
+	saveHealTokens()
+	healMapLock.Unlock()
+
 	for {
 		scannedObjects := 0
 		invalidStates := 0
@@ -274,7 +465,7 @@ func healSet(poolIndex int, setIndex int) {
 				UpdateParity: false,
 				NoLock:       false,
 				Recursive:    true,
-				ScanMode:     1,
+				ScanMode:     scanMode,
 				Pool:         &poolIndex,
 				Set:          &setIndex,
 			},
@@ -287,25 +478,29 @@ func healSet(poolIndex int, setIndex int) {
 			return
 		}
 
-		done := true
+		// Items only holds what was healed since the last poll, the set is
+		// done once the sequence finished.
+		done := status.Summary == "finished"
+		if status.Summary == "stopped" {
+			err = fmt.Errorf("heal of set %d/%d stopped: %s", poolIndex, setIndex, status.FailureDetail)
+			fmt.Println(err)
+			return
+		}
+		runStats.objectsHealed.Add(int64(len(status.Items)))
 
 		for _, v := range status.Items {
 			scannedObjects++
-			mb, ma := v.GetMissingCounts()
-			cb, ca := v.GetCorruptedCounts()
-			ofb, ofa := v.GetOfflineCounts()
-			broken := mb + ma + cb + ca + ofb + ofa
+			_, ma := v.GetMissingCounts()
+			_, ca := v.GetCorruptedCounts()
+			_, ofa := v.GetOfflineCounts()
 			invalidStates = invalidStates + ma + ca + ofa
-			if broken > 0 {
-				done = false
-			}
 		}
 
 		healMapLock.Lock()
-		healMap[fmt.Sprintf("%d/%d", poolIndex, poolIndex)] = invalidStates
+		healMap[fmt.Sprintf("%d/%d", poolIndex, setIndex)] = invalidStates
 		healMapLock.Unlock()
 		if done {
-			break
+			return nil
 		}
 
 	}
@@ -314,14 +509,111 @@ func healSet(poolIndex int, setIndex int) {
 var (
 	healMap     = make(map[string]int)
 	healMapLock = new(sync.Mutex)
+	healTokens  = make(map[string]*healToken)
 )
 
-func heal() {
-	pools, _, err := getInfra()
+// healToken identifies a heal sequence started by this tool so it can be
+// stopped later with `heal -abort`.
+type healToken struct {
+	ClientToken string
+	Pool        int
+	Set         int
+	StartTime   time.Time
+}
+
+// saveHealTokens writes the running heal sequences to healTokenFile.
+// healMapLock must be held by the caller.
+func saveHealTokens() {
+	if healTokenFile == "" {
+		return
+	}
+	outb, err := json.Marshal(healTokens)
+	if err != nil {
+		fmt.Println("Unable to encode heal tokens:", err)
+		return
+	}
+	err = os.WriteFile(healTokenFile, outb, 0o600)
+	if err != nil {
+		fmt.Println("Unable to save heal tokens:", err)
+	}
+}
+
+// abortHeal force-stops every heal sequence recorded in healTokenFile that
+// the server still reports as running.
+func abortHeal() {
+	bb, err := os.ReadFile(healTokenFile)
+	if err != nil {
+		panic(err)
+	}
+	tokens := make(map[string]*healToken)
+	err = json.Unmarshal(bb, &tokens)
+	if err != nil {
+		panic(err)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No heal sequences recorded in", healTokenFile)
+		return
+	}
+
+	err = makeClient()
 	if err != nil {
 		panic(err)
 	}
 
+	for _, key := range stringKeysSorted(tokens) {
+		t := tokens[key]
+		opts := madmin.HealOpts{
+			Recursive: true,
+			ScanMode:  1,
+			Pool:      &t.Pool,
+			Set:       &t.Set,
+		}
+
+		_, status, err := mclient.Heal(context.Background(), "", "", opts, t.ClientToken, false, false)
+		if err != nil {
+			fmt.Println("Set:", key, "not running:", err)
+			delete(tokens, key)
+			continue
+		}
+		if status.Summary != "running" {
+			fmt.Println("Set:", key, "already", status.Summary)
+			delete(tokens, key)
+			continue
+		}
+
+		_, _, err = mclient.Heal(context.Background(), "", "", opts, "", false, true)
+		if err != nil {
+			fmt.Println("Set:", key, "unable to stop:", err)
+			continue
+		}
+		fmt.Println("Set:", key, "stopped")
+		delete(tokens, key)
+	}
+
+	healTokens = tokens
+	saveHealTokens()
+}
+
+// healTarget is a zero based pool and set index as used by the heal API.
+type healTarget struct {
+	Pool int
+	Set  int
+
+	// Margin is how many more drives the set can lose before reaching
+	// its parity limit. Usage is the fraction of the set's space in use.
+	Margin int
+	Usage  float64
+}
+
+// healTargets returns the sets that should be healed, ordered by `-priority`.
+// Without `-allServers` only sets with drives on `-endpoint` are included, or
+// every set of a pool that consists of a single server.
+func healTargets(pools map[string]*Pool) (targets []healTarget) {
+	type setKey struct{ pool, set int }
+	index := make(map[setKey]int)
+	used := make(map[setKey]uint64)
+	total := make(map[setKey]uint64)
+
 	for i, v := range pools {
 		poolIndex, err := strconv.Atoi(i)
 		if err != nil {
@@ -329,17 +621,140 @@ func heal() {
 		}
 
 		for _, vv := range v.Servers {
-			if endpoint == vv.Endpoint || len(v.Servers) == 1 {
-				for si := range vv.Sets {
-					healMapLock.Lock()
-					healMap[fmt.Sprintf("%d/%d", poolIndex-1, si-1)] = 1
-					healMapLock.Unlock()
-					go healSet(poolIndex-1, si-1)
+			for si, set := range vv.Sets {
+				k := setKey{poolIndex - 1, si - 1}
+				for _, d := range set.Disks {
+					used[k] += d.UsedSpace
+					total[k] += d.TotalSpace
+				}
+
+				if !healAllServers && endpoint != vv.Endpoint && len(v.Servers) != 1 {
+					continue
+				}
+				if _, ok := index[k]; !ok {
+					index[k] = len(targets)
+					targets = append(targets, healTarget{
+						Pool:   k.pool,
+						Set:    k.set,
+						Margin: set.SCParity - set.BadDisks,
+					})
 				}
 			}
 		}
 	}
 
+	for k, i := range index {
+		if total[k] > 0 {
+			targets[i].Usage = float64(used[k]) / float64(total[k])
+		}
+	}
+
+	byID := func(a, b healTarget) bool {
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		return a.Set < b.Set
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		switch healPriority {
+		case "risk":
+			if a.Margin != b.Margin {
+				return a.Margin < b.Margin
+			}
+			if a.Usage != b.Usage {
+				return a.Usage > b.Usage
+			}
+		case "usage":
+			if a.Usage != b.Usage {
+				return a.Usage > b.Usage
+			}
+		}
+		return byID(a, b)
+	})
+	return
+}
+
+func heal() {
+	l := acquireLock(lockOperation())
+	defer l.release()
+
+	if healAbort {
+		abortHeal()
+		return
+	}
+
+	pools, _, err := getInfra()
+	if err != nil {
+		panic(err)
+	}
+
+	workers := healWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+
+	switch healPriority {
+	case "risk", "usage", "id":
+	default:
+		panic("invalid -priority " + healPriority + ", expected risk, usage or id")
+	}
+
+	restore := applyHealThrottle()
+	defer restore()
+
+	j := startJob("heal")
+	defer j.finishFromPanic()
+	handleInterrupts(j, l)
+
+	var targets []healTarget
+	for _, t := range healTargets(pools) {
+		if j.stepDone(fmt.Sprintf("set %d/%d", t.Pool, t.Set)) {
+			fmt.Printf("Skipping set %d/%d it was healed before\n", t.Pool, t.Set)
+			continue
+		}
+		targets = append(targets, t)
+		planProgress([]string{fmt.Sprintf("set %d/%d", t.Pool, t.Set)})
+		healMapLock.Lock()
+		healMap[fmt.Sprintf("%d/%d", t.Pool, t.Set)] = 1
+		healMapLock.Unlock()
+	}
+
+	// Sets are started strictly in priority order as worker slots free up.
+	canceled := false
+	go func() {
+		for i, t := range targets {
+			sem <- struct{}{}
+			if stop := interrupted.Load(); stop || lockLost() || j.canceled() {
+				switch {
+				case stop:
+					fmt.Println("Interrupted, not starting the remaining sets")
+				case lockLost():
+					fmt.Println("Not starting the remaining sets,", errLockLost)
+				default:
+					fmt.Println("Job canceled, not starting the remaining sets")
+				}
+				healMapLock.Lock()
+				canceled = !stop && !lockLost()
+				for _, t := range targets[i:] {
+					healMap[fmt.Sprintf("%d/%d", t.Pool, t.Set)] = 0
+				}
+				healMapLock.Unlock()
+				<-sem
+				return
+			}
+			fmt.Printf("Starting heal on set %d/%d margin(%d) usage(%.1f%%)\n", t.Pool, t.Set, t.Margin, t.Usage*100)
+			go func(t healTarget) {
+				defer func() { <-sem }()
+				name := fmt.Sprintf("set %d/%d", t.Pool, t.Set)
+				j.startStep(name)
+				j.finishStep(name, healSet(t.Pool, t.Set))
+				progressDone(name)
+			}(t)
+		}
+	}()
+
 	broken := 0
 	for {
 		time.Sleep(2 * time.Second)
@@ -355,30 +770,81 @@ func heal() {
 		}
 		broken = 0
 	}
+
+	// Wait for the steps of running sets to be recorded.
+	for i := 0; i < workers; i++ {
+		sem <- struct{}{}
+	}
+	healMapLock.Lock()
+	wasCanceled := canceled
+	healMapLock.Unlock()
+	switch {
+	case interrupted.Load():
+		stopInterrupted(j, false)
+	case wasCanceled:
+		j.finish(jobCanceled, nil)
+	case lockLost():
+		j.finish(jobFailed, errLockLost)
+		exitCode = 1
+	case j.failedSteps() > 0:
+		j.finish(jobFailed, fmt.Errorf("%d sets failed to heal", j.failedSteps()))
+	default:
+		j.finish(jobDone, nil)
+	}
+}
+
+// waitForHealBacklog blocks until the number of drives the background healer
+// is still working on is at or below healBacklogMax.
+func waitForHealBacklog() {
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+
+	for {
+		state, err := mclient.BackgroundHealStatus(context.Background())
+		if err != nil {
+			fmt.Println("Unable to read heal backlog:", err)
+		} else {
+			healing := len(state.HealDisks)
+			if healing <= healBacklogMax {
+				return
+			}
+			fmt.Printf("Waiting for heal backlog: drives healing(%d) max(%d)\n", healing, healBacklogMax)
+		}
+		time.Sleep(30 * time.Second)
+	}
 }
 
 func disks() {
+	if showLatency {
+		diskLatency()
+		return
+	}
+
 	pools, _, err := getInfra()
 	if err != nil {
 		panic(err)
 	}
 
+	var physical map[string]drivePhysical
+	if physicalIDs {
+		physical = drivesPhysical(pools, badDisksOnly)
+	}
+
 	for i, v := range pools {
 		for ii, vv := range v.Servers {
 			toPrint := []string{}
 			for _, vvv := range vv.Sets {
 				for _, vvvv := range vvv.Disks {
-					if badDisksOnly {
-						if vvvv.State != "ok" {
-							toPrint = append(toPrint,
-								fmt.Sprintf("%-20s %-4d %s", vvvv.Path, vvvv.Set, vvvv.State),
-							)
-						}
-					} else {
-						toPrint = append(toPrint,
-							fmt.Sprintf("%-30s %-4d %s", vvvv.Path, vvvv.Set, vvvv.State),
-						)
+					if badDisksOnly && !vvvv.isBad() {
+						continue
 					}
+					line := diskLine(vvvv)
+					if physicalIDs {
+						line += physicalLine(physical[ii+":"+vvvv.Path])
+					}
+					toPrint = append(toPrint, line)
 				}
 			}
 			if len(toPrint) > 0 {
@@ -387,7 +853,11 @@ func disks() {
 				fmt.Printf("%-10s %s\n", "Pool", i)
 				fmt.Printf("%-10s %s\n", "Server", ii)
 				fmt.Println("")
-				fmt.Printf("%-30s %-4s %s\n", "PATH", "SET", "STATE")
+				if physicalIDs {
+					fmt.Println(diskHeader() + physicalHeader())
+				} else {
+					fmt.Println(diskHeader())
+				}
 
 				for _, v := range toPrint {
 					fmt.Println(v)
@@ -396,38 +866,96 @@ func disks() {
 
 		}
 	}
+
+	warnRootDisks(pools)
+}
+
+// allDisks returns the drives of pools sorted by server and path, only the
+// ones matching -badStates when badOnly is set.
+func allDisks(pools map[string]*Pool, badOnly bool) (all []*Disk) {
+	all = []*Disk{}
+	for _, p := range pools {
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if badOnly && !d.isBad() {
+						continue
+					}
+					all = append(all, d)
+				}
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Server != all[j].Server {
+			return all[i].Server < all[j].Server
+		}
+		return all[i].Path < all[j].Path
+	})
+	return
 }
 
-func sets() {
-	pools, _, err := getInfra()
-	if err != nil {
-		panic(err)
+func diskHeader() string {
+	if wideOutput {
+		return fmt.Sprintf("%-30s %-4s %-10s %-10s %-10s %-12s %-8s %-8s %s",
+			"PATH", "SET", "STATE", "CAPACITY", "USED", "FREE INODES", "HEALING", "SCANNING", "LAST HEAL UPDATE")
 	}
+	return fmt.Sprintf("%-30s %-4s %s", "PATH", "SET", "STATE")
+}
 
-	type settemp struct {
-		Disks     []*Disk
-		CanReboot bool
-		Parity    int
-		BadDisks  int
+func diskLine(d *Disk) string {
+	if wideOutput {
+		lastUpdate := "-"
+		if !d.LastHealUpdate.IsZero() {
+			lastUpdate = d.LastHealUpdate.Format(time.RFC3339)
+		}
+		return fmt.Sprintf("%-30s %-4d %-10s %-10s %-10s %-12d %-8t %-8t %s",
+			d.Path, d.Set, d.State,
+			humanize.IBytes(d.TotalSpace), humanize.IBytes(d.UsedSpace),
+			d.FreeInodes, d.Healing, d.Scanning, lastUpdate)
 	}
+	return fmt.Sprintf("%-30s %-4d %s", d.Path, d.Set, d.State)
+}
 
-	sets := make(map[string]map[int]*settemp)
+// setSummary is an erasure set with the drives of all its servers.
+type setSummary struct {
+	Disks     []*Disk
+	CanReboot bool
+	Parity    int
+	RRParity  int
+	RRAtRisk  bool
+	BadDisks  int
+	// OfflineServers are the servers of the set ServerInfo reports as
+	// offline.
+	OfflineServers []string `json:",omitempty"`
+}
+
+// setSummaries groups the drives of pools by pool and set, keeping only the
+// drives matching -badStates when -badSetsOnly is set.
+func setSummaries(pools map[string]*Pool) (sets map[string]map[int]*setSummary) {
+	sets = make(map[string]map[int]*setSummary)
 	for pid, p := range pools {
-		sets[pid] = make(map[int]*settemp, 0)
+		sets[pid] = make(map[int]*setSummary, 0)
 		for _, s := range p.Servers {
 			for _, set := range s.Sets {
 				_, ok := sets[pid][set.ID]
 				if !ok {
-					sets[pid][set.ID] = new(settemp)
+					sets[pid][set.ID] = new(setSummary)
 				}
 
 				sets[pid][set.ID].Parity = set.SCParity
 				sets[pid][set.ID].CanReboot = set.CanReboot
+				sets[pid][set.ID].RRParity = set.RRSCParity
+				sets[pid][set.ID].RRAtRisk = sets[pid][set.ID].RRAtRisk || set.RRAtRisk
 				sets[pid][set.ID].BadDisks = set.BadDisks
+				if s.Offline {
+					sets[pid][set.ID].OfflineServers = append(sets[pid][set.ID].OfflineServers, s.Endpoint)
+					sort.Strings(sets[pid][set.ID].OfflineServers)
+				}
 
 				for _, d := range set.Disks {
 					if badSetsOnly {
-						if d.State != "ok" {
+						if d.isBad() {
 							sets[pid][set.ID].Disks = append(sets[pid][set.ID].Disks, d)
 						}
 					} else {
@@ -437,7 +965,16 @@ func sets() {
 			}
 		}
 	}
+	return
+}
+
+func sets() {
+	pools, _, err := getInfra()
+	if err != nil {
+		panic(err)
+	}
 
+	sets := setSummaries(pools)
 	if jsonOutput {
 		jsonOut(sets)
 		return
@@ -453,15 +990,35 @@ func sets() {
 				continue
 			}
 
-			fmt.Printf("\nPool(%s) SET(%d) CanReboot(%t) Parity(%d) BadDisks(%d)\n", i, ii, vv.CanReboot, vv.Parity, vv.BadDisks)
+			fmt.Printf("\nPool(%s) SET(%d) CanReboot(%t) Parity(%d) RRParity(%d) RRAtRisk(%t) BadDisks(%d)\n", i, ii, vv.CanReboot, vv.Parity, vv.RRParity, vv.RRAtRisk, vv.BadDisks)
 			for _, p := range toPrint {
 				fmt.Println(p)
 			}
+			for _, host := range vv.OfflineServers {
+				fmt.Println("server offline", host)
+			}
+		}
+	}
+
+	for _, pid := range stringKeysSorted(pools) {
+		for _, host := range stringKeysSorted(pools[pid].Servers) {
+			if s := pools[pid].Servers[host]; s.Offline && len(s.Sets) == 0 {
+				fmt.Printf("\nPool(%s) server offline %s, none of its drives are known\n", pid, host)
+			}
 		}
 	}
 }
 
+// infraMu serializes getInfra, a rollout polls it in the background while
+// the round runs.
+var infraMu sync.Mutex
+
 func getInfra() (pools map[string]*Pool, totalServers int, err error) {
+	infraMu.Lock()
+	defer infraMu.Unlock()
+	sp := startSpan("getInfra", nil)
+	defer func() { sp.end(err) }()
+
 	err = makeClient()
 	if err != nil {
 		panic(err)
@@ -469,7 +1026,7 @@ func getInfra() (pools map[string]*Pool, totalServers int, err error) {
 
 	var info madmin.StorageInfo
 	if os.Getenv("INFRA_FILE_REPLACEMENT") != "" {
-		fmt.Println("Loading storage info file", os.Getenv("INFRA_FILE_REPLACEMENT"))
+		fmt.Fprintln(statusOut(), "Loading storage info file", os.Getenv("INFRA_FILE_REPLACEMENT"))
 		bb, err := os.ReadFile(os.Getenv("INFRA_FILE_REPLACEMENT"))
 		if err != nil {
 			panic(err)
@@ -479,111 +1036,141 @@ func getInfra() (pools map[string]*Pool, totalServers int, err error) {
 			panic(err)
 		}
 	} else {
-		info, err = mclient.StorageInfo(context.Background())
+		info, err = clusterStorageInfo()
 		if err != nil {
 			return
 		}
 
 	}
 
-	setInfo := make(map[string]map[string]*Set)
+	offline := offlineServers()
+	info.Disks = append(info.Disks, offlineDisks(info.Disks, offline)...)
+
+	recordDriveStates(info.Disks)
+
+	pools, totalServers = buildInfra(&info, offline)
+	return
+}
 
-	pools = make(map[string]*Pool, 0)
-	for _, d := range info.Disks {
+// setKey is a set by pool and set number.
+type setKey struct{ pool, set int }
+
+// buildInfra builds the pools from the drives of info in one pass. Every
+// server has its own Set for each set it has drives in, the bad drives are
+// counted per set across servers and copied to all of them at the end.
+func buildInfra(info *madmin.StorageInfo, offline map[string]madmin.ServerProperties) (pools map[string]*Pool, totalServers int) {
+	pools = make(map[string]*Pool)
+	badDisks := make(map[setKey]int)
+	// The drives of a server share scheme://host:port, it is parsed once.
+	hosts := make(map[string]string)
+	// One allocation for every Disk and Set instead of one each, a server
+	// has at most one Set per drive.
+	disks := make([]Disk, len(info.Disks))
+	sets := make([]Set, 0, len(info.Disks))
+
+	for i := range info.Disks {
+		d := &info.Disks[i]
 		PI := strconv.Itoa(d.PoolIndex + 1)
 		SI := d.SetIndex + 1
-		if setInfo[PI] == nil {
-			setInfo[PI] = make(map[string]*Set, 0)
-		}
 
 		pool, ok := pools[PI]
 		if !ok {
-			pools[PI] = &Pool{
-				Servers: make(map[string]*Server, 0),
-			}
-			pool = pools[PI]
+			pool = &Pool{Servers: make(map[string]*Server)}
+			pools[PI] = pool
 		}
 
-		x, errx := url.Parse(d.Endpoint)
-		if errx != nil || x == nil {
-			panic(errx)
-		}
-
-		server, ok := pool.Servers[x.Hostname()]
+		host := endpointHost(hosts, d.Endpoint)
+		server, ok := pool.Servers[host]
 		if !ok {
-			pool.Servers[x.Hostname()] = &Server{
-				Sets:     make(map[int]*Set, 0),
+			server = &Server{
+				Sets:     make(map[int]*Set),
 				Rebooted: false,
-				Endpoint: x.Hostname(),
+				Endpoint: host,
 			}
-			server = pool.Servers[x.Hostname()]
+			pool.Servers[host] = server
 			totalServers++
 		}
 
 		set, ok := server.Sets[SI]
 		if !ok {
-			server.Sets[SI] = &Set{
-				Disks:      make(map[string]*Disk, 0),
-				SCParity:   info.Backend.StandardSCParity,
-				RRSCParity: info.Backend.RRSCParity,
+			sets = append(sets, Set{
+				Disks:      make(map[string]*Disk),
+				SCParity:   poolParity(info.Backend.StandardSCParities, info.Backend.StandardSCParity, d.PoolIndex),
+				RRSCParity: poolParity(info.Backend.RRSCParities, info.Backend.RRSCParity, d.PoolIndex),
 				ID:         SI,
 				Pool:       d.PoolIndex + 1,
 				CanReboot:  false,
-			}
-			set = server.Sets[SI]
+			})
+			set = &sets[len(sets)-1]
+			server.Sets[SI] = set
 		}
 
-		seti, ok := setInfo[PI][strconv.Itoa(SI)]
-		if !ok {
-			setInfo[PI][strconv.Itoa(SI)] = &Set{
-				SCParity:   info.Backend.StandardSCParity,
-				RRSCParity: info.Backend.RRSCParity,
-				ID:         SI,
-				Pool:       d.PoolIndex + 1,
-				BadDisks:   0,
-				CanReboot:  true,
-			}
-			seti = setInfo[PI][strconv.Itoa(SI)]
+		if rebootBad(d.State, d.Healing) {
+			badDisks[setKey{set.Pool, SI}]++
 		}
 
-		if d.State != "ok" {
-			seti.BadDisks++
+		path := d.DrivePath
+		if path == "" {
+			x, _ := url.Parse(d.Endpoint)
+			path = x.Path
 		}
 
-		if d.DrivePath == "" {
-			d.DrivePath = x.Path
+		disk := &disks[i]
+		*disk = Disk{
+			UUID:       d.UUID,
+			Index:      d.DiskIndex,
+			Pool:       d.PoolIndex + 1,
+			Server:     d.Endpoint,
+			Set:        SI,
+			Path:       path,
+			State:      d.State,
+			TotalSpace: d.TotalSpace,
+			UsedSpace:  d.UsedSpace,
+			FreeInodes: d.FreeInodes,
+			Healing:    d.Healing,
+			Scanning:   d.Scanning,
+			RootDisk:   d.RootDisk,
 		}
-
-		set.Disks[d.Endpoint] = &Disk{
-			UUID:   d.UUID,
-			Index:  d.DiskIndex,
-			Pool:   d.PoolIndex + 1,
-			Server: d.Endpoint,
-			Set:    SI,
-			Path:   d.DrivePath,
-			State:  d.State,
+		if d.HealInfo != nil {
+			disk.LastHealUpdate = d.HealInfo.LastUpdate
 		}
+		set.Disks[d.Endpoint] = disk
 	}
 
-	for i, v := range pools {
-		for _, vv := range v.Servers {
-			for iii, vvv := range vv.Sets {
-				seti, ok := setInfo[i][strconv.Itoa(iii)]
-				if ok {
-					if seti.BadDisks >= (seti.SCParity - 1) {
-						vvv.CanReboot = false
-					} else {
-						vvv.CanReboot = true
-					}
-					vvv.BadDisks = seti.BadDisks
-				}
+	totalServers += markOffline(pools, offline)
+
+	for _, p := range pools {
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				set.BadDisks = badDisks[setKey{set.Pool, set.ID}]
+				set.CanReboot = canReboot(set)
+				set.RRAtRisk = rrAtRisk(set)
 			}
 		}
 	}
-
 	return
 }
 
+// endpointHost returns the host name of a drive endpoint, hosts caches them
+// by everything before the drive path.
+func endpointHost(hosts map[string]string, endpoint string) string {
+	server := endpoint
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		if j := strings.IndexByte(endpoint[i+3:], '/'); j >= 0 {
+			server = endpoint[:i+3+j]
+		}
+	}
+	if host, ok := hosts[server]; ok {
+		return host
+	}
+	x, err := url.Parse(endpoint)
+	if err != nil || x == nil {
+		panic(err)
+	}
+	hosts[server] = x.Hostname()
+	return x.Hostname()
+}
+
 // stringKeysSorted returns the keys as a sorted string slice.
 func stringKeysSorted[K string, V any](m map[K]V) []string {
 	keys := make([]string, 0, len(m))
@@ -594,59 +1181,93 @@ func stringKeysSorted[K string, V any](m map[K]V) []string {
 	return keys
 }
 
+// statusOut is where progress messages go. When hosts or JSON are written to
+// stdout they are moved to stderr so the output stays pipeable.
+func statusOut() io.Writer {
+	if toStdout || jsonOutput || hostfileFormat == "json" || reportHTML == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
 func makeHostfile() {
+	if hostfileFormat != "text" && hostfileFormat != "json" {
+		panic("invalid -format " + hostfileFormat + ", expected text or json")
+	}
+
 	pools, totalServers, err := getInfra()
-	var rebootRounds [200][200]map[string]*Server
-	unhealthy := make(map[string]*Server, 0)
-	processed := 0
-	poolss := stringKeysSorted(pools)
-	for i := 0; i < len(rebootRounds); i++ {
-		if processed >= totalServers {
-			fmt.Printf("Total (%d) Online (%d)\n", totalServers, processed)
-			break
-		}
+	if err != nil {
+		panic(err)
+	}
+	excluded, removed := excludeServers(pools)
+	totalServers -= removed
+	for _, host := range stringKeysSorted(excluded) {
+		fmt.Fprintln(statusOut(), "Leaving out", host, excluded[host])
+	}
 
-		for _, pkey := range poolss {
-			pid, err := strconv.Atoi(pkey)
-			if err != nil {
-				panic(err)
-			}
-			v := pools[pkey]
-			if rebootRounds[i][pid] == nil {
-				rebootRounds[i][pid] = make(map[string]*Server)
+	var domains map[string]string
+	if topologyFile != "" {
+		domains, err = loadTopology(topologyFile)
+		if err != nil {
+			panic(err)
+		}
+		for _, p := range pools {
+			for host := range p.Servers {
+				if _, ok := domains[host]; !ok {
+					fmt.Fprintln(statusOut(), "No failure domain for", host, "in", topologyFile)
+				}
 			}
+		}
+	}
 
-			sortServKey := stringKeysSorted(v.Servers)
-		nextServer:
-			for _, skey := range sortServKey {
-				s := v.Servers[skey]
-				if s.Processed {
-					continue
-				}
+	rebootRounds, unhealthy := planRounds(pools, totalServers, domains)
 
-				if !areAllSetsOK(s) {
-					unhealthy[s.Endpoint] = s
-					continue
+	for ri, rv := range rebootRounds {
+		for _, rv2 := range rv {
+			for _, host := range stringKeysSorted(rv2) {
+				for _, set := range rv2[host].Sets {
+					if set.RRAtRisk {
+						fmt.Fprintf(statusOut(), "WARNING: round %d: reduced redundancy objects in pool %d set %d lose read quorum while %s is down\n", ri, set.Pool, set.ID, host)
+					}
 				}
+			}
+		}
+	}
 
-				_, ok := rebootRounds[i][pid][s.Endpoint]
-				if !ok {
-
-					for _, rv := range rebootRounds[i][pid] {
-						if haveMatchingSets(rv, s) {
-							continue nextServer
-						}
-					}
+	if hostfileFormat == "json" {
+		doc := newHostfileDocument(rebootRounds, unhealthy)
+		doc.Excluded = stringKeysSorted(excluded)
+		jsonOut(doc)
+		return
+	}
 
-					rebootRounds[i][pid][s.Endpoint] = pools[pkey].Servers[skey]
-					pools[pkey].Servers[skey].Processed = true
-					processed++
-				} else {
+	if toStdout {
+		for _, v := range unhealthy {
+			if v.Offline {
+				fmt.Fprintln(os.Stderr, "offline:", v.Endpoint)
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "unhealthy:", v.Endpoint)
+		}
+		for _, host := range stringKeysSorted(excluded) {
+			fmt.Fprintln(os.Stderr, "excluded:", host)
+		}
+		for ri, rv := range rebootRounds {
+			printed := false
+			for _, rv2 := range rv {
+				if len(rv2) < 1 {
 					continue
 				}
-
+				if !printed {
+					fmt.Printf("# round %d\n", ri)
+					printed = true
+				}
+				for _, rvkey := range stringKeysSorted(rv2) {
+					fmt.Println(rv2[rvkey].Endpoint)
+				}
 			}
 		}
+		return
 	}
 
 	_ = os.RemoveAll(folder)
@@ -668,6 +1289,17 @@ func makeHostfile() {
 	failfile.Sync()
 	failfile.Close()
 
+	if len(excluded) > 0 {
+		var list []byte
+		for _, host := range stringKeysSorted(excluded) {
+			list = append(list, host+"\n"...)
+		}
+		err = os.WriteFile(filepath.Join(folder, "excluded"), list, 0o777)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	var roundFile *os.File
 
 	for ri, rv := range rebootRounds {
@@ -691,6 +1323,131 @@ func makeHostfile() {
 	}
 }
 
+// planRounds splits the servers of pools into reboot rounds, a round never
+// contains two servers sharing a set or two servers of the same failure
+// domain. Servers with a set that can not lose them are returned as
+// unhealthy. Planning marks servers as Processed.
+func planRounds(pools map[string]*Pool, totalServers int, domains map[string]string) (rounds [][]map[string]*Server, unhealthy map[string]*Server) {
+	var rebootRounds [200][200]map[string]*Server
+	// roundDomains tracks the failure domains used by each round across all
+	// pools, a round never takes down two hosts of the same domain.
+	var roundDomains [200]map[string]bool
+	var roundSize [200]int
+	unhealthy = make(map[string]*Server, 0)
+	processed := 0
+	poolss := stringKeysSorted(pools)
+	for i := 0; i < len(rebootRounds); i++ {
+		if processed >= totalServers {
+			fmt.Fprintf(statusOut(), "Total (%d) Online (%d)\n", totalServers, processed)
+			break
+		}
+
+		roundDomains[i] = make(map[string]bool)
+		for _, pkey := range poolss {
+			pid, err := strconv.Atoi(pkey)
+			if err != nil {
+				panic(err)
+			}
+			v := pools[pkey]
+			if rebootRounds[i][pid] == nil {
+				rebootRounds[i][pid] = make(map[string]*Server)
+			}
+
+			sortServKey := stringKeysSorted(v.Servers)
+		nextServer:
+			for _, skey := range sortServKey {
+				s := v.Servers[skey]
+				if s.Processed {
+					continue
+				}
+
+				if s.Offline || !areAllSetsOK(s) {
+					unhealthy[s.Endpoint] = s
+					continue
+				}
+
+				_, ok := rebootRounds[i][pid][s.Endpoint]
+				if !ok {
+
+					for _, rv := range rebootRounds[i][pid] {
+						if haveMatchingSets(rv, s) {
+							continue nextServer
+						}
+					}
+
+					if maxPerRound > 0 && roundSize[i] >= maxPerRound {
+						continue nextServer
+					}
+
+					domain := domains[s.Endpoint]
+					if domain != "" && roundDomains[i][domain] {
+						continue nextServer
+					}
+					if domain != "" {
+						roundDomains[i][domain] = true
+					}
+
+					rebootRounds[i][pid][s.Endpoint] = pools[pkey].Servers[skey]
+					roundSize[i]++
+					pools[pkey].Servers[skey].Processed = true
+					processed++
+				} else {
+					continue
+				}
+
+			}
+		}
+	}
+
+	rounds = make([][]map[string]*Server, len(rebootRounds))
+	for i := range rebootRounds {
+		rounds[i] = rebootRounds[i][:]
+	}
+	return
+}
+
+// poolParity returns the parity of pool from the per pool list reported by
+// newer servers, or the cluster wide value when the list is missing.
+func poolParity(perPool []int, global int, pool int) int {
+	if pool >= 0 && pool < len(perPool) {
+		return perPool[pool]
+	}
+	return global
+}
+
+// canReboot reports whether the server owning set can go down while at least
+// -safetyMargin parity drives of the set stay available. By default a reboot
+// is assumed to take one drive offline, -strictParity counts the ok drives
+// the server actually has in the set.
+func canReboot(set *Set) bool {
+	offline := 1
+	if strictParity {
+		offline = 0
+		for _, d := range set.Disks {
+			if !rebootBad(d.State, d.Healing) {
+				offline++
+			}
+		}
+	}
+	return set.SCParity-set.BadDisks-offline >= safetyMargin
+}
+
+// rrAtRisk reports whether reduced redundancy objects in set drop below read
+// quorum while the server owning it is down. Servers without an RRS parity
+// configured are never at risk.
+func rrAtRisk(set *Set) bool {
+	if set.RRSCParity <= 0 {
+		return false
+	}
+	offline := 0
+	for _, d := range set.Disks {
+		if !rebootBad(d.State, d.Healing) {
+			offline++
+		}
+	}
+	return set.BadDisks+offline > set.RRSCParity
+}
+
 func areAllSetsOK(s1 *Server) (yes bool) {
 	for _, set := range s1.Sets {
 		if !set.CanReboot {
@@ -746,62 +1503,197 @@ func healthCheck() {
 		}
 	}()
 
-	hosts, err := os.ReadFile(hostfile)
+	hostsList, err := readHostfile(hostfile)
 	if err != nil {
 		panic(err)
 	}
-	hostsList := bytes.Split(hosts, []byte{10})
+	if !waitHealthy(hostsList) {
+		exitCode = 1
+	}
+}
 
-	hostMap := make(map[string]bool)
+// waitHealthy polls the health endpoint of every host every -interval until
+// all of them report healthy or -maxWait passed, then prints a report. Hosts
+// still not healthy at the deadline are reported as timed out.
+func waitHealthy(hostsList []string) (healthy bool) {
+	progress := make(map[string]*hostProgress)
+	rows := make([]*hostProgress, 0, len(hostsList))
 	for _, v := range hostsList {
-		if len(v) < 1 {
+		if _, ok := progress[v]; ok {
 			continue
 		}
-		hostMap[string(v)] = false
+		progress[v] = &hostProgress{Host: v, Status: "waiting", Since: time.Now()}
+		rows = append(rows, progress[v])
 	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Host < rows[j].Host })
 
 	defer func() {
 		fmt.Println()
 		fmt.Println("Post run host report...")
 		fmt.Println()
-		for i, v := range hostMap {
-			if v {
-				fmt.Println("healthy:", i)
-			} else {
-				fmt.Println("unhealthy:", i)
+		for _, p := range rows {
+			switch p.Status {
+			case "healthy":
+				fmt.Println("healthy:", p.Host, "after", p.waited())
+			case "timeout":
+				fmt.Printf("timeout: %s not healthy after %s, last: %s\n", p.Host, p.waited(), p.LastErr)
+			default:
+				fmt.Println("unhealthy:", p.Host, p.LastErr)
 			}
 		}
 		fmt.Println()
 	}()
 
-	unhealthy := 0
+	var deadline time.Time
+	if healthMaxWait > 0 {
+		deadline = time.Now().Add(healthMaxWait)
+	}
+	table := newHealthTable()
 	for {
-		unhealthy = 0
-		for host, healthy := range hostMap {
-			if healthy {
-				continue
+		pending := make([]string, 0, len(rows))
+		for _, p := range rows {
+			if p.Status != "healthy" {
+				pending = append(pending, p.Host)
 			}
-			ok, err := healthPing(host)
-			if err != nil {
-				unhealthy++
-				fmt.Println(err)
-				hostMap[host] = false
-			} else if !ok {
-				unhealthy++
-				fmt.Println("Waiting:", host)
-				hostMap[host] = false
-			} else {
-				hostMap[host] = true
-			}
-		}
-		if unhealthy == 0 {
-			return
 		}
-		fmt.Println("unhealthy hosts count:", unhealthy)
-		time.Sleep(30 * time.Second)
+
+		results := pollHealth(pending)
+		if checkDrives {
+			verifyDrives(pending, results)
+		}
+
+		waiting, failed := 0, 0
+		for i, host := range pending {
+			p := progress[host]
+			p.update(results[i])
+			switch p.Status {
+			case "failed":
+				failed++
+			case "waiting":
+				waiting++
+			}
+		}
+
+		done := len(rows) - waiting - failed
+		timedOut := !deadline.IsZero() && !time.Now().Before(deadline)
+		if timedOut {
+			for _, p := range rows {
+				if p.Status != "healthy" {
+					p.Status = "timeout"
+				}
+			}
+		}
+		summary := fmt.Sprintf("healthy(%d/%d) waiting(%d) failed(%d)", done, len(rows), waiting, failed)
+		if timedOut {
+			summary = fmt.Sprintf("healthy(%d/%d) timed out after %s", done, len(rows), healthMaxWait)
+		}
+		table.render(rows, summary)
+		if waiting+failed == 0 {
+			return true
+		}
+		if timedOut {
+			return false
+		}
+		sleep := healthInterval
+		if !deadline.IsZero() && time.Until(deadline) < sleep {
+			sleep = time.Until(deadline)
+		}
+		time.Sleep(sleep)
+	}
+}
+
+type healthResult struct {
+	ok     bool
+	reason string
+	err    error
+}
+
+// verifyDrives marks hosts that passed the health endpoint as still waiting
+// when StorageInfo reports any of their drives in a state other than ok.
+func verifyDrives(hosts []string, results []healthResult) {
+	badDrives, drives, err := driveStatesByHost()
+	if err != nil {
+		for i := range results {
+			if results[i].ok {
+				results[i].ok = false
+				results[i].err = fmt.Errorf("unable to verify drives: %w", err)
+			}
+		}
+		return
+	}
+
+	for i, host := range hosts {
+		if !results[i].ok {
+			continue
+		}
+		if drives[host] == 0 {
+			results[i].ok = false
+			results[i].reason = "no drives reported in storage info"
+		} else if badDrives[host] > 0 {
+			results[i].ok = false
+			results[i].reason = fmt.Sprintf("drives not ok (%d/%d)", badDrives[host], drives[host])
+		}
 	}
 }
 
+// driveStatesByHost returns the number of drives that are not ok and the
+// total number of drives for every server in the cluster.
+func driveStatesByHost() (badDrives map[string]int, drives map[string]int, err error) {
+	pools, _, err := getInfra()
+	if err != nil {
+		return
+	}
+
+	badDrives = make(map[string]int)
+	drives = make(map[string]int)
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					drives[host]++
+					if d.State != "ok" {
+						badDrives[host]++
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// pollHealth pings all hosts concurrently, using at most healthWorkers
+// requests at a time. Results are returned in the same order as hosts.
+func pollHealth(hosts []string) (results []healthResult) {
+	results = make([]healthResult, len(hosts))
+	workers := healthWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+	for i, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, host string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i].ok, results[i].reason, results[i].err = healthPing(host)
+			if results[i].ok && canaryBucket != "" {
+				err := canaryProbe(host)
+				if err != nil {
+					results[i].ok = false
+					results[i].err = err
+				}
+			}
+		}(i, host)
+	}
+	wg.Wait()
+	return
+}
+
 func rebootHostfile() {
 	defer func() {
 		r := recover()
@@ -810,97 +1702,338 @@ func rebootHostfile() {
 		}
 	}()
 
-	hosts, err := os.ReadFile(hostfile)
+	// Validate the hook flags before touching any host.
+	_ = maintenanceHooks()
+	defer printHostFailures()
+
+	hostsList, err := readHostfile(hostfile)
 	if err != nil {
 		panic(err)
 	}
-	hostsList := bytes.Split(hosts, []byte{10})
-	for _, v := range hostsList {
-		if len(v) < 1 {
+	hostsList = filterHosts(hostsList)
+	skipSince, err = parseSince(rebootSince)
+	if err != nil {
+		panic(err)
+	}
+	var l *opLock
+	if !dryRun {
+		l = acquireLock(lockOperation())
+		defer l.release()
+	}
+	handleInterrupts(nil, l)
+	planProgress(hostsList)
+	rebootHosts(hostsList)
+}
+
+// rebootHosts reboots one round of hosts: it waits for the heal backlog if
+// requested, runs the pre-flight checks, reboots every host and puts drained
+// hosts back once they are healthy.
+func rebootHosts(hostsList []string) {
+	defer func() {
+		if interrupted.Load() {
+			stopInterrupted(nil, false)
+		}
+	}()
+	if waitHealBacklog {
+		waitForHealBacklog()
+	}
+	if !runPreflight(hostsList) {
+		return
+	}
+	// An interrupted round still waits for the hosts it rebooted, the
+	// hosts it failed on are reported instead of waited for.
+	hostsList, failed := rebootRound(hostsList)
+	if len(failed) > 0 {
+		fmt.Println("Not waiting for", strings.Join(failed, ", ")+", rebooting them failed")
+		exitCode = 1
+	}
+	// Drained hosts are only put back once they are healthy again, reloaded
+	// hosts were never drained.
+	if !dryRun && !reloadOnly && (len(maintenanceHooks()) > 0 || healBetweenRounds) {
+		if !waitHealthy(hostsList) {
+			fmt.Println("Not every host became healthy within -maxWait, leaving the round drained")
+			exitCode = 1
+			return
+		}
+		enableHosts(hostsList)
+	}
+	verifyReboots(hostsList)
+	if !dryRun && !reloadOnly && healBetweenRounds {
+		healRound(hostsList)
+	}
+}
+
+// readHostfile returns the hosts listed in path, one per line. A path of "-"
+// reads from stdin. Empty lines and lines starting with '#' are skipped so the
+// output of `hostfile -stdout` can be piped straight back in.
+func readHostfile(path string) (hosts []string, err error) {
+	var raw []byte
+	if path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return
+	}
+
+	for _, v := range bytes.Split(raw, []byte{10}) {
+		v = bytes.TrimSpace(v)
+		if len(v) < 1 || v[0] == '#' {
 			continue
 		}
-		rebootServer(string(v))
+		hosts = append(hosts, string(v))
 	}
+	return
 }
 
-func rebootServer(host string) {
-	config := &ssh.ClientConfig{
-		User:            "root",
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+// rebootRound reboots hosts one after the other, waiting -stagger between
+// two of them so restarts do not hit the network all at once. It returns the
+// hosts it rebooted and the hosts it failed on, an interrupt or a degraded
+// cluster stops it early.
+func rebootRound(hosts []string) (done, failed []string) {
+	for i, host := range hosts {
+		if activeMonitor.hold() {
+			fmt.Println("Not rebooting", strings.Join(hosts[i:], ", ")+", the cluster degraded")
+			return
+		}
+		if i > 0 {
+			pause(rebootStagger, "before the next host")
+		}
+		if interrupted.Load() {
+			fmt.Println("Not rebooting", strings.Join(hosts[i:], ", ")+", interrupted")
+			return
+		}
+		if lockLost() {
+			fmt.Println("Not rebooting", strings.Join(hosts[i:], ", ")+",", errLockLost)
+			runStats.failures.Add(1)
+			exitCode = 1
+			return
+		}
+		progressStarted(host)
+		ok := rebootServer(host)
+		progressDone(host)
+		if ok {
+			done = append(done, host)
+		} else {
+			failed = append(failed, host)
+		}
 	}
+	return
+}
 
-	if minioOnly {
-		fmt.Printf("Rebooting(%s) dry(%t) minio(true) server(false)", host, dryRun)
+// pause sleeps for d, dry runs only say they would.
+func pause(d time.Duration, why string) {
+	if d <= 0 {
+		return
+	}
+	if dryRun {
+		fmt.Println("Would wait", d, why)
+		return
+	}
+	fmt.Println("Waiting", d, why)
+	select {
+	case <-time.After(d):
+	case <-interrupt:
+	}
+}
+
+// rebootServer reboots host and returns whether it did. A host it fails on
+// is put back into service when minio was not touched yet, otherwise it is
+// left drained and reported.
+func rebootServer(host string) (ok bool) {
+	var err error
+	sp := startSpan("rebootServer", map[string]string{
+		"host":      host,
+		"dryRun":    strconv.FormatBool(dryRun),
+		"minioOnly": strconv.FormatBool(minioOnly),
+	})
+	skipped, touched := false, false
+	// Only the hooks that drained host are enabled again on a failure.
+	var drained []maintenanceHook
+	defer func() {
+		sp.end(err)
+		touchHost(host)
+		ok = err == nil
+		if err != nil {
+			forgetBootState(host)
+			runStats.failures.Add(1)
+		} else if !dryRun && !skipped {
+			runStats.hostsRebooted.Add(1)
+		}
+		switch {
+		case err == nil || len(drained) == 0:
+		case touched:
+			fmt.Println("Leaving", host, "drained, put it back into service by hand once minio is healthy")
+		default:
+			if eerr := enableHooks(host, drained); eerr != nil {
+				recordHostFailure(host, eerr)
+				fmt.Println("Unable to enable", host, eerr)
+			}
+		}
+	}()
+
+	if reloadOnly {
+		fmt.Printf("Reloading(%s) dry(%t)\n", host, dryRun)
 	} else {
-		fmt.Printf("Rebooting(%s) dry(%t) minio(true) server(true)", host, dryRun)
+		fmt.Printf("Rebooting(%s) dry(%t) minio(true) server(%t)\n", host, dryRun, !minioOnly)
 	}
 
-	con, err := ssh.Dial("tcp", host+":"+port, config)
+	// Make sure the host is reachable before it is drained.
+	_, err = sshClient(host)
 	if err != nil {
 		fmt.Println(err)
+		if powerCycleHost(host, err) {
+			err = nil
+			if !dryRun {
+				fmt.Println("Reboot issued:", host)
+			}
+			return
+		}
+		recordHostFailure(host, err)
 		return
 	}
-	session, err := con.NewSession()
-	if err != nil {
-		fmt.Println(err)
-		return
+
+	// Re-running a round must not reboot the hosts it already got to.
+	if !skipSince.IsZero() && !forceAll {
+		done, reason, serr := rebootedSince(host, skipSince)
+		if serr != nil {
+			fmt.Println("Unable to tell if", host, "already rebooted:", serr)
+		} else if done {
+			fmt.Printf("Skipping %s, %s which is after %s\n", host, reason, skipSince.Format(time.RFC3339))
+			skipped = true
+			return
+		}
 	}
-	defer session.Close()
 
-	var output []byte
-	if dryRun {
-		output, err := session.CombinedOutput("date")
+	// Installing a change does not disturb the running minio, a host it
+	// fails on is not taken out of service.
+	if len(hostChanges) > 0 {
+		err = installChanges(host)
 		if err != nil {
-			fmt.Printf("Command failed @ %s .. err: %v\n", host, err)
-			fmt.Printf("Output: %s\n", output)
+			fmt.Println(host+":", err)
+			recordHostFailure(host, err)
 			return
 		}
-	} else {
-		if minioOnly {
-			output, err = session.CombinedOutput("sudo systemctl restart minio")
-			if err != nil {
-				fmt.Printf("Command failed @ %s .. err: %v\n", host, err)
-				fmt.Printf("Output: %s\n", output)
-				return
-			}
+	}
 
-		} else {
-			output, err = session.CombinedOutput("sudo systemctl stop minio")
-			if err != nil {
-				fmt.Printf("Command failed @ %s .. err: %v\n", host, err)
-				fmt.Printf("Output: %s\n", output)
-				return
-			}
+	// A reload keeps minio serving, the host stays in service.
+	if !dryRun && !reloadOnly {
+		// Hooks drained before the failing one are undone as well.
+		drained, err = drainHost(host)
+		if err != nil {
+			fmt.Println(err)
+			recordHostFailure(host, err)
+			return
+		}
+	}
 
-			output, err = session.CombinedOutput("sudo reboot")
-			if err != nil {
-				fmt.Printf("Command failed @ %s .. err: %v\n", host, err)
-				fmt.Printf("Output: %s\n", output)
-				return
-			}
+	if !dryRun && !reloadOnly && verifyReboot {
+		recordBootState(host)
+	}
+
+	var cmds []string
+	switch {
+	case dryRun:
+		cmds = []string{"date"}
+	case reloadOnly:
+		touched = true
+		err = reloadMinio(host)
+		if err != nil {
+			fmt.Println(host+":", err)
+			recordHostFailure(host, err)
+			return
+		}
+	case minioOnly:
+		cmds = []string{"sudo systemctl restart minio"}
+	default:
+		cmds = []string{"sudo systemctl stop minio", "sudo reboot"}
+	}
+
+	restarted := time.Now()
+	for _, cmd := range cmds {
+		var output []byte
+		touched = true
+		output, err = runSSH(host, cmd)
+		// The connection drops before reboot can report an exit status.
+		var missing *ssh.ExitMissingError
+		if cmd == "sudo reboot" && errors.As(err, &missing) {
+			err = nil
+		}
+		if err != nil {
+			fmt.Printf("Command failed @ %s .. err: %v\n", host, err)
+			fmt.Printf("Output: %s\n", output)
+			recordHostFailure(host, fmt.Errorf("%s: %w", cmd, err))
+			return
+		}
+	}
+	if !dryRun && !minioOnly && !reloadOnly {
+		sshForget(host)
+		fmt.Println("Reboot issued:", host)
+		return
+	}
+	if !dryRun {
+		err = waitUnitActive(host, restarted)
+		if err != nil {
+			fmt.Println(host+":", err)
+			rollbackHost(host, err)
+			recordHostFailure(host, err)
+			return
+		}
+	}
+	if reloadOnly {
+		fmt.Println("Reloaded:", host)
+		return
+	}
+	if !dryRun && verifyReboot {
+		err = verifyMinioRestart(host)
+		if err != nil {
+			fmt.Println(host+":", err)
+			rollbackHost(host, err)
+			recordHostFailure(host, err)
+			return
+		}
+	}
+	if !dryRun && len(hostChanges) > 0 {
+		err = verifyChanges(host)
+		if err != nil {
+			fmt.Println(host+":", err)
+			rollbackHost(host, err)
+			recordHostFailure(host, err)
+			return
 		}
 	}
 
 	fmt.Println("Rebooted:", host)
+	return
 }
 
-func healthPing(endpoint string) (healthy bool, err error) {
+// healthPing returns whether the health endpoint of endpoint answered 200.
+// When it answered something else the status is returned as reason.
+func healthPing(endpoint string) (healthy bool, reason string, err error) {
+	sp := startSpan("healthPing", map[string]string{"host": endpoint})
+	defer func() { sp.end(err) }()
+
 	client := new(http.Client)
 	client.Transport = DefaultTransport(secure)
-	url := "http://" + endpoint + ":" + port + "/minio/health/cluster"
+	client.Timeout = healthTimeout
+	url := "http://" + endpoint + ":" + port + healthPath
 	if secure {
-		url = "https://" + endpoint + ":" + port + "/minio/health/cluster"
+		url = "https://" + endpoint + ":" + port + healthPath
+	}
+	if healthMaintenance {
+		url += "?maintenance=true"
 	}
-	resp, rerr := client.Get(url + "?maintenance=true")
+	resp, rerr := client.Get(url)
 	if rerr != nil {
 		err = rerr
 		return
 	}
+	resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return false, nil
+		return false, "HTTP " + resp.Status, nil
 	}
 
-	return true, nil
+	return true, "", nil
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// verifyMinisign checks a minisign signature of message against the base64
+// encoded minisign public key. Both legacy ("Ed") and pre-hashed ("ED")
+// signatures are supported, and the trusted comment is verified as well.
+func verifyMinisign(publicKey string, message []byte, signature []byte) (err error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lastLine(publicKey)))
+	if err != nil {
+		return fmt.Errorf("invalid minisign public key: %w", err)
+	}
+	if len(key) != 42 || string(key[:2]) != "Ed" {
+		return errors.New("invalid minisign public key")
+	}
+	keyID, pub := key[2:10], ed25519.PublicKey(key[10:])
+
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return errors.New("invalid minisign signature: expected 4 lines")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 74 {
+		return errors.New("invalid minisign signature")
+	}
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return errors.New("invalid minisign signature: missing trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature: bad global signature")
+	}
+
+	if !bytes.Equal(sig[2:10], keyID) {
+		return errors.New("minisign signature was made with a different key")
+	}
+
+	signed := message
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		h := blake2b.Sum512(message)
+		signed = h[:]
+	default:
+		return errors.New("unsupported minisign signature algorithm")
+	}
+
+	if !ed25519.Verify(pub, signed, sig[10:]) {
+		return errors.New("minisign signature verification failed")
+	}
+	if !ed25519.Verify(pub, append(append([]byte{}, sig[10:]...), trustedComment...), globalSig) {
+		return errors.New("minisign trusted comment verification failed")
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of s, which lets public keys be
+// passed with or without their "untrusted comment" line.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
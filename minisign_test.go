@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The files in testdata/minisign were signed with throwaway keys, the
+// signatures are in the format minisign -S writes.
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "minisign", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	binary := readTestdata(t, "cluster-tool")
+	key := string(readTestdata(t, "minisign.pub"))
+	sig := readTestdata(t, "cluster-tool.minisig")
+
+	tampered := append([]byte{}, binary...)
+	tampered[len(tampered)-2] ^= 1
+
+	// The other key claiming the key id of the signing key.
+	other, err := base64.StdEncoding.DecodeString(lastLine(string(readTestdata(t, "other.pub"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := base64.StdEncoding.DecodeString(lastLine(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(other[2:10], signer[2:10])
+	impostor := base64.StdEncoding.EncodeToString(other)
+
+	tests := []struct {
+		name    string
+		key     string
+		message []byte
+		sig     []byte
+		wantErr bool
+	}{
+		{name: "prehashed signature", key: key, message: binary, sig: sig},
+		{name: "legacy signature", key: key, message: binary, sig: readTestdata(t, "cluster-tool.legacy.minisig")},
+		{name: "key without its comment", key: lastLine(key), message: binary, sig: sig},
+		{name: "tampered binary", key: key, message: tampered, sig: sig, wantErr: true},
+		{name: "truncated binary", key: key, message: binary[:len(binary)-1], sig: sig, wantErr: true},
+		{name: "wrong key", key: string(readTestdata(t, "other.pub")), message: binary, sig: sig, wantErr: true},
+		{name: "wrong key with the same key id", key: impostor, message: binary, sig: sig, wantErr: true},
+		{
+			name:    "tampered trusted comment",
+			key:     key,
+			message: binary,
+			sig:     []byte(strings.Replace(string(sig), "file:cluster-tool", "file:other-tool", 1)),
+			wantErr: true,
+		},
+		{name: "not a key", key: "bm90IGEga2V5", message: binary, sig: sig, wantErr: true},
+		{name: "not a signature", key: key, message: binary, sig: []byte("untrusted comment: nothing\n"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyMinisign(tt.key, tt.message, tt.sig)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got error %v, want one %t", err, tt.wantErr)
+			}
+		})
+	}
+}
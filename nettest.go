@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netNode is a server as seen by nettest: SSH is the host to log in to and
+// Addr the host:port other servers connect to.
+type netNode struct {
+	SSH  string
+	Addr string
+}
+
+// netProbe is the result of one node connecting to another.
+type netProbe struct {
+	From    string
+	To      string
+	OK      bool
+	Connect time.Duration
+	Error   string `json:",omitempty"`
+}
+
+// netReport is the -json output of nettest from -schemaVersion 2 on, version
+// 1 prints the Connect matrix alone.
+type netReport struct {
+	Connect [][]netProbe
+	MTU     [][]mtuProbe `json:",omitempty"`
+}
+
+// netNodes returns the servers from -hostfile, or every server of the cluster.
+func netNodes() (nodes []netNode) {
+	if hostfile != "" {
+		hosts, err := readHostfile(hostfile)
+		if err != nil {
+			panic(err)
+		}
+		for _, h := range hosts {
+			nodes = append(nodes, netNode{SSH: h, Addr: net.JoinHostPort(h, port)})
+		}
+		return
+	}
+
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	info, err := clusterServerInfo()
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range info.Servers {
+		host, _, err := net.SplitHostPort(s.Endpoint)
+		if err != nil {
+			host = s.Endpoint
+		}
+		nodes = append(nodes, netNode{SSH: host, Addr: s.Endpoint})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Addr < nodes[j].Addr })
+	return
+}
+
+// probePeers connects from node to every peer on its MinIO port using the
+// bash /dev/tcp device, so nothing has to be installed on the servers.
+func probePeers(from netNode, peers []netNode) (probes []netProbe) {
+	var script strings.Builder
+	for _, p := range peers {
+		host, port, err := net.SplitHostPort(p.Addr)
+		if err != nil {
+			host, port = p.Addr, "9000"
+		}
+		fmt.Fprintf(&script, `s=$(date +%%s%%N); if timeout %.3f bash -c '</dev/tcp/%s/%s' 2>/dev/null; then r=ok; else r=fail; fi; e=$(date +%%s%%N); echo "%s $r $((e-s))"; `,
+			netTimeout.Seconds(), host, port, p.Addr)
+	}
+
+	results := make(map[string]netProbe)
+	out, err := runSSH(from.SSH, "bash -c "+shellQuote(script.String()))
+	if err != nil {
+		for _, p := range peers {
+			results[p.Addr] = netProbe{From: from.Addr, To: p.Addr, Error: "ssh: " + err.Error()}
+		}
+	} else {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			f := strings.Fields(line)
+			if len(f) != 3 {
+				continue
+			}
+			ns, _ := strconv.ParseInt(f[2], 10, 64)
+			probe := netProbe{From: from.Addr, To: f[0], OK: f[1] == "ok", Connect: time.Duration(ns)}
+			if !probe.OK {
+				probe.Error = "connect failed"
+			}
+			results[f[0]] = probe
+		}
+	}
+
+	for _, p := range peers {
+		probe, ok := results[p.Addr]
+		if !ok {
+			probe = netProbe{From: from.Addr, To: p.Addr, Error: "no result"}
+		}
+		probes = append(probes, probe)
+	}
+	return
+}
+
+// mtuProbe is the interface MTU From uses to reach To and whether a ping of
+// that size with the don't-fragment flag got through.
+type mtuProbe struct {
+	From      string
+	To        string
+	Interface string
+	MTU       int
+	OK        bool
+	Error     string `json:",omitempty"`
+}
+
+// probeMTU pings every peer from node with a payload filling the MTU of the
+// interface the route to the peer uses, fragmentation prohibited.
+func probeMTU(from netNode, peers []netNode) (probes []mtuProbe) {
+	var script strings.Builder
+	for _, p := range peers {
+		host, _, err := net.SplitHostPort(p.Addr)
+		if err != nil {
+			host = p.Addr
+		}
+		fmt.Fprintf(&script, `ip=$(getent ahostsv4 %s | awk 'NR==1{print $1}'); dev=$(ip -o route get "$ip" 2>/dev/null | sed -n 's/.* dev \([^ ]*\).*/\1/p'); mtu=$(cat /sys/class/net/$dev/mtu 2>/dev/null || echo 0); size=$((mtu-28)); [ $size -gt 65507 ] && size=65507; if ! command -v ping >/dev/null; then r=noping; elif [ $size -gt 0 ] && ping -c 1 -W 2 -M do -s $size "$ip" >/dev/null 2>&1; then r=ok; else r=fail; fi; echo "%s ${dev:-none} $mtu $r"; `,
+			host, p.Addr)
+	}
+
+	results := make(map[string]mtuProbe)
+	out, err := runSSH(from.SSH, "bash -c "+shellQuote(script.String()))
+	if err != nil {
+		for _, p := range peers {
+			results[p.Addr] = mtuProbe{From: from.Addr, To: p.Addr, Error: "ssh: " + err.Error()}
+		}
+	} else {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			f := strings.Fields(line)
+			if len(f) != 4 {
+				continue
+			}
+			mtu, _ := strconv.Atoi(f[2])
+			probe := mtuProbe{From: from.Addr, To: f[0], Interface: f[1], MTU: mtu, OK: f[3] == "ok"}
+			switch {
+			case f[3] == "noping":
+				probe.Error = "ping is not installed"
+			case f[1] == "none":
+				probe.Error = "no route"
+			case !probe.OK:
+				probe.Error = fmt.Sprintf("%d byte ping with DF set did not get through", mtu)
+			}
+			results[f[0]] = probe
+		}
+	}
+
+	for _, p := range peers {
+		probe, ok := results[p.Addr]
+		if !ok {
+			probe = mtuProbe{From: from.Addr, To: p.Addr, Error: "no result"}
+		}
+		probes = append(probes, probe)
+	}
+	return
+}
+
+// mtuProblems reports failed probes and pairs of servers that use a
+// different MTU towards each other.
+func mtuProblems(nodes []netNode, matrix [][]mtuProbe) (problems []string) {
+	for i := range nodes {
+		for j := range nodes {
+			p := matrix[i][j]
+			if !p.OK {
+				problems = append(problems, fmt.Sprintf("%s -> %s: %s", p.From, p.To, p.Error))
+			}
+			if j > i {
+				back := matrix[j][i]
+				if p.MTU != back.MTU && p.Error == "" && back.Error == "" {
+					problems = append(problems, fmt.Sprintf("asymmetric MTU: %s uses %d (%s) towards %s, which uses %d (%s) back",
+						p.From, p.MTU, p.Interface, p.To, back.MTU, back.Interface))
+				}
+			}
+		}
+	}
+	return
+}
+
+func nettest() {
+	nodes := netNodes()
+	if len(nodes) == 0 {
+		fmt.Println("No servers to test")
+		return
+	}
+
+	matrix := make([][]netProbe, len(nodes))
+	workers := hostWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+	for i, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n netNode) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			matrix[i] = probePeers(n, nodes)
+		}(i, n)
+	}
+	wg.Wait()
+
+	var mtuMatrix [][]mtuProbe
+	var mtuIssues []string
+	if testMTU {
+		mtuMatrix = make([][]mtuProbe, len(nodes))
+		for i, n := range nodes {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, n netNode) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				mtuMatrix[i] = probeMTU(n, nodes)
+			}(i, n)
+		}
+		wg.Wait()
+		mtuIssues = mtuProblems(nodes, mtuMatrix)
+	}
+
+	var failures []netProbe
+	for _, row := range matrix {
+		for _, p := range row {
+			if !p.OK {
+				failures = append(failures, p)
+			}
+		}
+	}
+	if len(failures) > 0 || len(mtuIssues) > 0 {
+		exitCode = 1
+	}
+
+	if jsonOutput {
+		// Version 1 consumers expect the bare connect matrix.
+		if outputSchemaVersion < 2 {
+			jsonOut(matrix)
+		} else {
+			jsonOut(netReport{matrix, mtuMatrix})
+		}
+		return
+	}
+	defer printMTU(nodes, mtuMatrix, mtuIssues)
+
+	// Columns are numbered, the legend maps numbers to servers.
+	for i, n := range nodes {
+		fmt.Printf("%3d  %s\n", i+1, n.Addr)
+	}
+	fmt.Println()
+
+	cell := 3
+	if showRTT {
+		cell = 8
+	}
+	fmt.Printf("%-8s", "from\\to")
+	for i := range nodes {
+		fmt.Printf("%*d", cell, i+1)
+	}
+	fmt.Println()
+	for i, row := range matrix {
+		fmt.Printf("%-8d", i+1)
+		for _, p := range row {
+			v := "."
+			switch {
+			case !p.OK:
+				v = "X"
+			case showRTT:
+				v = fmt.Sprintf("%.1fms", float64(p.Connect)/float64(time.Millisecond))
+			}
+			fmt.Printf("%*s", cell, v)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println()
+	if len(failures) == 0 {
+		fmt.Printf("All %d connections succeeded\n", len(nodes)*len(nodes))
+		return
+	}
+	fmt.Printf("%d of %d connections failed:\n", len(failures), len(nodes)*len(nodes))
+	for _, p := range failures {
+		fmt.Printf("  %s -> %s: %s\n", p.From, p.To, p.Error)
+	}
+}
+
+func printMTU(nodes []netNode, matrix [][]mtuProbe, problems []string) {
+	if matrix == nil {
+		return
+	}
+	fmt.Println()
+	fmt.Println("MTU towards each server, X marks DF pings that did not get through:")
+	fmt.Printf("%-8s", "from\\to")
+	for i := range nodes {
+		fmt.Printf("%8d", i+1)
+	}
+	fmt.Println()
+	for i, row := range matrix {
+		fmt.Printf("%-8d", i+1)
+		for _, p := range row {
+			v := strconv.Itoa(p.MTU)
+			if !p.OK {
+				v += "X"
+			}
+			fmt.Printf("%8s", v)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	if len(problems) == 0 {
+		fmt.Println("MTU is consistent and full-size packets get through")
+		return
+	}
+	for _, p := range problems {
+		fmt.Println(" ", p)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// notifyTargets asks one server for the state of its notification targets,
+// by type:id. Every server connects to the targets on its own, the server
+// info only reports the targets of the server that answers it.
+func notifyTargets(n netNode) (map[string]string, error) {
+	client, err := adminAs(n.Addr, miniokey, miniosecret)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), netTimeout)
+	defer cancel()
+	info, err := client.ServerInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, byType := range info.Services.Notifications {
+		for typ, list := range byType {
+			for _, ids := range list {
+				for id, status := range ids {
+					targets[typ+":"+id] = status.Status
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+// checkNotifyTargets reports every notification target on every server.
+// A target loaded on some servers but not on others failed to initialize
+// where it is missing, those servers neither queue nor send its events.
+func checkNotifyTargets(nodes []netNode) []hostReport {
+	reports := make([]hostReport, len(nodes))
+	targets := make([]map[string]string, len(nodes))
+	errs := make([]error, len(nodes))
+	sem := make(chan struct{}, max(hostWorkers, 1))
+	wg := new(sync.WaitGroup)
+	for i, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n netNode) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			targets[i], errs[i] = notifyTargets(n)
+		}(i, n)
+	}
+	wg.Wait()
+
+	all := make(map[string]bool)
+	for _, t := range targets {
+		for id := range t {
+			all[id] = true
+		}
+	}
+	names := stringKeysSorted(all)
+
+	for i, n := range nodes {
+		r := hostReport{Host: n.Addr}
+		if err := errs[i]; err != nil {
+			r.Results = append(r.Results, newResult("admin", checkFail, err.Error(), "Check that the server is up and the credentials are valid"))
+			reports[i] = r
+			continue
+		}
+		if len(names) == 0 {
+			r.Results = append(r.Results, newResult("notify", checkPass, "no notification targets configured", ""))
+		}
+		for _, id := range names {
+			status, ok := targets[i][id]
+			switch {
+			case !ok:
+				r.Results = append(r.Results, newResult(id, checkFail, "not loaded on this server, its events are dropped here",
+					"Look for the target's initialization error in the server log, then restart the server"))
+			case strings.EqualFold(status, string(madmin.ItemOnline)):
+				r.Results = append(r.Results, newResult(id, checkPass, "online", ""))
+			default:
+				r.Results = append(r.Results, newResult(id, checkFail, "unreachable, events are queued or dropped",
+					"Check that the server can connect to the target and that the target accepts its credentials"))
+			}
+		}
+		reports[i] = r
+	}
+	return reports
+}
+
+func notifyCheck() {
+	if hostfile != "" && port == "" {
+		panic("-port is required with -hostfile")
+	}
+	nodes := netNodes()
+	if len(nodes) == 0 {
+		fmt.Println("No servers to check")
+		return
+	}
+	printHostReports(checkNotifyTargets(nodes))
+}
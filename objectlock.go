@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectLockBucket is the object lock setup of a bucket. LegalHolds and
+// Retained count object versions, they are only set with -scan.
+type objectLockBucket struct {
+	Bucket        string
+	Mode          string `json:",omitempty"`
+	RetentionDays int    `json:",omitempty"`
+	Retention     string `json:",omitempty"`
+	Scanned       bool
+	Versions      uint64
+	LegalHolds    uint64
+	Retained      uint64
+	Findings      []string `json:",omitempty"`
+}
+
+// retentionDays converts a default retention to days, a year counts as 365.
+func retentionDays(validity uint, unit minio.ValidityUnit) int {
+	if unit == minio.Years {
+		return int(validity) * 365
+	}
+	return int(validity)
+}
+
+// scanObjectLock counts the object versions of a bucket under legal hold and
+// under retention. MinIO lists the lock headers with the object metadata, so
+// no object has to be queried on its own.
+func scanObjectLock(ctx context.Context, s3 *minio.Client, b *objectLockBucket) error {
+	now := time.Now()
+	for obj := range s3.ListObjects(ctx, b.Bucket, minio.ListObjectsOptions{Recursive: true, WithVersions: true, WithMetadata: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if obj.IsDeleteMarker {
+			continue
+		}
+		b.Versions++
+		meta := func(name string) string {
+			for k, v := range obj.UserMetadata {
+				if strings.EqualFold(k, name) {
+					return v
+				}
+			}
+			return ""
+		}
+		if strings.EqualFold(meta("X-Amz-Object-Lock-Legal-Hold"), "ON") {
+			b.LegalHolds++
+		}
+		if until, err := time.Parse(time.RFC3339, meta("X-Amz-Object-Lock-Retain-Until-Date")); err == nil && until.After(now) {
+			b.Retained++
+		}
+	}
+	b.Scanned = true
+	return nil
+}
+
+func auditObjectLock() (buckets []objectLockBucket, err error) {
+	ctx := context.Background()
+	s3, err := s3Client(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s3.ListBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets: %w", err)
+	}
+	for _, lb := range list {
+		enabled, mode, validity, unit, lerr := s3.GetObjectLockConfig(ctx, lb.Name)
+		if lerr != nil {
+			if minio.ToErrorResponse(lerr).Code != "ObjectLockConfigurationNotFoundError" {
+				fmt.Fprintln(statusOut(), "Unable to read the object lock configuration of", lb.Name+":", lerr)
+			}
+			continue
+		}
+		if enabled != "Enabled" {
+			continue
+		}
+		b := objectLockBucket{Bucket: lb.Name}
+		if mode != nil && validity != nil && unit != nil {
+			b.Mode = string(*mode)
+			b.RetentionDays = retentionDays(*validity, *unit)
+			b.Retention = fmt.Sprintf("%d %s", *validity, strings.ToLower(string(*unit)))
+		}
+		if b.Mode == string(minio.Governance) && b.RetentionDays >= lockLongRetention {
+			b.Findings = append(b.Findings, fmt.Sprintf("governance retention of %s, anyone allowed to bypass governance can still delete", b.Retention))
+		}
+		if b.Mode == "" {
+			b.Findings = append(b.Findings, "no default retention, only explicitly locked objects are protected")
+		}
+		if lockScan {
+			if err := scanObjectLock(ctx, s3, &b); err != nil {
+				fmt.Fprintln(statusOut(), "Unable to list the objects of", lb.Name+":", err)
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+func objectLockAudit() {
+	buckets, err := auditObjectLock()
+	if err != nil {
+		panic(err)
+	}
+	if jsonOutput {
+		jsonOut(buckets)
+		return
+	}
+	if len(buckets) == 0 {
+		fmt.Println("No buckets with object lock enabled")
+		return
+	}
+	width := len("BUCKET")
+	for _, b := range buckets {
+		width = max(width, len(b.Bucket))
+	}
+	fmt.Printf("%-*s  %-11s  %-10s  %-10s  %-11s  %-10s  %s\n", width, "BUCKET", "MODE", "RETENTION", "VERSIONS", "LEGAL HOLD", "RETAINED", "FINDINGS")
+	for _, b := range buckets {
+		mode, retention := b.Mode, b.Retention
+		if mode == "" {
+			mode, retention = "-", "-"
+		}
+		versions, holds, retained := "-", "-", "-"
+		if b.Scanned {
+			versions, holds, retained = fmt.Sprint(b.Versions), fmt.Sprint(b.LegalHolds), fmt.Sprint(b.Retained)
+		}
+		line := fmt.Sprintf("%-*s  %-11s  %-10s  %-10s  %-11s  %-10s  %s", width, b.Bucket, mode, retention, versions, holds, retained, strings.Join(b.Findings, ", "))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
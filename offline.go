@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// offlineServers returns the servers ServerInfo reports as not online, by
+// hostname. A server that is down entirely has no drives in StorageInfo on
+// some releases and would otherwise vanish from the topology. Looking up
+// servers is best effort, without it only the drives of StorageInfo are
+// known.
+func offlineServers() map[string]madmin.ServerProperties {
+	var info madmin.InfoMessage
+	var err error
+	if os.Getenv("SERVER_INFO_FILE_REPLACEMENT") != "" {
+		var bb []byte
+		bb, err = os.ReadFile(os.Getenv("SERVER_INFO_FILE_REPLACEMENT"))
+		if err == nil {
+			err = json.Unmarshal(bb, &info)
+		}
+	} else if os.Getenv("INFRA_FILE_REPLACEMENT") != "" {
+		// A storage info file is not necessarily from a reachable
+		// cluster.
+		return nil
+	} else {
+		info, err = worstServerInfo()
+	}
+	if err != nil {
+		fmt.Fprintln(statusOut(), "Unable to look up offline servers:", err)
+		return nil
+	}
+
+	offline := make(map[string]madmin.ServerProperties)
+	for _, s := range info.Servers {
+		if s.State == string(madmin.ItemOnline) {
+			continue
+		}
+		offline[serverHostname(s.Endpoint)] = s
+	}
+	return offline
+}
+
+// serverHostname strips the port and scheme from a ServerInfo endpoint.
+func serverHostname(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		return host
+	}
+	return endpoint
+}
+
+// offlineDisks returns the drives ServerInfo lists for offline servers that
+// are missing from StorageInfo, marked offline.
+func offlineDisks(known []madmin.Disk, offline map[string]madmin.ServerProperties) (disks []madmin.Disk) {
+	seen := make(map[string]bool, len(known))
+	for _, d := range known {
+		seen[d.Endpoint] = true
+	}
+	for _, host := range stringKeysSorted(offline) {
+		for _, d := range offline[host].Disks {
+			if d.Endpoint == "" || seen[d.Endpoint] {
+				continue
+			}
+			seen[d.Endpoint] = true
+			if d.State == "" || d.State == madmin.DriveStateOk {
+				d.State = madmin.DriveStateOffline
+			}
+			disks = append(disks, d)
+		}
+	}
+	return
+}
+
+// markOffline flags the offline servers in pools. Servers without a single
+// drive known are added to the pool ServerInfo places them in, so they are
+// still reported.
+func markOffline(pools map[string]*Pool, offline map[string]madmin.ServerProperties) (added int) {
+	for _, host := range stringKeysSorted(offline) {
+		found := false
+		for _, p := range pools {
+			if s, ok := p.Servers[host]; ok {
+				s.Offline = true
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		props := offline[host]
+		poolNumbers := props.PoolNumbers
+		if len(poolNumbers) == 0 && props.PoolNumber > 0 {
+			poolNumbers = []int{props.PoolNumber}
+		}
+		if len(poolNumbers) == 0 {
+			fmt.Fprintln(statusOut(), "Server", host, "is offline and not part of a known pool")
+			continue
+		}
+		for _, n := range poolNumbers {
+			pid := strconv.Itoa(n)
+			if pools[pid] == nil {
+				pools[pid] = &Pool{Servers: make(map[string]*Server)}
+			}
+			pools[pid].Servers[host] = &Server{
+				Sets:     make(map[int]*Set),
+				Endpoint: host,
+				Offline:  true,
+			}
+			added++
+		}
+	}
+	return
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The ClusterMaintenance custom resource declares a rolling restart, heal or
+// upgrade of the MinIO cluster. 'operator' reconciles them from inside the
+// Kubernetes cluster, one at a time in creation order, and reports progress
+// in their status.
+const (
+	operatorGroup    = "clustertool.zveinn.github.io"
+	operatorVersion  = "v1alpha1"
+	operatorResource = "clustermaintenances"
+)
+
+// Maintenance operations and phases.
+const (
+	opRollingRestart = "RollingRestart"
+	opHeal           = "Heal"
+	opUpgrade        = "Upgrade"
+
+	phasePending   = "Pending"
+	phaseRunning   = "Running"
+	phaseSucceeded = "Succeeded"
+	phaseFailed    = "Failed"
+)
+
+var (
+	operatorNamespace string
+	operatorKubeAPI   string
+	operatorResync    time.Duration
+	operatorWorkDir   string
+	operatorImage     string
+	operatorSecret    string
+	operatorSSHSecret string
+)
+
+type clusterMaintenance struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name              string    `json:"name"`
+		Namespace         string    `json:"namespace"`
+		UID               string    `json:"uid"`
+		Generation        int64     `json:"generation"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Spec   maintenanceSpec   `json:"spec"`
+	Status maintenanceStatus `json:"status"`
+}
+
+type maintenanceSpec struct {
+	Operation    string   `json:"operation"`
+	DryRun       *bool    `json:"dryRun,omitempty"`
+	MinioOnly    *bool    `json:"minioOnly,omitempty"`
+	Window       string   `json:"window,omitempty"`
+	Timezone     string   `json:"timezone,omitempty"`
+	Canary       int      `json:"canary,omitempty"`
+	MaxPerRound  int      `json:"maxPerRound,omitempty"`
+	ExcludeHosts []string `json:"excludeHosts,omitempty"`
+	HealPriority string   `json:"healPriority,omitempty"`
+	UpdateURL    string   `json:"updateURL,omitempty"`
+	Args         []string `json:"args,omitempty"`
+}
+
+type maintenanceStatus struct {
+	Phase              string            `json:"phase,omitempty"`
+	Message            string            `json:"message,omitempty"`
+	JobID              string            `json:"jobID,omitempty"`
+	Progress           string            `json:"progress,omitempty"`
+	Steps              []maintenanceStep `json:"steps,omitempty"`
+	StartTime          *time.Time        `json:"startTime,omitempty"`
+	CompletionTime     *time.Time        `json:"completionTime,omitempty"`
+	ObservedGeneration int64             `json:"observedGeneration,omitempty"`
+}
+
+type maintenanceStep struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+func (cm *clusterMaintenance) key() string {
+	return cm.Metadata.Namespace + "/" + cm.Metadata.Name
+}
+
+// dryRun defaults to true like the -dryRun flags of the commands.
+func (s maintenanceSpec) dryRun() bool {
+	return s.DryRun == nil || *s.DryRun
+}
+
+// minioOnly defaults to true like -minioOnly, a spec without it does not
+// reboot hosts.
+func (s maintenanceSpec) minioOnly() bool {
+	return s.MinioOnly == nil || *s.MinioOnly
+}
+
+// kubeClient talks to the Kubernetes API with the service account of the
+// pod, or through -kubeAPI, e.g. a 'kubectl proxy' at http://127.0.0.1:8001.
+type kubeClient struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+func newKubeClient() (k *kubeClient, err error) {
+	if operatorKubeAPI != "" {
+		return &kubeClient{base: strings.TrimSuffix(operatorKubeAPI, "/"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod, use -kubeAPI")
+	}
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s/ca.crt", serviceAccountDir)
+	}
+	return &kubeClient{
+		base:  "https://" + host + ":" + port,
+		token: strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (k *kubeClient) do(method string, path string, contentType string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, k.base+path, body)
+	if err != nil {
+		return err
+	}
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+func maintenancePath(namespace string) string {
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", operatorGroup, operatorVersion, namespace, operatorResource)
+}
+
+func (k *kubeClient) listMaintenances(namespace string) (items []*clusterMaintenance, err error) {
+	var list struct {
+		Items []*clusterMaintenance `json:"items"`
+	}
+	err = k.do(http.MethodGet, maintenancePath(namespace), "", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i].Metadata, list.Items[j].Metadata
+		if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return list.Items, nil
+}
+
+// updateStatus replaces the status of cm through the status subresource.
+func (k *kubeClient) updateStatus(cm *clusterMaintenance) error {
+	path := maintenancePath(cm.Metadata.Namespace) + "/" + cm.Metadata.Name + "/status"
+	return k.do(http.MethodPatch, path, "application/merge-patch+json", map[string]any{"status": cm.Status}, nil)
+}
+
+// maintenanceRun is the operation the operator is running.
+type maintenanceRun struct {
+	key        string
+	uid        string
+	generation int64
+	dir        string
+	cmd        *exec.Cmd
+	done       chan error
+	// message is set by runs that do not record a job, like Upgrade.
+	message string
+}
+
+type operatorState struct {
+	kube    *kubeClient
+	running *maintenanceRun
+}
+
+func operator() {
+	if operatorNamespace == "" {
+		b, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			panic("no -namespace given and not running in a Kubernetes pod")
+		}
+		operatorNamespace = strings.TrimSpace(string(b))
+	}
+	kube, err := newKubeClient()
+	if err != nil {
+		panic(err)
+	}
+	err = os.MkdirAll(operatorWorkDir, 0o700)
+	if err != nil {
+		panic(err)
+	}
+
+	o := &operatorState{kube: kube}
+	fmt.Println("Reconciling", operatorResource+"."+operatorGroup, "in namespace", operatorNamespace, "every", operatorResync)
+	t := time.NewTicker(operatorResync)
+	defer t.Stop()
+	for {
+		o.reconcile()
+		var done chan error
+		if o.running != nil {
+			done = o.running.done
+		}
+		select {
+		case <-t.C:
+		case err := <-done:
+			o.finish(err)
+		}
+	}
+}
+
+func (o *operatorState) reconcile() {
+	items, err := o.kube.listMaintenances(operatorNamespace)
+	if err != nil {
+		fmt.Println("Unable to list", operatorResource+":", err)
+		return
+	}
+
+	for _, cm := range items {
+		switch {
+		case o.running != nil && o.running.uid == cm.Metadata.UID:
+			o.report(cm)
+		case cm.Status.ObservedGeneration == cm.Metadata.Generation &&
+			(cm.Status.Phase == phaseSucceeded || cm.Status.Phase == phaseFailed):
+		case o.running != nil:
+			if cm.Status.Phase != phasePending {
+				cm.Status.Phase = phasePending
+				cm.Status.Message = "waiting for " + o.running.key
+				o.setStatus(cm)
+			}
+		default:
+			o.start(cm)
+		}
+	}
+
+	// A resource deleted while it runs stops its operation like Ctrl-C.
+	found := false
+	for _, cm := range items {
+		found = found || o.running != nil && o.running.uid == cm.Metadata.UID
+	}
+	if o.running != nil && !found && o.running.cmd != nil {
+		fmt.Println(o.running.key, "was deleted, interrupting its operation")
+		_ = o.running.cmd.Process.Signal(os.Interrupt)
+	}
+}
+
+func (o *operatorState) setStatus(cm *clusterMaintenance) {
+	err := o.kube.updateStatus(cm)
+	if err != nil {
+		fmt.Println("Unable to update the status of", cm.key()+":", err)
+	}
+}
+
+// start runs the operation of cm. A resource that is Running without a run
+// of this process was interrupted by a restart of the operator, its job is
+// resumed.
+func (o *operatorState) start(cm *clusterMaintenance) {
+	run := &maintenanceRun{
+		key:        cm.key(),
+		uid:        cm.Metadata.UID,
+		generation: cm.Metadata.Generation,
+		dir:        filepath.Join(operatorWorkDir, cm.Metadata.Namespace, cm.Metadata.Name),
+		done:       make(chan error, 1),
+	}
+	resume := ""
+	if cm.Status.Phase == phaseRunning && cm.Status.ObservedGeneration == cm.Metadata.Generation {
+		resume = cm.Status.JobID
+	}
+	if resume == "" {
+		_ = os.RemoveAll(run.dir)
+	}
+	err := os.MkdirAll(run.dir, 0o700)
+	if err == nil {
+		err = o.launch(run, cm.Spec, resume)
+	}
+
+	now := time.Now().UTC()
+	cm.Status.ObservedGeneration = cm.Metadata.Generation
+	cm.Status.CompletionTime = nil
+	if resume == "" {
+		cm.Status.StartTime = &now
+		cm.Status.JobID = ""
+		cm.Status.Progress = ""
+		cm.Status.Steps = nil
+	}
+	if err != nil {
+		cm.Status.Phase = phaseFailed
+		cm.Status.Message = err.Error()
+		cm.Status.CompletionTime = &now
+		o.setStatus(cm)
+		return
+	}
+	cm.Status.Phase = phaseRunning
+	cm.Status.Message = cm.Spec.Operation + " started"
+	if resume != "" {
+		cm.Status.Message = "resumed job " + resume + " after an operator restart"
+	}
+	fmt.Println(cm.key()+":", cm.Status.Message)
+	o.running = run
+	o.setStatus(cm)
+}
+
+// commonArgs are the flags of the operator passed on to the commands it
+// runs. Credentials are passed in the environment, so they do not end up in
+// job files.
+func commonArgs() []string {
+	args := []string{
+		"-endpoint", endpoint,
+		"-port", port,
+		"-secure=" + strconv.FormatBool(secure),
+		"-safetyMargin", strconv.Itoa(safetyMargin),
+		"-sshUser", sshUser,
+		"-sshPort", sshPort,
+	}
+	if sshKey != "" {
+		args = append(args, "-sshKey", sshKey)
+	}
+	return args
+}
+
+func (o *operatorState) launch(run *maintenanceRun, spec maintenanceSpec, resume string) error {
+	jobs := filepath.Join(run.dir, "jobs")
+	rounds := filepath.Join(run.dir, "rounds")
+	var filter []string
+	if len(spec.ExcludeHosts) > 0 {
+		filter = []string{"-excludeHosts", strings.Join(spec.ExcludeHosts, ",")}
+	}
+
+	var steps [][]string
+	switch spec.Operation {
+	case opRollingRestart:
+		if resume == "" {
+			hostfile := []string{"hostfile", "-folder", rounds}
+			if spec.MaxPerRound > 0 {
+				hostfile = append(hostfile, "-maxPerRound", strconv.Itoa(spec.MaxPerRound))
+			}
+			steps = append(steps, append(append(hostfile, filter...), commonArgs()...))
+		}
+		rollout := []string{"rollout", "-folder", rounds, "-jobsDir", jobs,
+			"-dryRun=" + strconv.FormatBool(spec.dryRun()),
+			"-minioOnly=" + strconv.FormatBool(spec.minioOnly()),
+			"-checkpoint", filepath.Join(run.dir, "checkpoint.json"),
+		}
+		if spec.Window != "" {
+			rollout = append(rollout, "-window", spec.Window)
+		}
+		if spec.Timezone != "" {
+			rollout = append(rollout, "-timezone", spec.Timezone)
+		}
+		if spec.Canary > 0 {
+			rollout = append(rollout, "-canary", strconv.Itoa(spec.Canary))
+		}
+		if resume != "" {
+			rollout = append(rollout, "-resume", resume)
+		}
+		rollout = append(append(rollout, filter...), commonArgs()...)
+		steps = append(steps, append(rollout, spec.Args...))
+	case opHeal:
+		heal := []string{"heal", "-jobsDir", jobs,
+			"-dryRun=" + strconv.FormatBool(spec.dryRun()),
+			"-healTokens", filepath.Join(run.dir, "heal-tokens.json"),
+			"-checkpoint", filepath.Join(run.dir, "checkpoint.json"),
+		}
+		if spec.HealPriority != "" {
+			heal = append(heal, "-priority", spec.HealPriority)
+		}
+		if resume != "" {
+			heal = append(heal, "-resume", resume)
+		}
+		heal = append(heal, commonArgs()...)
+		steps = append(steps, append(heal, spec.Args...))
+	case opUpgrade:
+		go func() { run.done <- upgradeServers(run, spec) }()
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q, expected %s, %s or %s", spec.Operation, opRollingRestart, opHeal, opUpgrade)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	started := make(chan error, 1)
+	go func() {
+		for i, args := range steps {
+			cmd := exec.Command(exe, args...)
+			cmd.Env = append(os.Environ(), "CLUSTER_TOOL_KEY="+miniokey, "CLUSTER_TOOL_SECRET="+miniosecret)
+			out := &prefixWriter{prefix: "[" + run.key + "] "}
+			cmd.Stdout, cmd.Stderr = out, out
+			err := cmd.Start()
+			if i == len(steps)-1 {
+				run.cmd = cmd
+				started <- err
+			}
+			if err == nil {
+				err = cmd.Wait()
+			}
+			if err != nil {
+				if i < len(steps)-1 {
+					started <- fmt.Errorf("%s: %w", args[0], err)
+					return
+				}
+				run.done <- fmt.Errorf("%s: %w", args[0], err)
+				return
+			}
+		}
+		run.done <- nil
+	}()
+	return <-started
+}
+
+// upgradeServers verifies the release and updates every server through
+// MinIO's own update API, the servers restart together.
+func upgradeServers(run *maintenanceRun, spec maintenanceSpec) error {
+	sumsURL := spec.UpdateURL
+	if sumsURL == "" {
+		sumsURL = releaseSumsURL("", "", "")
+	}
+	r, err := verifyRelease(sumsURL, "")
+	if err != nil {
+		return err
+	}
+	updated, err := updateServers(r, spec.dryRun())
+	run.message = r.Name + " sha256 " + r.SHA256 + ": " + strings.Join(updated, ", ")
+	if spec.dryRun() {
+		run.message = "dry run: " + run.message
+	}
+	return err
+}
+
+// jobOf returns the newest job recorded for run.
+func jobOf(run *maintenanceRun) *job {
+	matches, _ := filepath.Glob(filepath.Join(run.dir, "jobs", "*.json"))
+	var newest *job
+	for _, m := range matches {
+		b, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		j := new(job)
+		if json.Unmarshal(b, j) == nil && (newest == nil || j.Created.After(newest.Created)) {
+			newest = j
+		}
+	}
+	return newest
+}
+
+// report copies the progress of the running job into the status of cm.
+func (o *operatorState) report(cm *clusterMaintenance) {
+	j := jobOf(o.running)
+	if j == nil {
+		return
+	}
+	cm.Status.Phase = phaseRunning
+	cm.Status.JobID = j.ID
+	cm.Status.Progress = jobProgress(j)
+	cm.Status.Steps = nil
+	for _, s := range j.Steps {
+		cm.Status.Steps = append(cm.Status.Steps, maintenanceStep{Name: s.Name, State: s.State, Error: s.Error})
+	}
+	if len(j.Steps) > 0 {
+		last := j.Steps[len(j.Steps)-1]
+		cm.Status.Message = last.Name + " " + last.State
+	}
+	o.setStatus(cm)
+}
+
+// finish records the outcome of the run in the status of its resource.
+func (o *operatorState) finish(runErr error) {
+	run := o.running
+	o.running = nil
+
+	items, err := o.kube.listMaintenances(operatorNamespace)
+	if err != nil {
+		fmt.Println("Unable to list", operatorResource+":", err)
+		return
+	}
+	for _, cm := range items {
+		if cm.Metadata.UID != run.uid {
+			continue
+		}
+		now := time.Now().UTC()
+		cm.Status.CompletionTime = &now
+		cm.Status.ObservedGeneration = run.generation
+		cm.Status.Phase = phaseSucceeded
+		cm.Status.Message = run.message
+		if j := jobOf(run); j != nil {
+			cm.Status.JobID = j.ID
+			cm.Status.Progress = jobProgress(j)
+			cm.Status.Steps = nil
+			for _, s := range j.Steps {
+				cm.Status.Steps = append(cm.Status.Steps, maintenanceStep{Name: s.Name, State: s.State, Error: s.Error})
+			}
+			cm.Status.Message = "job " + j.State
+			if j.Error != "" {
+				cm.Status.Message += ": " + j.Error
+			}
+			if j.State != jobDone {
+				cm.Status.Phase = phaseFailed
+			}
+		}
+		if runErr != nil {
+			cm.Status.Phase = phaseFailed
+			cm.Status.Message = strings.TrimPrefix(cm.Status.Message+", ", ", ") + runErr.Error()
+		}
+		fmt.Println(cm.key()+":", cm.Status.Phase, cm.Status.Message)
+		o.setStatus(cm)
+	}
+}
+
+// prefixWriter prints every line written to it to stdout with a prefix.
+type prefixWriter struct {
+	prefix  string
+	partial []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Println(p.prefix + string(p.partial[:i]))
+		p.partial = p.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+// operatorManifests is printed by 'operator manifests': the CRD, the RBAC
+// the operator needs in its namespace and a Deployment running it.
+const operatorManifests = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Resource}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  names:
+    kind: ClusterMaintenance
+    listKind: ClusterMaintenanceList
+    plural: {{.Resource}}
+    singular: clustermaintenance
+    shortNames: [cmaint]
+  scope: Namespaced
+  versions:
+  - name: {{.Version}}
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - {name: Operation, type: string, jsonPath: .spec.operation}
+    - {name: Phase, type: string, jsonPath: .status.phase}
+    - {name: Progress, type: string, jsonPath: .status.progress}
+    - {name: Age, type: date, jsonPath: .metadata.creationTimestamp}
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [operation]
+            properties:
+              operation: {type: string, enum: [RollingRestart, Heal, Upgrade]}
+              dryRun: {type: boolean, default: true, description: "Like -dryRun, set to false to touch the cluster"}
+              minioOnly: {type: boolean, default: true, description: "RollingRestart restarts the minio service instead of rebooting hosts, set to false to reboot them"}
+              window: {type: string, description: "Daily maintenance window for RollingRestart rounds, e.g. 22:00-06:00"}
+              timezone: {type: string, description: "Timezone of window, e.g. Europe/Berlin"}
+              canary: {type: integer, minimum: 0, description: "Hosts rebooted and verified before the other rounds"}
+              maxPerRound: {type: integer, minimum: 0}
+              excludeHosts: {type: array, items: {type: string}, description: "Host globs or /regexes/ never touched"}
+              healPriority: {type: string, enum: [risk, usage, id]}
+              updateURL: {type: string, description: "Checksum file URL of the release to upgrade to, e.g. .../linux-amd64/minio.RELEASE.2024-01-01T00-00-00Z.sha256sum, defaults to the latest release"}
+              args: {type: array, items: {type: string}, description: "More flags for the rollout or heal command"}
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cluster-tool
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: cluster-tool
+  namespace: {{.Namespace}}
+rules:
+- apiGroups: [{{.Group}}]
+  resources: [{{.Resource}}]
+  verbs: [get, list, watch]
+- apiGroups: [{{.Group}}]
+  resources: [{{.Resource}}/status]
+  verbs: [get, patch, update]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: cluster-tool
+  namespace: {{.Namespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: cluster-tool
+subjects:
+- kind: ServiceAccount
+  name: cluster-tool
+  namespace: {{.Namespace}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cluster-tool-operator
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels: {app: cluster-tool-operator}
+  template:
+    metadata:
+      labels: {app: cluster-tool-operator}
+    spec:
+      serviceAccountName: cluster-tool
+      containers:
+      - name: operator
+        image: {{.Image}}
+        args: [operator, -endpoint, {{.Endpoint}}, -port, "{{.Port}}", -secure={{.Secure}}, -workDir, /var/lib/cluster-tool, -sshKey, /etc/cluster-tool/ssh/ssh-privatekey]
+        env:
+        - name: CLUSTER_TOOL_KEY
+          valueFrom: {secretKeyRef: {name: {{.Secret}}, key: accessKey}}
+        - name: CLUSTER_TOOL_SECRET
+          valueFrom: {secretKeyRef: {name: {{.Secret}}, key: secretKey}}
+        volumeMounts:
+        - {name: work, mountPath: /var/lib/cluster-tool}
+        - {name: ssh, mountPath: /etc/cluster-tool/ssh, readOnly: true}
+      volumes:
+      # A kubernetes.io/ssh-auth secret with the key the hosts accept for
+      # -sshUser.
+      - name: ssh
+        secret: {secretName: {{.SSHSecret}}, defaultMode: 0400}
+      # Use a PersistentVolumeClaim so running jobs resume after the pod
+      # is rescheduled.
+      - name: work
+        emptyDir: {}
+`
+
+func operatorManifestsCmd() {
+	ns := operatorNamespace
+	if ns == "" {
+		ns = "default"
+	}
+	t := template.Must(template.New("manifests").Parse(operatorManifests))
+	err := t.Execute(os.Stdout, map[string]any{
+		"Group":     operatorGroup,
+		"Version":   operatorVersion,
+		"Resource":  operatorResource,
+		"Namespace": ns,
+		"Image":     operatorImage,
+		"Secret":    operatorSecret,
+		"SSHSecret": operatorSSHSecret,
+		"Endpoint":  endpoint,
+		"Port":      port,
+		"Secure":    secure,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/dustin/go-humanize"
+)
+
+// outputTemplate renders the JSON output of a command when -output is
+// go-template or go-template-file. Like kubectl the template runs on the
+// decoded JSON, so its data model is the one -schema -schemaVersion 1
+// documents and field names are the JSON ones.
+var outputTemplate *template.Template
+
+var outputFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": func(sep string, v []any) string {
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = fmt.Sprint(e)
+		}
+		return strings.Join(parts, sep)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// bytes formats a size in bytes, like 1.5 TiB.
+	"bytes": func(v json.Number) (string, error) {
+		n, err := strconv.ParseUint(v.String(), 10, 64)
+		return humanize.IBytes(n), err
+	},
+}
+
+// parseOutput parses -output: json, go-template=TEMPLATE or
+// go-template-file=PATH.
+func parseOutput(s string) error {
+	kind, arg, _ := strings.Cut(s, "=")
+	switch kind {
+	case "json":
+		return nil
+	case "go-template":
+	case "go-template-file":
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		arg = string(b)
+	default:
+		return fmt.Errorf("invalid -output %q, expected json, go-template=TEMPLATE or go-template-file=PATH", s)
+	}
+	if arg == "" {
+		return fmt.Errorf("-output %s needs a template", kind)
+	}
+	t, err := template.New("output").Funcs(outputFuncs).Option("missingkey=zero").Parse(arg)
+	if err != nil {
+		return err
+	}
+	outputTemplate = t
+	return nil
+}
+
+// renderTemplate prints data through -output's template.
+func renderTemplate(data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Sizes and counts stay integers instead of becoming floats.
+	dec.UseNumber()
+	var v any
+	err = dec.Decode(&v)
+	if err != nil {
+		panic(err)
+	}
+	err = outputTemplate.Execute(os.Stdout, v)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// drivePhysical are the physical identifiers of a drive, the ones RMA
+// tickets and technicians at the rack need.
+type drivePhysical struct {
+	Disk      string `json:",omitempty"`
+	Serial    string `json:",omitempty"`
+	WWN       string `json:",omitempty"`
+	Enclosure string `json:",omitempty"`
+	Slot      string `json:",omitempty"`
+}
+
+// physicalScript resolves a device to its whole disk and prints the disk,
+// its serial, WWN and SAS address, and the SES enclosure slot from sysfs
+// when there is one.
+const physicalScript = `d=$(readlink -f %s); p=$(lsblk -no PKNAME "$d" 2>/dev/null | head -n1); [ -n "$p" ] && d=/dev/$p
+n=${d#/dev/}
+echo "disk=$d"
+echo "serial=$(lsblk -dno SERIAL "$d" 2>/dev/null | head -n1)"
+echo "wwn=$(lsblk -dno WWN "$d" 2>/dev/null | head -n1)"
+echo "sas=$(cat /sys/block/$n/device/sas_address 2>/dev/null)"
+e=$(ls -d /sys/block/$n/device/enclosure_device:* 2>/dev/null | head -n1)
+[ -n "$e" ] && echo "enclosure=$(basename "$(dirname "$(readlink -f "$e")")")" && echo "slot=${e##*enclosure_device:}"
+true`
+
+// sesEnclosuresScript lists the SCSI generic devices of enclosures, SCSI
+// peripheral type 13.
+const sesEnclosuresScript = `for g in /sys/class/scsi_generic/*; do [ "$(cat $g/device/type 2>/dev/null)" = 13 ] && echo /dev/${g##*/}; done; true`
+
+// driveDevice returns the device holding path, from the mounts or, for
+// drives that are no longer mounted, from fstab.
+func driveDevice(h *hostData, path string) (dev string, err error) {
+	mounts, err := hostMounts(h)
+	if err != nil {
+		return "", err
+	}
+	if mp := mountPointOf(path, mounts); mp != "" && mp != "/" {
+		return mounts[mp].Device, nil
+	}
+	fstab, err := hostFstab(h)
+	if err != nil {
+		return "", err
+	}
+	mp := fstabMountFor(path, fstab)
+	if mp == "" {
+		return "", fmt.Errorf("%s is neither mounted nor in fstab", path)
+	}
+	return fstabDevicePath(fstab[mp].Device), nil
+}
+
+// physicalInfo returns the physical identifiers of the drive holding path.
+// lsblk answers for most drives, smartctl fills in the serial and WWN behind
+// controllers lsblk can not see through and sg_ses the slot for enclosures
+// the kernel has no ses driver bound for.
+func physicalInfo(h *hostData, path string) (p drivePhysical, err error) {
+	dev, err := driveDevice(h, path)
+	if err != nil {
+		return p, err
+	}
+	out, err := h.run(fmt.Sprintf(physicalScript, shellQuote(dev)))
+	if err != nil {
+		return p, err
+	}
+	sas := ""
+	for _, line := range strings.Split(out, "\n") {
+		k, v, _ := strings.Cut(line, "=")
+		switch k {
+		case "disk":
+			p.Disk = v
+		case "serial":
+			p.Serial = v
+		case "wwn":
+			p.WWN = v
+		case "sas":
+			sas = v
+		case "enclosure":
+			p.Enclosure = v
+		case "slot":
+			p.Slot = v
+		}
+	}
+
+	if p.Serial == "" || p.WWN == "" {
+		out, err := h.run("sudo smartctl -i " + shellQuote(p.Disk) + " 2>/dev/null")
+		if err == nil || out != "" {
+			serial, wwn := smartctlIdentity(out)
+			if p.Serial == "" {
+				p.Serial = serial
+			}
+			if p.WWN == "" {
+				p.WWN = wwn
+			}
+		}
+	}
+	if p.Slot == "" && sas != "" {
+		p.Enclosure, p.Slot = sesSlot(h, sas)
+	}
+	return p, nil
+}
+
+// smartctlIdentity reads the serial and WWN from smartctl -i, which prints
+// them as "Serial Number:" and "LU WWN Device Id: 5 000c50 0a1b2c3d" for ATA
+// drives and "Serial number:" and "Logical Unit id: 0x5000..." for SAS ones.
+func smartctlIdentity(out string) (serial string, wwn string) {
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "serial number":
+			serial = v
+		case "lu wwn device id":
+			wwn = "0x" + strings.ReplaceAll(v, " ", "")
+		case "logical unit id":
+			wwn = v
+		}
+	}
+	return
+}
+
+// sesSlot finds the slot of the drive with the SAS address sas in the
+// additional element status page of the enclosures on the host.
+func sesSlot(h *hostData, sas string) (enclosure string, slot string) {
+	out, err := h.run(sesEnclosuresScript)
+	if err != nil {
+		return "", ""
+	}
+	for _, sg := range strings.Fields(out) {
+		page, err := h.run("sudo sg_ses -p aes " + shellQuote(sg) + " 2>/dev/null")
+		if err != nil {
+			continue
+		}
+		current := ""
+		for _, line := range strings.Split(page, "\n") {
+			line = strings.TrimSpace(line)
+			if _, v, ok := strings.Cut(line, "device slot number:"); ok {
+				current = strings.TrimSpace(v)
+				continue
+			}
+			if v, ok := strings.CutPrefix(line, "SAS address:"); ok && current != "" && strings.EqualFold(strings.TrimSpace(v), sas) {
+				return sg, "Slot " + current
+			}
+		}
+	}
+	return "", ""
+}
+
+// drivesPhysical maps the drives of every host to their physical
+// identifiers, keyed by host:path. Drives that can not be mapped are left
+// out.
+func drivesPhysical(pools map[string]*Pool, badOnly bool) (info map[string]drivePhysical) {
+	var drives []badDrive
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if badOnly && !d.isBad() {
+						continue
+					}
+					drives = append(drives, badDrive{Host: host, Path: d.Path, State: d.State})
+				}
+			}
+		}
+	}
+	info = make(map[string]drivePhysical)
+	lock := new(sync.Mutex)
+	forEachHost(drives, func(h *hostData, d badDrive) {
+		p, err := physicalInfo(h, d.Path)
+		if err != nil {
+			return
+		}
+		lock.Lock()
+		info[d.Host+":"+d.Path] = p
+		lock.Unlock()
+	})
+	return
+}
+
+func physicalHeader() string {
+	return fmt.Sprintf(" %-10s %-20s %-20s %s", "DEVICE", "SERIAL", "WWN", "SLOT")
+}
+
+func physicalLine(p drivePhysical) string {
+	slot := "-"
+	if p.Slot != "" {
+		slot = strings.TrimSpace(p.Enclosure + " " + p.Slot)
+	}
+	return fmt.Sprintf(" %-10s %-20s %-20s %s", orDash(p.Disk), orDash(p.Serial), orDash(p.WWN), slot)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// builtinPolicies ship with MinIO and cannot be changed, they are not
+// linted.
+var builtinPolicies = map[string]bool{
+	"consoleAdmin": true,
+	"diagnostics":  true,
+	"readonly":     true,
+	"readwrite":    true,
+	"writeonly":    true,
+}
+
+// policyReport holds the lint results of one policy.
+type policyReport struct {
+	Policy  string
+	Users   []string `json:",omitempty"`
+	Groups  []string `json:",omitempty"`
+	Results []checkResult
+}
+
+// canonicalPolicy is the policy with its lists sorted, two policies that
+// allow the same written differently compare equal.
+func canonicalPolicy(p policyDocument) string {
+	for i := range p.Statement {
+		s := &p.Statement[i]
+		for _, l := range []stringOrList{s.Action, s.NotAction, s.Resource, s.NotResource} {
+			sort.Strings(l)
+		}
+		s.Sid = ""
+	}
+	sort.Slice(p.Statement, func(i, j int) bool {
+		a, _ := json.Marshal(p.Statement[i])
+		b, _ := json.Marshal(p.Statement[j])
+		return string(a) < string(b)
+	})
+	p.Version = ""
+	b, _ := json.Marshal(p.Statement)
+	return string(b)
+}
+
+// lintStatements flags statements that allow everything on everything,
+// that allow wildcard actions without any condition, and allows written
+// with NotAction or NotResource, which grant whatever is not listed.
+func lintStatements(p policyDocument) (r []checkResult) {
+	for i, s := range p.Statement {
+		if !s.allows() {
+			continue
+		}
+		name := fmt.Sprintf("statement %d", i+1)
+		if s.Sid != "" {
+			name = fmt.Sprintf("statement %q", s.Sid)
+		}
+		if s.allResources() && s.Action.has("*", "s3:*") {
+			r = append(r, newResult("wildcard", checkFail, name+" allows s3:* on every bucket",
+				"Limit the actions and the buckets to what the users of the policy need"))
+			continue
+		}
+		if len(s.NotAction) > 0 || len(s.NotResource) > 0 {
+			r = append(r, newResult("not", checkWarn, name+" allows with NotAction or NotResource, which grants everything not listed",
+				"List the allowed actions and resources instead"))
+		}
+		var wild []string
+		for _, a := range s.Action {
+			if strings.Contains(a, "*") {
+				wild = append(wild, a)
+			}
+		}
+		if len(wild) > 0 && len(s.Condition) == 0 {
+			r = append(r, newResult("condition", checkWarn, fmt.Sprintf("%s allows %s on %s without conditions", name, strings.Join(wild, ","), strings.Join(s.Resource, ",")),
+				"Restrict wildcard actions with conditions like aws:SourceIp or s3:prefix"))
+		}
+	}
+	return
+}
+
+// policyAttachments returns the users and groups every policy is attached
+// to, for the built-in identity provider and LDAP.
+func policyAttachments(ctx context.Context, names []string) (users, groups map[string][]string, err error) {
+	users, groups = make(map[string][]string), make(map[string][]string)
+	res, err := mclient.GetPolicyEntities(ctx, madmin.PolicyEntitiesQuery{Policy: names})
+	if err != nil {
+		return nil, nil, err
+	}
+	mappings := res.PolicyMappings
+	if ldap, lerr := mclient.GetLDAPPolicyEntities(ctx, madmin.PolicyEntitiesQuery{Policy: names}); lerr == nil {
+		mappings = append(mappings, ldap.PolicyMappings...)
+	}
+	for _, m := range mappings {
+		users[m.Policy] = append(users[m.Policy], m.Users...)
+		groups[m.Policy] = append(groups[m.Policy], m.Groups...)
+	}
+	return users, groups, nil
+}
+
+// lintPolicies lints every policy that is not built in. attachments is
+// false when the server did not tell which users and groups they belong to.
+func lintPolicies() (reports []policyReport, attachments bool, err error) {
+	ctx := context.Background()
+	err = makeClient()
+	if err != nil {
+		return nil, false, err
+	}
+	raw, err := mclient.ListCannedPolicies(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("listing policies: %w", err)
+	}
+	var names []string
+	for _, name := range stringKeysSorted(raw) {
+		if !builtinPolicies[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, false, nil
+	}
+	users, groups, aerr := policyAttachments(ctx, names)
+	attachments = aerr == nil
+	if aerr != nil {
+		fmt.Fprintln(statusOut(), "Unable to read policy attachments, not checking them:", aerr)
+	}
+
+	canonical := make(map[string][]string)
+	for _, name := range names {
+		r := policyReport{Policy: name, Users: users[name], Groups: groups[name]}
+		p, perr := parsePolicy(raw[name])
+		if perr != nil {
+			r.Results = append(r.Results, newResult("parse", checkFail, perr.Error(), ""))
+			reports = append(reports, r)
+			continue
+		}
+		r.Results = append(r.Results, lintStatements(p)...)
+		if attachments && len(r.Users) == 0 && len(r.Groups) == 0 {
+			r.Results = append(r.Results, newResult("attached", checkWarn, "not attached to any user or group",
+				"Remove it, unless OpenID claims or service accounts refer to it by name"))
+		}
+		c := canonicalPolicy(p)
+		canonical[c] = append(canonical[c], name)
+		reports = append(reports, r)
+	}
+
+	for i, r := range reports {
+		for _, same := range canonical {
+			if len(same) < 2 || !slices.Contains(same, r.Policy) {
+				continue
+			}
+			var others []string
+			for _, o := range same {
+				if o != r.Policy {
+					others = append(others, o)
+				}
+			}
+			reports[i].Results = append(reports[i].Results, newResult("duplicate", checkWarn, "allows the same as "+strings.Join(others, ", "),
+				"Attach one of them and remove the others"))
+		}
+		if len(reports[i].Results) == 0 {
+			reports[i].Results = []checkResult{newResult("lint", checkPass, "no findings", "")}
+		}
+	}
+	return reports, attachments, nil
+}
+
+func policyLint() {
+	reports, attachments, err := lintPolicies()
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range reports {
+		for _, res := range r.Results {
+			if res.Status == checkFail {
+				exitCode = 1
+			}
+		}
+	}
+	if jsonOutput {
+		jsonOut(reports)
+		return
+	}
+	if len(reports) == 0 {
+		fmt.Println("No policies besides the built-in ones")
+		return
+	}
+	for _, r := range reports {
+		attached := "attached to nothing"
+		switch {
+		case !attachments:
+			attached = "attachments unknown"
+		case len(r.Users)+len(r.Groups) > 0:
+			attached = fmt.Sprintf("%d users, %d groups", len(r.Users), len(r.Groups))
+		}
+		fmt.Printf("%s (%s)\n", r.Policy, attached)
+		for _, res := range r.Results {
+			fmt.Printf("  %-5s %-10s %s\n", strings.ToUpper(res.Status), res.Check, res.Message)
+			if res.Hint != "" && res.Status != checkPass {
+				fmt.Printf("  %-5s %-10s -> %s\n", "", "", res.Hint)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// portCheck is the result of connecting to one port of a server.
+type portCheck struct {
+	Host    string
+	Port    string
+	Service string
+	OK      bool
+	Connect time.Duration
+	Error   string `json:",omitempty"`
+}
+
+// portsReport groups the checks from the operator host and, with -nodes,
+// the failed connections between servers.
+type portsReport struct {
+	Local []portCheck
+	Nodes []netProbe `json:",omitempty"`
+}
+
+// dialReason turns a dial error into something an operator can act on, the
+// difference between refused and timed out is the difference between a
+// stopped service and a firewall dropping packets.
+func dialReason(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns: " + dnsErr.Err
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused, nothing is listening or a firewall rejects it"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "no route to host"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timed out, most likely filtered by a firewall"
+	}
+	return err.Error()
+}
+
+func checkPort(host, port, service string) (c portCheck) {
+	c = portCheck{Host: host, Port: port, Service: service}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), netTimeout)
+	c.Connect = time.Since(start)
+	if err != nil {
+		c.Error = dialReason(err)
+		return
+	}
+	conn.Close()
+	c.OK = true
+	return
+}
+
+// portServices are the ports every server has to expose, in column order.
+func portServices() [][2]string {
+	return [][2]string{
+		{"s3", port},
+		{"console", consolePort},
+		{"ssh", sshPort},
+	}
+}
+
+func portsAudit() {
+	nodes := netNodes()
+	if len(nodes) == 0 {
+		fmt.Println("No servers to check")
+		return
+	}
+	services := portServices()
+
+	workers := hostWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	wg := new(sync.WaitGroup)
+
+	checks := make([][]portCheck, len(nodes))
+	for i, n := range nodes {
+		checks[i] = make([]portCheck, len(services))
+		for j, s := range services {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i, j int, host string, s [2]string) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				checks[i][j] = checkPort(host, s[1], s[0])
+			}(i, j, n.SSH, s)
+		}
+	}
+	wg.Wait()
+
+	var report portsReport
+	failed := false
+	for _, row := range checks {
+		for _, c := range row {
+			report.Local = append(report.Local, c)
+			if !c.OK {
+				failed = true
+			}
+		}
+	}
+
+	if checkNodes {
+		var peers []netNode
+		for _, n := range nodes {
+			for _, s := range services[:2] {
+				peers = append(peers, netNode{SSH: n.SSH, Addr: net.JoinHostPort(n.SSH, s[1])})
+			}
+		}
+		results := make([][]netProbe, len(nodes))
+		for i, n := range nodes {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, n netNode) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				results[i] = probePeers(netNode{SSH: n.SSH, Addr: n.SSH}, peers)
+			}(i, n)
+		}
+		wg.Wait()
+		for _, row := range results {
+			for _, p := range row {
+				if !p.OK {
+					report.Nodes = append(report.Nodes, p)
+					failed = true
+				}
+			}
+		}
+	}
+
+	if failed {
+		exitCode = 1
+	}
+
+	if jsonOutput {
+		jsonOut(report)
+		return
+	}
+
+	line := fmt.Sprintf("%-30s", "host")
+	for _, s := range services {
+		line += fmt.Sprintf(" %-14s", s[0]+"("+s[1]+")")
+	}
+	fmt.Println(strings.TrimRight(line, " "))
+	for i, row := range checks {
+		line = fmt.Sprintf("%-30s", nodes[i].SSH)
+		for _, c := range row {
+			v := "FAIL"
+			if c.OK {
+				v = fmt.Sprintf("ok %s", c.Connect.Round(time.Millisecond/10))
+			}
+			line += fmt.Sprintf(" %-14s", v)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	var errs []string
+	for _, row := range checks {
+		for _, c := range row {
+			if !c.OK {
+				errs = append(errs, fmt.Sprintf("%s %s port %s: %s", c.Host, c.Service, c.Port, c.Error))
+			}
+		}
+	}
+	for _, p := range report.Nodes {
+		errs = append(errs, fmt.Sprintf("%s -> %s: %s", p.From, p.To, p.Error))
+	}
+
+	fmt.Println()
+	if len(errs) == 0 {
+		if checkNodes {
+			fmt.Println("All ports are reachable from here and between servers")
+		} else {
+			fmt.Println("All ports are reachable from here")
+		}
+		return
+	}
+	fmt.Println(strings.Join(errs, "\n"))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// preflightChecks verifies that rebooting hosts at the same time is safe:
+// every host belongs to the cluster, no erasure set loses read quorum and no
+// heal, rebalance or decommission is running. With -bmcFile the BMCs are asked
+// about failed hardware too.
+func preflightChecks(hosts []string) (results []checkResult) {
+	pools, _, err := getInfra()
+	if err != nil {
+		return []checkResult{newResult("cluster", checkFail, err.Error(), "Verify -endpoint, -port and credentials")}
+	}
+
+	results = append(results, checkHostsInCluster(pools, hosts)...)
+	results = append(results, checkReadQuorum(pools, hosts)...)
+	results = append(results, checkRootDisksPreflight(pools, hosts)...)
+	results = append(results, checkBackgroundOperations()...)
+	results = append(results, checkHardware(hosts)...)
+	return
+}
+
+func checkHostsInCluster(pools map[string]*Pool, hosts []string) (r []checkResult) {
+	known := make(map[string]bool)
+	for _, p := range pools {
+		for host := range p.Servers {
+			known[host] = true
+		}
+	}
+	var unknown []string
+	for _, h := range hosts {
+		if !known[h] {
+			unknown = append(unknown, h)
+		}
+	}
+	if len(unknown) > 0 {
+		return []checkResult{newResult("membership", checkFail,
+			"not part of the connected cluster: "+strings.Join(unknown, ", "),
+			"Check that the hostfile was generated for this cluster")}
+	}
+	return []checkResult{newResult("membership", checkPass, fmt.Sprintf("all %d hosts belong to the cluster", len(hosts)), "")}
+}
+
+// checkReadQuorum fails when taking all hosts offline at once leaves any set
+// with more unavailable drives than its parity.
+func checkReadQuorum(pools map[string]*Pool, hosts []string) (r []checkResult) {
+	rebooting := make(map[string]bool)
+	for _, h := range hosts {
+		rebooting[h] = true
+	}
+
+	type setState struct {
+		parity      int
+		unavailable int
+		drives      int
+	}
+	sets := make(map[string]*setState)
+	for pid, p := range pools {
+		for host, s := range p.Servers {
+			for _, set := range s.Sets {
+				key := pid + "/" + fmt.Sprint(set.ID)
+				st, ok := sets[key]
+				if !ok {
+					st = &setState{parity: set.SCParity}
+					sets[key] = st
+				}
+				for _, d := range set.Disks {
+					st.drives++
+					if rebootBad(d.State, d.Healing) || rebooting[host] {
+						st.unavailable++
+					}
+				}
+			}
+		}
+	}
+
+	var broken []string
+	for key, st := range sets {
+		if st.unavailable > st.parity {
+			broken = append(broken, fmt.Sprintf("set %s would have %d/%d drives offline with parity %d", key, st.unavailable, st.drives, st.parity))
+		}
+	}
+	if len(broken) > 0 {
+		sort.Strings(broken)
+		return []checkResult{newResult("quorum", checkFail, strings.Join(broken, "; "),
+			"Regenerate the hostfile or repair bad drives first")}
+	}
+	return []checkResult{newResult("quorum", checkPass, "all sets keep read quorum", "")}
+}
+
+func checkBackgroundOperations() (r []checkResult) {
+	ctx := context.Background()
+
+	heal, err := mclient.BackgroundHealStatus(ctx)
+	if err != nil {
+		r = append(r, newResult("heal", checkFail, err.Error(), ""))
+	} else if len(heal.HealDisks) > healBacklogMax {
+		r = append(r, newResult("heal", checkFail, fmt.Sprintf("%d drives are healing", len(heal.HealDisks)),
+			"Wait for healing to finish, see -waitHealBacklog"))
+	} else if n := len(heal.HealDisks); n > 0 {
+		r = append(r, newResult("heal", checkPass, fmt.Sprintf("%d drives healing, within -healBacklogMax %d", n, healBacklogMax), ""))
+	} else {
+		r = append(r, newResult("heal", checkPass, "no drives are healing", ""))
+	}
+
+	// Clusters with a single pool can not rebalance and return an error.
+	rebalancing := false
+	rs, err := mclient.RebalanceStatus(ctx)
+	if err == nil && rs.StoppedAt.IsZero() {
+		for _, p := range rs.Pools {
+			if p.Status == "Started" || p.Status == "Active" {
+				rebalancing = true
+			}
+		}
+	}
+	if rebalancing {
+		r = append(r, newResult("rebalance", checkFail, "a rebalance is in progress", "Wait for it to finish or stop it"))
+	} else {
+		r = append(r, newResult("rebalance", checkPass, "no rebalance in progress", ""))
+	}
+
+	pools, err := mclient.ListPoolsStatus(ctx)
+	if err != nil {
+		r = append(r, newResult("decommission", checkFail, err.Error(), ""))
+		return
+	}
+	var decom []string
+	for _, p := range pools {
+		d := p.Decommission
+		if d != nil && !d.StartTime.IsZero() && !d.Complete && !d.Failed && !d.Canceled {
+			decom = append(decom, p.CmdLine)
+		}
+	}
+	if len(decom) > 0 {
+		r = append(r, newResult("decommission", checkFail, "decommission in progress: "+strings.Join(decom, ", "),
+			"Wait for the decommission to finish"))
+	} else {
+		r = append(r, newResult("decommission", checkPass, "no decommission in progress", ""))
+	}
+	return
+}
+
+// runPreflight prints the pre-flight results for hosts and reports whether
+// the reboot may proceed. Failures block it unless -force is set, dry runs
+// only report.
+func runPreflight(hosts []string) (ok bool) {
+	results := preflightChecks(hosts)
+
+	failed := false
+	for _, r := range results {
+		if r.Status == checkFail {
+			failed = true
+		}
+		fmt.Printf("Pre-flight %-5s %-12s %s\n", strings.ToUpper(r.Status), r.Check, r.Message)
+	}
+
+	switch {
+	case !failed:
+		return true
+	case dryRun:
+		fmt.Println("Pre-flight checks failed, continuing because this is a dry run")
+		return true
+	case forceReboot:
+		fmt.Println("Pre-flight checks failed, continuing because -force is set")
+		return true
+	}
+	fmt.Println("Pre-flight checks failed, use -force to reboot anyway")
+	exitCode = 1
+	return false
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// provisionData is what the env file and unit templates are rendered with.
+type provisionData struct {
+	Host         string
+	User         string
+	Binary       string
+	EnvFile      string
+	Volumes      string
+	Opts         string
+	RootUser     string
+	RootPassword string
+	// Drives are the mount points of the data drives, in label order.
+	Drives []string
+}
+
+const minioUnitPath = "/etc/systemd/system/minio.service"
+
+// defaultUnitTemplate is the unit MinIO ships for bare metal installs.
+const defaultUnitTemplate = `[Unit]
+Description=MinIO
+Documentation=https://min.io/docs/minio/linux/index.html
+Wants=network-online.target
+After=network-online.target
+AssertFileIsExecutable={{.Binary}}
+
+[Service]
+WorkingDirectory=/usr/local
+User={{.User}}
+Group={{.User}}
+ProtectProc=invisible
+EnvironmentFile=-{{.EnvFile}}
+ExecStartPre=/bin/bash -c "if [ -z \"${MINIO_VOLUMES}\" ]; then echo \"Variable MINIO_VOLUMES not set in {{.EnvFile}}\"; exit 1; fi"
+ExecStart={{.Binary}} server $MINIO_OPTS $MINIO_VOLUMES
+Restart=always
+LimitNOFILE=1048576
+TasksMax=infinity
+TimeoutStopSec=infinity
+SendSIGKILL=no
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const defaultEnvTemplate = `# Written by cluster-tool provision for {{.Host}}
+MINIO_VOLUMES="{{.Volumes}}"
+MINIO_OPTS="{{.Opts}}"
+{{- if .RootUser}}
+MINIO_ROOT_USER={{.RootUser}}
+MINIO_ROOT_PASSWORD={{.RootPassword}}
+{{- end}}
+`
+
+// provisionTemplate parses the template in file, or def without one.
+func provisionTemplate(name, file, def string) *template.Template {
+	text := def
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		text = string(b)
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", name, err))
+	}
+	return t
+}
+
+// provisionChecks validate a provisioned host, on top of the host checks
+// that apply before MinIO runs.
+var provisionChecks = []hostCheck{
+	{"mounts", checkHostMounts},
+	{"fstab", checkHostFstab},
+	{"limits", checkHostLimits},
+	{"provision", checkProvisioned},
+}
+
+// provisionTargets returns the hosts given as arguments or in -hostfile.
+func provisionTargets() (hosts []string) {
+	hosts = cmdArgs
+	if hostfile != "" {
+		more, err := readHostfile(hostfile)
+		if err != nil {
+			panic(err)
+		}
+		hosts = append(hosts, more...)
+	}
+	if len(hosts) == 0 {
+		panic("expected hosts to provision, as arguments or in -hostfile")
+	}
+	return
+}
+
+func provision() {
+	if provisionVolumes == "" {
+		panic("-volumes is required, e.g. https://node{5...8}.example.net:9000/mnt/drive{1...4}")
+	}
+	if strings.Trim(provisionDrives, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/_-.:[]*?,") != "" {
+		panic("invalid -drives " + provisionDrives + ", expected comma separated device paths or globs")
+	}
+	envTemplate := provisionTemplate("env", provisionEnvTemplate, defaultEnvTemplate)
+	unitTemplate := provisionTemplate("unit", provisionUnitTemplate, defaultUnitTemplate)
+	if upgradeBinary != "" {
+		_, err := verifyLocalRelease(upgradeBinary, upgradePublicKey)
+		if err != nil {
+			panic(err)
+		}
+	}
+	defer printHostFailures()
+
+	var validate []*hostData
+	for _, host := range provisionTargets() {
+		fmt.Println()
+		fmt.Println("Provisioning", host)
+		mounts, err := provisionHost(host, envTemplate, unitTemplate)
+		if err != nil {
+			fmt.Println(host+":", err)
+			recordHostFailure(host, err)
+			continue
+		}
+		validate = append(validate, &hostData{Host: host, Drives: mounts})
+	}
+	if dryRun || len(validate) == 0 {
+		return
+	}
+	fmt.Println()
+	printHostReports(runHostChecks(validate, provisionChecks))
+}
+
+// provisionHost creates the minio user, formats and mounts the data drives,
+// installs the binary and writes the env file and unit. Every step can run
+// again on a host that was provisioned before. The unit is enabled but not
+// started, the host only joins the cluster with the pool it expands.
+func provisionHost(host string, envTemplate, unitTemplate *template.Template) (mounts []string, err error) {
+	_, err = sshClient(host)
+	if err != nil {
+		return nil, err
+	}
+	user := provisionUser
+	err = provisionRun(host, fmt.Sprintf("id -u %s >/dev/null 2>&1 || sudo useradd -r -M -U -s /sbin/nologin %s", shellQuote(user), shellQuote(user)))
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := provisionDevices(host)
+	if err != nil {
+		return nil, err
+	}
+	for i, dev := range devices {
+		mp := fmt.Sprintf("%s%d", provisionMountPrefix, i+1)
+		label := fmt.Sprintf("%s%d", provisionLabelPrefix, i+1)
+		err = provisionDrive(host, dev, mp, label)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dev, err)
+		}
+		mounts = append(mounts, mp)
+	}
+
+	if upgradeBinary != "" {
+		err = installMinio(host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := provisionData{
+		Host:         host,
+		User:         user,
+		Binary:       upgradeBinaryPath,
+		EnvFile:      provisionEnvFile,
+		Volumes:      provisionVolumes,
+		Opts:         provisionOpts,
+		RootUser:     miniokey,
+		RootPassword: miniosecret,
+		Drives:       mounts,
+	}
+	var env, unit bytes.Buffer
+	err = envTemplate.Execute(&env, data)
+	if err == nil {
+		err = unitTemplate.Execute(&unit, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The env file holds the root credentials.
+	err = provisionFile(host, provisionEnvFile, env.Bytes(), 0o640, user)
+	if err == nil {
+		err = provisionFile(host, minioUnitPath, unit.Bytes(), 0o644, "root")
+	}
+	if err == nil {
+		err = provisionRun(host, "sudo systemctl daemon-reload && sudo systemctl enable minio")
+	}
+	return mounts, err
+}
+
+// provisionDevices lists the block devices -drives matches on host, in
+// natural order so labels follow the device names.
+func provisionDevices(host string) (devices []string, err error) {
+	patterns := strings.ReplaceAll(provisionDrives, ",", " ")
+	out, err := runSSH(host, "ls -1d -- "+patterns+" 2>/dev/null; true")
+	if err != nil {
+		return nil, err
+	}
+	devices = strings.Fields(string(out))
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no drives match -drives %s", provisionDrives)
+	}
+	sort.Slice(devices, func(a, b int) bool { return naturalLess(devices[a], devices[b]) })
+	fmt.Printf("%s: %d data drives: %s\n", host, len(devices), strings.Join(devices, " "))
+	return
+}
+
+// provisionDrive formats dev as XFS labeled label and mounts it on mp
+// through fstab. A drive that already carries label is kept, any other
+// filesystem is only formatted with -wipe.
+func provisionDrive(host, dev, mp, label string) error {
+	out, err := runSSH(host, "sudo blkid -o export "+shellQuote(dev)+" 2>/dev/null; lsblk -nro MOUNTPOINT "+shellQuote(dev)+" 2>/dev/null | sed 's/^/MOUNTPOINT=/'")
+	if err != nil {
+		return err
+	}
+	fs := make(map[string]string)
+	var mounted []string
+	for _, line := range strings.Split(string(out), "\n") {
+		k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+		if k == "MOUNTPOINT" && v != "" {
+			mounted = append(mounted, v)
+		} else if k != "" {
+			fs[k] = v
+		}
+	}
+	for _, m := range mounted {
+		if m != mp {
+			return fmt.Errorf("mounted on %s, not touching it", m)
+		}
+	}
+
+	switch {
+	case fs["TYPE"] == "xfs" && fs["LABEL"] == label:
+		fmt.Printf("%s: %s is already formatted as %s\n", host, dev, label)
+	case fs["TYPE"] != "" && !provisionWipe:
+		return fmt.Errorf("has a %s filesystem labeled %q, -wipe formats it", fs["TYPE"], fs["LABEL"])
+	case fs["PTTYPE"] != "" && !provisionWipe:
+		return fmt.Errorf("has a %s partition table, -wipe formats it", fs["PTTYPE"])
+	default:
+		err = provisionRun(host, fmt.Sprintf("sudo mkfs.xfs -f -L %s %s", shellQuote(label), shellQuote(dev)))
+		if err != nil {
+			return err
+		}
+	}
+
+	entry := fmt.Sprintf("LABEL=%s %s xfs defaults,noatime 0 2", label, mp)
+	return provisionRun(host, fmt.Sprintf("sudo mkdir -p %s && { grep -q %s /etc/fstab || echo %s | sudo tee -a /etc/fstab >/dev/null; } && { mountpoint -q %s || sudo mount %s; } && sudo chown %s: %s",
+		shellQuote(mp), shellQuote("^LABEL="+label+" "), shellQuote(entry), shellQuote(mp), shellQuote(mp), shellQuote(provisionUser), shellQuote(mp)))
+}
+
+// provisionRun runs a command that changes host, dry runs print it.
+func provisionRun(host, cmd string) error {
+	if dryRun {
+		fmt.Printf("%s: would run %s\n", host, cmd)
+		return nil
+	}
+	out, err := runSSH(host, cmd)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// provisionFile writes data to path on host, owned by root and group.
+func provisionFile(host, path string, data []byte, mode os.FileMode, group string) error {
+	if dryRun {
+		shown := data
+		if miniosecret != "" {
+			shown = bytes.ReplaceAll(data, []byte(miniosecret), []byte("********"))
+		}
+		fmt.Printf("%s: would write %s:\n%s", host, path, shown)
+		return nil
+	}
+	dir, err := stagingDir(host)
+	if err != nil {
+		return err
+	}
+	defer removeStaging(host, dir)
+	name := filepath.Base(path)
+	err = scpUpload(host, dir, name, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", path, err)
+	}
+	return provisionRun(host, fmt.Sprintf("sudo install -D -m %04o -o root -g %s %s %s",
+		mode.Perm(), shellQuote(group), shellQuote(dir+"/"+name), shellQuote(path)))
+}
+
+// checkProvisioned verifies what provision set up: the user, drive
+// ownership, the binary and the unit.
+func checkProvisioned(h *hostData) (r []checkResult) {
+	if _, err := h.run("id -u " + shellQuote(provisionUser)); err != nil {
+		r = append(r, newResult("user", checkFail, provisionUser+" does not exist", ""))
+	} else {
+		r = append(r, newResult("user", checkPass, provisionUser+" exists", ""))
+	}
+
+	var wrong []string
+	for _, mp := range h.Drives {
+		out, err := h.run("stat -c %U " + shellQuote(mp))
+		if err != nil || out != provisionUser {
+			wrong = append(wrong, mp)
+		}
+	}
+	if len(wrong) > 0 {
+		r = append(r, newResult("owner", checkFail, "not owned by "+provisionUser+": "+strings.Join(wrong, ", "), "MinIO cannot write to these drives"))
+	} else {
+		r = append(r, newResult("owner", checkPass, fmt.Sprintf("all %d drives are owned by %s", len(h.Drives), provisionUser), ""))
+	}
+
+	out, err := h.run(shellQuote(upgradeBinaryPath) + " --version")
+	if err != nil {
+		r = append(r, newResult("binary", checkFail, err.Error(), "Install MinIO with -binary"))
+	} else {
+		r = append(r, newResult("binary", checkPass, strings.Split(out, "\n")[0], ""))
+	}
+
+	if out, err = h.run("systemctl is-enabled minio"); err != nil || out != "enabled" {
+		r = append(r, newResult("unit", checkFail, "minio unit is not enabled: "+out, ""))
+	} else {
+		r = append(r, newResult("unit", checkPass, "minio unit is enabled", ""))
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// runStats are summary counters for the current invocation, pushed to the
+// Pushgateway when the command finishes.
+var runStats struct {
+	hostsRebooted atomic.Int64
+	objectsHealed atomic.Int64
+	failures      atomic.Int64
+}
+
+// pushMetrics sends the run summary of command to `-pushgateway`, grouped by
+// job and command so every command keeps its own last result.
+func pushMetrics(command string, duration time.Duration, runErr error) {
+	if pushgateway == "" {
+		return
+	}
+
+	success := 1
+	if runErr != nil {
+		success = 0
+	}
+
+	buf := new(bytes.Buffer)
+	gauge := func(name string, help string, value any) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("minio_cluster_tool_duration_seconds", "Duration of the last run.", duration.Seconds())
+	gauge("minio_cluster_tool_hosts_rebooted", "Hosts rebooted or restarted by the last run.", runStats.hostsRebooted.Load())
+	gauge("minio_cluster_tool_objects_healed", "Objects processed by heal sequences in the last run.", runStats.objectsHealed.Load())
+	gauge("minio_cluster_tool_failures", "Host or set operations that failed in the last run.", runStats.failures.Load())
+	gauge("minio_cluster_tool_success", "Whether the last run completed without a fatal error.", success)
+	gauge("minio_cluster_tool_last_run_timestamp_seconds", "Unix time the last run finished.", time.Now().Unix())
+
+	u := strings.TrimSuffix(pushgateway, "/")
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		u = "http://" + u
+	}
+	u += "/metrics/job/" + url.PathEscape(pushJob) + "/command/" + url.PathEscape(command)
+
+	req, err := http.NewRequest(http.MethodPut, u, buf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to push metrics:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to push metrics:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		fmt.Fprintln(os.Stderr, "Unable to push metrics:", resp.Status)
+	}
+}
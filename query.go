@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -fields and -where turn the JSON output of a command into a flat list of
+// records, so a slice of it can be taken on hosts without jq. Nested
+// collections are flattened into one record per innermost element, which
+// inherits the fields of the objects around it: the drives of 'info' are
+// records with the fields of their set and server as well. Field names are
+// matched without regard to case.
+
+// queryRecords flattens v, decoded from JSON, into records.
+func queryRecords(v any, inherited map[string]any) (records []map[string]any) {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			records = append(records, queryRecords(e, inherited)...)
+		}
+		return
+	case map[string]any:
+		if queryContainer(x) {
+			// A map of records like the drives of a set, or a struct
+			// holding nothing but collections.
+			keys := stringKeysSorted(x)
+			sort.Slice(keys, func(i, j int) bool { return naturalLess(keys[i], keys[j]) })
+			for _, k := range keys {
+				records = append(records, queryRecords(x[k], inherited)...)
+			}
+			return
+		}
+		own := make(map[string]any, len(inherited)+len(x))
+		for k, val := range inherited {
+			own[k] = val
+		}
+		var children []string
+		for k, val := range x {
+			if queryCollection(val) {
+				children = append(children, k)
+				continue
+			}
+			own[k] = val
+		}
+		sort.Slice(children, func(i, j int) bool { return naturalLess(children[i], children[j]) })
+		for _, k := range children {
+			records = append(records, queryRecords(x[k], own)...)
+		}
+		if len(records) == 0 {
+			records = append(records, own)
+		}
+		return
+	}
+	rec := make(map[string]any, len(inherited)+1)
+	for k, val := range inherited {
+		rec[k] = val
+	}
+	rec["Value"] = v
+	return []map[string]any{rec}
+}
+
+// queryCollection reports whether v holds objects or lists to flatten,
+// objects of plain values stay a field of their record.
+func queryCollection(v any) bool {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			switch e.(type) {
+			case map[string]any, []any:
+				return true
+			}
+		}
+	case map[string]any:
+		for _, e := range x {
+			switch e.(type) {
+			case map[string]any, []any:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryContainer reports whether every value of x is an object or a list.
+func queryContainer(x map[string]any) bool {
+	for _, e := range x {
+		switch e.(type) {
+		case map[string]any, []any:
+		default:
+			return false
+		}
+	}
+	return len(x) > 0
+}
+
+// queryField returns the key of rec matching name, ignoring case.
+func queryField(rec map[string]any, name string) (key string, ok bool) {
+	if _, ok := rec[name]; ok {
+		return name, true
+	}
+	for k := range rec {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return name, false
+}
+
+func queryString(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// applyQuery applies -where and -fields to data.
+func applyQuery(data any) any {
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	var v any
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		panic(err)
+	}
+
+	records := []map[string]any{}
+	for _, rec := range queryRecords(v, nil) {
+		if queryFilter == nil || queryFilter.match(rec) {
+			records = append(records, rec)
+		}
+	}
+	if queryFields == "" {
+		return records
+	}
+	var fields []string
+	for _, f := range strings.Split(queryFields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	for i, rec := range records {
+		picked := make(map[string]any, len(fields))
+		for _, f := range fields {
+			k, _ := queryField(rec, f)
+			picked[k] = rec[k]
+		}
+		records[i] = picked
+	}
+	return records
+}
+
+// queryExpr is a parsed -where expression: comparisons of a field with a
+// value joined by &&, || and !, grouped with parentheses.
+type queryExpr struct {
+	op          string
+	left, right *queryExpr
+	field       string
+	value       string
+	re          *regexp.Regexp
+}
+
+func (e *queryExpr) match(rec map[string]any) bool {
+	switch e.op {
+	case "&&":
+		return e.left.match(rec) && e.right.match(rec)
+	case "||":
+		return e.left.match(rec) || e.right.match(rec)
+	case "!":
+		return !e.left.match(rec)
+	}
+	k, _ := queryField(rec, e.field)
+	got := queryString(rec[k])
+	switch e.op {
+	case "=~":
+		return e.re.MatchString(got)
+	case "!~":
+		return !e.re.MatchString(got)
+	}
+
+	// Numbers compare as numbers, anything else as text.
+	var cmp int
+	a, aerr := strconv.ParseFloat(got, 64)
+	b, berr := strconv.ParseFloat(e.value, 64)
+	switch {
+	case aerr == nil && berr == nil && a < b:
+		cmp = -1
+	case aerr == nil && berr == nil && a > b:
+		cmp = 1
+	case aerr == nil && berr == nil:
+	default:
+		cmp = strings.Compare(got, e.value)
+	}
+	switch e.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+var queryOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "=", "!", "(", ")"}
+
+func queryTokens(s string) (tokens []string, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at %d", i)
+			}
+			// Quoted values keep their quote so they are never taken
+			// for an operator.
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+			continue
+		}
+		op := ""
+		for _, o := range queryOperators {
+			if strings.HasPrefix(s[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			tokens = append(tokens, op)
+			i += len(op)
+			continue
+		}
+		j := i
+		for j < len(s) && !strings.ContainsRune(" \t\"'&|=!<>()", rune(s[j])) {
+			j++
+		}
+		tokens = append(tokens, s[i:j])
+		i = j
+	}
+	return
+}
+
+// parseWhere parses a -where expression like 'state!=ok && pool==2'.
+func parseWhere(s string) (e *queryExpr, err error) {
+	tokens, err := queryTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	e, err = p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid -where %q: %w", s, err)
+	}
+	return e, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *queryParser) or() (*queryExpr, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right *queryExpr
+		right, err = p.and()
+		left = &queryExpr{op: "||", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *queryParser) and() (*queryExpr, error) {
+	left, err := p.unary()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right *queryExpr
+		right, err = p.unary()
+		left = &queryExpr{op: "&&", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *queryParser) unary() (*queryExpr, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		e, err := p.unary()
+		return &queryExpr{op: "!", left: e}, err
+	case "(":
+		p.next()
+		e, err := p.or()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("missing )")
+		}
+		return e, err
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (*queryExpr, error) {
+	field := p.next()
+	op := p.next()
+	value := p.next()
+	if field == "" || op == "" || value == "" {
+		return nil, fmt.Errorf("expected field, operator and value")
+	}
+	switch op {
+	case "=":
+		op = "=="
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return nil, fmt.Errorf("unknown operator %q after %s", op, field)
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		value = value[1 : len(value)-1]
+	}
+	e := &queryExpr{op: op, field: field, value: value}
+	if op == "=~" || op == "!~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		e.re = re
+	}
+	return e, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+// whereString prints e with every operator parenthesized.
+func whereString(e *queryExpr) string {
+	switch e.op {
+	case "&&", "||":
+		return "(" + whereString(e.left) + " " + e.op + " " + whereString(e.right) + ")"
+	case "!":
+		return "!" + whereString(e.left)
+	}
+	return e.field + e.op + e.value
+}
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "comparison", in: "state!=ok", want: "state!=ok"},
+		{name: "single equals", in: "pool = 2", want: "pool==2"},
+		{name: "and binds tighter than or", in: "a==1 || b==2 && c==3", want: "(a==1 || (b==2 && c==3))"},
+		{name: "parentheses", in: "(a==1 || b==2) && c==3", want: "((a==1 || b==2) && c==3)"},
+		{name: "not", in: "!(state==ok)", want: "!state==ok"},
+		{name: "quoted value keeps operators", in: `path=="/mnt/a&&b"`, want: "path==/mnt/a&&b"},
+		{name: "single quotes", in: "state=='faulty drive'", want: "state==faulty drive"},
+		{name: "regexp", in: "endpoint=~'^node[0-9]+'", want: "endpoint=~^node[0-9]+"},
+		{name: "numbers", in: "usedspace>=10 && freeinodes<5", want: "(usedspace>=10 && freeinodes<5)"},
+		{name: "empty", in: "", wantErr: true},
+		{name: "only spaces", in: "   ", wantErr: true},
+		{name: "unbalanced double quote", in: `state=="ok`, wantErr: true},
+		{name: "unbalanced single quote", in: "state=='ok", wantErr: true},
+		{name: "missing parenthesis", in: "(state==ok", wantErr: true},
+		{name: "extra parenthesis", in: "state==ok)", wantErr: true},
+		{name: "missing field", in: "==ok", wantErr: true},
+		{name: "missing value", in: "state==", wantErr: true},
+		{name: "unknown operator", in: "state ~ ok", wantErr: true},
+		{name: "dangling and", in: "state==ok &&", wantErr: true},
+		{name: "invalid regexp", in: "state=~'('", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseWhere(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", whereString(e))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := whereString(e); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhereMatch(t *testing.T) {
+	rec := map[string]any{"State": "ok", "Pool": float64(2), "Endpoint": "node10:9000"}
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "state==ok", want: true},
+		{in: "STATE!=ok", want: false},
+		{in: "pool>10", want: false},
+		{in: "pool<10", want: true},
+		{in: "endpoint=~'^node1[0-9]'", want: true},
+		{in: "state==ok && !(pool==2)", want: false},
+		{in: "state==bad || pool>=2", want: true},
+		// Fields a record does not have compare as empty.
+		{in: "unknown==ok", want: false},
+		{in: "unknown!=ok", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			e, err := parseWhere(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.match(rec); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// setQuorum is the drive availability of one erasure set.
+type setQuorum struct {
+	Drives  int
+	Offline int
+	Parity  int
+}
+
+// writeQuorum is the number of drives a set needs online to accept writes.
+func (s setQuorum) writeQuorum() int {
+	data := s.Drives - s.Parity
+	if data == s.Parity {
+		return data + 1
+	}
+	return data
+}
+
+// quorumSnapshot returns the drive availability of every set, keyed by
+// pool/set.
+func quorumSnapshot() (sets map[string]*setQuorum, err error) {
+	pools, _, err := getInfra()
+	if err != nil {
+		return nil, err
+	}
+	sets = make(map[string]*setQuorum)
+	for pid, p := range pools {
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				key := fmt.Sprintf("%s/%d", pid, set.ID)
+				q, ok := sets[key]
+				if !ok {
+					q = &setQuorum{Parity: set.SCParity}
+					sets[key] = q
+				}
+				for _, d := range set.Disks {
+					q.Drives++
+					if d.State != "ok" {
+						q.Offline++
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// quorumRegressions compares the sets after a round with the snapshot taken
+// before it.
+func quorumRegressions(before, after map[string]*setQuorum) (problems []string) {
+	for key, a := range after {
+		if a.Drives-a.Offline < a.writeQuorum() {
+			problems = append(problems, fmt.Sprintf("set %s has no write quorum (%d/%d drives online, needs %d)", key, a.Drives-a.Offline, a.Drives, a.writeQuorum()))
+			continue
+		}
+		if b, ok := before[key]; ok && a.Offline > b.Offline {
+			problems = append(problems, fmt.Sprintf("set %s has %d offline drives, %d before the round", key, a.Offline, b.Offline))
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			problems = append(problems, fmt.Sprintf("set %s is no longer reported", key))
+		}
+	}
+	sort.Strings(problems)
+	return
+}
+
+// verifyRound checks that no set lost drives or write quorum compared to
+// before. Drives can take a moment to reconnect after a host reports healthy,
+// so it retries for up to a minute.
+func verifyRound(before map[string]*setQuorum) bool {
+	var problems []string
+	for attempt := 0; attempt < 6; attempt++ {
+		if attempt > 0 {
+			time.Sleep(10 * time.Second)
+		}
+		after, err := quorumSnapshot()
+		if err != nil {
+			problems = []string{"unable to read storage info: " + err.Error()}
+			continue
+		}
+		problems = quorumRegressions(before, after)
+		if len(problems) == 0 {
+			fmt.Println("Quorum verified: every set has write quorum and no new offline drives")
+			return true
+		}
+	}
+	for _, p := range problems {
+		fmt.Println("Quorum check failed:", p)
+	}
+	return false
+}
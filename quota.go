@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/madmin-go/v3"
+)
+
+// bucketQuota compares the hard quota of a bucket with what the scanner
+// last counted in it.
+type bucketQuota struct {
+	Bucket   string
+	Quota    uint64 `json:",omitempty"`
+	Used     uint64
+	Objects  uint64
+	Versions uint64
+	Percent  float64 `json:",omitempty"`
+	// Status is ok, near when it is within -within percent of its quota,
+	// over, or none for buckets without a quota.
+	Status string
+}
+
+// quotaReport is the output of 'quota report'. Usage comes from the data
+// scanner, it lags behind by up to one scan cycle.
+type quotaReport struct {
+	LastScan time.Time
+	Buckets  []bucketQuota
+}
+
+func bucketQuotas() (r quotaReport, err error) {
+	ctx := context.Background()
+	err = makeClient()
+	if err != nil {
+		return r, err
+	}
+	usage, err := mclient.DataUsageInfo(ctx)
+	if err != nil {
+		return r, fmt.Errorf("reading data usage: %w", err)
+	}
+	r.LastScan = usage.LastUpdate
+
+	// Buckets without objects are not in the usage, list them all.
+	s3, err := s3Client(endpoint)
+	if err != nil {
+		return r, err
+	}
+	buckets, err := s3.ListBuckets(ctx)
+	if err != nil {
+		return r, fmt.Errorf("listing buckets: %w", err)
+	}
+	for _, b := range buckets {
+		u := usage.BucketsUsage[b.Name]
+		q := bucketQuota{Bucket: b.Name, Used: u.Size, Objects: u.ObjectsCount, Versions: u.VersionsCount, Status: "none"}
+		quota, qerr := mclient.GetBucketQuota(ctx, b.Name)
+		// Buckets without a quota answer with an error on some releases.
+		if qerr != nil && madmin.ToErrorResponse(qerr).Code != "XMinioAdminNoSuchQuotaConfiguration" {
+			fmt.Fprintln(statusOut(), "Unable to read the quota of", b.Name+":", qerr)
+		}
+		q.Quota = quota.Size
+		if q.Quota == 0 {
+			q.Quota = quota.Quota
+		}
+		if q.Quota > 0 {
+			q.Percent = float64(q.Used) / float64(q.Quota) * 100
+			switch {
+			case q.Used >= q.Quota:
+				q.Status = "over"
+			case q.Percent >= 100-quotaWithin:
+				q.Status = "near"
+			default:
+				q.Status = "ok"
+			}
+		}
+		r.Buckets = append(r.Buckets, q)
+	}
+	sort.Slice(r.Buckets, func(i, j int) bool {
+		if r.Buckets[i].Percent != r.Buckets[j].Percent {
+			return r.Buckets[i].Percent > r.Buckets[j].Percent
+		}
+		return r.Buckets[i].Bucket < r.Buckets[j].Bucket
+	})
+	return r, nil
+}
+
+func quotaReportCmd() {
+	r, err := bucketQuotas()
+	if err != nil {
+		panic(err)
+	}
+	if !quotaAll {
+		var limited []bucketQuota
+		for _, b := range r.Buckets {
+			if b.Quota > 0 {
+				limited = append(limited, b)
+			}
+		}
+		r.Buckets = limited
+	}
+	for _, b := range r.Buckets {
+		if b.Status == "near" || b.Status == "over" {
+			exitCode = 1
+		}
+	}
+	if jsonOutput {
+		jsonOut(r)
+		return
+	}
+
+	if !r.LastScan.IsZero() {
+		fmt.Println("Usage as of the scan finished", r.LastScan.Local().Format(time.RFC3339))
+	}
+	if len(r.Buckets) == 0 {
+		fmt.Println("No buckets with a quota, -all lists every bucket")
+		return
+	}
+	width := len("BUCKET")
+	for _, b := range r.Buckets {
+		width = max(width, len(b.Bucket))
+	}
+	fmt.Printf("%-*s  %-10s  %-10s  %-7s  %-12s  %-12s  %s\n", width, "BUCKET", "QUOTA", "USED", "USED%", "OBJECTS", "VERSIONS", "STATUS")
+	for _, b := range r.Buckets {
+		quota, pct := "-", "-"
+		if b.Quota > 0 {
+			quota = humanize.IBytes(b.Quota)
+			pct = humanize.FormatFloat("#.#", b.Percent) + "%"
+		}
+		mark := ""
+		switch b.Status {
+		case "near":
+			mark = fmt.Sprintf("  <- within %s%% of the quota", humanize.FormatFloat("#.#", quotaWithin))
+		case "over":
+			mark = "  <- at or over the quota, writes are rejected"
+		}
+		line := fmt.Sprintf("%-*s  %-10s  %-10s  %-7s  %-12d  %-12d  %s%s", width, b.Bucket, quota, humanize.IBytes(b.Used), pct, b.Objects, b.Versions, b.Status, mark)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// fstabDevicePath resolves the UUID=, LABEL=, PARTUUID= and PARTLABEL= forms
+// of an fstab device to the udev symlink that exists when the device does.
+func fstabDevicePath(dev string) string {
+	for prefix, dir := range map[string]string{
+		"UUID=":      "/dev/disk/by-uuid/",
+		"LABEL=":     "/dev/disk/by-label/",
+		"PARTUUID=":  "/dev/disk/by-partuuid/",
+		"PARTLABEL=": "/dev/disk/by-partlabel/",
+	} {
+		if v, ok := strings.CutPrefix(dev, prefix); ok {
+			return dir + strings.Trim(v, `"`)
+		}
+	}
+	return dev
+}
+
+// fstabMountFor returns the fstab mount point that path lives on, ignoring
+// the root filesystem.
+func fstabMountFor(path string, fstab map[string]fstabEntry) (mp string) {
+	path = strings.TrimSuffix(path, "/")
+	for m := range fstab {
+		if m == "" {
+			continue
+		}
+		if (path == m || strings.HasPrefix(path, m+"/")) && len(m) > len(mp) {
+			mp = m
+		}
+	}
+	return
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirm asks question on the terminal, yes answers it up front.
+func confirm(question string, yes bool) bool {
+	if yes {
+		return true
+	}
+	fmt.Print(question + " [y/N] ")
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// remountDrive mounts the fstab entry holding d if the drive is not mounted
+// but its device is present. It returns false when nothing was mounted.
+func remountDrive(h *hostData, d badDrive) (mounted bool, err error) {
+	mounts, err := hostMounts(h)
+	if err != nil {
+		return false, err
+	}
+	if mp := mountPointOf(d.Path, mounts); mp != "" && mp != "/" {
+		fmt.Printf("%s:%s is mounted on %s, not touching it (see drive fscheck)\n", d.Host, d.Path, mp)
+		return false, nil
+	}
+
+	fstab, err := hostFstab(h)
+	if err != nil {
+		return false, err
+	}
+	mp := fstabMountFor(d.Path, fstab)
+	if mp == "" {
+		return false, fmt.Errorf("no fstab entry for %s", d.Path)
+	}
+	dev := fstabDevicePath(fstab[mp].Device)
+	out, err := h.run("test -b " + shellQuote(dev) + " && echo present || echo missing")
+	if err != nil {
+		return false, err
+	}
+	if out != "present" {
+		return false, fmt.Errorf("device %s is not present, the drive needs to be replaced or reseated", dev)
+	}
+
+	if !confirm(fmt.Sprintf("Mount %s (%s) on %s for %s?", mp, dev, d.Host, d.Path), remountYes) {
+		fmt.Println("Skipped", d.Host+":"+d.Path)
+		return false, nil
+	}
+	// The drive may have been mounted while the question was open, the
+	// mounts read before are cached.
+	output, err := runSSH(h.Host, "cat /proc/self/mounts")
+	if err != nil {
+		return false, err
+	}
+	if cur := mountPointOf(d.Path, parseMounts(string(output))); cur != "" && cur != "/" {
+		fmt.Printf("%s:%s was mounted on %s in the meantime, not touching it\n", d.Host, d.Path, cur)
+		return false, nil
+	}
+	// Run directly, the output of a failed mount must not be cached.
+	output, err = runSSH(h.Host, "sudo mount "+shellQuote(mp))
+	if err != nil {
+		return false, fmt.Errorf("mount %s: %w: %s", mp, err, strings.TrimSpace(string(output)))
+	}
+	fmt.Printf("Mounted %s on %s\n", mp, d.Host)
+	return true, nil
+}
+
+// waitDrivesOnline polls storage info until every drive in drives is ok or
+// -wait has passed, and returns the drives that are still not ok.
+func waitDrivesOnline(drives []badDrive, wait time.Duration) (pending []badDrive) {
+	deadline := time.Now().Add(wait)
+	pending = drives
+	for len(pending) > 0 {
+		time.Sleep(10 * time.Second)
+		pools, _, err := getInfra()
+		if err != nil {
+			fmt.Println("Unable to read storage info:", err)
+		} else {
+			states := make(map[string]string)
+			for _, p := range pools {
+				for host, s := range p.Servers {
+					for _, set := range s.Sets {
+						for _, disk := range set.Disks {
+							states[host+":"+disk.Path] = disk.State
+						}
+					}
+				}
+			}
+			var still []badDrive
+			for _, d := range pending {
+				if states[d.Host+":"+d.Path] == "ok" {
+					fmt.Println("Drive online:", d.Host+":"+d.Path)
+				} else {
+					still = append(still, d)
+				}
+			}
+			pending = still
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+	return
+}
+
+func driveRemount() {
+	l := acquireLock(lockOperation())
+	defer l.release()
+
+	drives := badDrives()
+	if len(drives) == 0 {
+		fmt.Println("All drives are ok")
+		return
+	}
+
+	hosts := make(map[string]*hostData)
+	var mounted []badDrive
+	for _, d := range drives {
+		h, ok := hosts[d.Host]
+		if !ok {
+			h = &hostData{Host: d.Host}
+			hosts[d.Host] = h
+		}
+		touchHost(d.Host)
+		ok, err := remountDrive(h, d)
+		if err != nil {
+			fmt.Printf("%s:%s: %v\n", d.Host, d.Path, err)
+			recordHostFailure(d.Host, fmt.Errorf("%s: %w", d.Path, err))
+			continue
+		}
+		if ok {
+			mounted = append(mounted, d)
+		}
+	}
+
+	if len(mounted) > 0 {
+		fmt.Println("Waiting for MinIO to pick up", len(mounted), "drives")
+		for _, d := range waitDrivesOnline(mounted, remountWait) {
+			recordHostFailure(d.Host, fmt.Errorf("%s: mounted but MinIO still reports it as not ok after %s", d.Path, remountWait))
+		}
+	}
+	printHostFailures()
+}
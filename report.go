@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type reportSet struct {
+	ID        int
+	Drives    int
+	BadDrives int
+	Parity    int
+	Margin    int
+	CanReboot bool
+	RRAtRisk  bool
+}
+
+type reportPool struct {
+	ID        string
+	Servers   int
+	Drives    int
+	BadDrives int
+	Used      string
+	Total     string
+	UsedPct   float64
+	States    map[string]int
+	Sets      []reportSet
+}
+
+type reportData struct {
+	Generated time.Time
+	Endpoint  string
+	Tool      string
+	Pools     []reportPool
+	BadDrives []*Disk
+	Checks    []checkResult
+	Charts    []reportChart
+}
+
+func buildReport() (r reportData) {
+	r = reportData{Generated: time.Now().UTC(), Endpoint: endpoint, Tool: version}
+
+	d := loadDoctorData()
+	if d.poolsErr != nil {
+		panic(d.poolsErr)
+	}
+	r.Checks = runDoctorChecks(d)
+
+	summaries := setSummaries(d.pools)
+	for _, pid := range stringKeysSorted(d.pools) {
+		p := d.pools[pid]
+		rp := reportPool{ID: pid, Servers: len(p.Servers), States: make(map[string]int)}
+		var used, total uint64
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				for _, disk := range set.Disks {
+					rp.Drives++
+					rp.States[disk.State]++
+					used += disk.UsedSpace
+					total += disk.TotalSpace
+					if disk.isBad() {
+						rp.BadDrives++
+						r.BadDrives = append(r.BadDrives, disk)
+					}
+				}
+			}
+		}
+		rp.Used = humanize.IBytes(used)
+		rp.Total = humanize.IBytes(total)
+		if total > 0 {
+			rp.UsedPct = float64(used) / float64(total) * 100
+		}
+
+		for id, s := range summaries[pid] {
+			bad := 0
+			for _, disk := range s.Disks {
+				if disk.isBad() {
+					bad++
+				}
+			}
+			rp.Sets = append(rp.Sets, reportSet{
+				ID:        id,
+				Drives:    len(s.Disks),
+				BadDrives: bad,
+				Parity:    s.Parity,
+				Margin:    s.Parity - bad,
+				CanReboot: s.CanReboot,
+				RRAtRisk:  s.RRAtRisk,
+			})
+		}
+		sort.Slice(rp.Sets, func(i, j int) bool { return rp.Sets[i].ID < rp.Sets[j].ID })
+		r.Pools = append(r.Pools, rp)
+	}
+
+	sort.Slice(r.BadDrives, func(i, j int) bool {
+		if r.BadDrives[i].Server != r.BadDrives[j].Server {
+			return r.BadDrives[i].Server < r.BadDrives[j].Server
+		}
+		return r.BadDrives[i].Path < r.BadDrives[j].Path
+	})
+
+	if reportCharts {
+		r.Charts = buildCharts()
+	}
+	return
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct": func(f float64) string { return humanize.FormatFloat("#.#", f) + "%" },
+	"ts":  func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>MinIO cluster report {{.Endpoint}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; margin-bottom: 0; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: left; }
+th { background: #f4f4f4; }
+.meta { color: #666; }
+.pass { background: #e6f4ea; }
+.warn { background: #fff4e5; }
+.fail { background: #fdecea; }
+.bar { background: #eee; width: 200px; height: 12px; display: inline-block; vertical-align: middle; }
+.bar span { background: #4a90d9; height: 12px; display: block; }
+</style>
+</head>
+<body>
+<h1>MinIO cluster report</h1>
+<p class="meta">{{.Endpoint}} &middot; generated {{ts .Generated}} by cluster-tool {{.Tool}}</p>
+
+<h2>Checks</h2>
+<table>
+<tr><th>Status</th><th>Check</th><th>Message</th><th>Hint</th></tr>
+{{range .Checks}}<tr class="{{.Status}}"><td>{{.Status}}</td><td>{{.Check}}</td><td>{{.Message}}</td><td>{{if ne .Status "pass"}}{{.Hint}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Pools</h2>
+<table>
+<tr><th>Pool</th><th>Servers</th><th>Drives</th><th>Not ok</th><th>Used</th><th>Capacity</th><th>Drive states</th></tr>
+{{range .Pools}}<tr class="{{if gt .BadDrives 0}}warn{{else}}pass{{end}}"><td>{{.ID}}</td><td>{{.Servers}}</td><td>{{.Drives}}</td><td>{{.BadDrives}}</td>
+<td>{{.Used}} / {{.Total}}</td><td><span class="bar"><span style="width: {{printf "%.0f" .UsedPct}}%"></span></span> {{pct .UsedPct}}</td>
+<td>{{range $state, $n := .States}}{{$state}}: {{$n}}<br>{{end}}</td></tr>
+{{end}}</table>
+
+{{range .Pools}}
+<h2>Pool {{.ID}} sets</h2>
+<table>
+<tr><th>Set</th><th>Drives</th><th>Not ok</th><th>Parity</th><th>Parity margin</th><th>Can reboot</th><th>Reduced redundancy at risk</th></tr>
+{{range .Sets}}<tr class="{{if le .Margin 0}}fail{{else if or (not .CanReboot) .RRAtRisk}}warn{{else}}pass{{end}}"><td>{{.ID}}</td><td>{{.Drives}}</td><td>{{.BadDrives}}</td><td>{{.Parity}}</td><td>{{.Margin}}</td><td>{{.CanReboot}}</td><td>{{.RRAtRisk}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Drives that are not ok</h2>
+{{if .BadDrives}}<table>
+<tr><th>Server</th><th>Path</th><th>Pool</th><th>Set</th><th>State</th><th>Healing</th></tr>
+{{range .BadDrives}}<tr class="fail"><td>{{.Server}}</td><td>{{.Path}}</td><td>{{.Pool}}</td><td>{{.Set}}</td><td>{{.State}}</td><td>{{.Healing}}</td></tr>
+{{end}}</table>{{else}}<p>All drives are ok.</p>{{end}}
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+{{if .SVG}}{{.SVG}}{{else}}<p class="meta">{{.Note}}</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func report() {
+	if reportHTML == "" {
+		panic("report needs -html <file>, use - for stdout")
+	}
+
+	data := buildReport()
+
+	var w io.Writer = os.Stdout
+	if reportHTML != "-" {
+		f, err := os.Create(reportHTML)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	err := reportTemplate.Execute(w, data)
+	if err != nil {
+		panic(err)
+	}
+	if reportHTML != "-" {
+		fmt.Fprintln(statusOut(), "Wrote", reportHTML)
+	}
+}
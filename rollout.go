@@ -0,0 +1,614 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type maintenanceWindow struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// parseWindow parses a daily window in the form "HH:MM-HH:MM". Windows where
+// the end is before the start wrap around midnight.
+func parseWindow(w string, tz string) (mw *maintenanceWindow, err error) {
+	start, end, ok := strings.Cut(w, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", w)
+	}
+
+	mw = new(maintenanceWindow)
+	mw.Start, err = parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	mw.End, err = parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	if mw.Start == mw.End {
+		return nil, fmt.Errorf("invalid window %q, start and end are equal", w)
+	}
+
+	mw.Location, err = time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func parseClock(c string) (d time.Duration, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(c))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", c)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// sinceMidnight returns the time of day of t on the clock of the window's
+// timezone, which is not how long ago midnight was on days the clock moves.
+func (mw *maintenanceWindow) sinceMidnight(t time.Time) time.Duration {
+	t = t.In(mw.Location)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+func (mw *maintenanceWindow) contains(t time.Time) bool {
+	now := mw.sinceMidnight(t)
+	if mw.Start < mw.End {
+		return now >= mw.Start && now < mw.End
+	}
+	return now >= mw.Start || now < mw.End
+}
+
+// nextStart returns the next time the window opens after t.
+func (mw *maintenanceWindow) nextStart(t time.Time) time.Time {
+	t = t.In(mw.Location)
+	y, m, d := t.Date()
+	// The minutes are normalized on the clock, not by adding elapsed time.
+	minute := int(mw.Start / time.Minute)
+	start := time.Date(y, m, d, 0, minute, 0, 0, mw.Location)
+	if !start.After(t) {
+		start = time.Date(y, m, d+1, 0, minute, 0, 0, mw.Location)
+	}
+	return start
+}
+
+// waitForWindow blocks until the window is open and reports whether it had
+// to wait for it.
+func (mw *maintenanceWindow) waitForWindow() (waited bool) {
+	for !mw.contains(time.Now()) {
+		waited = true
+		next := mw.nextStart(time.Now())
+		fmt.Println("Outside maintenance window, resuming at", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+		case <-interrupt:
+			return
+		}
+	}
+	return
+}
+
+// roundFiles returns the round files in dir ordered by round number.
+func roundFiles(dir string) (files []string, err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "round-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	rounds := make(map[int]string)
+	ids := make([]int, 0, len(matches))
+	for _, v := range matches {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(v), "round-"))
+		if err != nil {
+			continue
+		}
+		rounds[id] = v
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		files = append(files, rounds[id])
+	}
+	return
+}
+
+func rollout() {
+	var mw *maintenanceWindow
+	var err error
+	if window != "" {
+		mw, err = parseWindow(window, timezone)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if onDegrade != "abort" && onDegrade != "pause" {
+		panic("invalid -onDegrade " + onDegrade + ", expected abort or pause")
+	}
+	// Validate the hook flags before touching any host.
+	_ = maintenanceHooks()
+	defer printHostFailures()
+
+	rounds, err := roundFiles(folder)
+	if err != nil {
+		panic(err)
+	}
+	if len(rounds) == 0 {
+		fmt.Println("No round files found in", folder)
+		return
+	}
+
+	var l *opLock
+	if !dryRun {
+		l = acquireLock(lockOperation())
+		defer l.release()
+	}
+
+	skipSince, err = parseSince(rebootSince)
+	if err != nil {
+		panic(err)
+	}
+	j := startJob("rollout")
+	defer j.finishFromPanic()
+	// A resumed rollout skips the hosts that rebooted since it first started.
+	if resumeJobID != "" && skipSince.IsZero() {
+		skipSince = j.Created
+	}
+	handleInterrupts(j, l)
+	stages, err := rolloutStages(rounds)
+	if err != nil {
+		panic(err)
+	}
+	for _, st := range stages {
+		for _, rf := range rounds {
+			if j.stepDone(st.step(rf)) {
+				continue
+			}
+			hosts, err := readHostfile(rf)
+			if err != nil {
+				panic(err)
+			}
+			for _, h := range st.filter(hosts) {
+				if hostExcluded(h) == "" {
+					planProgress([]string{h})
+				}
+			}
+		}
+	}
+
+	ran := false
+	canaryDone := false
+	for si, st := range stages {
+		if st.Name != "" && j.stepDone(st.Name) {
+			fmt.Println("Skipping", st.Name, "it was finished before")
+			continue
+		}
+		if si > 0 && pauseStages && !approveStage(j, stages[si-1].Name, st.Name) {
+			return
+		}
+		// Reloads keep minio serving, there is nothing to wait for
+		// between rounds.
+		gated := !dryRun && !reloadOnly
+		var stageBefore map[string]*setQuorum
+		if st.Name != "" {
+			j.startStep(st.Name)
+			fmt.Println()
+			fmt.Println("Starting", st.Name)
+			if verifyQuorum && gated {
+				stageBefore, err = quorumSnapshot()
+				if err != nil {
+					panic(err)
+				}
+			}
+		}
+		var stageHosts []string
+
+		for _, rf := range rounds {
+			name := st.step(rf)
+			if j.stepDone(name) {
+				fmt.Println("Skipping", name, "it was finished before")
+				continue
+			}
+			hosts, err := readHostfile(rf)
+			if err != nil {
+				panic(err)
+			}
+			hosts = filterHosts(st.filter(hosts))
+			if len(hosts) == 0 {
+				continue
+			}
+			if ran {
+				pause(roundDelay, "before "+name)
+			}
+			ran = true
+
+			// A round that has started is always finished, even if the
+			// window closes while it is in progress. The backlog can grow
+			// while the window is closed, it is checked again once it opens.
+			for {
+				if waitHealBacklog {
+					waitForHealBacklog()
+				}
+				if mw == nil || !mw.waitForWindow() || !waitHealBacklog || interrupted.Load() {
+					break
+				}
+			}
+			if interrupted.Load() {
+				stopInterrupted(j, false)
+				return
+			}
+			if lockLost() {
+				fmt.Println("Aborting rollout before", name+",", errLockLost)
+				j.finish(jobFailed, errLockLost)
+				exitCode = 1
+				return
+			}
+			if j.canceled() {
+				fmt.Println("Job canceled before", name)
+				j.finish(jobCanceled, nil)
+				return
+			}
+			if canaryHosts > 0 && !canaryDone && !j.stepDone("canary") {
+				canaryDone = true
+				n := min(canaryHosts, len(hosts))
+				err = runCanary(j, hosts[:n])
+				if err != nil && interrupted.Load() {
+					stopInterrupted(j, false)
+					return
+				}
+				if err != nil {
+					fmt.Println("Aborting rollout, the canary failed:", err)
+					j.finish(jobFailed, err)
+					exitCode = 1
+					return
+				}
+				stageHosts = append(stageHosts, hosts[:n]...)
+				// The rest of the first round goes with the normal rounds.
+				hosts = hosts[n:]
+				if len(hosts) == 0 {
+					j.startStep(name)
+					j.finishStep(name, nil)
+					continue
+				}
+			}
+			if !runPreflight(hosts) {
+				j.finish(jobFailed, fmt.Errorf("pre-flight checks failed before %s", name))
+				return
+			}
+
+			var before map[string]*setQuorum
+			if verifyQuorum && gated {
+				before, err = quorumSnapshot()
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			j.startStep(name)
+			fmt.Println()
+			fmt.Println("Starting", name, "hosts:", len(hosts))
+			m := startDegradeMonitor(hosts)
+			done, failed := rebootRound(hosts)
+			stageHosts = append(stageHosts, done...)
+			// The monitor keeps watching while the round is verified.
+			if gated {
+				err = verifyRolloutRound(name, done, before)
+			}
+			// A failed reload stops the rollout as well, it is only the
+			// health gating that reloads skip.
+			if err == nil && !dryRun && len(failed) > 0 {
+				fmt.Println("Aborting rollout after", name+", rebooting", strings.Join(failed, ", "), "failed")
+				err = fmt.Errorf("reboot failed on %s in %s", strings.Join(failed, ", "), name)
+			}
+			m.stop()
+			if err == nil && gated {
+				err = degradeAbort(m, name)
+			}
+			if err != nil {
+				j.finishStep(name, err)
+				j.finish(jobFailed, err)
+				exitCode = 1
+				return
+			}
+			if gated && healBetweenRounds {
+				healRound(done)
+			}
+			if len(done) < len(hosts) && lockLost() {
+				j.finishStep(name, errLockLost)
+				j.finish(jobFailed, errLockLost)
+				return
+			}
+			if len(done) < len(hosts) && interrupted.Load() {
+				// Resuming the job reboots the rest of the round.
+				j.finishStep(name, errors.New("interrupted"))
+				stopInterrupted(j, false)
+				return
+			}
+			j.finishStep(name, nil)
+		}
+
+		if st.Name != "" {
+			err = verifyStage(st.Name, stageHosts, stageBefore, gated)
+			j.finishStep(st.Name, err)
+			if err != nil {
+				j.finish(jobFailed, err)
+				exitCode = 1
+				return
+			}
+		}
+	}
+
+	fmt.Println("Rollout complete")
+	j.finish(jobDone, nil)
+}
+
+// rolloutStage is a part of the rollout that -stageBy completes and
+// verifies before the next one starts. Without -stageBy the whole rollout is
+// one stage with no name.
+type rolloutStage struct {
+	Name  string
+	Hosts map[string]bool
+}
+
+// step returns the job step name of round file rf in the stage.
+func (st rolloutStage) step(rf string) string {
+	if st.Name == "" {
+		return filepath.Base(rf)
+	}
+	return st.Name + "/" + filepath.Base(rf)
+}
+
+// filter returns the hosts of the stage.
+func (st rolloutStage) filter(hosts []string) (kept []string) {
+	if st.Hosts == nil {
+		return hosts
+	}
+	for _, h := range hosts {
+		if st.Hosts[h] {
+			kept = append(kept, h)
+		}
+	}
+	return
+}
+
+// rolloutStages splits the hosts of the round files by -stageBy. A host
+// that is a server of several pools goes with the first one.
+func rolloutStages(rounds []string) (stages []rolloutStage, err error) {
+	switch stageBy {
+	case "":
+		return []rolloutStage{{}}, nil
+	case "pool":
+	default:
+		return nil, fmt.Errorf("invalid -stageBy %s, expected pool", stageBy)
+	}
+	pools, _, err := getInfra()
+	if err != nil {
+		return nil, err
+	}
+	pids := stringKeysSorted(pools)
+	sort.Slice(pids, func(a, b int) bool { return naturalLess(pids[a], pids[b]) })
+	staged := make(map[string]bool)
+	for _, pid := range pids {
+		st := rolloutStage{Name: "pool-" + pid, Hosts: make(map[string]bool)}
+		for host := range pools[pid].Servers {
+			if !staged[host] {
+				staged[host] = true
+				st.Hosts[host] = true
+			}
+		}
+		stages = append(stages, st)
+	}
+	for _, rf := range rounds {
+		hosts, err := readHostfile(rf)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hosts {
+			if !staged[h] && hostExcluded(h) == "" {
+				return nil, fmt.Errorf("%s: %s is not a server of any pool", rf, h)
+			}
+		}
+	}
+	return
+}
+
+// verifyStage waits for every host of a finished stage to be healthy and
+// checks that no set lost drives or write quorum since the stage started.
+func verifyStage(name string, hosts []string, before map[string]*setQuorum, gated bool) error {
+	if !gated {
+		fmt.Println(name, "complete")
+		return nil
+	}
+	if !waitHealthy(hosts) {
+		fmt.Println("Aborting rollout after", name+", not every host became healthy within -maxWait")
+		return fmt.Errorf("hosts not healthy after %s in %s", healthMaxWait, name)
+	}
+	if verifyQuorum && !verifyRound(before) {
+		fmt.Println("Aborting rollout after", name)
+		return fmt.Errorf("quorum verification failed after %s", name)
+	}
+	fmt.Println(name, "complete and verified")
+	return nil
+}
+
+// approveStage asks the operator to confirm before the next stage of
+// -pauseBetweenStages starts. Without a yes the job stops and resuming it
+// is the approval.
+func approveStage(j *job, prev, next string) bool {
+	gate := "approve " + next
+	if j.stepDone(gate) {
+		return true
+	}
+	if dryRun {
+		fmt.Println("Would ask for approval before", next)
+		return true
+	}
+	// The step failed when an earlier run stopped at the gate.
+	pending := false
+	if j != nil && resumeJobID != "" {
+		j.mu.Lock()
+		for _, s := range j.Steps {
+			pending = pending || s.Name == gate && s.State == jobFailed
+		}
+		j.mu.Unlock()
+	}
+	j.startStep(gate)
+	if pending {
+		fmt.Println("Approved", next, "by resuming the job")
+		j.finishStep(gate, nil)
+		return true
+	}
+	fmt.Println()
+	if confirm(fmt.Sprintf("%s is complete. Continue with %s?", prev, next), false) {
+		j.finishStep(gate, nil)
+		return true
+	}
+	err := fmt.Errorf("waiting for approval before %s", next)
+	j.finishStep(gate, err)
+	j.finish(jobCanceled, err)
+	fmt.Println("Stopped before", next+", continue with:", resumeCommand(j, progress.started, j == nil))
+	if hint := credentialsHint(); hint != "" {
+		fmt.Println(hint)
+	}
+	return false
+}
+
+// verifyRolloutRound waits for the hosts of a round to become healthy,
+// enables them again and verifies their reboots and the quorum of the sets.
+func verifyRolloutRound(name string, hosts []string, before map[string]*setQuorum) error {
+	if !waitHealthy(hosts) {
+		fmt.Println("Aborting rollout after", name+", not every host became healthy within -maxWait")
+		return fmt.Errorf("hosts not healthy after %s in %s", healthMaxWait, name)
+	}
+	enableHosts(hosts)
+	if !verifyReboots(hosts) {
+		fmt.Println("Aborting rollout after", name+", not every host rebooted")
+		return fmt.Errorf("reboots not verified in %s", name)
+	}
+	if verifyQuorum && !verifyRound(before) {
+		fmt.Println("Aborting rollout after", name)
+		return fmt.Errorf("quorum verification failed after %s", name)
+	}
+	return nil
+}
+
+// degradeAbort returns an error when the cluster degraded during the round
+// and the rollout has to stop, -onDegrade pause waits for it to recover.
+func degradeAbort(m *degradeMonitor, name string) error {
+	if !m.hold() {
+		return nil
+	}
+	problems := m.current()
+	fmt.Println("Aborting rollout after", name+", the cluster degraded:")
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	return fmt.Errorf("cluster degraded during %s: %s", name, strings.Join(problems, "; "))
+}
+
+// runCanary reboots the canary hosts ahead of the first round, verifies
+// them like a round and lets them soak for -soak. After the soak they must
+// still be healthy, their drives ok and the smoke test must pass before any
+// other host is touched.
+func runCanary(j *job, hosts []string) (err error) {
+	if !runPreflight(hosts) {
+		return fmt.Errorf("pre-flight checks failed before the canary")
+	}
+	gated := !dryRun && !reloadOnly
+	var before map[string]*setQuorum
+	if verifyQuorum && gated {
+		before, err = quorumSnapshot()
+		if err != nil {
+			return err
+		}
+	}
+
+	j.startStep("canary")
+	defer func() { j.finishStep("canary", err) }()
+	fmt.Println()
+	fmt.Println("Starting canary hosts:", strings.Join(hosts, ", "))
+	m := startDegradeMonitor(hosts)
+	done, _ := rebootRound(hosts)
+	if gated {
+		err = verifyRolloutRound("canary", done, before)
+	}
+	m.stop()
+	if gated {
+		if err == nil {
+			err = degradeAbort(m, "the canary")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(done) < len(hosts) {
+		return fmt.Errorf("canary stopped after %d of %d hosts", len(done), len(hosts))
+	}
+	pause(canarySoak, "for the canary to soak")
+	if interrupted.Load() {
+		return fmt.Errorf("interrupted during the soak")
+	}
+	if !gated {
+		if dryRun {
+			fmt.Println("Would verify health, drive states and run the smoke test on the canary")
+		}
+		return nil
+	}
+	if !waitHealthy(hosts) {
+		return fmt.Errorf("canary not healthy after the soak")
+	}
+	if drives := canaryBadDrives(hosts); len(drives) > 0 {
+		return fmt.Errorf("bad drives on the canary after the soak: %s", strings.Join(drives, ", "))
+	}
+	for _, s := range smokeTest() {
+		fmt.Printf("Canary smoke test %-5s %-17s %s\n", strings.ToUpper(s.Status), s.Step, s.Error)
+		if s.Status == checkFail {
+			err = fmt.Errorf("smoke test step %s failed: %s", s.Step, s.Error)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Canary passed, continuing with the rounds")
+	return nil
+}
+
+// canaryBadDrives returns the drives of hosts listed as bad by -badStates,
+// as host:path (state).
+func canaryBadDrives(hosts []string) (drives []string) {
+	pools, _, err := getInfra()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	only := make(map[string]bool)
+	for _, h := range hosts {
+		only[h] = true
+	}
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			if !only[host] {
+				continue
+			}
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if d.isBad() {
+						drives = append(drives, fmt.Sprintf("%s:%s (%s)", host, d.Path, d.State))
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(drives)
+	return
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		window, tz string
+		start, end time.Duration
+		wantErr    bool
+	}{
+		{name: "same day", window: "01:00-05:30", tz: "UTC", start: time.Hour, end: 5*time.Hour + 30*time.Minute},
+		{name: "across midnight", window: "22:00-04:00", tz: "Europe/Oslo", start: 22 * time.Hour, end: 4 * time.Hour},
+		{name: "spaces", window: "22:00 - 04:00", tz: "Local", start: 22 * time.Hour, end: 4 * time.Hour},
+		{name: "no end", window: "22:00", tz: "UTC", wantErr: true},
+		{name: "start and end equal", window: "02:00-02:00", tz: "UTC", wantErr: true},
+		{name: "hour out of range", window: "25:00-04:00", tz: "UTC", wantErr: true},
+		{name: "not a time", window: "late-early", tz: "UTC", wantErr: true},
+		{name: "unknown timezone", window: "22:00-04:00", tz: "Mars/Olympus_Mons", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := parseWindow(tt.window, tt.tz)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", mw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mw.Start != tt.start || mw.End != tt.end {
+				t.Errorf("got %s-%s, want %s-%s", mw.Start, mw.End, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func mustWindow(t *testing.T, window, tz string) *maintenanceWindow {
+	t.Helper()
+	mw, err := parseWindow(window, tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mw
+}
+
+func TestWindowContains(t *testing.T) {
+	utc := func(day, hour, min int) time.Time { return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name       string
+		window, tz string
+		at         time.Time
+		want       bool
+	}{
+		{name: "inside", window: "01:00-05:00", tz: "UTC", at: utc(14, 3, 0), want: true},
+		{name: "start is inside", window: "01:00-05:00", tz: "UTC", at: utc(14, 1, 0), want: true},
+		{name: "end is outside", window: "01:00-05:00", tz: "UTC", at: utc(14, 5, 0), want: false},
+		{name: "before", window: "01:00-05:00", tz: "UTC", at: utc(14, 0, 59), want: false},
+		{name: "across midnight before it", window: "22:00-04:00", tz: "UTC", at: utc(14, 23, 30), want: true},
+		{name: "across midnight after it", window: "22:00-04:00", tz: "UTC", at: utc(15, 3, 59), want: true},
+		{name: "across midnight during the day", window: "22:00-04:00", tz: "UTC", at: utc(14, 12, 0), want: false},
+		{name: "across midnight at its end", window: "22:00-04:00", tz: "UTC", at: utc(15, 4, 0), want: false},
+		// 06:00 UTC is 02:00 in New York during summer time.
+		{name: "timezone inside", window: "01:00-05:00", tz: "America/New_York", at: utc(14, 6, 0), want: true},
+		{name: "timezone outside", window: "01:00-05:00", tz: "America/New_York", at: utc(14, 3, 0), want: false},
+		{name: "timezone across midnight", window: "22:00-04:00", tz: "Asia/Tokyo", at: utc(14, 14, 0), want: true},
+		// Oslo skips from 02:00 to 03:00 on 2026-03-29, 03:30 UTC is
+		// 05:30 on the clock.
+		{
+			name:   "clock moved forward",
+			window: "03:00-05:00",
+			tz:     "Europe/Oslo",
+			at:     time.Date(2026, 3, 29, 3, 30, 0, 0, time.UTC),
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := mustWindow(t, tt.window, tt.tz)
+			if got := mw.contains(tt.at); got != tt.want {
+				t.Errorf("%s at %s: got %t, want %t", tt.window, tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowNextStart(t *testing.T) {
+	utc := func(day, hour, min int) time.Time { return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name       string
+		window, tz string
+		at, want   time.Time
+	}{
+		{name: "later today", window: "22:00-04:00", tz: "UTC", at: utc(14, 12, 0), want: utc(14, 22, 0)},
+		{name: "already open", window: "22:00-04:00", tz: "UTC", at: utc(14, 23, 0), want: utc(15, 22, 0)},
+		{name: "just opened", window: "22:00-04:00", tz: "UTC", at: utc(14, 22, 0), want: utc(15, 22, 0)},
+		{name: "after midnight", window: "22:00-04:00", tz: "UTC", at: utc(15, 1, 0), want: utc(15, 22, 0)},
+		{name: "end of month", window: "01:00-05:00", tz: "UTC", at: utc(31, 6, 0), want: time.Date(2026, 11, 1, 1, 0, 0, 0, time.UTC)},
+		// 12:00 UTC is 08:00 in New York, the window opens at 01:00 EDT.
+		{name: "timezone", window: "01:00-05:00", tz: "America/New_York", at: utc(14, 12, 0), want: utc(15, 5, 0)},
+		// Before 01:00 UTC it is already the next day in Tokyo.
+		{name: "timezone date", window: "02:00-04:00", tz: "Asia/Tokyo", at: utc(14, 16, 0), want: utc(14, 17, 0)},
+		// 04:00 in Oslo on the day summer time starts is 02:00 UTC.
+		{
+			name:   "clock moved forward",
+			window: "04:00-06:00",
+			tz:     "Europe/Oslo",
+			at:     time.Date(2026, 3, 28, 23, 30, 0, 0, time.UTC),
+			want:   time.Date(2026, 3, 29, 2, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := mustWindow(t, tt.window, tt.tz)
+			if got := mw.nextStart(tt.at); !got.Equal(tt.want) {
+				t.Errorf("%s after %s: got %s, want %s", tt.window, tt.at.Format(time.RFC3339), got.UTC().Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
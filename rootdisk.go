@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rootDiskScript prints the physical disks below / and below every drive
+// path given as argument, one "path disk..." line each. lsblk -s walks from
+// the filesystem through partitions, LVM and md down to the disks, so a
+// separate mount on a partition or volume of the OS disk is found too.
+const rootDiskScript = `disks() {
+	src=$(findmnt -n -o SOURCE --target "$1" 2>/dev/null | sed 's/\[.*//')
+	[ -b "$src" ] && lsblk -nrso NAME,TYPE "$src" 2>/dev/null | awk '$2 == "disk" { print $1 }' | sort -u | tr '\n' ' '
+}
+echo "/ $(disks /)"
+for p in "$@"; do
+	echo "$p $(disks "$p")"
+done`
+
+// rootDiskDrives returns the drives of the host that resolve to a physical
+// disk of the root filesystem.
+func rootDiskDrives(h *hostData) (shared []string, err error) {
+	cmd := "sh -c " + shellQuote(rootDiskScript) + " sh"
+	for _, d := range h.Drives {
+		cmd += " " + shellQuote(d)
+	}
+	out, err := h.run(cmd)
+	if err != nil {
+		return nil, err
+	}
+	root := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "/" {
+			for _, disk := range fields[1:] {
+				root[disk] = true
+			}
+			continue
+		}
+		for _, disk := range fields[1:] {
+			if root[disk] {
+				shared = append(shared, fmt.Sprintf("%s (on %s)", fields[0], disk))
+				break
+			}
+		}
+	}
+	return
+}
+
+// checkHostRootDisk fails when a drive path is on the same physical disk as
+// the OS, whether it is not mounted at all or mounted from a partition or
+// volume of the OS disk.
+func checkHostRootDisk(h *hostData) []checkResult {
+	if len(h.Drives) == 0 {
+		return []checkResult{newResult("rootdisk", checkWarn, "no drive paths to inspect", "")}
+	}
+	shared, err := rootDiskDrives(h)
+	if err != nil {
+		return hostFail("rootdisk", err)
+	}
+	if len(shared) > 0 {
+		return []checkResult{newResult("rootdisk", checkFail, "on the root disk: "+strings.Join(shared, ", "),
+			"Move the data paths to dedicated drives, MinIO is writing to the OS disk")}
+	}
+	return []checkResult{newResult("rootdisk", checkPass, "no drive is on the root disk", "")}
+}
+
+// rootDisks returns the drives MinIO flags as sharing the root disk, as
+// host:path sorted.
+func rootDisks(pools map[string]*Pool, hosts map[string]bool) (drives []string) {
+	for _, p := range pools {
+		for host, s := range p.Servers {
+			if hosts != nil && !hosts[host] {
+				continue
+			}
+			for _, set := range s.Sets {
+				for _, d := range set.Disks {
+					if d.RootDisk {
+						drives = append(drives, host+":"+d.Path)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(drives)
+	return
+}
+
+func checkRootDisks(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("rootdisk", checkFail, d.poolsErr.Error(), "")}
+	}
+	if drives := rootDisks(d.pools, nil); len(drives) > 0 {
+		return []checkResult{newResult("rootdisk", checkFail,
+			fmt.Sprintf("MinIO reports %d drives on the root disk: %s", len(drives), strings.Join(drives, ", ")),
+			"Run 'host check' on these hosts and move the data paths to dedicated drives")}
+	}
+	return []checkResult{newResult("rootdisk", checkPass, "MinIO reports no drive on the root disk", "")}
+}
+
+// checkRootDisksPreflight warns about drives of the rebooting hosts that
+// MinIO flags as sharing the root disk: after the reboot a drive that did
+// not mount writes to the OS disk as well.
+func checkRootDisksPreflight(pools map[string]*Pool, hosts []string) []checkResult {
+	rebooting := make(map[string]bool)
+	for _, h := range hosts {
+		rebooting[h] = true
+	}
+	if drives := rootDisks(pools, rebooting); len(drives) > 0 {
+		return []checkResult{newResult("rootdisk", checkWarn, "drives on the root disk: "+strings.Join(drives, ", "),
+			"Fix the data paths before rebooting, see 'host check'")}
+	}
+	return nil
+}
+
+// warnRootDisks prints the drives on the root disk after the disks output,
+// where a single flag in a long table is easy to miss.
+func warnRootDisks(pools map[string]*Pool) {
+	drives := rootDisks(pools, nil)
+	if len(drives) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "WARNING: MinIO reports %d drives on the root disk, data is written to the OS disk:\n", len(drives))
+	for _, d := range drives {
+		fmt.Fprintln(os.Stderr, "  "+d)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+// okDisks returns n ok drives of a set, keyed like the drives of a Set.
+func okDisks(n int) map[string]*Disk {
+	disks := make(map[string]*Disk, n)
+	for i := range n {
+		disks[string(rune('a'+i))] = &Disk{State: "ok"}
+	}
+	return disks
+}
+
+func TestCanReboot(t *testing.T) {
+	defer func(m int, s bool) { safetyMargin, strictParity = m, s }(safetyMargin, strictParity)
+
+	tests := []struct {
+		name   string
+		set    *Set
+		margin int
+		strict bool
+		want   bool
+	}{
+		{name: "parity left over", set: &Set{SCParity: 2}, margin: 1, want: true},
+		{name: "parity edge without margin", set: &Set{SCParity: 1}, margin: 0, want: true},
+		{name: "parity edge with margin", set: &Set{SCParity: 1}, margin: 1, want: false},
+		{name: "one bad drive already", set: &Set{SCParity: 2, BadDisks: 1}, margin: 1, want: false},
+		{name: "one bad drive without margin", set: &Set{SCParity: 2, BadDisks: 1}, margin: 0, want: true},
+		{name: "no parity", set: &Set{}, margin: 0, want: false},
+		{
+			name:   "strict counts every drive of the server",
+			set:    &Set{SCParity: 2, Disks: okDisks(2)},
+			margin: 1,
+			strict: true,
+			want:   false,
+		},
+		{
+			name:   "strict at the parity edge",
+			set:    &Set{SCParity: 2, Disks: okDisks(2)},
+			margin: 0,
+			strict: true,
+			want:   true,
+		},
+		{
+			name: "strict does not count drives that are already bad",
+			set: &Set{SCParity: 2, BadDisks: 1, Disks: map[string]*Disk{
+				"a": {State: "ok"},
+				"b": {State: "offline"},
+			}},
+			margin: 0,
+			strict: true,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			safetyMargin, strictParity = tt.margin, tt.strict
+			if got := canReboot(tt.set); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// testServer is a server of pool 1 in sets, which can all reboot unless the
+// set id is in blocked.
+type testServer struct {
+	endpoint string
+	sets     []int
+	blocked  []int
+	offline  bool
+}
+
+func testPools(servers []testServer) map[string]*Pool {
+	pool := &Pool{Servers: make(map[string]*Server)}
+	for _, ts := range servers {
+		s := &Server{Endpoint: ts.endpoint, Sets: make(map[int]*Set), Offline: ts.offline}
+		for _, id := range ts.sets {
+			s.Sets[id] = &Set{ID: id, CanReboot: !slices.Contains(ts.blocked, id)}
+		}
+		pool.Servers[ts.endpoint] = s
+	}
+	return map[string]*Pool{"0": pool}
+}
+
+func TestPlanRounds(t *testing.T) {
+	defer func(m int) { maxPerRound = m }(maxPerRound)
+
+	tests := []struct {
+		name          string
+		servers       []testServer
+		domains       map[string]string
+		maxPerRound   int
+		want          [][]string
+		wantUnhealthy []string
+	}{
+		{
+			name: "hosts of one set reboot one at a time",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1}},
+				{endpoint: "b", sets: []int{1}},
+				{endpoint: "c", sets: []int{1}},
+			},
+			want: [][]string{{"a"}, {"b"}, {"c"}},
+		},
+		{
+			name: "several sets reboot together",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1}},
+				{endpoint: "b", sets: []int{1}},
+				{endpoint: "c", sets: []int{2}},
+				{endpoint: "d", sets: []int{2}},
+			},
+			want: [][]string{{"a", "c"}, {"b", "d"}},
+		},
+		{
+			name: "a host spanning sets blocks both",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1, 2}},
+				{endpoint: "b", sets: []int{1}},
+				{endpoint: "c", sets: []int{2}},
+			},
+			want: [][]string{{"a"}, {"b", "c"}},
+		},
+		{
+			name: "a set without parity to spare leaves its hosts out",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1, 2}, blocked: []int{2}},
+				{endpoint: "b", sets: []int{1}},
+				{endpoint: "c", sets: []int{3}},
+			},
+			want:          [][]string{{"b", "c"}},
+			wantUnhealthy: []string{"a"},
+		},
+		{
+			name: "offline hosts are unhealthy",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1}, offline: true},
+				{endpoint: "b", sets: []int{2}},
+			},
+			want:          [][]string{{"b"}},
+			wantUnhealthy: []string{"a"},
+		},
+		{
+			name: "one host per failure domain",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1}},
+				{endpoint: "b", sets: []int{2}},
+				{endpoint: "c", sets: []int{3}},
+			},
+			domains: map[string]string{"a": "rack1", "b": "rack1"},
+			want:    [][]string{{"a", "c"}, {"b"}},
+		},
+		{
+			name: "rounds are capped by -maxPerRound",
+			servers: []testServer{
+				{endpoint: "a", sets: []int{1}},
+				{endpoint: "b", sets: []int{2}},
+				{endpoint: "c", sets: []int{3}},
+			},
+			maxPerRound: 2,
+			want:        [][]string{{"a", "b"}, {"c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxPerRound = tt.maxPerRound
+			rounds, unhealthy := planRounds(testPools(tt.servers), len(tt.servers), tt.domains)
+
+			var got [][]string
+			for _, round := range rounds {
+				var hosts []string
+				for _, servers := range round {
+					for endpoint := range servers {
+						hosts = append(hosts, endpoint)
+					}
+				}
+				if len(hosts) > 0 {
+					sort.Strings(hosts)
+					got = append(got, hosts)
+				}
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("rounds %q, want %q", got, tt.want)
+			}
+			if s := stringKeysSorted(unhealthy); !slices.Equal(s, tt.wantUnhealthy) {
+				t.Errorf("unhealthy %q, want %q", s, tt.wantUnhealthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+type runbookDrive struct {
+	badDrive
+	drivePhysical
+	Verdict     string
+	MountPoint  string
+	FstabDevice string
+	FSType      string
+	Label       string
+	// ByUUID is set when fstab mounts the drive by UUID, which changes
+	// when the new drive is formatted.
+	ByUUID bool
+	Error  string
+}
+
+// MkfsForce is the flag that makes mkfs overwrite an existing filesystem,
+// the ext tools take -F where xfs and btrfs take -f.
+func (r runbookDrive) MkfsForce() string {
+	if strings.HasPrefix(r.FSType, "ext") {
+		return "-F"
+	}
+	return "-f"
+}
+
+type runbookHost struct {
+	Host   string
+	Owner  string
+	Drives []runbookDrive
+}
+
+type runbookData struct {
+	Generated time.Time
+	Tool      string
+	Endpoint  string
+	Hosts     []runbookHost
+}
+
+// minioOwnerScript prints the user and group the minio unit runs as.
+const minioOwnerScript = `systemctl show minio -p User -p Group --value 2>/dev/null`
+
+// runbookFor gathers everything the replacement steps of d need from its
+// host.
+func runbookFor(h *hostData, d badDrive) (r runbookDrive) {
+	r = runbookDrive{badDrive: d, FSType: "xfs"}
+	r.Verdict = diagnoseDrive(h, d).Verdict
+
+	fstab, err := hostFstab(h)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.MountPoint = fstabMountFor(d.Path, fstab)
+	if r.MountPoint == "" {
+		r.Error = "no fstab entry for " + d.Path
+		return
+	}
+	e := fstab[r.MountPoint]
+	r.FstabDevice = e.Device
+	if e.FSType != "" && e.FSType != "auto" {
+		r.FSType = e.FSType
+	}
+	switch {
+	case strings.HasPrefix(e.Device, "LABEL="):
+		r.Label = strings.Trim(strings.TrimPrefix(e.Device, "LABEL="), `"`)
+	case strings.HasPrefix(e.Device, "UUID="):
+		r.ByUUID = true
+	}
+	if r.Label == "" {
+		// Keep the label of the old drive when it can still be read.
+		out, err := h.run("sudo blkid -s LABEL -o value " + shellQuote(fstabDevicePath(e.Device)) + " 2>/dev/null")
+		if err == nil {
+			r.Label = out
+		}
+	}
+
+	r.drivePhysical, err = physicalInfo(h, d.Path)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return
+}
+
+// hostOwner returns user:group of the minio unit on the host, the owner
+// the new drive's mount point needs.
+func hostOwner(h *hostData) string {
+	out, err := h.run(minioOwnerScript)
+	lines := strings.Fields(out)
+	if err != nil || len(lines) != 2 {
+		return "minio-user:minio-user"
+	}
+	return lines[0] + ":" + lines[1]
+}
+
+func buildRunbook() (data runbookData) {
+	data = runbookData{Generated: time.Now(), Tool: "cluster-tool", Endpoint: endpoint}
+	if port != "" {
+		data.Endpoint += " -port " + port
+	}
+	if secure {
+		data.Endpoint += " -secure"
+	}
+
+	byHost := make(map[string]*runbookHost)
+	lock := new(sync.Mutex)
+	forEachHost(badDrives(), func(h *hostData, d badDrive) {
+		r := runbookFor(h, d)
+		owner := hostOwner(h)
+		lock.Lock()
+		defer lock.Unlock()
+		rh, ok := byHost[d.Host]
+		if !ok {
+			rh = &runbookHost{Host: d.Host, Owner: owner}
+			byHost[d.Host] = rh
+		}
+		rh.Drives = append(rh.Drives, r)
+	})
+	for _, rh := range byHost {
+		sort.Slice(rh.Drives, func(i, j int) bool { return rh.Drives[i].Path < rh.Drives[j].Path })
+		data.Hosts = append(data.Hosts, *rh)
+	}
+	sort.Slice(data.Hosts, func(i, j int) bool { return data.Hosts[i].Host < data.Hosts[j].Host })
+	return
+}
+
+func runbook() {
+	data := buildRunbook()
+	if len(data.Hosts) == 0 {
+		fmt.Fprintln(statusOut(), "All drives are ok, there is nothing to replace")
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if runbookOut != "" {
+		f, err := os.Create(runbookOut)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	err := runbookTemplate.Execute(w, data)
+	if err != nil {
+		panic(err)
+	}
+	if runbookOut != "" {
+		fmt.Println("Wrote", runbookOut)
+	}
+}
+
+var runbookTemplate = template.Must(template.New("runbook").Funcs(template.FuncMap{
+	"ts":   func(t time.Time) string { return t.Format(time.RFC3339) },
+	"q":    shellQuote,
+	"dash": orDash,
+}).Parse(`# Drive replacement runbook
+
+Generated {{ts .Generated}} from {{.Endpoint}}.
+{{range .Hosts}}{{$host := .}}
+## {{.Host}}
+{{range .Drives}}
+### {{.Path}}
+
+| | |
+|---|---|
+| MinIO state | {{.State}} |
+| Pool / set | {{.Pool}} / {{.Set}} |
+| Diagnosis | {{.Verdict}} |
+| Device | {{dash .Disk}} |
+| Serial | {{dash .Serial}} |
+| WWN | {{dash .WWN}} |
+| Enclosure slot | {{if .Slot}}{{.Enclosure}} {{.Slot}}{{else}}unknown, match the serial on the drive label{{end}} |
+| Mount point | {{dash .MountPoint}} |
+| fstab device | {{dash .FstabDevice}} |
+{{if .Error}}
+> Not everything could be read from the host: {{.Error}}
+{{end}}{{if .MountPoint}}
+1. Blink the bay LED and confirm the serial on the drive label before pulling anything:
+
+       {{$.Tool}} drive locate -on {{$host.Host}}:{{.Path}}
+
+2. Unmount the drive on {{$host.Host}}, ignore "not mounted":
+
+       sudo umount {{q .MountPoint}}
+
+3. Pull the drive{{if .Serial}} with serial {{.Serial}}{{end}}{{if .Slot}} from {{.Enclosure}} {{.Slot}}{{end}} and insert the new one in the same bay.
+
+4. Find the new drive, it has a new serial and no mount point. It is called /dev/NEW below{{if .Disk}}, it usually takes the name {{.Disk}} again{{end}}:
+
+       lsblk -d -o NAME,SERIAL,WWN,SIZE,MOUNTPOINT
+
+5. Format it:
+
+       sudo mkfs.{{.FSType}} {{.MkfsForce}}{{if .Label}} -L {{q .Label}}{{end}} /dev/NEW
+{{if .ByUUID}}
+6. fstab mounts the drive by UUID, replace {{.FstabDevice}} in /etc/fstab with the UUID of the new filesystem:
+
+       sudo blkid -s UUID -o value /dev/NEW
+{{end}}
+{{if .ByUUID}}7{{else}}6{{end}}. Mount it and hand it to the minio user:
+
+       sudo mount {{q .MountPoint}}
+       sudo chown {{$host.Owner}} {{q .MountPoint}}
+
+{{if .ByUUID}}8{{else}}7{{end}}. Switch the LED off:
+
+       {{$.Tool}} drive locate -off {{$host.Host}}:{{.Path}}
+{{end}}{{end}}
+### After the replacement on {{.Host}}
+
+MinIO formats and heals fresh drives on its own. Start a heal of the affected sets to not wait for the next scan:
+
+    {{$.Tool}} heal -endpoint {{$.Endpoint}} -allServers -priority risk -dryRun=false
+
+Verify:
+
+- every drive of the host is ok and healing has finished: ` + "`" + `{{$.Tool}} disks -endpoint {{$.Endpoint}} -wide` + "`" + `
+- the kernel does not complain about the new drive: ` + "`" + `{{$.Tool}} drive fscheck -endpoint {{$.Endpoint}}` + "`" + ` reports nothing for {{.Host}}
+- no set is at risk anymore: ` + "`" + `{{$.Tool}} sets -endpoint {{$.Endpoint}} -badSetsOnly` + "`" + `
+{{end}}`))
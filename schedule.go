@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// cronField is the set of values one field of a cron expression matches.
+type cronField map[int]bool
+
+// cronSpec is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week.
+type cronSpec struct {
+	minute, hour, dom, month, dow cronField
+	domAny, dowAny                bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@nightly": "0 2 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func parseCronField(s string, min, max int) (f cronField, err error) {
+	f = make(cronField)
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			lo, err = strconv.Atoi(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(b)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			f[v] = true
+		}
+	}
+	return f, nil
+}
+
+func parseCron(expr string) (c *cronSpec, err error) {
+	if alias, ok := cronAliases[expr]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in %q", expr)
+	}
+	c = &cronSpec{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	out := [5]*cronField{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		*out[i], err = parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7.
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	return c, nil
+}
+
+// matches follows cron: when both day of month and day of week are
+// restricted either one matching is enough.
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// scheduleEntry is one line of -schedule.
+type scheduleEntry struct {
+	Line string
+	Cron string
+	Task string
+	Args []string
+
+	spec *cronSpec
+}
+
+// scheduleRun is the result of one execution of an entry.
+type scheduleRun struct {
+	Task     string
+	Started  time.Time
+	Finished time.Time
+	Status   string
+	Message  string
+}
+
+// scheduleTasks are the tasks a schedule can run. Each returns a check
+// status and a one line summary.
+var scheduleTasks = map[string]func(args []string) (status string, message string){
+	"doctor":   scheduledDoctor,
+	"heal":     scheduledHeal,
+	"snapshot": scheduledSnapshot,
+}
+
+// loadSchedule reads a schedule file with one "<cron> <task> [args]" entry
+// per line, where cron is five fields or one of @hourly, @daily, @nightly,
+// @weekly and @monthly:
+//
+//	@nightly doctor
+//	0 3 * * 6 heal 1 2 deep
+//	@hourly snapshot
+func loadSchedule(path string) (entries []*scheduleEntry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		n := 5
+		if strings.HasPrefix(fields[0], "@") {
+			n = 1
+		}
+		if len(fields) <= n {
+			return nil, fmt.Errorf("%s:%d: expected '<cron> <task> [args]'", path, line)
+		}
+		e := &scheduleEntry{Line: text, Cron: strings.Join(fields[:n], " "), Task: fields[n], Args: fields[n+1:]}
+		e.spec, err = parseCron(e.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if _, ok := scheduleTasks[e.Task]; !ok {
+			return nil, fmt.Errorf("%s:%d: unknown task %q, expected doctor, heal or snapshot", path, line, e.Task)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func scheduledDoctor(args []string) (status string, message string) {
+	results := runDoctorChecks(loadDoctorData())
+	status = checkPass
+	var problems []string
+	for _, r := range results {
+		switch r.Status {
+		case checkFail:
+			status = checkFail
+		case checkWarn:
+			if status == checkPass {
+				status = checkWarn
+			}
+		}
+		if r.Status != checkPass {
+			problems = append(problems, r.Check+": "+r.Message)
+		}
+	}
+	if len(problems) == 0 {
+		return status, fmt.Sprintf("all %d checks passed", len(results))
+	}
+	return status, strings.Join(problems, "; ")
+}
+
+// scheduledHeal heals one set, given as a 1 based pool and set like in the
+// rest of the output. "deep" also verifies bitrot checksums.
+func scheduledHeal(args []string) (status string, message string) {
+	if len(args) < 2 || len(args) > 3 {
+		return checkFail, "expected 'heal <pool> <set> [deep]'"
+	}
+	p, perr := strconv.Atoi(args[0])
+	s, serr := strconv.Atoi(args[1])
+	if perr != nil || serr != nil || p < 1 || s < 1 {
+		return checkFail, "pool and set must be numbers starting at 1"
+	}
+	mode := madmin.HealNormalScan
+	if len(args) == 3 {
+		if args[2] != "deep" {
+			return checkFail, "unknown heal mode " + args[2]
+		}
+		mode = madmin.HealDeepScan
+	}
+	err := makeClient()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	l, err := tryLock(fmt.Sprintf("scheduled heal %d %d", p, s))
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer l.release()
+	// A set the API or an earlier run is still healing is left alone.
+	key := fmt.Sprintf("%d/%d", p-1, s-1)
+	healMapLock.Lock()
+	if _, running := healTokens[key]; running || healMap[key] > 0 {
+		healMapLock.Unlock()
+		return checkWarn, fmt.Sprintf("set %d/%d is already healing", p, s)
+	}
+	healMap[key] = 1
+	healMapLock.Unlock()
+	err = healSetMode(p-1, s-1, mode)
+	if err != nil {
+		return checkFail, fmt.Sprintf("heal of set %d/%d failed: %v", p, s, err)
+	}
+	return checkPass, fmt.Sprintf("set %d/%d healed", p, s)
+}
+
+// scheduledSnapshot writes the storage info model to -snapshotDir.
+func scheduledSnapshot(args []string) (status string, message string) {
+	if snapshotDir == "" {
+		return checkFail, "-snapshotDir is not set"
+	}
+	pools, _, err := getInfra()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	b, err := json.Marshal(pools)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	err = os.MkdirAll(snapshotDir, 0o755)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	path := filepath.Join(snapshotDir, "snapshot-"+time.Now().UTC().Format("20060102-150405")+".json")
+	err = os.WriteFile(path, b, 0o644)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	return checkPass, "wrote " + path
+}
+
+// scheduleHistory is how many runs of each entry are kept in memory.
+const scheduleHistory = 20
+
+// scheduler runs schedule entries from serve, an entry is skipped when its
+// previous run has not finished yet.
+type scheduler struct {
+	mu      sync.Mutex
+	entries []*scheduleEntry
+	running map[*scheduleEntry]bool
+	runs    map[*scheduleEntry][]scheduleRun
+}
+
+func newScheduler(entries []*scheduleEntry) *scheduler {
+	return &scheduler{
+		entries: entries,
+		running: make(map[*scheduleEntry]bool),
+		runs:    make(map[*scheduleEntry][]scheduleRun),
+	}
+}
+
+func (s *scheduler) run(e *scheduleEntry) {
+	s.mu.Lock()
+	if s.running[e] {
+		s.mu.Unlock()
+		fmt.Println("Schedule:", e.Line, "is still running, skipped")
+		return
+	}
+	s.running[e] = true
+	s.mu.Unlock()
+
+	r := scheduleRun{Task: e.Task, Started: time.Now()}
+	func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.Status, r.Message = checkFail, fmt.Sprint(rec)
+			}
+		}()
+		r.Status, r.Message = scheduleTasks[e.Task](e.Args)
+	}()
+	r.Finished = time.Now()
+	fmt.Printf("Schedule: %s %s in %s: %s\n", e.Line, strings.ToUpper(r.Status), r.Finished.Sub(r.Started).Round(time.Second), r.Message)
+
+	h := historyEntry{Command: "schedule " + e.Task, Args: e.Args, Started: r.Started, Finished: r.Finished, Outcome: "success"}
+	if r.Status == checkFail {
+		h.Outcome, h.Error = "failed", r.Message
+	}
+	saveHistory(h)
+
+	if scheduleLog != "" {
+		b, _ := json.Marshal(struct {
+			Entry string
+			scheduleRun
+		}{e.Line, r})
+		f, err := os.OpenFile(scheduleLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err == nil {
+			_, err = f.Write(append(b, '\n'))
+			f.Close()
+		}
+		if err != nil {
+			fmt.Println("Unable to write", scheduleLog+":", err)
+		}
+	}
+
+	s.mu.Lock()
+	runs := append(s.runs[e], r)
+	if len(runs) > scheduleHistory {
+		runs = runs[len(runs)-scheduleHistory:]
+	}
+	s.runs[e] = runs
+	s.running[e] = false
+	s.mu.Unlock()
+}
+
+// loop starts the entries matching each minute.
+func (s *scheduler) loop() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(next))
+		for _, e := range s.entries {
+			if e.spec.matches(next) {
+				go s.run(e)
+			}
+		}
+	}
+}
+
+// scheduleStatus is one entry in /v1/schedule.
+type scheduleStatus struct {
+	Entry   string
+	Running bool
+	Runs    []scheduleRun
+}
+
+func (s *scheduler) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	out := []scheduleStatus{}
+	for _, e := range s.entries {
+		out = append(out, scheduleStatus{Entry: e.Line, Running: s.running[e], Runs: append([]scheduleRun{}, s.runs[e]...)})
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleMetrics exposes the last run of every entry for Prometheus.
+func (s *scheduler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP minio_cluster_tool_schedule_success Whether the last run of a scheduled task passed (1), warned (0.5) or failed (0).")
+	fmt.Fprintln(w, "# TYPE minio_cluster_tool_schedule_success gauge")
+	for _, e := range s.entries {
+		runs := s.runs[e]
+		if len(runs) == 0 {
+			continue
+		}
+		v := map[string]string{checkPass: "1", checkWarn: "0.5", checkFail: "0"}[runs[len(runs)-1].Status]
+		fmt.Fprintf(w, "minio_cluster_tool_schedule_success{entry=%q,task=%q} %s\n", e.Line, e.Task, v)
+	}
+	fmt.Fprintln(w, "# HELP minio_cluster_tool_schedule_last_run_timestamp_seconds Unix time the last run of a scheduled task finished.")
+	fmt.Fprintln(w, "# TYPE minio_cluster_tool_schedule_last_run_timestamp_seconds gauge")
+	for _, e := range s.entries {
+		runs := s.runs[e]
+		if len(runs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "minio_cluster_tool_schedule_last_run_timestamp_seconds{entry=%q,task=%q} %d\n", e.Line, e.Task, runs[len(runs)-1].Finished.Unix())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		min, max int
+		want     []int
+		wantErr  bool
+	}{
+		{name: "any", in: "*", min: 0, max: 6, want: []int{0, 1, 2, 3, 4, 5, 6}},
+		{name: "single value", in: "5", min: 0, max: 59, want: []int{5}},
+		{name: "list", in: "1,3,5", min: 0, max: 59, want: []int{1, 3, 5}},
+		{name: "range", in: "9-12", min: 0, max: 23, want: []int{9, 10, 11, 12}},
+		{name: "step of any", in: "*/15", min: 0, max: 59, want: []int{0, 15, 30, 45}},
+		{name: "step of a single value runs to the end", in: "5/15", min: 0, max: 59, want: []int{5, 20, 35, 50}},
+		{name: "step of a range", in: "1-10/3", min: 0, max: 59, want: []int{1, 4, 7, 10}},
+		{name: "range and value", in: "1-2,7", min: 0, max: 7, want: []int{1, 2, 7}},
+		{name: "below the minimum", in: "0", min: 1, max: 31, wantErr: true},
+		{name: "above the maximum", in: "60", min: 0, max: 59, wantErr: true},
+		{name: "range above the maximum", in: "20-24", min: 0, max: 23, wantErr: true},
+		{name: "descending range", in: "10-5", min: 0, max: 59, wantErr: true},
+		{name: "zero step", in: "*/0", min: 0, max: 59, wantErr: true},
+		{name: "not a number", in: "mon", min: 0, max: 7, wantErr: true},
+		{name: "empty list entry", in: "1,", min: 0, max: 59, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseCronField(tt.in, tt.min, tt.max)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", slices.Sorted(maps.Keys(f)))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := slices.Sorted(maps.Keys(f)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{name: "every minute", in: "* * * * *"},
+		{name: "alias", in: "@nightly"},
+		{name: "sunday as 7", in: "0 2 * * 7"},
+		{name: "too few fields", in: "0 2 * *", wantErr: true},
+		{name: "too many fields", in: "0 2 * * * *", wantErr: true},
+		{name: "unknown alias", in: "@sometimes", wantErr: true},
+		{name: "minute out of range", in: "60 * * * *", wantErr: true},
+		{name: "hour out of range", in: "0 24 * * *", wantErr: true},
+		{name: "day of month out of range", in: "0 0 32 * *", wantErr: true},
+		{name: "month out of range", in: "0 0 * 13 *", wantErr: true},
+		{name: "day of week out of range", in: "0 0 * * 8", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCron(tt.in)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got error %v, want one %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2026-10-18 is a Sunday, 2026-10-15 a Thursday.
+	sunday := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	thursday := time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{name: "sunday as 7", expr: "0 2 * * 7", at: sunday, want: true},
+		{name: "sunday as 0", expr: "0 2 * * 0", at: sunday, want: true},
+		{name: "sunday as 7 not on thursday", expr: "0 2 * * 7", at: thursday, want: false},
+		{name: "weekday range", expr: "0 2 * * 1-5", at: thursday, want: true},
+		{name: "weekday range not on sunday", expr: "0 2 * * 1-5", at: sunday, want: false},
+		{name: "wrong minute", expr: "30 2 * * *", at: sunday, want: false},
+		{name: "stepped minute", expr: "5/15 * * * *", at: sunday.Add(35 * time.Minute), want: true},
+		{name: "stepped minute off the step", expr: "5/15 * * * *", at: sunday.Add(30 * time.Minute), want: false},
+		{name: "day of month only", expr: "0 2 15 * *", at: thursday, want: true},
+		{name: "day of month or day of week, by month", expr: "0 2 15 * 0", at: thursday, want: true},
+		{name: "day of month or day of week, by week", expr: "0 2 15 * 0", at: sunday, want: true},
+		{name: "neither day matches", expr: "0 2 1 * 1", at: thursday, want: false},
+		{name: "wrong month", expr: "0 2 * 11 *", at: thursday, want: false},
+		{name: "alias", expr: "@nightly", at: thursday, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.matches(tt.at); got != tt.want {
+				t.Errorf("%s at %s: got %t, want %t", tt.expr, tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaVersion is the version of the JSON documents the commands print.
+// Within a version fields are only ever added: a field is never renamed,
+// removed or given another type, and a command's data keeps its shape.
+// Consumers must ignore fields they do not know. Any other change bumps the
+// version, -schemaVersion keeps printing the previous one.
+//
+// Version 1 is the bare data as printed before the output was versioned and
+// stays the default so existing consumers keep working, version 2 wraps it
+// in a jsonDocument and is asked for with -schemaVersion 2.
+const schemaVersion = 2
+
+// jsonDocument is the envelope of every JSON output from version 2 on.
+type jsonDocument struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Command       string `json:"command"`
+	Data          any    `json:"data"`
+}
+
+// jsonCommand is the command whose output jsonOut prints.
+var jsonCommand string
+
+// jsonOneOf is the Output of commands printing one of several documents,
+// depending on their arguments.
+type jsonOneOf []any
+
+// jsonVersions is the Output of commands whose data changed shape, keyed by
+// the schema version each shape was introduced in.
+type jsonVersions map[int]any
+
+// forVersion returns the shape printed with -schemaVersion v.
+func (j jsonVersions) forVersion(v int) (out any) {
+	best := 0
+	for version, o := range j {
+		if version <= v && version > best {
+			best, out = version, o
+		}
+	}
+	return
+}
+
+func jsonOut(b interface{}) {
+	if queryFields != "" || queryFilter != nil {
+		b = applyQuery(b)
+	}
+	if outputTemplate != nil {
+		renderTemplate(b)
+		return
+	}
+	var doc interface{} = b
+	if outputSchemaVersion >= 2 {
+		doc = jsonDocument{SchemaVersion: schemaVersion, Command: jsonCommand, Data: b}
+	}
+	outb, err := json.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(outb))
+}
+
+// printOutputSchema prints the JSON Schema of the output of cmd.
+func printOutputSchema(cmd *command) {
+	if cmd.Output == nil {
+		panic(cmd.Name + " has no JSON output")
+	}
+	if outputSchemaVersion < 1 || outputSchemaVersion > schemaVersion {
+		panic(fmt.Sprintf("invalid -schemaVersion %d, expected 1 to %d", outputSchemaVersion, schemaVersion))
+	}
+
+	output := cmd.Output
+	if versions, ok := output.(jsonVersions); ok {
+		output = versions.forVersion(outputSchemaVersion)
+	}
+	g := &schemaGenerator{defs: make(map[string]any)}
+	var data map[string]any
+	if alts, ok := output.(jsonOneOf); ok {
+		var oneOf []any
+		for _, a := range alts {
+			oneOf = append(oneOf, g.of(reflect.TypeOf(a)))
+		}
+		data = map[string]any{"oneOf": oneOf}
+	} else {
+		data = g.of(reflect.TypeOf(output))
+	}
+
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     fmt.Sprintf("https://github.com/zveinn/minio-cluster-tool/schema/v%d/%s.json", outputSchemaVersion, strings.ReplaceAll(cmd.Name, " ", "-")),
+		"title":   "cluster-tool " + cmd.Name,
+	}
+	if outputSchemaVersion >= 2 {
+		schema["type"] = "object"
+		schema["required"] = []string{"schemaVersion", "command", "data"}
+		schema["properties"] = map[string]any{
+			"schemaVersion": map[string]any{"const": schemaVersion},
+			"command":       map[string]any{"const": cmd.Name},
+			"data":          data,
+		}
+	} else {
+		for k, v := range data {
+			schema[k] = v
+		}
+	}
+	if len(g.defs) > 0 {
+		schema["$defs"] = g.defs
+	}
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(out))
+}
+
+// schemaGenerator derives JSON Schemas from Go types the way encoding/json
+// marshals them. Named structs become $defs so they are described once.
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) of(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]any{"type": "integer", "description": "duration in nanoseconds"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return map[string]any{"description": "custom encoding of " + t.String()}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Pointer:
+		return nullable(g.of(t.Elem()))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nullable(map[string]any{"type": "string", "contentEncoding": "base64"})
+		}
+		return nullable(map[string]any{"type": "array", "items": g.of(t.Elem())})
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": g.of(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": g.of(t.Elem())})
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.Name()
+		if t.PkgPath() != "main" {
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		if _, ok := g.defs[name]; !ok {
+			// Reserve the name first, types can refer to themselves.
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	// Interfaces can hold anything.
+	return map[string]any{}
+}
+
+// object describes the fields of a struct, embedded structs without a name
+// contribute their fields like encoding/json does.
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					add(ft)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = g.of(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+// nullable allows null next to s, encoding/json prints nil pointers, slices
+// and maps as null.
+func nullable(s map[string]any) map[string]any {
+	if t, ok := s["type"].(string); ok {
+		s["type"] = []string{t, "null"}
+		return s
+	}
+	return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Release artifacts are expected to be named cluster-tool-<os>-<arch> and
+// accompanied by a SHA256SUMS file, optionally signed as SHA256SUMS.minisig.
+const checksumAsset = "SHA256SUMS"
+
+func releaseAssetName() string {
+	name := "cluster-tool-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func httpGet(url string) (body []byte, err error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func latestRelease(repo string) (r githubRelease, err error) {
+	body, err := httpGet("https://api.github.com/repos/" + repo + "/releases/latest")
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &r)
+	return
+}
+
+func (r githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// checksumFor returns the hex encoded SHA256 listed for name in a
+// sha256sum formatted file.
+func checksumFor(sums []byte, name string) (sum string, err error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+func verifySHA256(data []byte, expected string) error {
+	h := sha256.Sum256(data)
+	got := hex.EncodeToString(h[:])
+	if got != expected {
+		return fmt.Errorf("checksum mismatch: expected %s got %s", expected, got)
+	}
+	return nil
+}
+
+// replaceExecutable atomically swaps the running binary with data.
+func replaceExecutable(data []byte) (path string, err error) {
+	path, err = os.Executable()
+	if err != nil {
+		return
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cluster-tool-update-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o755)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+func selfUpdate() {
+	release, err := latestRelease(updateRepo)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Current(%s) Latest(%s)\n", version, release.TagName)
+	if release.TagName == version && !updateForce {
+		fmt.Println("Already up to date")
+		return
+	}
+	if updateCheckOnly {
+		return
+	}
+	if updatePublicKey == "" && !updateInsecure {
+		panic("-publicKey is required to verify the release, -insecure installs it unverified")
+	}
+
+	asset := releaseAssetName()
+	binURL := release.assetURL(asset)
+	sumsURL := release.assetURL(checksumAsset)
+	if binURL == "" || sumsURL == "" {
+		panic(fmt.Sprintf("release %s has no %s or %s asset", release.TagName, asset, checksumAsset))
+	}
+
+	sums, err := httpGet(sumsURL)
+	if err != nil {
+		panic(err)
+	}
+
+	if updatePublicKey != "" {
+		sigURL := release.assetURL(checksumAsset + ".minisig")
+		if sigURL == "" {
+			panic("release " + release.TagName + " is not signed")
+		}
+		sig, err := httpGet(sigURL)
+		if err != nil {
+			panic(err)
+		}
+		err = verifyMinisign(updatePublicKey, sums, sig)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("Signature verified")
+	} else {
+		fmt.Println("WARNING: -insecure given, the checksum file signature is not verified")
+	}
+
+	expected, err := checksumFor(sums, asset)
+	if err != nil {
+		panic(err)
+	}
+
+	bin, err := httpGet(binURL)
+	if err != nil {
+		panic(err)
+	}
+	err = verifySHA256(bin, expected)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Checksum verified:", expected)
+
+	path, err := replaceExecutable(bin)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Updated", path, "to", release.TagName)
+}
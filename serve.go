@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clusterCache is the cluster model kept by serve. It is reloaded every
+// -refresh, requests are answered from the last successful load.
+type clusterCache struct {
+	mu           sync.Mutex
+	pools        map[string]*Pool
+	totalServers int
+	loaded       time.Time
+	err          error
+}
+
+func (c *clusterCache) refresh() {
+	pools, total, err := getInfra()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err != nil {
+		fmt.Println("Unable to refresh cluster model:", err)
+		return
+	}
+	c.pools, c.totalServers, c.loaded = pools, total, time.Now()
+}
+
+// serveStatus is returned by /v1/status.
+type serveStatus struct {
+	Loaded time.Time
+	Age    string
+	Error  string `json:",omitempty"`
+}
+
+// healStatus is one set in /v1/heal.
+type healStatus struct {
+	Pool    int
+	Set     int
+	Running bool
+	Invalid int
+	Started *time.Time `json:",omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"Error": err.Error()})
+}
+
+// withModel runs fn with the cached model locked, answering 503 until the
+// first load succeeded.
+func (c *clusterCache) withModel(w http.ResponseWriter, fn func(pools map[string]*Pool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pools == nil {
+		err := c.err
+		if err == nil {
+			err = fmt.Errorf("cluster model is not loaded yet")
+		}
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	fn(c.pools)
+}
+
+func (c *clusterCache) handleStatus(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	st := serveStatus{Loaded: c.loaded, Age: time.Since(c.loaded).Round(time.Second).String()}
+	if c.err != nil {
+		st.Error = c.err.Error()
+	}
+	c.mu.Unlock()
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (c *clusterCache) handleInfo(w http.ResponseWriter, r *http.Request) {
+	c.withModel(w, func(pools map[string]*Pool) {
+		writeJSON(w, http.StatusOK, pools)
+	})
+}
+
+func (c *clusterCache) handleSets(w http.ResponseWriter, r *http.Request) {
+	c.withModel(w, func(pools map[string]*Pool) {
+		writeJSON(w, http.StatusOK, setSummaries(pools))
+	})
+}
+
+func (c *clusterCache) handleDisks(w http.ResponseWriter, r *http.Request) {
+	c.withModel(w, func(pools map[string]*Pool) {
+		writeJSON(w, http.StatusOK, allDisks(pools, r.URL.Query().Get("bad") == "true"))
+	})
+}
+
+// handleHostfile plans reboot rounds from the cached model, the same as
+// 'hostfile -format json'.
+func (c *clusterCache) handleHostfile(w http.ResponseWriter, r *http.Request) {
+	c.withModel(w, func(pools map[string]*Pool) {
+		for _, p := range pools {
+			for _, s := range p.Servers {
+				s.Processed = false
+			}
+		}
+		rounds, unhealthy := planRounds(pools, c.totalServers, nil)
+		writeJSON(w, http.StatusOK, newHostfileDocument(rounds, unhealthy))
+	})
+}
+
+// handleHeal starts heal sequences on POST and lists them on GET. Pool and
+// set are 1 based like in the rest of the output, without them every set is
+// healed.
+func (c *clusterCache) handleHeal(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		healMapLock.Lock()
+		status := []healStatus{}
+		for _, key := range stringKeysSorted(healMap) {
+			var pool, set int
+			fmt.Sscanf(key, "%d/%d", &pool, &set)
+			st := healStatus{Pool: pool + 1, Set: set + 1, Invalid: healMap[key]}
+			if t, ok := healTokens[key]; ok {
+				st.Running = true
+				started := t.StartTime
+				st.Started = &started
+			}
+			status = append(status, st)
+		}
+		healMapLock.Unlock()
+		writeJSON(w, http.StatusOK, status)
+		return
+	case http.MethodPost:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use GET or POST"))
+		return
+	}
+
+	var targets [][2]int
+	ok := false
+	c.withModel(w, func(pools map[string]*Pool) {
+		sets := setSummaries(pools)
+		q := r.URL.Query()
+		if q.Get("pool") == "" {
+			for _, pid := range stringKeysSorted(sets) {
+				p, _ := strconv.Atoi(pid)
+				var ids []int
+				for id := range sets[pid] {
+					ids = append(ids, id)
+				}
+				sort.Ints(ids)
+				for _, id := range ids {
+					targets = append(targets, [2]int{p - 1, id - 1})
+				}
+			}
+			ok = true
+			return
+		}
+		p, perr := strconv.Atoi(q.Get("pool"))
+		s, serr := strconv.Atoi(q.Get("set"))
+		if perr != nil || serr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("pool and set must be numbers"))
+			return
+		}
+		if _, found := sets[strconv.Itoa(p)][s]; !found {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no set %d/%d", p, s))
+			return
+		}
+		targets = append(targets, [2]int{p - 1, s - 1})
+		ok = true
+	})
+	if !ok {
+		return
+	}
+
+	l, err := tryLock("serve heal " + r.URL.RawQuery)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	// The lock is held until every heal started here is finished, at most
+	// -healWorkers of them run at once.
+	workers := healWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	var failed atomic.Int64
+	began, query := time.Now(), r.URL.RawQuery
+	started := []healStatus{}
+	healMapLock.Lock()
+	for _, t := range targets {
+		key := fmt.Sprintf("%d/%d", t[0], t[1])
+		if _, running := healTokens[key]; running || healMap[key] > 0 {
+			continue
+		}
+		healMap[key] = 1
+		started = append(started, healStatus{Pool: t[0] + 1, Set: t[1] + 1, Running: true})
+		wg.Add(1)
+		go func(pool, set int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if healSet(pool, set) != nil {
+				failed.Add(1)
+			}
+		}(t[0], t[1])
+	}
+	healMapLock.Unlock()
+	go func() {
+		wg.Wait()
+		l.release()
+		if len(started) == 0 {
+			return
+		}
+		e := historyEntry{Command: "serve heal", Args: []string{query}, Started: began, Finished: time.Now(), Outcome: "success", Failures: failed.Load()}
+		if e.Failures > 0 {
+			e.Outcome = "failed"
+		}
+		saveHistory(e)
+	}()
+	writeJSON(w, http.StatusAccepted, started)
+}
+
+// rebootJob is the round of reboots started through the API, only one runs
+// at a time.
+type rebootJob struct {
+	Hosts    []string
+	DryRun   bool
+	Running  bool
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+	Error    string     `json:",omitempty"`
+	Failures []string   `json:",omitempty"`
+}
+
+var (
+	currentReboot     *rebootJob
+	currentRebootLock sync.Mutex
+)
+
+// plannedRound refuses hosts that can not reboot together. The cluster model
+// is loaded again and every host has to be in the same round hostfile would
+// plan from it right now.
+func plannedRound(hosts []string) error {
+	pools, totalServers, err := getInfra()
+	if err != nil {
+		return fmt.Errorf("loading the cluster model: %w", err)
+	}
+	var domains map[string]string
+	if topologyFile != "" {
+		domains, err = loadTopology(topologyFile)
+		if err != nil {
+			return err
+		}
+	}
+	rounds, unhealthy := planRounds(pools, totalServers, domains)
+	roundOf := make(map[string]int)
+	for ri, rv := range rounds {
+		for _, servers := range rv {
+			for host := range servers {
+				roundOf[host] = ri
+			}
+		}
+	}
+	first := -1
+	for _, h := range hosts {
+		if _, ok := unhealthy[h]; ok {
+			return fmt.Errorf("%s can not be rebooted, a set it belongs to can not lose it", h)
+		}
+		ri, ok := roundOf[h]
+		if !ok {
+			return fmt.Errorf("%s is not in any planned round", h)
+		}
+		if first < 0 {
+			first = ri
+		} else if ri != first {
+			return fmt.Errorf("%s and %s are in different rounds, reboot one planned round at a time", hosts[0], h)
+		}
+	}
+	return nil
+}
+
+// handleReboot starts a round of reboots on POST and reports the last one on
+// GET. The body is {"Hosts": [...], "Confirm": true}, the hosts have to be
+// one of the rounds planned from the current cluster state. The flags given
+// to serve decide between a dry run and a real reboot.
+func handleReboot(w http.ResponseWriter, r *http.Request) {
+	currentRebootLock.Lock()
+	defer currentRebootLock.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, currentReboot)
+		return
+	case http.MethodPost:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use GET or POST"))
+		return
+	}
+
+	// A form posted from another site can not set this content type.
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("the body must be application/json"))
+		return
+	}
+	var req struct {
+		Hosts   []string
+		Confirm bool
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Hosts) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no hosts given"))
+		return
+	}
+	if !req.Confirm {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("reboots have to be confirmed"))
+		return
+	}
+	if currentReboot != nil && currentReboot.Running {
+		writeError(w, http.StatusConflict, fmt.Errorf("a reboot of %v is still running", currentReboot.Hosts))
+		return
+	}
+	err = plannedRound(req.Hosts)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	var l *opLock
+	if !dryRun {
+		l, err = tryLock("serve reboot " + strings.Join(req.Hosts, " "))
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	}
+
+	job := &rebootJob{Hosts: req.Hosts, DryRun: dryRun, Running: true, Started: time.Now()}
+	currentReboot = job
+	go func() {
+		defer l.release()
+		defer func() {
+			rec := recover()
+			currentRebootLock.Lock()
+			defer currentRebootLock.Unlock()
+			if rec != nil {
+				job.Error = fmt.Sprint(rec)
+			}
+			hostFailures.Lock()
+			for _, h := range req.Hosts {
+				for _, msg := range hostFailures.errs[h] {
+					job.Failures = append(job.Failures, h+": "+msg)
+				}
+			}
+			hostFailures.Unlock()
+			now := time.Now()
+			job.Finished = &now
+			job.Running = false
+
+			e := historyEntry{Command: "serve reboot", Args: req.Hosts, DryRun: job.DryRun, Started: job.Started, Finished: now, Outcome: "success", Error: job.Error, Hosts: req.Hosts}
+			if job.Error != "" || len(job.Failures) > 0 {
+				e.Outcome = "failed"
+			}
+			go saveHistory(e)
+		}()
+		hostFailures.Lock()
+		for _, h := range req.Hosts {
+			delete(hostFailures.errs, h)
+		}
+		hostFailures.Unlock()
+		fmt.Println("Reboot requested through the API:", req.Hosts)
+		rebootHosts(req.Hosts)
+	}()
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func serve() {
+	// Every handler shares this client, it is not replaced while serving.
+	if err := makeClient(); err != nil {
+		panic(err)
+	}
+	cache := new(clusterCache)
+	cache.refresh()
+	go func() {
+		for range time.Tick(serveRefresh) {
+			cache.refresh()
+		}
+	}()
+
+	auth, err := newAPIAuth()
+	if err != nil {
+		panic(err)
+	}
+	if !auth.enabled() {
+		if !loopbackOnly(serveListen) {
+			panic("-tokenFile or -oidcIssuer is required to serve on " + serveListen + ", without them anyone who can reach it can heal and reboot")
+		}
+		fmt.Println("WARNING: no -tokenFile or -oidcIssuer given, anyone on this host can heal and reboot")
+	}
+
+	sched := newScheduler(nil)
+	if scheduleFile != "" {
+		entries, err := loadSchedule(scheduleFile)
+		if err != nil {
+			panic(err)
+		}
+		sched = newScheduler(entries)
+		for _, e := range entries {
+			fmt.Println("Scheduled:", e.Line)
+		}
+		go sched.loop()
+	}
+
+	// The UI page holds no data, it asks for a token and sends it with
+	// every API request.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", auth.require(roleRead, roleRead, cache.handleStatus))
+	mux.HandleFunc("/v1/info", auth.require(roleRead, roleRead, cache.handleInfo))
+	mux.HandleFunc("/v1/sets", auth.require(roleRead, roleRead, cache.handleSets))
+	mux.HandleFunc("/v1/disks", auth.require(roleRead, roleRead, cache.handleDisks))
+	mux.HandleFunc("/v1/hostfile", auth.require(roleRead, roleRead, cache.handleHostfile))
+	mux.HandleFunc("/v1/heal", auth.require(roleRead, roleOperator, cache.handleHeal))
+	mux.HandleFunc("/v1/reboot", auth.require(roleRead, roleAdmin, handleReboot))
+	mux.HandleFunc("/v1/schedule", auth.require(roleRead, roleRead, sched.handleSchedule))
+	mux.HandleFunc("/metrics", auth.require(roleRead, roleRead, sched.handleMetrics))
+	mux.HandleFunc("/", handleUI)
+
+	fmt.Println("Serving the API on", serveListen, "refreshing every", serveRefresh)
+	err = http.ListenAndServe(serveListen, mux)
+	if err != nil {
+		panic(err)
+	}
+}
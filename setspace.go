@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// MinIO places objects by hash on every set of a pool, one nearly full set
+// slows down writes to the whole pool long before the pool average shows
+// it. The defaults apply to every command running the doctor checks, the
+// ones showing set usage can change them.
+var (
+	setUsageWarn float64 = 80
+	setUsageFail float64 = 90
+)
+
+func setSpaceFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&setUsageWarn, "setWarn", 80, "Warn about erasure sets with at least this percentage of their space used")
+	fs.Float64Var(&setUsageFail, "setFail", 90, "Fail erasure sets with at least this percentage of their space used")
+}
+
+// setUsage is the space of one erasure set across all its servers.
+type setUsage struct {
+	Pool   string
+	Set    int
+	Used   uint64
+	Total  uint64
+	Pct    float64
+	Status string
+}
+
+func setUsages(pools map[string]*Pool) (usages []setUsage) {
+	for pid, sets := range setSummaries(pools) {
+		for id, s := range sets {
+			u := setUsage{Pool: pid, Set: id, Status: checkPass}
+			for _, d := range s.Disks {
+				u.Used += d.UsedSpace
+				u.Total += d.TotalSpace
+			}
+			if u.Total == 0 {
+				continue
+			}
+			u.Pct = float64(u.Used) / float64(u.Total) * 100
+			switch {
+			case u.Pct >= setUsageFail:
+				u.Status = checkFail
+			case u.Pct >= setUsageWarn:
+				u.Status = checkWarn
+			}
+			usages = append(usages, u)
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Pool != usages[j].Pool {
+			return naturalLess(usages[i].Pool, usages[j].Pool)
+		}
+		return usages[i].Set < usages[j].Set
+	})
+	return
+}
+
+// checkSetSpace flags erasure sets above -setWarn or -setFail, one result
+// per pool when all its sets are fine.
+func checkSetSpace(d *doctorData) (r []checkResult) {
+	if d.poolsErr != nil {
+		return []checkResult{newResult("setspace", checkFail, d.poolsErr.Error(), "")}
+	}
+	fullest := make(map[string]float64)
+	var pools []string
+	for _, u := range setUsages(d.pools) {
+		if _, ok := fullest[u.Pool]; !ok {
+			pools = append(pools, u.Pool)
+		}
+		switch u.Status {
+		case checkFail:
+			r = append(r, newResult("setspace", checkFail, fmt.Sprintf("set %s/%d is %.1f%% used", u.Pool, u.Set, u.Pct), "Expand the cluster or free up space, writes to the pool slow down"))
+		case checkWarn:
+			r = append(r, newResult("setspace", checkWarn, fmt.Sprintf("set %s/%d is %.1f%% used", u.Pool, u.Set, u.Pct), "Plan a pool expansion, this set fills up before the pool does"))
+		}
+		fullest[u.Pool] = max(fullest[u.Pool], u.Pct)
+	}
+	if len(r) > 0 {
+		return r
+	}
+	for _, pid := range pools {
+		r = append(r, newResult("setspace", checkPass, fmt.Sprintf("every set of pool %s is below %.0f%%, the fullest at %.1f%%", pid, setUsageWarn, fullest[pid]), ""))
+	}
+	return
+}
+
+func setsUsage() {
+	pools, _, err := getInfra()
+	if err != nil {
+		panic(err)
+	}
+	usages := setUsages(pools)
+	for _, u := range usages {
+		if u.Status == checkFail {
+			exitCode = 1
+		}
+	}
+	if jsonOutput {
+		jsonOut(usages)
+		return
+	}
+	fmt.Printf("%-5s %-4s %-4s %-10s %-10s %s\n", "", "POOL", "SET", "USED", "CAPACITY", "USED%")
+	for _, u := range usages {
+		fmt.Printf("%-5s %-4s %-4d %-10s %-10s %.1f%%\n", strings.ToUpper(u.Status), u.Pool, u.Set, humanize.IBytes(u.Used), humanize.IBytes(u.Total), u.Pct)
+	}
+}
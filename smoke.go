@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// smokeStep is the result of one step of the smoke test.
+type smokeStep struct {
+	Step    string
+	Status  string
+	Latency time.Duration
+	Error   string `json:",omitempty"`
+}
+
+const (
+	smokeObjectSize = 12 << 20
+	smokePartSize   = 5 << 20
+)
+
+// smokeTest runs a short S3 scenario against -endpoint: create a bucket, a
+// multipart upload, a range GET, a listing and cleanup. After the first failure
+// the remaining steps are skipped, cleanup always runs.
+func smokeTest() (steps []smokeStep) {
+	client, err := s3Client(endpoint)
+	if err != nil {
+		return []smokeStep{{Step: "client", Status: checkFail, Error: err.Error()}}
+	}
+	ctx := context.Background()
+
+	bucket := smokeBucket
+	if bucket == "" {
+		bucket = fmt.Sprintf("cluster-tool-smoke-%d", time.Now().Unix())
+	}
+	object := "smoke/multipart.bin"
+	payload := make([]byte, smokeObjectSize)
+	_, _ = rand.Read(payload)
+
+	failed := false
+	run := func(name string, fn func() error) {
+		if failed {
+			steps = append(steps, smokeStep{Step: name, Status: "skip"})
+			return
+		}
+		start := time.Now()
+		err := fn()
+		s := smokeStep{Step: name, Status: checkPass, Latency: time.Since(start)}
+		if err != nil {
+			s.Status = checkFail
+			s.Error = err.Error()
+			failed = true
+		}
+		steps = append(steps, s)
+	}
+
+	run("create-bucket", func() error {
+		return client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
+	})
+	created := !failed
+
+	run("multipart-upload", func() error {
+		_, err := client.PutObject(ctx, bucket, object, bytes.NewReader(payload), int64(len(payload)), minio.PutObjectOptions{
+			PartSize: smokePartSize,
+		})
+		return err
+	})
+
+	run("range-get", func() error {
+		opts := minio.GetObjectOptions{}
+		start, end := int64(smokePartSize-512), int64(smokePartSize+511)
+		err := opts.SetRange(start, end)
+		if err != nil {
+			return err
+		}
+		obj, err := client.GetObject(ctx, bucket, object, opts)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		got, err := io.ReadAll(obj)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, payload[start:end+1]) {
+			return fmt.Errorf("range %d-%d returned %d bytes that do not match the upload", start, end, len(got))
+		}
+		return nil
+	})
+
+	run("list", func() error {
+		found := false
+		for info := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+			if info.Err != nil {
+				return info.Err
+			}
+			if info.Key == object {
+				found = info.Size == int64(len(payload))
+				if !found {
+					return fmt.Errorf("%s is listed with size %d, expected %d", object, info.Size, len(payload))
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not listed", object)
+		}
+		return nil
+	})
+
+	// Cleanup runs even after a failure so the cluster is left as it was.
+	failed = false
+	if created {
+		run("delete-object", func() error {
+			return client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{})
+		})
+		failed = false
+		run("delete-bucket", func() error {
+			return client.RemoveBucket(ctx, bucket)
+		})
+	}
+	return
+}
+
+func smoke() {
+	steps := smokeTest()
+	for _, s := range steps {
+		if s.Status == checkFail {
+			exitCode = 1
+		}
+	}
+
+	if jsonOutput {
+		jsonOut(steps)
+		return
+	}
+	for _, s := range steps {
+		latency := ""
+		if s.Status != "skip" {
+			latency = s.Latency.Round(time.Millisecond).String()
+		}
+		fmt.Printf("%-5s %-17s %8s %s\n", strings.ToUpper(s.Status), s.Step, latency, s.Error)
+	}
+}
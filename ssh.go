@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshPool keeps one client per host so a host can be sent several commands
+// without reconnecting. Every command runs in its own session.
+// A host is dialed outside the lock, callers asking for a host that is
+// being dialed wait for that dial.
+var sshPool = struct {
+	sync.Mutex
+	clients map[string]*ssh.Client
+	dialing map[string]*sshDialing
+}{clients: make(map[string]*ssh.Client), dialing: make(map[string]*sshDialing)}
+
+// sshDialing is a dial in progress, done is closed once client or err is set.
+type sshDialing struct {
+	done   chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// sshAgent is the client of the ssh agent at $SSH_AUTH_SOCK, connected once
+// and shared by every dial. It is nil without an agent.
+var sshAgent = sync.OnceValue(func() agent.ExtendedAgent {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil
+	}
+	return agent.NewClient(conn)
+})
+
+// sshAuthMethods uses -sshKey when given, otherwise the ssh agent and the
+// default keys in ~/.ssh.
+func sshAuthMethods() (methods []ssh.AuthMethod, err error) {
+	keys := []string{sshKey}
+	if sshKey == "" {
+		if a := sshAgent(); a != nil {
+			methods = append(methods, ssh.PublicKeysCallback(a.Signers))
+		}
+		home, _ := os.UserHomeDir()
+		keys = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, k := range keys {
+		pem, rerr := os.ReadFile(k)
+		if rerr != nil {
+			if sshKey != "" {
+				return nil, rerr
+			}
+			continue
+		}
+		signer, perr := ssh.ParsePrivateKey(pem)
+		if perr != nil {
+			if sshKey != "" {
+				return nil, fmt.Errorf("%s: %w", k, perr)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no ssh agent or private key found, see -sshKey")
+	}
+	return
+}
+
+// sshDial connects to host, retrying with exponential backoff up to
+// -sshRetries times.
+func sshDial(host string) (client *ssh.Client, err error) {
+	auth, err := sshAuthMethods()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            sshUser,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		client, err = ssh.Dial("tcp", net.JoinHostPort(host, sshPort), config)
+		if err == nil || attempt >= sshRetries {
+			break
+		}
+		fmt.Printf("SSH to %s failed (%v), retrying in %s\n", host, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	// -port was the ssh port before -sshPort existed, hosts that only
+	// accept ssh there still work but are told to pass -sshPort.
+	if err != nil && !flagsGiven["sshPort"] && port != "" && port != sshPort {
+		legacy, lerr := ssh.Dial("tcp", net.JoinHostPort(host, port), config)
+		if lerr == nil {
+			sshLegacyPort.Do(func() {
+				fmt.Printf("WARNING: %s accepts ssh on -port %s, -port is the MinIO API port now, pass -sshPort %s\n", host, port, port)
+			})
+			return legacy, nil
+		}
+		err = fmt.Errorf("%w, -port is the MinIO API port, set -sshPort if ssh does not listen on %s", err, sshPort)
+	}
+	return
+}
+
+var sshLegacyPort sync.Once
+
+func sshClient(host string) (*ssh.Client, error) {
+	sshPool.Lock()
+	if c, ok := sshPool.clients[host]; ok {
+		sshPool.Unlock()
+		return c, nil
+	}
+	if d, ok := sshPool.dialing[host]; ok {
+		sshPool.Unlock()
+		<-d.done
+		return d.client, d.err
+	}
+	d := &sshDialing{done: make(chan struct{})}
+	sshPool.dialing[host] = d
+	sshPool.Unlock()
+
+	d.client, d.err = sshDial(host)
+
+	sshPool.Lock()
+	delete(sshPool.dialing, host)
+	if d.err == nil {
+		sshPool.clients[host] = d.client
+	}
+	sshPool.Unlock()
+	close(d.done)
+	return d.client, d.err
+}
+
+// sshForget closes and removes the pooled client of host, for example after
+// the host was rebooted.
+func sshForget(host string) {
+	sshPool.Lock()
+	defer sshPool.Unlock()
+	if c, ok := sshPool.clients[host]; ok {
+		c.Close()
+		delete(sshPool.clients, host)
+	}
+}
+
+// runSSH runs cmd on host and returns its combined output. A pooled
+// connection that went stale is replaced once before giving up.
+func runSSH(host string, cmd string) (output []byte, err error) {
+	client, err := sshClient(host)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		sshForget(host)
+		client, err = sshClient(host)
+		if err != nil {
+			return nil, err
+		}
+		session, err = client.NewSession()
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer session.Close()
+
+	if sshCommandTimeout <= 0 {
+		return session.CombinedOutput(cmd)
+	}
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := session.CombinedOutput(cmd)
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-time.After(sshCommandTimeout):
+		// Not every sshd honors signals, dropping the connection makes sure
+		// the session ends either way.
+		_ = session.Signal(ssh.SIGKILL)
+		sshForget(host)
+		return nil, fmt.Errorf("timed out after %s", sshCommandTimeout)
+	}
+}
+
+// scpUpload copies data to dir/name on host with the scp protocol, which
+// works with any sshd without needing an sftp subsystem.
+func scpUpload(host, dir, name string, data []byte, mode os.FileMode) error {
+	client, err := sshClient(host)
+	if err != nil {
+		return err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = session.Start("scp -qt " + shellQuote(dir))
+	if err != nil {
+		return err
+	}
+	err = scpSend(stdin, bufio.NewReader(stdout), name, data, mode)
+	stdin.Close()
+	if werr := session.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// stagingDir makes a private directory on host for files copied there
+// before they are installed, another user could replace or read a file at a
+// fixed path in /tmp in between. The caller removes it with removeStaging.
+func stagingDir(host string) (string, error) {
+	out, err := runSSH(host, "mktemp -d")
+	dir := strings.TrimSpace(string(out))
+	if err != nil {
+		return "", fmt.Errorf("mktemp -d: %w: %s", err, dir)
+	}
+	if !strings.HasPrefix(dir, "/") {
+		return "", fmt.Errorf("mktemp -d printed %q", dir)
+	}
+	return dir, nil
+}
+
+func removeStaging(host, dir string) {
+	output, err := runSSH(host, "rm -rf "+shellQuote(dir))
+	if err != nil {
+		fmt.Printf("Unable to remove %s:%s: %v: %s\n", host, dir, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// scpSend speaks the source side of scp to a sink started with 'scp -t'.
+// The sink acknowledges every message with a zero byte, or an error line.
+func scpSend(w io.Writer, r *bufio.Reader, name string, data []byte, mode os.FileMode) (err error) {
+	ack := func() error {
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("scp: %w", err)
+		}
+		if b != 0 {
+			msg, _ := r.ReadString('\n')
+			return fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+		}
+		return nil
+	}
+	if err = ack(); err != nil {
+		return
+	}
+	if _, err = fmt.Fprintf(w, "C%04o %d %s\n", mode.Perm(), len(data), name); err != nil {
+		return
+	}
+	if err = ack(); err != nil {
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		return
+	}
+	if _, err = w.Write([]byte{0}); err != nil {
+		return
+	}
+	return ack()
+}
+
+// hostFailures collects the hosts an operation failed on so they can be
+// listed once the command finishes instead of scrolling past.
+var hostFailures = struct {
+	sync.Mutex
+	errs map[string][]string
+}{errs: make(map[string][]string)}
+
+func recordHostFailure(host string, err error) {
+	hostFailures.Lock()
+	defer hostFailures.Unlock()
+	hostFailures.errs[host] = append(hostFailures.errs[host], err.Error())
+}
+
+// printHostFailures prints every recorded failure and sets a non-zero exit
+// code if there were any.
+func printHostFailures() {
+	hostFailures.Lock()
+	defer hostFailures.Unlock()
+	if len(hostFailures.errs) == 0 {
+		return
+	}
+	exitCode = 1
+
+	hosts := make([]string, 0, len(hostFailures.errs))
+	for h := range hostFailures.errs {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	fmt.Println()
+	fmt.Println("Failed hosts:", len(hosts))
+	for _, h := range hosts {
+		for _, e := range hostFailures.errs[h] {
+			fmt.Printf("  %s: %s\n", h, e)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "strings"
+
+// driveStates is a comma separated list of drive states given as a flag.
+// "!ok" matches every state but ok and "healing" matches drives that are
+// healing, which MinIO reports next to the state instead of as one.
+type driveStates struct {
+	notOK  bool
+	states map[string]bool
+}
+
+// rebootBadStates are the drives that count against the parity of a set
+// when deciding whether a host can reboot on top of every drive that is not
+// ok, badStates are the ones listed and alerted on as bad. Both default to
+// every drive that is not ok.
+var (
+	rebootBadStates = driveStates{notOK: true}
+	badStates       = driveStates{notOK: true}
+)
+
+func (s *driveStates) String() string {
+	var list []string
+	if s.notOK {
+		list = append(list, "!ok")
+	}
+	list = append(list, stringKeysSorted(s.states)...)
+	return strings.Join(list, ",")
+}
+
+func (s *driveStates) Set(v string) error {
+	*s = driveStates{states: make(map[string]bool)}
+	for _, state := range strings.Split(v, ",") {
+		state = strings.TrimSpace(state)
+		switch state {
+		case "":
+		case "!ok":
+			s.notOK = true
+		default:
+			s.states[state] = true
+		}
+	}
+	return nil
+}
+
+// bad reports whether a drive in state, healing or not, is in the list.
+func (s *driveStates) bad(state string, healing bool) bool {
+	if s.states[state] || healing && s.states["healing"] {
+		return true
+	}
+	return s.notOK && state != "ok"
+}
+
+// rebootBad reports whether a drive counts against the parity of its set.
+// A drive that is not ok always does, -rebootBadStates only adds states such
+// as healing.
+func rebootBad(state string, healing bool) bool {
+	return state != "ok" || rebootBadStates.bad(state, healing)
+}
+
+// isBad reports whether the drive is listed as bad by -badStates.
+func (d *Disk) isBad() bool {
+	return badStates.bad(d.State, d.Healing)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// tierReport is one remote tier. Tiered is what the tier stats count, the
+// pending fields are what lifecycle rules should already have moved to the
+// tier but has not been moved yet, they are only set with -scan.
+type tierReport struct {
+	Name            string
+	Type            string
+	Endpoint        string `json:",omitempty"`
+	Bucket          string `json:",omitempty"`
+	Prefix          string `json:",omitempty"`
+	Online          bool
+	Error           string `json:",omitempty"`
+	Tiered          uint64
+	TieredObjects   int
+	TieredVersions  int
+	Scanned         bool
+	Pending         uint64
+	PendingVersions uint64
+}
+
+// ruleMatches tells if the filter of a lifecycle rule selects an object.
+func ruleMatches(r lifecycle.Rule, obj minio.ObjectInfo) bool {
+	f := r.RuleFilter
+	for _, p := range []string{r.Prefix, f.Prefix, f.And.Prefix} {
+		if !strings.HasPrefix(obj.Key, p) {
+			return false
+		}
+	}
+	for _, t := range append([]lifecycle.Tag{f.Tag}, f.And.Tags...) {
+		if t.Key != "" && obj.UserTags[t.Key] != t.Value {
+			return false
+		}
+	}
+	for _, n := range []int64{f.ObjectSizeGreaterThan, f.And.ObjectSizeGreaterThan} {
+		if n > 0 && obj.Size <= n {
+			return false
+		}
+	}
+	for _, n := range []int64{f.ObjectSizeLessThan, f.And.ObjectSizeLessThan} {
+		if n > 0 && obj.Size >= n {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingTransitions lists every version of a bucket and adds the versions
+// that are due for transition to a tier, but still stored locally, to the
+// tier's pending counts. A noncurrent version is due counting from when its
+// successor was written.
+func pendingTransitions(ctx context.Context, s3 *minio.Client, bucket string, rules []lifecycle.Rule, tiers map[string]*tierReport) error {
+	now := time.Now()
+	var lastKey string
+	var successor time.Time
+	for obj := range s3.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true, WithVersions: true, WithMetadata: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		noncurrent := obj.Key == lastKey
+		since := successor
+		lastKey, successor = obj.Key, obj.LastModified
+		if obj.IsDeleteMarker || tiers[obj.StorageClass] != nil {
+			continue
+		}
+		for _, r := range rules {
+			if r.Status != "Enabled" || !ruleMatches(r, obj) {
+				continue
+			}
+			var tier string
+			var due bool
+			if noncurrent {
+				t := r.NoncurrentVersionTransition
+				tier, due = t.StorageClass, !since.AddDate(0, 0, int(t.NoncurrentDays)).After(now)
+			} else {
+				t := r.Transition
+				tier = t.StorageClass
+				if t.Date.IsZero() {
+					due = !obj.LastModified.AddDate(0, 0, int(t.Days)).After(now)
+				} else {
+					due = !t.Date.After(now)
+				}
+			}
+			if tr := tiers[tier]; tr != nil && due {
+				tr.Pending += uint64(obj.Size)
+				tr.PendingVersions++
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func tierReports() (reports []*tierReport, err error) {
+	ctx := context.Background()
+	err = makeClient()
+	if err != nil {
+		return nil, err
+	}
+	configs, err := mclient.ListTiers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tiers: %w", err)
+	}
+	byName := make(map[string]*tierReport)
+	for _, c := range configs {
+		r := &tierReport{Name: c.Name, Type: c.Type.String()}
+		switch {
+		case c.S3 != nil:
+			r.Endpoint, r.Bucket, r.Prefix = c.S3.Endpoint, c.S3.Bucket, c.S3.Prefix
+		case c.MinIO != nil:
+			r.Endpoint, r.Bucket, r.Prefix = c.MinIO.Endpoint, c.MinIO.Bucket, c.MinIO.Prefix
+		case c.Azure != nil:
+			r.Endpoint, r.Bucket, r.Prefix = c.Azure.Endpoint, c.Azure.Bucket, c.Azure.Prefix
+		case c.GCS != nil:
+			r.Endpoint, r.Bucket, r.Prefix = c.GCS.Endpoint, c.GCS.Bucket, c.GCS.Prefix
+		}
+		// The server writes and deletes a test object on the tier.
+		if verr := mclient.VerifyTier(ctx, c.Name); verr != nil {
+			r.Error = verr.Error()
+		} else {
+			r.Online = true
+		}
+		byName[r.Name] = r
+		reports = append(reports, r)
+	}
+	if len(reports) == 0 {
+		return nil, nil
+	}
+
+	stats, err := mclient.TierStats(ctx)
+	if err != nil {
+		fmt.Fprintln(statusOut(), "Unable to read tier stats:", err)
+	}
+	for _, s := range stats {
+		if r := byName[s.Name]; r != nil {
+			r.Tiered, r.TieredObjects, r.TieredVersions = s.Stats.TotalSize, s.Stats.NumObjects, s.Stats.NumVersions
+		}
+	}
+
+	if !tiersScan {
+		return reports, nil
+	}
+	s3, err := s3Client(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := s3.ListBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets: %w", err)
+	}
+	for _, b := range buckets {
+		cfg, lerr := s3.GetBucketLifecycle(ctx, b.Name)
+		if lerr != nil {
+			if minio.ToErrorResponse(lerr).Code != "NoSuchLifecycleConfiguration" {
+				fmt.Fprintln(statusOut(), "Unable to read the lifecycle of", b.Name+":", lerr)
+			}
+			continue
+		}
+		var rules []lifecycle.Rule
+		for _, r := range cfg.Rules {
+			if byName[r.Transition.StorageClass] != nil || byName[r.NoncurrentVersionTransition.StorageClass] != nil {
+				rules = append(rules, r)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		if perr := pendingTransitions(ctx, s3, b.Name, rules, byName); perr != nil {
+			fmt.Fprintln(statusOut(), "Unable to list the objects of", b.Name+":", perr)
+		}
+	}
+	for _, r := range reports {
+		r.Scanned = true
+	}
+	return reports, nil
+}
+
+func tiers() {
+	reports, err := tierReports()
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range reports {
+		if !r.Online {
+			exitCode = 1
+		}
+	}
+	if jsonOutput {
+		jsonOut(reports)
+		return
+	}
+	if len(reports) == 0 {
+		fmt.Println("No remote tiers configured")
+		return
+	}
+	width, target := len("TIER"), len("TARGET")
+	for _, r := range reports {
+		width = max(width, len(r.Name))
+		target = max(target, len(r.Endpoint)+len(r.Bucket)+len(r.Prefix)+2)
+	}
+	fmt.Printf("%-*s  %-6s  %-*s  %-7s  %-10s  %-10s  %-10s  %s\n", width, "TIER", "TYPE", target, "TARGET", "STATUS", "TIERED", "VERSIONS", "PENDING", "PENDING VERSIONS")
+	for _, r := range reports {
+		status := "online"
+		if !r.Online {
+			status = "offline"
+		}
+		pending, pendingVersions := "-", "-"
+		if r.Scanned {
+			pending, pendingVersions = humanize.IBytes(r.Pending), fmt.Sprint(r.PendingVersions)
+		}
+		line := fmt.Sprintf("%-*s  %-6s  %-*s  %-7s  %-10s  %-10d  %-10s  %s", width, r.Name, strings.ToLower(r.Type), target, r.Endpoint+" "+r.Bucket+"/"+r.Prefix,
+			status, humanize.IBytes(r.Tiered), r.TieredVersions, pending, pendingVersions)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	for _, r := range reports {
+		if r.Error != "" {
+			fmt.Printf("%s: %s\n", r.Name, r.Error)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadTopology reads a failure domain file with one "host domain" pair per
+// line, for example "node01 rack-a". Empty lines and lines starting with '#'
+// are skipped. The domain can be anything shared by hosts that may fail
+// together: a rack, a PDU or a zone.
+func loadTopology(path string) (domains map[string]string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	domains = make(map[string]string)
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 'host domain', got %q", path, line, text)
+		}
+		domains[fields[0]] = fields[1]
+	}
+	return domains, sc.Err()
+}
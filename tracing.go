@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are exported with OTLP/HTTP using the JSON encoding, which every
+// OpenTelemetry collector accepts on /v1/traces.
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Status       otlpStatus     `json:"status"`
+
+	start time.Time
+}
+
+var (
+	traceID   string
+	rootSpan  *span
+	spans     []*span
+	spansLock = new(sync.Mutex)
+)
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startTracing creates the root span for command. It does nothing unless
+// `-otelEndpoint` is set.
+func startTracing(command string) {
+	if otelEndpoint == "" {
+		return
+	}
+	traceID = randomHex(16)
+	rootSpan = newSpan(command, "", nil)
+}
+
+func newSpan(name string, parent string, attrs map[string]string) *span {
+	s := &span{
+		TraceID:      traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: parent,
+		Name:         name,
+		Kind:         1,
+		start:        time.Now(),
+	}
+	for _, k := range stringKeysSorted(attrs) {
+		kv := otlpKeyValue{Key: k}
+		kv.Value.StringValue = attrs[k]
+		s.Attributes = append(s.Attributes, kv)
+	}
+	return s
+}
+
+// startSpan starts a child of the command's root span. The returned span is
+// nil when tracing is disabled, and ending a nil span is a no-op.
+func startSpan(name string, attrs map[string]string) *span {
+	if rootSpan == nil {
+		return nil
+	}
+	return newSpan(name, rootSpan.SpanID, attrs)
+}
+
+// end records the span, marking it as failed when err is not nil.
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+	s.Start = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.End = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err != nil {
+		s.Status = otlpStatus{Code: 2, Message: err.Error()}
+	} else {
+		s.Status = otlpStatus{Code: 1}
+	}
+
+	spansLock.Lock()
+	spans = append(spans, s)
+	flush := len(spans) >= 512
+	spansLock.Unlock()
+	if flush {
+		exportSpans()
+	}
+}
+
+func exportSpans() {
+	spansLock.Lock()
+	batch := spans
+	spans = nil
+	spansLock.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	service := otlpKeyValue{Key: "service.name"}
+	service.Value.StringValue = "minio-cluster-tool"
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpKeyValue{service}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "minio-cluster-tool"},
+				"spans": batch,
+			}},
+		}},
+	}
+	outb, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to encode spans:", err)
+		return
+	}
+
+	url := otelEndpoint
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url = strings.TrimSuffix(url, "/") + "/v1/traces"
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(outb))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to export spans:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		fmt.Fprintln(os.Stderr, "Unable to export spans:", resp.Status)
+	}
+}
+
+// stopTracing ends the root span and exports everything still buffered.
+func stopTracing(err error) {
+	if rootSpan == nil {
+		return
+	}
+	rootSpan.end(err)
+	rootSpan = nil
+	exportSpans()
+}
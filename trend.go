@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// snapshotTimeFormat is the time in the snapshot file names written by the
+// snapshot schedule task.
+const snapshotTimeFormat = "20060102-150405"
+
+// trendMetrics are the values trend can follow, each computed per pool or
+// set of a snapshot.
+var trendMetrics = map[string]func(d *Disk) int64{
+	"baddisks": func(d *Disk) int64 {
+		if d.isBad() {
+			return 1
+		}
+		return 0
+	},
+	"used":   func(d *Disk) int64 { return int64(d.UsedSpace) },
+	"free":   func(d *Disk) int64 { return int64(d.TotalSpace) - int64(d.UsedSpace) },
+	"growth": func(d *Disk) int64 { return int64(d.UsedSpace) },
+}
+
+type snapshotFile struct {
+	Path string
+	Time time.Time
+}
+
+// snapshotFiles returns the snapshots in dir taken after since, oldest
+// first.
+func snapshotFiles(dir string, since time.Time) (files []snapshotFile, err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "snapshot-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "snapshot-"), ".json")
+		t, err := time.Parse(snapshotTimeFormat, ts)
+		if err != nil || t.Before(since) {
+			continue
+		}
+		files = append(files, snapshotFile{Path: m, Time: t})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Time.Before(files[j].Time) })
+	return
+}
+
+func readSnapshot(path string) (pools map[string]*Pool, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Snapshots saved from 'info' output carry the versioned envelope.
+	var doc struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(b, &doc) == nil && doc.SchemaVersion >= 2 {
+		b = doc.Data
+	}
+	err = json.Unmarshal(b, &pools)
+	return
+}
+
+// trendBucket truncates t to the start of its hour, day or week (weeks start
+// on Monday).
+func trendBucket(t time.Time, by string) time.Time {
+	t = t.UTC()
+	switch by {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func trendLabel(t time.Time, by string) string {
+	if by == "hour" {
+		return t.Format("2006-01-02 15:00")
+	}
+	return t.Format("2006-01-02")
+}
+
+// snapshotValues sums metric per pool or per pool/set of one snapshot.
+func snapshotValues(pools map[string]*Pool, metric func(d *Disk) int64, per string) map[string]int64 {
+	values := make(map[string]int64)
+	for _, p := range pools {
+		for _, s := range p.Servers {
+			for _, set := range s.Sets {
+				key := strconv.Itoa(set.Pool)
+				if per == "set" {
+					key += "/" + strconv.Itoa(set.ID)
+				}
+				for _, d := range set.Disks {
+					values[key] += metric(d)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// trendTable is one row per time bucket and one column per pool or set.
+type trendTable struct {
+	Groups  []string
+	Buckets []time.Time
+	Values  map[time.Time]map[string]int64
+}
+
+// buildTrend reads the snapshots and keeps one value per bucket and group:
+// the worst bad disk count, or the last value seen for capacity.
+func buildTrend(files []snapshotFile, name string, by string, per string) (t trendTable) {
+	metric := trendMetrics[name]
+	t.Values = make(map[time.Time]map[string]int64)
+	groups := make(map[string]bool)
+	for _, f := range files {
+		pools, err := readSnapshot(f.Path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping", f.Path+":", err)
+			continue
+		}
+		b := trendBucket(f.Time, by)
+		row, ok := t.Values[b]
+		if !ok {
+			row = make(map[string]int64)
+			t.Values[b] = row
+			t.Buckets = append(t.Buckets, b)
+		}
+		for g, v := range snapshotValues(pools, metric, per) {
+			groups[g] = true
+			if cur, seen := row[g]; !seen || name != "baddisks" || v > cur {
+				row[g] = v
+			}
+		}
+	}
+	t.Groups = stringKeysSorted(groups)
+	sort.Slice(t.Groups, func(i, j int) bool { return naturalLess(t.Groups[i], t.Groups[j]) })
+
+	if name == "growth" {
+		// Growth is the change of used space since the previous bucket,
+		// the first bucket has nothing to compare with.
+		prev := make(map[string]int64)
+		for _, b := range t.Buckets {
+			row := t.Values[b]
+			next := make(map[string]int64, len(row))
+			for g, v := range row {
+				next[g] = v
+				if p, ok := prev[g]; ok {
+					row[g] = v - p
+				} else {
+					delete(row, g)
+				}
+			}
+			prev = next
+		}
+		if len(t.Buckets) > 0 {
+			t.Buckets = t.Buckets[1:]
+		}
+	}
+	return
+}
+
+// naturalLess orders "2/10" after "2/9".
+func naturalLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aerr := strconv.Atoi(as[i])
+		bi, berr := strconv.Atoi(bs[i])
+		if aerr == nil && berr == nil && ai != bi {
+			return ai < bi
+		}
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func trendCell(name string, v int64, ok bool, raw bool) string {
+	switch {
+	case !ok:
+		return ""
+	case name == "baddisks" || raw:
+		return strconv.FormatInt(v, 10)
+	case v < 0:
+		// Used space shrinks when data is deleted.
+		return "-" + humanize.IBytes(uint64(-v))
+	}
+	return humanize.IBytes(uint64(v))
+}
+
+func trend() {
+	if len(cmdArgs) != 1 || trendMetrics[cmdArgs[0]] == nil {
+		panic("expected a metric: " + strings.Join(stringKeysSorted(trendMetrics), ", "))
+	}
+	name := cmdArgs[0]
+	if snapshotDir == "" {
+		panic("trend needs -snapshotDir, the directory the snapshot schedule task writes to")
+	}
+	if trendBy != "hour" && trendBy != "day" && trendBy != "week" {
+		panic("invalid -by " + trendBy + ", expected hour, day or week")
+	}
+	if trendPer != "pool" && trendPer != "set" {
+		panic("invalid -per " + trendPer + ", expected pool or set")
+	}
+
+	files, err := snapshotFiles(snapshotDir, time.Now().Add(-trendLast))
+	if err != nil {
+		panic(err)
+	}
+	if len(files) == 0 {
+		fmt.Println("No snapshots in", snapshotDir, "within the last", trendLast)
+		return
+	}
+	t := buildTrend(files, name, trendBy, trendPer)
+
+	header := append([]string{strings.ToUpper(trendBy)}, t.Groups...)
+	for i, g := range t.Groups {
+		header[i+1] = strings.ToUpper(trendPer) + " " + g
+	}
+	rows := [][]string{header}
+	for _, b := range t.Buckets {
+		row := []string{trendLabel(b, trendBy)}
+		for _, g := range t.Groups {
+			v, ok := t.Values[b][g]
+			row = append(row, trendCell(name, v, ok, trendCSV))
+		}
+		rows = append(rows, row)
+	}
+
+	if trendCSV {
+		w := csv.NewWriter(os.Stdout)
+		err = w.WriteAll(rows)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, c := range row {
+			widths[i] = max(widths[i], len(c))
+		}
+	}
+	for _, row := range rows {
+		line := ""
+		for i, c := range row {
+			line += fmt.Sprintf("%-*s  ", widths[i], c)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sysctlRule is a kernel setting MinIO recommends. Values are compared
+// numerically, Op is one of >=, <= or =.
+type sysctlRule struct {
+	Key   string
+	Op    string
+	Value int64
+}
+
+// Recommended from the MinIO kernel tuning guide. Only thresholds are
+// checked, so hosts tuned beyond them pass.
+var sysctlRules = []sysctlRule{
+	{"fs.file-max", ">=", 4194303},
+	{"vm.max_map_count", ">=", 524288},
+	{"vm.swappiness", "<=", 1},
+	{"vm.dirty_background_ratio", "<=", 3},
+	{"vm.dirty_ratio", "<=", 10},
+	{"net.core.somaxconn", ">=", 65535},
+	{"net.ipv4.tcp_max_syn_backlog", ">=", 16384},
+	{"net.core.netdev_max_backlog", ">=", 250000},
+}
+
+const recommendedNofile = 1048576
+
+func (r sysctlRule) ok(v int64) bool {
+	switch r.Op {
+	case ">=":
+		return v >= r.Value
+	case "<=":
+		return v <= r.Value
+	}
+	return v == r.Value
+}
+
+// minioNofile returns the open files limit of the running minio process, or
+// the limit systemd would start it with.
+func minioNofile(h *hostData) (limit string, err error) {
+	out, err := h.run(`pid=$(pidof -s minio); if [ -n "$pid" ]; then sudo cat /proc/$pid/limits; else echo "Max open files $(systemctl show minio -p LimitNOFILE --value 2>/dev/null)"; fi`)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(line, "Max open files"); ok {
+			// Empty when minio is neither running nor a systemd unit.
+			fields := strings.Fields(v)
+			if len(fields) == 0 {
+				return "", nil
+			}
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no open files limit found")
+}
+
+// checkHostLimits compares file limits, sysctls, transparent hugepages and
+// SELinux against what MinIO recommends.
+func checkHostLimits(h *hostData) (r []checkResult) {
+	var deviations []string
+
+	nofile, err := minioNofile(h)
+	switch {
+	case err != nil:
+		deviations = append(deviations, "nofile: "+err.Error())
+	case nofile == "infinity" || nofile == "":
+	default:
+		n, perr := strconv.ParseInt(nofile, 10, 64)
+		if perr != nil || n < recommendedNofile {
+			deviations = append(deviations, fmt.Sprintf("nofile %s, recommended %d", nofile, recommendedNofile))
+		}
+	}
+
+	out, err := h.run("sysctl -a 2>/dev/null")
+	if err != nil {
+		return hostFail("limits", err)
+	}
+	sysctls := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if ok {
+			sysctls[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	for _, rule := range sysctlRules {
+		raw, ok := sysctls[rule.Key]
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			deviations = append(deviations, fmt.Sprintf("%s has no value, recommended %s %d", rule.Key, rule.Op, rule.Value))
+			continue
+		}
+		v, perr := strconv.ParseInt(fields[0], 10, 64)
+		if perr != nil || !rule.ok(v) {
+			deviations = append(deviations, fmt.Sprintf("%s %s, recommended %s %d", rule.Key, raw, rule.Op, rule.Value))
+		}
+	}
+
+	// The active value is shown in brackets, e.g. "always [madvise] never".
+	out, err = h.run("cat /sys/kernel/mm/transparent_hugepage/enabled 2>/dev/null || true")
+	if err == nil && strings.Contains(out, "[always]") {
+		deviations = append(deviations, "transparent hugepages always, recommended madvise")
+	}
+
+	out, err = h.run("getenforce 2>/dev/null || true")
+	if err == nil && strings.EqualFold(out, "Enforcing") {
+		deviations = append(deviations, "SELinux enforcing, make sure the MinIO policy is installed")
+	}
+
+	if len(deviations) > 0 {
+		return []checkResult{newResult("limits", checkWarn, strings.Join(deviations, "; "),
+			"Apply the MinIO recommended limits and kernel settings")}
+	}
+	return []checkResult{newResult("limits", checkPass, "limits and kernel settings match the recommendations", "")}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// MinIO publishes every release as minio.RELEASE.<time> next to a
+// .sha256sum and a .minisig file, minio.sha256sum names the latest one.
+const (
+	minioReleaseURL = "https://dl.min.io/server/minio/release/"
+	// minioPublicKey is the minisign key MinIO signs its releases with.
+	minioPublicKey = "RWTx5Zr1tiHQLwG9keckT0c45M3AGeHD6IvimQHpyRywVWGbP1aVSGav"
+)
+
+// minioRelease is a MinIO binary whose checksum and signature were verified.
+type minioRelease struct {
+	Name    string
+	SHA256  string
+	SumsURL string
+	Binary  []byte
+}
+
+// verifiedBinary is the release the current invocation installs, it is
+// recorded in the operation history.
+var verifiedBinary minioRelease
+
+// releaseSumsURL returns the URL of the checksum file of release, or of the
+// latest release when it is empty.
+func releaseSumsURL(base, arch, release string) string {
+	if base == "" {
+		base = minioReleaseURL
+	}
+	if arch == "" {
+		arch = "linux-amd64"
+	}
+	name := "minio"
+	if release != "" {
+		name = "minio." + strings.TrimPrefix(release, "minio.")
+	}
+	return strings.TrimSuffix(base, "/") + "/" + arch + "/" + name + ".sha256sum"
+}
+
+// verifyRelease downloads the release named by the checksum file at
+// sumsURL, checks its SHA256 and its minisign signature and returns the
+// pinned release. The binary is signed, not the checksum file, so nothing
+// is trusted until both match.
+func verifyRelease(sumsURL string, publicKey string) (r minioRelease, err error) {
+	if publicKey == "" {
+		publicKey = minioPublicKey
+	}
+	sums, err := httpGet(sumsURL)
+	if err != nil {
+		return r, err
+	}
+	fields := strings.Fields(string(sums))
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "minio.RELEASE.") {
+		return r, fmt.Errorf("%s: not a MinIO release checksum", sumsURL)
+	}
+	r.SHA256, r.Name = strings.ToLower(fields[0]), fields[1]
+
+	if base := path.Base(sumsURL); base != "minio.sha256sum" && base != r.Name+".sha256sum" {
+		return r, fmt.Errorf("%s lists %s", sumsURL, r.Name)
+	}
+	// Pin the release, minio.sha256sum moves on with the next one.
+	dir := sumsURL[:strings.LastIndex(sumsURL, "/")+1]
+	r.SumsURL = dir + r.Name + ".sha256sum"
+
+	fmt.Println("Downloading", dir+r.Name)
+	r.Binary, err = httpGet(dir + r.Name)
+	if err != nil {
+		return r, err
+	}
+	err = verifySHA256(r.Binary, r.SHA256)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", r.Name, err)
+	}
+	sig, err := httpGet(dir + r.Name + ".minisig")
+	if err != nil {
+		return r, err
+	}
+	err = verifyMinisign(publicKey, r.Binary, sig)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", r.Name, err)
+	}
+	fmt.Println("Signature verified:", r.Name)
+	fmt.Println("Checksum verified:", r.SHA256)
+	verifiedBinary = r
+	return r, nil
+}
+
+// updateServers asks every server to install r through MinIO's update API.
+// The servers download the pinned release themselves and restart together,
+// verifyUpdatedServers checks what they run afterwards.
+func updateServers(r minioRelease, dry bool) (updated []string, err error) {
+	err = makeClient()
+	if err != nil {
+		return nil, err
+	}
+	st, err := mclient.ServerUpdateV2(context.Background(), madmin.ServerUpdateOpts{
+		UpdateURL: r.SumsURL,
+		DryRun:    dry,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var failed []string
+	for _, res := range st.Results {
+		if res.Err != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", res.Host, res.Err))
+			continue
+		}
+		updated = append(updated, fmt.Sprintf("%s %s -> %s", res.Host, res.CurrentVersion, res.UpdatedVersion))
+	}
+	if len(failed) > 0 {
+		return updated, fmt.Errorf("update failed on %s", strings.Join(failed, ", "))
+	}
+	return updated, nil
+}
+
+// runsRelease reports whether a server version, RFC3339 or a release tag,
+// is the release made at t.
+func runsRelease(version string, t time.Time) bool {
+	v, err := time.Parse(time.RFC3339, version)
+	if err != nil {
+		v, err = releaseTime(version)
+	}
+	return err == nil && v.Equal(t)
+}
+
+// verifyUpdatedServers waits until every server is back online running r,
+// all on the same commit, or -verifyTimeout passed. The servers download the
+// release on their own, only what they run afterwards shows that the verified
+// release is what got installed.
+func verifyUpdatedServers(r minioRelease) error {
+	want, err := releaseTime(strings.TrimPrefix(r.Name, "minio."))
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.Name, err)
+	}
+	deadline := time.Now().Add(verifyTimeout)
+	for {
+		var problems []string
+		info, err := clusterServerInfo()
+		if err == nil {
+			commits := make(map[string]bool)
+			for _, s := range info.Servers {
+				switch {
+				case s.State != string(madmin.ItemOnline):
+					problems = append(problems, s.Endpoint+" is "+s.State)
+				case !runsRelease(s.Version, want):
+					problems = append(problems, s.Endpoint+" runs "+s.Version)
+				default:
+					commits[s.CommitID] = true
+				}
+			}
+			if len(commits) > 1 {
+				problems = append(problems, "servers run different commits: "+strings.Join(stringKeysSorted(commits), ", "))
+			}
+			if len(problems) == 0 {
+				fmt.Println("Every server runs", r.Name)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("unable to verify the update: %w", err)
+			}
+			return fmt.Errorf("not every server runs %s after %s: %s", r.Name, verifyTimeout, strings.Join(problems, "; "))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// verifyLocalRelease checks a binary downloaded for an air-gapped cluster
+// against the .sha256sum and .minisig files downloaded with it.
+func verifyLocalRelease(binary string, publicKey string) (r minioRelease, err error) {
+	if publicKey == "" {
+		publicKey = minioPublicKey
+	}
+	r.Binary, err = os.ReadFile(binary)
+	if err != nil {
+		return r, err
+	}
+	sums, err := os.ReadFile(binary + ".sha256sum")
+	if err != nil {
+		return r, fmt.Errorf("%w, download it from the release site next to the binary", err)
+	}
+	fields := strings.Fields(string(sums))
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "minio.RELEASE.") {
+		return r, fmt.Errorf("%s: not a MinIO release checksum", binary+".sha256sum")
+	}
+	r.SHA256, r.Name = strings.ToLower(fields[0]), fields[1]
+	err = verifySHA256(r.Binary, r.SHA256)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", binary, err)
+	}
+	sig, err := os.ReadFile(binary + ".minisig")
+	if err != nil {
+		return r, fmt.Errorf("%w, download it from the release site next to the binary", err)
+	}
+	err = verifyMinisign(publicKey, r.Binary, sig)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", binary, err)
+	}
+	fmt.Println("Signature verified:", r.Name)
+	fmt.Println("Checksum verified:", r.SHA256)
+	verifiedBinary = r
+	return r, nil
+}
+
+// installMinio copies the verified -binary to host and renames it over
+// -binaryPath. The running minio keeps the old binary until it restarts,
+// which is left at -binaryPath.old for a rollback.
+func installMinio(host string) (err error) {
+	r := verifiedBinary
+	if dryRun {
+		fmt.Printf("Would install %s to %s:%s\n", r.Name, host, upgradeBinaryPath)
+		return nil
+	}
+	dir, err := stagingDir(host)
+	if err != nil {
+		return err
+	}
+	defer removeStaging(host, dir)
+	staged := dir + "/" + r.Name
+	err = scpUpload(host, dir, r.Name, r.Binary, 0o755)
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", r.Name, err)
+	}
+	// The new binary is written next to the old one so the rename is atomic.
+	dst := upgradeBinaryPath
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".new")
+	cmd := fmt.Sprintf("echo %s | sha256sum -c --quiet && sudo install -m 0755 %s %s && { ! test -e %s || sudo ln -f %s %s; } && sudo mv -f %s %s",
+		shellQuote(r.SHA256+"  "+staged), shellQuote(staged), shellQuote(tmp),
+		shellQuote(dst), shellQuote(dst), shellQuote(dst+".old"),
+		shellQuote(tmp), shellQuote(dst))
+	output, err := runSSH(host, cmd)
+	if err != nil {
+		return fmt.Errorf("installing %s: %w: %s", r.Name, err, strings.TrimSpace(string(output)))
+	}
+	fmt.Printf("Installed %s to %s:%s\n", r.Name, host, dst)
+	return nil
+}
+
+// binaryChange installs the verified -binary right before a host restarts
+// and puts the old binary back when minio does not start with it.
+type binaryChange struct{}
+
+func (binaryChange) Name() string { return "binary" }
+
+func (binaryChange) Install(host string) error { return installMinio(host) }
+
+func (binaryChange) Verify(host string) error { return nil }
+
+func (binaryChange) Rollback(host string) error {
+	dst := upgradeBinaryPath
+	output, err := runSSH(host, fmt.Sprintf("test -e %s && sudo mv -f %s %s", shellQuote(dst+".old"), shellQuote(dst+".old"), shellQuote(dst)))
+	if err != nil {
+		return fmt.Errorf("restoring %s: %w: %s", dst+".old", err, strings.TrimSpace(string(output)))
+	}
+	fmt.Printf("Restored the previous binary on %s:%s\n", host, dst)
+	return nil
+}
+
+func upgrade() {
+	if upgradeBinary != "" {
+		if reloadOnly {
+			panic("-binary needs minio to restart, it cannot be combined with -reload")
+		}
+		_, err := verifyLocalRelease(upgradeBinary, upgradePublicKey)
+		if err != nil {
+			panic(err)
+		}
+		if upgradeCheckOnly {
+			return
+		}
+		// Every host gets the binary right before it restarts, in the
+		// set-safe rounds of -folder.
+		hostChanges = append(hostChanges, binaryChange{})
+		rollout()
+		return
+	}
+
+	// The update API restarts every server at once, -dryRun and
+	// -verifyTimeout are the only rollout flags it uses.
+	for _, name := range upgradeRolloutFlags {
+		if flagsGiven[name] && name != "dryRun" && name != "verifyTimeout" {
+			panic("-" + name + " needs -binary, the update API restarts every server at once")
+		}
+	}
+	r, err := verifyRelease(releaseSumsURL(upgradeURL, upgradeArch, upgradeRelease), upgradePublicKey)
+	if err != nil {
+		panic(err)
+	}
+	if upgradeCheckOnly {
+		return
+	}
+
+	if !dryRun {
+		l := acquireLock(lockOperation())
+		defer l.release()
+	}
+	updated, err := updateServers(r, dryRun)
+	for _, u := range updated {
+		if dryRun {
+			fmt.Println("Would update", u)
+		} else {
+			fmt.Println("Updated", u)
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	if !dryRun {
+		err = verifyUpdatedServers(r)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Set at build time with:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// newestSupportedRelease is the newest MinIO release the compiled in
+// madmin-go version is known to work with. Bump it together with madmin-go.
+const newestSupportedRelease = "RELEASE.2025-02-28T09-55-16Z"
+
+type buildVersion struct {
+	Version       string
+	Commit        string
+	BuildDate     string
+	GoVersion     string
+	MadminVersion string
+}
+
+func getBuildVersion() (v buildVersion) {
+	v.Version = version
+	v.Commit = commit
+	v.BuildDate = buildDate
+	v.GoVersion = runtime.Version()
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == "github.com/minio/madmin-go/v3" {
+			v.MadminVersion = dep.Version
+		}
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if v.Commit == "" {
+				v.Commit = s.Value
+			}
+		case "vcs.time":
+			if v.BuildDate == "" {
+				v.BuildDate = s.Value
+			}
+		}
+	}
+	return
+}
+
+// releaseTime parses a MinIO release tag such as RELEASE.2024-01-31T20-20-33Z.
+func releaseTime(release string) (t time.Time, err error) {
+	const layout = "2006-01-02T15-04-05Z"
+	tag := strings.TrimPrefix(release, "RELEASE.")
+	// Strip hotfix suffixes like .hotfix.abcdef or -fips.
+	if len(tag) > len(layout) {
+		tag = tag[:len(layout)]
+	}
+	return time.Parse(layout, tag)
+}
+
+func versionCmd() {
+	v := getBuildVersion()
+	if jsonOutput {
+		jsonOut(v)
+	} else {
+		fmt.Printf("%-10s %s\n", "Version", v.Version)
+		fmt.Printf("%-10s %s\n", "Commit", v.Commit)
+		fmt.Printf("%-10s %s\n", "Built", v.BuildDate)
+		fmt.Printf("%-10s %s\n", "Go", v.GoVersion)
+		fmt.Printf("%-10s %s\n", "madmin-go", v.MadminVersion)
+	}
+
+	if !checkCompat {
+		return
+	}
+
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	info, err := clusterServerInfo()
+	if err != nil {
+		panic(err)
+	}
+
+	supported, err := releaseTime(newestSupportedRelease)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println()
+	warnings := 0
+	for _, srv := range info.Servers {
+		rt, err := releaseTime(srv.Version)
+		if err != nil {
+			fmt.Printf("Unknown version on %s: %s\n", srv.Endpoint, srv.Version)
+			continue
+		}
+		if rt.After(supported) {
+			warnings++
+			fmt.Printf("WARNING: %s runs %s which is newer than %s supported by madmin-go %s\n",
+				srv.Endpoint, srv.Version, newestSupportedRelease, v.MadminVersion)
+		}
+	}
+	if warnings == 0 {
+		fmt.Println("All servers are compatible with this build")
+	}
+}
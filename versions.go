@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// serverVersion is the build a server reports. Mismatch is set when it
+// differs from the version and commit most servers run.
+type serverVersion struct {
+	Endpoint      string
+	State         string
+	Version       string
+	CommitID      string
+	UptimeSeconds int64
+	Mismatch      bool
+}
+
+// serverVersions lists every server of info sorted by endpoint and returns
+// the version/commit pair run by most servers.
+func serverVersions(info madmin.InfoMessage) (servers []serverVersion, majority string) {
+	counts := make(map[string]int)
+	for _, s := range info.Servers {
+		servers = append(servers, serverVersion{
+			Endpoint:      s.Endpoint,
+			State:         s.State,
+			Version:       s.Version,
+			CommitID:      s.CommitID,
+			UptimeSeconds: s.Uptime,
+		})
+		if s.Version != "" {
+			counts[s.Version+" "+s.CommitID]++
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Endpoint < servers[j].Endpoint })
+
+	for _, k := range stringKeysSorted(counts) {
+		if counts[k] > counts[majority] {
+			majority = k
+		}
+	}
+	for i, s := range servers {
+		servers[i].Mismatch = s.Version != "" && s.Version+" "+s.CommitID != majority
+	}
+	return
+}
+
+func versions() {
+	err := makeClient()
+	if err != nil {
+		panic(err)
+	}
+	info, err := clusterServerInfo()
+	if err != nil {
+		panic(err)
+	}
+
+	servers, _ := serverVersions(info)
+	for _, s := range servers {
+		if s.Mismatch {
+			exitCode = 1
+		}
+	}
+
+	if jsonOutput {
+		jsonOut(servers)
+		return
+	}
+
+	width := len("ENDPOINT")
+	for _, s := range servers {
+		if len(s.Endpoint) > width {
+			width = len(s.Endpoint)
+		}
+	}
+	fmt.Printf("%-*s  %-8s  %-30s  %-12s  %s\n", width, "ENDPOINT", "STATE", "VERSION", "COMMIT", "UPTIME")
+	for _, s := range servers {
+		commit := s.CommitID
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		uptime := (time.Duration(s.UptimeSeconds) * time.Second).String()
+		mark := ""
+		if s.Mismatch {
+			mark = "  <- mismatch"
+		}
+		line := fmt.Sprintf("%-*s  %-8s  %-30s  %-12s  %-10s%s", width, s.Endpoint, s.State, s.Version, commit, uptime, mark)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// versionSkewMessage describes the servers that do not run the majority
+// build, or is empty when all of them do.
+func versionSkewMessage(servers []serverVersion, majority string) string {
+	var behind []string
+	for _, s := range servers {
+		if s.Mismatch {
+			behind = append(behind, fmt.Sprintf("%s runs %s", s.Endpoint, strings.TrimSpace(s.Version+" "+s.CommitID)))
+		}
+	}
+	if len(behind) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d servers differ from %s: %s", len(behind), majority, strings.Join(behind, ", "))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handleUI serves the single page web UI of serve. The page only talks to
+// the /v1 API, everything it shows is also available to scripts.
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(uiPage))
+}
+
+const uiPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>MinIO cluster tool</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: left; }
+th { background: #f4f4f4; }
+.ok { background: #e6f4ea; }
+.warn { background: #fff4e5; }
+.bad { background: #fdecea; }
+.meta { color: #666; }
+button { margin-right: 0.5em; }
+#wizard section { display: none; }
+#wizard section.active { display: block; }
+</style>
+</head>
+<body>
+<h1>MinIO cluster tool</h1>
+<p class="meta"><label>API token: <input type="password" id="token" size="40" onchange="saveToken()"></label></p>
+<p class="meta" id="status">Loading...</p>
+
+<h2>Sets</h2>
+<table id="sets"></table>
+
+<h2>Drives that are not ok</h2>
+<div id="disks"></div>
+
+<h2>Heal</h2>
+<button onclick="startHeal()">Heal all sets</button>
+<table id="heal"></table>
+
+<h2>Reboot rounds</h2>
+<div id="wizard">
+<section id="step1" class="active">
+<p>Plan reboot rounds from the current cluster state. Every round only contains servers that can be down at the same time.</p>
+<button onclick="plan()">Plan rounds</button>
+</section>
+<section id="step2">
+<p>Pick the round to reboot.</p>
+<div id="rounds"></div>
+<button onclick="show('step1')">Back</button>
+</section>
+<section id="step3">
+<p id="confirmText"></p>
+<table id="confirmHosts"></table>
+<p><label><input type="checkbox" id="understood"> I checked that these servers can be taken down now</label></p>
+<p><label>Type the round number to confirm: <input id="confirmRound" size="4"></label></p>
+<button onclick="reboot()">Reboot round</button>
+<button onclick="show('step2')">Back</button>
+</section>
+</div>
+<h3>Last reboot</h3>
+<pre id="reboot">none</pre>
+
+<script>
+let plan_ = null;
+let selected = null;
+
+function esc(s) {
+  return String(s).replace(/[&<>"']/g, c => ({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]));
+}
+
+function saveToken() {
+  localStorage.setItem('clusterToolToken', document.getElementById('token').value);
+  refresh();
+}
+
+async function api(path, opts) {
+  opts = opts || {};
+  opts.headers = Object.assign({}, opts.headers);
+  const token = localStorage.getItem('clusterToolToken');
+  if (token) {
+    opts.headers['Authorization'] = 'Bearer ' + token;
+  }
+  const resp = await fetch(path, opts);
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body && body.Error ? body.Error : resp.statusText);
+  }
+  return body;
+}
+
+function show(step) {
+  document.querySelectorAll('#wizard section').forEach(s => s.classList.toggle('active', s.id === step));
+}
+
+async function refresh() {
+  try {
+    const st = await api('/v1/status');
+    document.getElementById('status').textContent = 'Cluster model loaded ' + st.Loaded + ' (' + st.Age + ' ago)' + (st.Error ? ', last refresh failed: ' + st.Error : '');
+
+    const sets = await api('/v1/sets');
+    let rows = '<tr><th>Pool</th><th>Set</th><th>Drives</th><th>Not ok</th><th>Parity</th><th>Margin</th><th>Can reboot</th></tr>';
+    for (const pool of Object.keys(sets).sort((a, b) => a - b)) {
+      for (const id of Object.keys(sets[pool]).sort((a, b) => a - b)) {
+        const s = sets[pool][id];
+        const bad = (s.Disks || []).filter(d => d.State !== 'ok').length;
+        const margin = s.Parity - bad;
+        const cls = margin <= 0 ? 'bad' : (!s.CanReboot || s.RRAtRisk ? 'warn' : 'ok');
+        rows += '<tr class="' + cls + '"><td>' + esc(pool) + '</td><td>' + esc(id) + '</td><td>' + (s.Disks || []).length + '</td><td>' + bad + '</td><td>' + s.Parity + '</td><td>' + margin + '</td><td>' + s.CanReboot + '</td></tr>';
+      }
+    }
+    document.getElementById('sets').innerHTML = rows;
+
+    const disks = await api('/v1/disks?bad=true');
+    if (disks.length === 0) {
+      document.getElementById('disks').innerHTML = '<p>All drives are ok.</p>';
+    } else {
+      let t = '<table><tr><th>Server</th><th>Path</th><th>Pool</th><th>Set</th><th>State</th><th>Healing</th></tr>';
+      for (const d of disks) {
+        t += '<tr class="bad"><td>' + esc(d.Server) + '</td><td>' + esc(d.Path) + '</td><td>' + d.Pool + '</td><td>' + d.Set + '</td><td>' + esc(d.State) + '</td><td>' + d.Healing + '</td></tr>';
+      }
+      document.getElementById('disks').innerHTML = t + '</table>';
+    }
+
+    const heal = await api('/v1/heal');
+    let h = '<tr><th>Pool</th><th>Set</th><th>Running</th><th>Objects not healed yet</th><th>Started</th></tr>';
+    for (const s of heal) {
+      h += '<tr class="' + (s.Running ? 'warn' : 'ok') + '"><td>' + s.Pool + '</td><td>' + s.Set + '</td><td>' + s.Running + '</td><td>' + s.Invalid + '</td><td>' + esc(s.Started || '') + '</td></tr>';
+    }
+    document.getElementById('heal').innerHTML = heal.length ? h : '<tr><td>No heal started from here</td></tr>';
+
+    const job = await api('/v1/reboot');
+    document.getElementById('reboot').textContent = job ? JSON.stringify(job, null, 2) : 'none';
+  } catch (e) {
+    document.getElementById('status').textContent = 'Error: ' + e.message;
+  }
+}
+
+async function startHeal() {
+  if (!confirm('Start a heal on every set?')) {
+    return;
+  }
+  try {
+    await api('/v1/heal', {method: 'POST'});
+  } catch (e) {
+    alert(e.message);
+  }
+  refresh();
+}
+
+async function plan() {
+  try {
+    plan_ = await api('/v1/hostfile');
+  } catch (e) {
+    alert(e.message);
+    return;
+  }
+  let out = '';
+  if (plan_.Unhealthy.length) {
+    out += '<p class="bad">Left out because a set can not lose them: ' + plan_.Unhealthy.map(u => esc(u.Host)).join(', ') + '</p>';
+  }
+  out += '<table><tr><th>Round</th><th>Hosts</th><th></th></tr>';
+  for (const r of plan_.Rounds) {
+    out += '<tr><td>' + r.Round + '</td><td>' + r.Hosts.map(h => esc(h.Host)).join(', ') + '</td><td><button onclick="pick(' + r.Round + ')">Select</button></td></tr>';
+  }
+  document.getElementById('rounds').innerHTML = out + '</table>';
+  show('step2');
+}
+
+function pick(round) {
+  selected = plan_.Rounds.find(r => r.Round === round);
+  document.getElementById('confirmText').textContent = 'Round ' + round + ' takes these ' + selected.Hosts.length + ' servers down:';
+  let t = '<tr><th>Host</th><th>Pool</th><th>Sets (bad drives / parity)</th></tr>';
+  for (const h of selected.Hosts) {
+    const sets = h.Sets.map(s => s.ID + ' (' + s.BadDisks + '/' + s.Parity + ')' + (s.RRAtRisk ? ' reduced redundancy at risk' : '')).join(', ');
+    t += '<tr class="' + (h.Sets.some(s => s.RRAtRisk) ? 'warn' : 'ok') + '"><td>' + esc(h.Host) + '</td><td>' + h.Pool + '</td><td>' + esc(sets) + '</td></tr>';
+  }
+  document.getElementById('confirmHosts').innerHTML = t;
+  document.getElementById('understood').checked = false;
+  document.getElementById('confirmRound').value = '';
+  show('step3');
+}
+
+async function reboot() {
+  if (!document.getElementById('understood').checked || document.getElementById('confirmRound').value !== String(selected.Round)) {
+    alert('Tick the checkbox and type the round number to confirm');
+    return;
+  }
+  try {
+    await api('/v1/reboot', {method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({Hosts: selected.Hosts.map(h => h.Host), Confirm: true})});
+  } catch (e) {
+    alert(e.message);
+    return;
+  }
+  show('step1');
+  refresh();
+}
+
+document.getElementById('token').value = localStorage.getItem('clusterToolToken') || '';
+refresh();
+setInterval(refresh, 10000);
+</script>
+</body>
+</html>
+`